@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/lukman83/kidkazz-scrap/internal/cache"
+	"github.com/lukman83/kidkazz-scrap/internal/usage"
+	"github.com/spf13/cobra"
+)
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Inspect or clear the response cache",
+}
+
+var cacheStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show cache size, freshness and hit rate",
+	Args:  cobra.NoArgs,
+	RunE:  runCacheStats,
+}
+
+var cachePurgeCmd = &cobra.Command{
+	Use:   "purge",
+	Short: "Delete cached results",
+	Args:  cobra.NoArgs,
+	RunE:  runCachePurge,
+}
+
+func init() {
+	cacheStatsCmd.Flags().String("format", "table", "Output format: json, table")
+	cachePurgeCmd.Flags().Bool("expired", false, "Only delete entries past their stale window")
+	cacheCmd.AddCommand(cacheStatsCmd, cachePurgeCmd)
+	rootCmd.AddCommand(cacheCmd)
+}
+
+func runCacheStats(cmd *cobra.Command, args []string) error {
+	format, _ := cmd.Flags().GetString("format")
+
+	store, err := openCache()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	st, err := store.Stats(cachePolicy())
+	if err != nil {
+		return err
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(st)
+	}
+
+	fmt.Printf("Cache: %s (%s)\n\n", st.Path, usage.FormatBytes(st.FileBytes))
+	fmt.Printf("%-10s %8s %8s %8s %8s %10s\n", "KIND", "ENTRIES", "FRESH", "STALE", "EXPIRED", "SIZE")
+	for _, kind := range cache.Kinds() {
+		ks := st.Kinds[kind]
+		fmt.Printf("%-10s %8d %8d %8d %8d %10s\n", kind, ks.Entries, ks.Fresh, ks.Stale, ks.Expired, usage.FormatBytes(int64(ks.Bytes)))
+	}
+	fmt.Printf("\nHits: %d  Stale hits: %d  Misses: %d  Writes: %d  Hit rate: %.1f%%\n",
+		st.Hits, st.StaleHits, st.Misses, st.Writes, st.HitRate()*100)
+	return nil
+}
+
+func runCachePurge(cmd *cobra.Command, args []string) error {
+	expired, _ := cmd.Flags().GetBool("expired")
+
+	store, err := openCache()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	n, err := store.Purge(cachePolicy(), expired)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Removed %d cached result(s) from %s\n", n, store.Path())
+	return nil
+}
@@ -1,7 +1,6 @@
 package cmd
 
 import (
-	"context"
 	"fmt"
 	"sort"
 	"strings"
@@ -20,11 +19,14 @@ var categoriesCmd = &cobra.Command{
 
 func init() {
 	categoriesCmd.Flags().Int("limit", 60, "Number of products to sample")
+	categoriesCmd.Flags().String("strategy", "", "Run only this strategy: graphql, mobile, static, headless (skips fallbacks)")
 	rootCmd.AddCommand(categoriesCmd)
 }
 
 func runCategories(cmd *cobra.Command, args []string) error {
-	initPlatforms()
+	if err := initPlatforms(); err != nil {
+		return err
+	}
 
 	keyword := args[0]
 	limit, _ := cmd.Flags().GetInt("limit")
@@ -37,7 +39,7 @@ func runCategories(cmd *cobra.Command, args []string) error {
 
 	spin := ui.NewSpinner()
 	spin.Start(fmt.Sprintf("Discovering best-seller categories for '%s'...", keyword))
-	ctx := platform.WithProgress(context.Background(), spin.Update)
+	ctx := withStrategy(platform.WithProgress(cmd.Context(), spin.Update), cmd)
 	products, err := scraper.Trending(ctx, platform.TrendingOpts{
 		Category: keyword,
 		Limit:    limit,
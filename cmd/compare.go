@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/lukman83/kidkazz-scrap/internal/compare"
+	"github.com/lukman83/kidkazz-scrap/internal/platform"
+	"github.com/lukman83/kidkazz-scrap/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+var compareCmd = &cobra.Command{
+	Use:   "compare [query]",
+	Short: "Compare prices of a product across shops",
+	Long: `Search a product and report the spread of its prices: min, quartiles,
+median and max of the effective (discounted) price, official stores vs
+other shops, and the cheapest credible offers. Ads are excluded, and a
+listing found on two pages or platforms counts once.
+
+An offer is credible when it has at least --min-reviews reviews and comes
+from an official store or has a product rating of at least --min-rating.
+Shop reputation is not scraped: the product's rating stands in for it.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runCompare,
+}
+
+func init() {
+	compareCmd.Flags().String("platforms", "", "Comma-separated platforms to search, or all (default: --platform)")
+	compareCmd.Flags().Int("pages", 1, fmt.Sprintf("Result pages searched per platform (at most %d)", compare.MaxPages))
+	compareCmd.Flags().Int("limit", compare.DefaultLimit, fmt.Sprintf("Products per page (at most %d)", compare.MaxLimit))
+	compareCmd.Flags().String("location", "", "Buyer location: city or city/district, e.g. surabaya/gubeng (affects prices, stock and proxy exit)")
+	compareCmd.Flags().Int("min-reviews", compare.DefaultMinReviews, "Reviews a credible offer needs")
+	compareCmd.Flags().Float64("min-rating", compare.DefaultMinRating, "Product rating a credible offer from a non-official shop needs")
+	compareCmd.Flags().Int("top", compare.DefaultTop, fmt.Sprintf("Cheapest credible offers to list (at most %d)", compare.MaxTop))
+	compareCmd.Flags().String("format", "table", "Output format: json, table")
+	rootCmd.AddCommand(compareCmd)
+}
+
+func runCompare(cmd *cobra.Command, args []string) error {
+	if err := initPlatforms(); err != nil {
+		return err
+	}
+
+	query := args[0]
+	platforms, _ := cmd.Flags().GetString("platforms")
+	pages, _ := cmd.Flags().GetInt("pages")
+	limit, _ := cmd.Flags().GetInt("limit")
+	location, _ := cmd.Flags().GetString("location")
+	minReviews, _ := cmd.Flags().GetInt("min-reviews")
+	minRating, _ := cmd.Flags().GetFloat64("min-rating")
+	top, _ := cmd.Flags().GetInt("top")
+	format, _ := cmd.Flags().GetString("format")
+	if platforms == "" {
+		platforms, _ = cmd.Flags().GetString("platform")
+	}
+
+	spin := ui.NewSpinner()
+	spin.Start(fmt.Sprintf("Comparing prices of '%s'...", query))
+	ctx := platform.WithProgress(cmd.Context(), spin.Update)
+	report, err := compare.Compare(ctx, query, compare.Options{
+		Platforms:  compare.ParsePlatforms(platforms),
+		Pages:      pages,
+		Limit:      limit,
+		Location:   location,
+		MinReviews: minReviews,
+		MinRating:  minRating,
+		Top:        top,
+	})
+	spin.Stop()
+	if err != nil {
+		return fmt.Errorf("compare failed: %w", err)
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	printCompareReport(report)
+	return nil
+}
+
+// printCompareReport prints a comparison as a statistics table followed by
+// the cheapest credible offers.
+func printCompareReport(r *compare.Report) {
+	var searched []string
+	for _, p := range r.Platforms {
+		switch {
+		case p.Error != "":
+			searched = append(searched, p.Platform+": failed")
+		case p.StrategyUsed != "":
+			searched = append(searched, fmt.Sprintf("%s: %d products via %s", p.Platform, p.Products, p.StrategyUsed))
+		default:
+			searched = append(searched, fmt.Sprintf("%s: %d products", p.Platform, p.Products))
+		}
+	}
+	fmt.Printf("Prices of '%s' (%s; %d ads and %d repeated listings excluded)\n", r.Query, strings.Join(searched, ", "), r.FilteredAds, r.Duplicates)
+	if r.Location != "" {
+		fmt.Printf("Buyer location: %s\n", r.Location)
+	}
+	for _, w := range r.Warnings {
+		fmt.Fprintf(os.Stderr, "Note: %s\n", w)
+	}
+	fmt.Println()
+	if r.Effective == nil {
+		fmt.Println("No priced offers found.")
+		return
+	}
+
+	fmt.Printf("%-16s %6s %14s %14s %14s %14s %14s\n", "PRICE", "OFFERS", "MIN", "P25", "MEDIAN", "P75", "MAX")
+	for _, row := range []struct {
+		name  string
+		stats *compare.Stats
+	}{
+		{"effective", r.Effective},
+		{"list", r.List},
+		{"official", r.Official},
+		{"non-official", r.NonOfficial},
+	} {
+		if s := row.stats; s != nil {
+			fmt.Printf("%-16s %6d %14s %14s %14s %14s %14s\n", row.name, s.Count,
+				formatPrice(s.Min), formatPrice(s.P25), formatPrice(s.Median), formatPrice(s.P75), formatPrice(s.Max))
+		}
+	}
+	fmt.Printf("\n%d of %d offers discounted; %d credible.\nCredible: %s.\n",
+		r.Discounted, r.Offers, r.Credible, r.CredibleBar)
+
+	if len(r.Cheapest) == 0 {
+		return
+	}
+	fmt.Println("\nCheapest credible offers:")
+	for i, o := range r.Cheapest {
+		fmt.Printf(" %d. %s\n", i+1, o.Name)
+		line := "    " + formatPrice(o.EffectivePrice)
+		if o.ListPrice > o.EffectivePrice {
+			line += "  (was " + formatPrice(o.ListPrice)
+			if pct := compare.DiscountPercent(o.ListPrice, o.EffectivePrice); pct > 0 {
+				line += fmt.Sprintf(", -%d%%", pct)
+			}
+			line += ")"
+		}
+		line += "  |  Shop: " + o.Shop
+		if o.City != "" {
+			line += fmt.Sprintf(" (%s)", o.City)
+		}
+		if o.Official {
+			line += " [Official]"
+		}
+		line += fmt.Sprintf("  |  %.1f, %d reviews", o.Rating, o.Reviews)
+		if len(r.Platforms) > 1 {
+			line += "  |  " + o.Platform
+		}
+		fmt.Println(line)
+		fmt.Printf("    %s\n", cleanURL(o.URL))
+	}
+}
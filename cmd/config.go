@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/lukman83/kidkazz-scrap/config"
+	"github.com/lukman83/kidkazz-scrap/internal/stealth"
+	"github.com/lukman83/kidkazz-scrap/internal/tokopedia"
+	"github.com/lukman83/kidkazz-scrap/internal/usage"
+	"github.com/spf13/cobra"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect or check the configuration",
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the effective config with the source of each value",
+	Long: "Print the effective configuration after merging defaults, the config file, .env, " +
+		"environment variables, the selected profile and flags. Secrets are redacted.",
+	Args: cobra.NoArgs,
+	RunE: runConfigShow,
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the config file, every profile and the effective config",
+	Args:  cobra.NoArgs,
+	// Report config errors instead of failing before the command runs.
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error { return nil },
+	SilenceUsage:      true,
+	RunE:              runConfigValidate,
+}
+
+func init() {
+	configShowCmd.Flags().String("format", "table", "Output format: json, table")
+	configCmd.AddCommand(configShowCmd, configValidateCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+// configEntry is one line of "config show".
+type configEntry struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+func runConfigShow(cmd *cobra.Command, args []string) error {
+	format, _ := cmd.Flags().GetString("format")
+
+	entries := make([]configEntry, 0, len(config.AllSettings()))
+	for _, s := range config.AllSettings() {
+		entries = append(entries, configEntry{Key: s.Key, Value: s.Value(cfg), Source: cfg.Source(s.Key)})
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(map[string]any{
+			"file":     cfg.File,
+			"profile":  cfg.Profile,
+			"settings": entries,
+		})
+	}
+
+	file, profile := cfg.File, cfg.Profile
+	if file == "" {
+		file = "(none)"
+	}
+	if profile == "" {
+		profile = "(none)"
+	}
+	fmt.Printf("Config file: %s\nProfile:     %s\n\n", file, profile)
+	fmt.Printf("%-20s %-36s %s\n", "KEY", "VALUE", "SOURCE")
+	for _, e := range entries {
+		fmt.Printf("%-20s %-36s %s\n", e.Key, e.Value, e.Source)
+	}
+	return nil
+}
+
+func runConfigValidate(cmd *cobra.Command, args []string) error {
+	if cfgErr != nil {
+		return cfgErr
+	}
+
+	failed := false
+	report := func(name string, err error) {
+		if err == nil {
+			fmt.Printf("ok    %s\n", name)
+			return
+		}
+		failed = true
+		fmt.Printf("FAIL  %s\n", name)
+		for _, e := range unjoin(err) {
+			fmt.Printf("        %v\n", e)
+		}
+	}
+
+	// Each profile on its own, as the file defines it.
+	if cfg.File != "" {
+		f, err := config.ReadFile(cfg.File)
+		if err != nil {
+			return err
+		}
+		for _, name := range f.ProfileNames() {
+			c := config.DefaultConfig()
+			if err := errors.Join(c.LoadFile(f, cfg.File), c.UseProfile(f, name)); err != nil {
+				report("profile "+name, err)
+				continue
+			}
+			report("profile "+name, validateConfig(c))
+		}
+	}
+
+	report("effective config", validateConfig(cfg))
+	if failed {
+		return fmt.Errorf("invalid configuration")
+	}
+	return nil
+}
+
+// validateConfig checks c, including that its strategy and warm-up step
+// names exist and its fingerprints and cookie jar files load.
+func validateConfig(c *config.Config) error {
+	errs := []error{c.Validate()}
+	if c.FingerprintsFile != "" {
+		if _, err := stealth.LoadFingerprintPool(c.FingerprintsFile); err != nil {
+			errs = append(errs, fmt.Errorf("fingerprints_file: %w", err))
+		}
+	}
+	if c.CookieJar != "" {
+		if _, err := stealth.OpenCookieJars(c.CookieJar, c.CookieKey, c.CookieKeyFile); err != nil {
+			errs = append(errs, fmt.Errorf("cookie_jar: %w", err))
+		}
+	}
+	if c.BudgetJob != "" {
+		if _, err := usage.ParseBytes(c.BudgetJob); err != nil {
+			errs = append(errs, fmt.Errorf("budget_job: %w", err))
+		}
+	}
+	if c.BudgetDaily != "" {
+		if _, err := usage.ParseBytes(c.BudgetDaily); err != nil {
+			errs = append(errs, fmt.Errorf("budget_daily: %w", err))
+		}
+	}
+	for _, step := range c.Warmup {
+		if !slices.Contains(tokopedia.WarmupSteps(), step) {
+			errs = append(errs, fmt.Errorf("warmup: unknown step %q", step))
+		}
+	}
+	known := tokopedia.StrategyNames()
+	for _, name := range append(slices.Clone(c.FastStrategies), c.SlowStrategies...) {
+		if !slices.Contains(known, name) {
+			errs = append(errs, fmt.Errorf("strategies: unknown strategy %q", name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// unjoin flattens (nested) errors.Join results back into their parts.
+func unjoin(err error) []error {
+	j, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return []error{err}
+	}
+	var out []error
+	for _, e := range j.Unwrap() {
+		out = append(out, unjoin(e)...)
+	}
+	return out
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/lukman83/kidkazz-scrap/internal/testserver"
+	"github.com/spf13/cobra"
+)
+
+var mockserverCmd = &cobra.Command{
+	Use:   "mockserver",
+	Short: "Run a local mock of the Tokopedia endpoints",
+	Long: "Serve a local emulation of Tokopedia's search GraphQL endpoint, search and product pages, " +
+		"and robots.txt, with optional latency and 429/5xx/captcha injection. Point the scraper at it with " +
+		"KIDKAZZ_TOKOPEDIA_BASE_URL and KIDKAZZ_TOKOPEDIA_GQL_URL.\n\n" +
+		"With --tls it serves HTTPS (HTTP/2 and HTTP/1.1) with a self-signed certificate and logs the " +
+		"TLS ClientHello (JA3) and HTTP/2 (Akamai) fingerprint of every connection, to check --tls-impersonate.",
+	RunE: runMockserver,
+}
+
+func init() {
+	mockserverCmd.Flags().String("addr", "127.0.0.1:9090", "Listen address")
+	mockserverCmd.Flags().String("fixtures", "", "JSON file of fixture products (default: synthetic catalogue)")
+	mockserverCmd.Flags().String("robots", "", "File served as robots.txt (default: allow all)")
+	mockserverCmd.Flags().Duration("latency", 0, "Latency added to every response")
+	mockserverCmd.Flags().Duration("jitter", 0, "Random extra latency up to this value")
+	mockserverCmd.Flags().Float64("rate-429", 0, "Fraction of requests answered with 429")
+	mockserverCmd.Flags().Duration("retry-after", 0, "Retry-After sent with injected 429s")
+	mockserverCmd.Flags().Float64("rate-5xx", 0, "Fraction of requests answered with 500")
+	mockserverCmd.Flags().Float64("rate-captcha", 0, "Fraction of requests answered with a captcha page")
+	mockserverCmd.Flags().String("empty-keyword", "no-results", "Searches containing this keyword return no results")
+	mockserverCmd.Flags().Uint64("seed", 1, "Seed for synthetic data and fault injection")
+	mockserverCmd.Flags().Bool("tls", false, "Serve HTTPS and log each connection's TLS and HTTP/2 fingerprint")
+	mockserverCmd.Flags().String("tls-cert", filepath.Join(os.TempDir(), "kidkazz-mockserver.pem"), "Where --tls writes its certificate (PEM)")
+	rootCmd.AddCommand(mockserverCmd)
+}
+
+func runMockserver(cmd *cobra.Command, args []string) error {
+	addr, _ := cmd.Flags().GetString("addr")
+	mcfg := testserver.Config{}
+	mcfg.FixturesFile, _ = cmd.Flags().GetString("fixtures")
+	mcfg.Latency, _ = cmd.Flags().GetDuration("latency")
+	mcfg.Jitter, _ = cmd.Flags().GetDuration("jitter")
+	mcfg.RateLimitRate, _ = cmd.Flags().GetFloat64("rate-429")
+	mcfg.RetryAfter, _ = cmd.Flags().GetDuration("retry-after")
+	mcfg.ErrorRate, _ = cmd.Flags().GetFloat64("rate-5xx")
+	mcfg.CaptchaRate, _ = cmd.Flags().GetFloat64("rate-captcha")
+	mcfg.EmptyKeyword, _ = cmd.Flags().GetString("empty-keyword")
+	mcfg.Seed, _ = cmd.Flags().GetUint64("seed")
+	if path, _ := cmd.Flags().GetString("robots"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read robots file: %w", err)
+		}
+		mcfg.RobotsTxt = string(data)
+	}
+
+	srv, err := testserver.New(mcfg)
+	if err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	if useTLS, _ := cmd.Flags().GetBool("tls"); useTLS {
+		return serveMockTLS(cmd, ln, srv)
+	}
+
+	base := "http://" + ln.Addr().String()
+	fmt.Fprintf(cmd.ErrOrStderr(), "Mock Tokopedia listening on %s\n", base)
+	fmt.Fprintf(cmd.ErrOrStderr(), "  export KIDKAZZ_TOKOPEDIA_BASE_URL=%s\n", base)
+	fmt.Fprintf(cmd.ErrOrStderr(), "  export KIDKAZZ_TOKOPEDIA_GQL_URL=%s\n", testserver.GraphQLURL(base))
+
+	return http.Serve(ln, srv)
+}
+
+// serveMockTLS serves srv over HTTPS, logging every connection's fingerprint.
+func serveMockTLS(cmd *cobra.Command, ln net.Listener, srv http.Handler) error {
+	cert, certPEM, err := testserver.NewCertificate()
+	if err != nil {
+		return fmt.Errorf("certificate: %w", err)
+	}
+	certPath, _ := cmd.Flags().GetString("tls-cert")
+	if err := os.WriteFile(certPath, certPEM, 0o644); err != nil {
+		return fmt.Errorf("write certificate: %w", err)
+	}
+
+	base := "https://" + ln.Addr().String()
+	w := cmd.ErrOrStderr()
+	fmt.Fprintf(w, "Mock Tokopedia listening on %s\n", base)
+	fmt.Fprintf(w, "  export SSL_CERT_FILE=%s\n", certPath)
+	fmt.Fprintf(w, "  export KIDKAZZ_TOKOPEDIA_BASE_URL=%s\n", base)
+	fmt.Fprintf(w, "  export KIDKAZZ_TOKOPEDIA_GQL_URL=%s\n", testserver.GraphQLURL(base))
+
+	var mu sync.Mutex
+	return testserver.ServeTLS(ln, cert, srv, func(h testserver.ClientHello) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(w, "tls hello from %s: alpn=%s protocol=%s ja3=%s ja3n=%s\n", h.Remote,
+			strings.Join(h.ALPN, ","), h.Protocol, h.JA3Hash, h.JA3NHash)
+		fmt.Fprintf(w, "  ja3: %s\n", h.JA3)
+		if h.H2 != "" {
+			fmt.Fprintf(w, "  h2:  %s\n", h.H2)
+		}
+	})
+}
@@ -1,102 +1,306 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/lukman83/kidkazz-scrap/config"
+	"github.com/lukman83/kidkazz-scrap/internal/cache"
+	"github.com/lukman83/kidkazz-scrap/internal/cassette"
+	"github.com/lukman83/kidkazz-scrap/internal/logging"
 	"github.com/lukman83/kidkazz-scrap/internal/platform"
 	"github.com/lukman83/kidkazz-scrap/internal/stealth"
 	"github.com/lukman83/kidkazz-scrap/internal/tokopedia"
+	"github.com/lukman83/kidkazz-scrap/internal/tracing"
+	"github.com/lukman83/kidkazz-scrap/internal/usage"
 	"github.com/spf13/cobra"
-	"golang.org/x/time/rate"
 )
 
 var cfg *config.Config
 
+// cfgErr is a config file or profile error from initConfig. It fails every
+// command except "config", which reports it.
+var cfgErr error
+
 var rootCmd = &cobra.Command{
 	Use:   "kidkazz",
 	Short: "KidKazz Scrap - Marketplace scraping CLI & MCP server",
 	Long:  "A Go-based CLI tool and MCP server for scraping Indonesian marketplace data.",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if cfgErr != nil {
+			cmd.SilenceUsage = true
+			return cfgErr
+		}
+		job := cfg.Job
+		if job == "" {
+			job = cmd.Name()
+		}
+		cmd.SetContext(usage.WithJob(cmd.Context(), job))
+		return nil
+	},
 }
 
+// Execute runs the CLI. The invocation gets one request ID, carried by
+// cmd.Context() into the scrapers and their logs.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	ctx := logging.WithRequestID(context.Background(), logging.NewRequestID())
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
 
 func init() {
-	cobra.OnInitialize(initConfig)
+	cobra.OnInitialize(initConfig, initLogging, initTracing)
+	cobra.OnFinalize(closeCache, saveCookies, flushUsage, closeRobotsLog, shutdownTracing)
 
-	rootCmd.PersistentFlags().String("platform", "tokopedia", "Target marketplace platform")
-	rootCmd.PersistentFlags().String("delay-profile", "normal", "Delay profile: cautious, normal, aggressive")
-	rootCmd.PersistentFlags().Bool("respect-robots", true, "Respect robots.txt rules")
-	rootCmd.PersistentFlags().String("proxy-mode", "direct", "Proxy mode: decodo, wireguard, custom, direct")
-	rootCmd.PersistentFlags().String("wireguard-config", "", "Path to WireGuard config file")
-	rootCmd.PersistentFlags().String("proxy-file", "", "Path to proxy list file")
+	rootCmd.PersistentFlags().String("config", "", "Config file (default ./kidkazz.yaml, then <user config dir>/kidkazz/kidkazz.yaml)")
+	rootCmd.PersistentFlags().String("profile", "", "Named profile from the config file")
+	rootCmd.PersistentFlags().String("record", "", "Record HTTP interactions to this cassette directory")
+	rootCmd.PersistentFlags().String("replay", "", "Replay HTTP interactions from this cassette directory (offline)")
+	rootCmd.PersistentFlags().Bool("refresh", false, "Ignore cached results but store the fresh ones")
+	config.RegisterFlags(rootCmd.PersistentFlags())
 }
 
+// initConfig layers the configuration: defaults, config file, .env,
+// environment variables, profile, then explicitly set flags. A selected
+// profile beats the environment; a flag beats both.
 func initConfig() {
 	cfg = config.DefaultConfig()
-	cfg.LoadFromEnv()
+	f, profile, err := loadConfigFile(cfg)
+	errs := []error{err, cfg.LoadFromEnv()}
+	if f != nil {
+		errs = append(errs, cfg.UseProfile(f, profile))
+	}
+	errs = append(errs, cfg.LoadFlags(rootCmd.PersistentFlags()))
+	cfgErr = errors.Join(errs...)
 
-	// Override from flags only if explicitly set by user
-	if rootCmd.PersistentFlags().Changed("platform") {
-		cfg.DefaultPlatform, _ = rootCmd.PersistentFlags().GetString("platform")
+	cfg.RecordDir, _ = rootCmd.PersistentFlags().GetString("record")
+	cfg.ReplayDir, _ = rootCmd.PersistentFlags().GetString("replay")
+	cfg.CacheRefresh, _ = rootCmd.PersistentFlags().GetBool("refresh")
+}
+
+// loadConfigFile applies the top level of the config file selected by
+// --config and $KIDKAZZ_CONFIG, if any. It returns the file and the profile
+// requested by --profile or $KIDKAZZ_PROFILE, for initConfig to apply.
+func loadConfigFile(c *config.Config) (*config.File, string, error) {
+	config.LoadDotEnv() // so .env can select the file and profile
+	explicit, _ := rootCmd.PersistentFlags().GetString("config")
+	profile, _ := rootCmd.PersistentFlags().GetString("profile")
+	if profile == "" {
+		profile = os.Getenv("KIDKAZZ_PROFILE")
 	}
-	if rootCmd.PersistentFlags().Changed("delay-profile") {
-		cfg.DelayProfile, _ = rootCmd.PersistentFlags().GetString("delay-profile")
+
+	path, err := config.FindFile(explicit)
+	if err != nil {
+		return nil, "", err
 	}
-	if rootCmd.PersistentFlags().Changed("respect-robots") {
-		cfg.RespectRobots, _ = rootCmd.PersistentFlags().GetBool("respect-robots")
+	if path == "" {
+		if profile != "" {
+			return nil, "", fmt.Errorf("profile %q requested but no config file found", profile)
+		}
+		return nil, "", nil
 	}
-	if rootCmd.PersistentFlags().Changed("proxy-mode") {
-		cfg.ProxyMode, _ = rootCmd.PersistentFlags().GetString("proxy-mode")
+	f, err := config.ReadFile(path)
+	if err != nil {
+		return nil, "", err
 	}
-	if v, _ := rootCmd.PersistentFlags().GetString("wireguard-config"); v != "" {
-		cfg.WireGuardConfig = v
+	if err := c.LoadFile(f, path); err != nil {
+		return nil, "", err
 	}
-	if v, _ := rootCmd.PersistentFlags().GetString("proxy-file"); v != "" {
-		cfg.ProxyFile = v
+	return f, profile, nil
+}
+
+// initLogging installs the slog logger. Logs always go to stderr: stdout
+// carries command output and the MCP stdio protocol.
+func initLogging() {
+	if err := logging.Setup(os.Stderr, cfg.LogLevel, cfg.LogFormat); err != nil {
+		logging.Setup(os.Stderr, "info", logging.FormatText)
+		slog.Warn("falling back to defaults", "err", err)
 	}
 }
 
-// buildHTTPClient creates the stealth-wrapped HTTP client from config.
-func buildHTTPClient() *http.Client {
-	fpPool := stealth.NewFingerprintPool()
-	delay := stealth.NewHumanDelay(stealth.DelayProfile(cfg.DelayProfile))
-	limiter := rate.NewLimiter(rate.Limit(cfg.RatePerSecond), cfg.RateBurst)
+// shutdownTracer flushes spans on exit; set by initTracing.
+var shutdownTracer func(context.Context) error
 
-	baseTransport := &http.Transport{
-		MaxIdleConns:        100,
-		MaxIdleConnsPerHost: 10,
+// initTracing installs the configured span exporter. A broken exporter
+// config only disables tracing, it never blocks a scrape.
+func initTracing() {
+	shutdown, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    cfg.TraceExporter,
+		Endpoint:    cfg.TraceEndpoint,
+		File:        cfg.TraceFile,
+		ServiceName: "kidkazz-scrap",
+		Version:     "1.0.0",
+	})
+	if err != nil {
+		slog.Warn("tracing disabled", "err", err)
+		return
 	}
+	shutdownTracer = shutdown
+}
+
+// shutdownTracing flushes buffered spans to the exporter.
+func shutdownTracing() {
+	if shutdownTracer == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTracer(ctx); err != nil {
+		slog.Warn("flush traces failed", "err", err)
+	}
+	shutdownTracer = nil
+}
 
-	var proxyRotator *stealth.ProxyRotator
+// loadFingerprints returns the configured browser profiles, or the built-in
+// set when no fingerprints file is configured.
+func loadFingerprints() (*stealth.FingerprintPool, error) {
+	if cfg.FingerprintsFile == "" {
+		return stealth.NewFingerprintPool()
+	}
+	return stealth.LoadFingerprintPool(cfg.FingerprintsFile)
+}
+
+// cookieJars is the open cookie jar, saved by saveCookies when the command finishes.
+var cookieJars *stealth.CookieJars
+
+// openCookieJars opens the configured cookie jar file, or in-memory jars
+// when none is configured.
+func openCookieJars() (*stealth.CookieJars, error) {
+	if cfg.CookieJar == "" {
+		return stealth.NewCookieJars(), nil
+	}
+	return stealth.OpenCookieJars(cfg.CookieJar, cfg.CookieKey, cfg.CookieKeyFile)
+}
+
+// saveCookies writes the cookie jar back to disk.
+func saveCookies() {
+	if cookieJars == nil {
+		return
+	}
+	if err := cookieJars.Save(); err != nil {
+		slog.Warn("save cookie jar failed", "path", cfg.CookieJar, "err", err)
+	}
+	cookieJars = nil
+}
+
+// usageMeter meters scrape traffic; flushUsage appends what is left to the
+// usage log when the command finishes.
+var usageMeter *usage.Meter
+
+// usagePath returns the configured usage log, or the default one.
+func usagePath() (string, error) {
+	if cfg.UsageLog != "" {
+		return cfg.UsageLog, nil
+	}
+	path, err := usage.DefaultPath()
+	if err != nil {
+		return "", fmt.Errorf("locate usage log: %w", err)
+	}
+	return path, nil
+}
+
+// openUsageMeter opens the usage log with the configured budgets.
+func openUsageMeter() (*usage.Meter, error) {
+	var budget usage.Budget
+	var err error
+	if cfg.BudgetJob != "" {
+		if budget.JobBytes, err = usage.ParseBytes(cfg.BudgetJob); err != nil {
+			return nil, fmt.Errorf("budget_job: %w", err)
+		}
+	}
+	if cfg.BudgetDaily != "" {
+		if budget.DailyBytes, err = usage.ParseBytes(cfg.BudgetDaily); err != nil {
+			return nil, fmt.Errorf("budget_daily: %w", err)
+		}
+	}
+	path, err := usagePath()
+	if err != nil {
+		return nil, err
+	}
+	return usage.OpenMeter(path, budget)
+}
+
+// flushUsage appends pending traffic to the usage log.
+func flushUsage() {
+	if usageMeter == nil {
+		return
+	}
+	if err := usageMeter.Flush(); err != nil {
+		slog.Warn("write usage log failed", "err", err)
+	}
+	usageMeter = nil
+}
+
+// robotsLogFile is the open --robots-log file, closed by closeRobotsLog when
+// the command finishes.
+var robotsLogFile *os.File
+
+// closeRobotsLog closes the robots.txt decision log.
+func closeRobotsLog() {
+	if robotsLogFile == nil {
+		return
+	}
+	if err := robotsLogFile.Close(); err != nil {
+		slog.Warn("close robots log failed", "path", cfg.RobotsLog, "err", err)
+	}
+	robotsLogFile = nil
+}
+
+// buildProxies returns the configured proxy providers, or nil for direct
+// connections. The HTTP client and the headless browser share them.
+func buildProxies() *stealth.ProxyRotator {
 	switch cfg.ProxyMode {
 	case "direct":
 		// No proxy
 	case "decodo":
-		if cfg.DecodoUsername != "" && cfg.DecodoPassword != "" {
-			proxyRotator = stealth.NewProxyRotator([]stealth.ProxyProvider{
-				&stealth.DecodoProvider{
-					Username: cfg.DecodoUsername,
-					Password: cfg.DecodoPassword,
-					Country:  cfg.DecodoCountry,
-					City:     cfg.DecodoCity,
-				},
-			})
-		} else {
-			log.Println("warning: proxy-mode=decodo but DECODO_USERNAME/DECODO_PASSWORD not set, falling back to direct")
+		if cfg.DecodoUsername == "" || cfg.DecodoPassword == "" {
+			slog.Warn("proxy-mode=decodo but DECODO_USERNAME/DECODO_PASSWORD not set, falling back to direct")
+			return nil
 		}
+		return stealth.NewProxyRotator([]stealth.ProxyProvider{
+			&stealth.DecodoProvider{
+				Username: cfg.DecodoUsername,
+				Password: cfg.DecodoPassword,
+				Country:  cfg.DecodoCountry,
+				City:     cfg.DecodoCity,
+			},
+		})
 	case "wireguard", "custom":
-		log.Printf("warning: proxy-mode=%s is not yet implemented, falling back to direct", cfg.ProxyMode)
+		slog.Warn("proxy mode not yet implemented, falling back to direct", "proxy_mode", cfg.ProxyMode)
 	default:
-		log.Printf("warning: unknown proxy-mode %q, falling back to direct", cfg.ProxyMode)
+		slog.Warn("unknown proxy mode, falling back to direct", "proxy_mode", cfg.ProxyMode)
+	}
+	return nil
+}
+
+// buildHTTPClient creates the stealth-wrapped HTTP client from config.
+// With --replay the stealth pipeline is replaced by a cassette; with --record
+// the pipeline records what it sends, fingerprint and cookies included.
+func buildHTTPClient(fpPool *stealth.FingerprintPool, cookies *stealth.CookieJars, meter *usage.Meter, proxyRotator *stealth.ProxyRotator) (*http.Client, error) {
+	if cfg.RecordDir != "" && cfg.ReplayDir != "" {
+		return nil, fmt.Errorf("--record and --replay are mutually exclusive")
+	}
+	if cfg.ReplayDir != "" {
+		replayer, err := cassette.NewReplayer(cfg.ReplayDir)
+		if err != nil {
+			return nil, err
+		}
+		return &http.Client{Transport: replayer}, nil
+	}
+
+	delay := stealth.NewHumanDelay(stealth.DelayProfile(cfg.DelayProfile))
+	limiter := stealth.NewAdaptiveLimiter(cfg.RatePerSecond, cfg.RateBurst)
+
+	baseTransport := &http.Transport{
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 10,
 	}
 
 	robotsClient := &http.Client{}
@@ -109,15 +313,156 @@ func buildHTTPClient() *http.Client {
 		Proxy:       proxyRotator,
 		Delay:       delay,
 		RateLimiter: limiter,
+		Cookies:     cookies,
+		Usage:       meter,
+	}
+	if cfg.TLSImpersonate {
+		transport.Impersonate = stealth.NewTLSImpersonator()
+	}
+
+	if cfg.RobotsLog != "" {
+		f, err := os.OpenFile(cfg.RobotsLog, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			slog.Warn("cannot open robots log", "path", cfg.RobotsLog, "err", err)
+		} else {
+			robotsLogFile = f
+			transport.RobotsLog = stealth.NewRobotsAuditLog(f)
+		}
+	}
+
+	if cfg.RecordDir != "" {
+		recorder, err := cassette.NewRecorder(cfg.RecordDir, nil,
+			cassette.NewRedactor(cfg.DecodoUsername, cfg.DecodoPassword, cfg.APIKey))
+		if err != nil {
+			return nil, err
+		}
+		transport.Recorder = recorder
 	}
 
-	return &http.Client{Transport: transport}
+	return &http.Client{Transport: transport}, nil
 }
 
 // initPlatforms registers all available platform scrapers.
-func initPlatforms() {
-	client := buildHTTPClient()
-	limiter := rate.NewLimiter(rate.Limit(cfg.RatePerSecond), cfg.RateBurst)
-	tokScraper := tokopedia.NewScraper(client, limiter, cfg.MaxConcurrent)
-	platform.Register("tokopedia", tokScraper)
+func initPlatforms() error {
+	fpPool, err := loadFingerprints()
+	if err != nil {
+		return err
+	}
+	cookieJars, err = openCookieJars()
+	if err != nil {
+		return err
+	}
+	usageMeter, err = openUsageMeter()
+	if err != nil {
+		return err
+	}
+	proxies := buildProxies()
+	client, err := buildHTTPClient(fpPool, cookieJars, usageMeter, proxies)
+	if err != nil {
+		return err
+	}
+	// The headless browser shares the pipeline's robots.txt check and rate
+	// limits; a replayed cassette has no pipeline.
+	transport, _ := client.Transport.(*stealth.StealthTransport)
+	tokScraper, err := tokopedia.NewScraper(client, tokopedia.Options{
+		MaxConcurrent: cfg.MaxConcurrent,
+		Breaker: platform.BreakerConfig{
+			FailureThreshold: cfg.BreakerThreshold,
+			CoolDown:         cfg.BreakerCooldown,
+		},
+		FastStrategies:  cfg.FastStrategies,
+		SlowStrategies:  cfg.SlowStrategies,
+		RaceTimeout:     cfg.RaceTimeout,
+		FallbackTimeout: cfg.FallbackTimeout,
+		BaseURL:         cfg.TokopediaBaseURL,
+		GraphQLEndpoint: cfg.TokopediaGraphQLURL,
+		Fingerprints:    fpPool,
+		Cookies:         cookieJars,
+		Proxy:           proxies,
+		Warmup:          cfg.Warmup,
+		Usage:           usageMeter,
+		Transport:       transport,
+		Replay:          cfg.ReplayDir != "",
+	})
+	if err != nil {
+		return fmt.Errorf("tokopedia: %w", err)
+	}
+	platform.Register("tokopedia", withCache("tokopedia", tokScraper))
+	return nil
+}
+
+// Open cache state, released by closeCache when the command finishes.
+var (
+	cacheStore    *cache.Store
+	cacheScrapers []*cache.Scraper
+)
+
+// cachePolicy returns the cache TTLs from config.
+func cachePolicy() cache.Policy {
+	return cache.Policy{
+		TTL: map[cache.Kind]time.Duration{
+			cache.KindSearch:   cfg.CacheTTLSearch,
+			cache.KindTrending: cfg.CacheTTLTrending,
+			cache.KindProduct:  cfg.CacheTTLProduct,
+		},
+		Stale: cfg.CacheStale,
+	}
+}
+
+// openCache opens the configured cache file.
+func openCache() (*cache.Store, error) {
+	path := cfg.CachePath
+	if path == "" {
+		var err error
+		if path, err = cache.DefaultPath(); err != nil {
+			return nil, fmt.Errorf("locate cache dir: %w", err)
+		}
+	}
+	return cache.Open(path)
+}
+
+// withCache puts the response cache in front of s unless caching is disabled,
+// replaying a cassette, or the cache file is unavailable.
+func withCache(name string, s platform.Scraper) platform.Scraper {
+	if !cfg.CacheEnabled || cfg.ReplayDir != "" {
+		return s
+	}
+	if cacheStore == nil {
+		store, err := openCache()
+		if err != nil {
+			slog.Warn("response cache disabled", "err", err)
+			cfg.CacheEnabled = false
+			return s
+		}
+		cacheStore = store
+	}
+	cs := cache.NewScraper(name, s, cacheStore, cachePolicy(), cfg.CacheRefresh)
+	cacheScrapers = append(cacheScrapers, cs)
+	return cs
+}
+
+// cacheCloseGrace is how long closeCache lets background refreshes finish
+// before cancelling them.
+const cacheCloseGrace = 5 * time.Second
+
+// closeCache stops background refreshes and closes the cache file.
+func closeCache() {
+	ctx, cancel := context.WithTimeout(context.Background(), cacheCloseGrace)
+	defer cancel()
+	for _, cs := range cacheScrapers {
+		cs.Close(ctx)
+	}
+	cacheScrapers = nil
+	if cacheStore != nil {
+		cacheStore.Close()
+		cacheStore = nil
+	}
+}
+
+// withStrategy applies the command's --strategy flag (if set) to ctx.
+func withStrategy(ctx context.Context, cmd *cobra.Command) context.Context {
+	if name, _ := cmd.Flags().GetString("strategy"); name != "" {
+		return platform.WithStrategy(ctx, name)
+	}
+	return ctx
 }
@@ -1,11 +1,11 @@
 package cmd
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 
+	"github.com/lukman83/kidkazz-scrap/internal/models"
 	"github.com/lukman83/kidkazz-scrap/internal/platform"
 	"github.com/lukman83/kidkazz-scrap/internal/ui"
 	"github.com/spf13/cobra"
@@ -23,17 +23,22 @@ func init() {
 	searchCmd.Flags().Int("limit", 20, "Products per page")
 	searchCmd.Flags().String("format", "json", "Output format: json, table")
 	searchCmd.Flags().Bool("no-ads", false, "Exclude ad/promoted products")
+	searchCmd.Flags().String("location", "", "Buyer location: city or city/district, e.g. surabaya/gubeng (affects prices, stock and proxy exit)")
+	searchCmd.Flags().String("strategy", "", "Run only this strategy: graphql, mobile, static, headless (skips fallbacks)")
 	rootCmd.AddCommand(searchCmd)
 }
 
 func runSearch(cmd *cobra.Command, args []string) error {
-	initPlatforms()
+	if err := initPlatforms(); err != nil {
+		return err
+	}
 
 	keyword := args[0]
 	page, _ := cmd.Flags().GetInt("page")
 	limit, _ := cmd.Flags().GetInt("limit")
 	format, _ := cmd.Flags().GetString("format")
 	noAds, _ := cmd.Flags().GetBool("no-ads")
+	location, _ := cmd.Flags().GetString("location")
 	platformName, _ := cmd.Flags().GetString("platform")
 
 	scraper, err := platform.Get(platformName)
@@ -43,10 +48,11 @@ func runSearch(cmd *cobra.Command, args []string) error {
 
 	spin := ui.NewSpinner()
 	spin.Start(fmt.Sprintf("Searching '%s' on %s...", keyword, platformName))
-	ctx := platform.WithProgress(context.Background(), spin.Update)
+	ctx := withStrategy(platform.WithProgress(cmd.Context(), spin.Update), cmd)
 	products, err := scraper.Search(ctx, keyword, platform.SearchOpts{
-		Page:  page,
-		Limit: limit,
+		Page:     page,
+		Limit:    limit,
+		Location: location,
 	})
 	spin.Stop()
 	if err != nil {
@@ -55,7 +61,7 @@ func runSearch(cmd *cobra.Command, args []string) error {
 
 	if noAds {
 		before := len(products)
-		products = filterAds(products)
+		products = models.FilterAds(products)
 		if len(products) < before {
 			fmt.Fprintf(os.Stderr, "Note: %d ad(s) filtered, showing %d of %d results\n", before-len(products), len(products), before)
 		}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/lukman83/kidkazz-scrap/internal/drift"
+	"github.com/lukman83/kidkazz-scrap/internal/platform"
+	"github.com/lukman83/kidkazz-scrap/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+var selfcheckCmd = &cobra.Command{
+	Use:   "selfcheck",
+	Short: "Probe each strategy and check its payloads for schema drift",
+	Long: "Run a probe search through each strategy and compare the raw payloads against the expected " +
+		"schema. Reports unknown, missing and type-changed fields plus per-field fill-rates, and exits " +
+		"non-zero when any strategy shows drift or fails.",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runSelfcheck,
+}
+
+func init() {
+	selfcheckCmd.Flags().String("keyword", "mainan anak", "Probe search keyword")
+	selfcheckCmd.Flags().StringSlice("strategies", nil, "Strategies to check (default: all)")
+	selfcheckCmd.Flags().String("format", "table", "Output format: json, table")
+	selfcheckCmd.Flags().BoolP("verbose", "v", false, "Also list unknown (new) fields")
+	rootCmd.AddCommand(selfcheckCmd)
+}
+
+func runSelfcheck(cmd *cobra.Command, args []string) error {
+	if err := initPlatforms(); err != nil {
+		return err
+	}
+
+	keyword, _ := cmd.Flags().GetString("keyword")
+	strategies, _ := cmd.Flags().GetStringSlice("strategies")
+	format, _ := cmd.Flags().GetString("format")
+	verbose, _ := cmd.Flags().GetBool("verbose")
+	platformName, _ := cmd.Flags().GetString("platform")
+
+	scraper, err := platform.Get(platformName)
+	if err != nil {
+		return err
+	}
+	checker, ok := platform.Underlying(scraper).(drift.SelfChecker)
+	if !ok {
+		return fmt.Errorf("platform %s does not support selfcheck", platformName)
+	}
+
+	spin := ui.NewSpinner()
+	spin.Start(fmt.Sprintf("Self-checking %s...", platformName))
+	reports, err := checker.SelfCheck(platform.WithProgress(cmd.Context(), spin.Update), keyword, strategies)
+	spin.Stop()
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(reports)
+	default:
+		printSelfcheck(reports, verbose)
+	}
+
+	var failed []string
+	for _, r := range reports {
+		if !r.OK() {
+			failed = append(failed, r.Source)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("selfcheck failed for: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func printSelfcheck(reports []drift.Report, verbose bool) {
+	for _, r := range reports {
+		status := "OK"
+		if !r.OK() {
+			status = "DRIFT"
+		}
+		if r.Products == 0 && r.Error != "" {
+			status = "FAILED"
+		}
+		fmt.Printf("%-9s %-7s schema=%s products=%d\n", r.Source, status, r.Schema, r.Products)
+
+		for _, w := range r.Warnings() {
+			fmt.Printf("    ! %s\n", w)
+		}
+		if verbose {
+			for _, f := range r.Findings {
+				if f.Kind == drift.FindingUnknown {
+					fmt.Printf("    + %s\n", f)
+				}
+			}
+		}
+		if len(r.FillRates) > 0 {
+			parts := make([]string, len(r.FillRates))
+			for i, fr := range r.FillRates {
+				parts[i] = fmt.Sprintf("%s %.0f%%", fr.Field, fr.Rate*100)
+			}
+			fmt.Printf("    fill: %s\n", strings.Join(parts, ", "))
+		}
+	}
+}
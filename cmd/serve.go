@@ -1,7 +1,7 @@
 package cmd
 
 import (
-	"fmt"
+	"log/slog"
 
 	mcpserver "github.com/lukman83/kidkazz-scrap/mcp"
 	"github.com/spf13/cobra"
@@ -18,9 +18,11 @@ func init() {
 }
 
 func runServe(cmd *cobra.Command, args []string) error {
-	initPlatforms()
+	if err := initPlatforms(); err != nil {
+		return err
+	}
 
-	fmt.Fprintln(cmd.ErrOrStderr(), "Starting KidKazz MCP server on stdio...")
+	slog.Info("starting MCP server on stdio")
 
-	return mcpserver.Serve()
+	return mcpserver.Serve(mcpserver.Options{Usage: usageMeter, Saved: cacheStore})
 }
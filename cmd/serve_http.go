@@ -20,7 +20,9 @@ func init() {
 }
 
 func runServeHTTP(cmd *cobra.Command, args []string) error {
-	initPlatforms()
+	if err := initPlatforms(); err != nil {
+		return err
+	}
 
 	port := cfg.HTTPPort
 	if p, _ := cmd.Flags().GetString("port"); p != "" {
@@ -28,5 +30,9 @@ func runServeHTTP(cmd *cobra.Command, args []string) error {
 	}
 
 	addr := fmt.Sprintf(":%s", port)
-	return mcpserver.ServeHTTP(addr, cfg.APIKey)
+	var metricsAddr string
+	if cfg.MetricsPort != "" {
+		metricsAddr = fmt.Sprintf(":%s", cfg.MetricsPort)
+	}
+	return mcpserver.ServeHTTP(addr, metricsAddr, cfg.APIKey, mcpserver.Options{Usage: usageMeter, Saved: cacheStore})
 }
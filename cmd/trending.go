@@ -1,11 +1,11 @@
 package cmd
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 
+	"github.com/lukman83/kidkazz-scrap/internal/models"
 	"github.com/lukman83/kidkazz-scrap/internal/platform"
 	"github.com/lukman83/kidkazz-scrap/internal/ui"
 	"github.com/spf13/cobra"
@@ -22,16 +22,21 @@ func init() {
 	trendingCmd.Flags().String("category", "", "Category filter")
 	trendingCmd.Flags().String("format", "json", "Output format: json, table")
 	trendingCmd.Flags().Bool("no-ads", false, "Exclude ad/promoted products")
+	trendingCmd.Flags().String("location", "", "Buyer location: city or city/district, e.g. surabaya/gubeng (affects prices, stock and proxy exit)")
+	trendingCmd.Flags().String("strategy", "", "Run only this strategy: graphql, mobile, static, headless (skips fallbacks)")
 	rootCmd.AddCommand(trendingCmd)
 }
 
 func runTrending(cmd *cobra.Command, args []string) error {
-	initPlatforms()
+	if err := initPlatforms(); err != nil {
+		return err
+	}
 
 	limit, _ := cmd.Flags().GetInt("limit")
 	category, _ := cmd.Flags().GetString("category")
 	format, _ := cmd.Flags().GetString("format")
 	noAds, _ := cmd.Flags().GetBool("no-ads")
+	location, _ := cmd.Flags().GetString("location")
 	platformName, _ := cmd.Flags().GetString("platform")
 
 	scraper, err := platform.Get(platformName)
@@ -41,10 +46,11 @@ func runTrending(cmd *cobra.Command, args []string) error {
 
 	spin := ui.NewSpinner()
 	spin.Start("Fetching trending products...")
-	ctx := platform.WithProgress(context.Background(), spin.Update)
+	ctx := withStrategy(platform.WithProgress(cmd.Context(), spin.Update), cmd)
 	products, err := scraper.Trending(ctx, platform.TrendingOpts{
 		Category: category,
 		Limit:    limit,
+		Location: location,
 	})
 	spin.Stop()
 	if err != nil {
@@ -53,7 +59,7 @@ func runTrending(cmd *cobra.Command, args []string) error {
 
 	if noAds {
 		before := len(products)
-		products = filterAds(products)
+		products = models.FilterAds(products)
 		if len(products) < before {
 			fmt.Fprintf(os.Stderr, "Note: %d ad(s) filtered, showing %d of %d results\n", before-len(products), len(products), before)
 		}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lukman83/kidkazz-scrap/internal/usage"
+	"github.com/spf13/cobra"
+)
+
+var usageCmd = &cobra.Command{
+	Use:   "usage",
+	Short: "Report bandwidth used and estimated proxy cost",
+	Long: `Report the bytes scrapes sent and received, read from the usage log.
+
+Cost is estimated from proxy_prices (price per GB by proxy provider, e.g.
+KIDKAZZ_PROXY_PRICES=decodo-rotating=3.5). Direct traffic costs nothing.`,
+	Args: cobra.NoArgs,
+	RunE: runUsage,
+}
+
+func init() {
+	usageCmd.Flags().Int("days", 30, "Report the last N days (today included)")
+	usageCmd.Flags().String("by", usage.ByProvider, "Group by: "+strings.Join(usage.Groupings(), ", "))
+	usageCmd.Flags().String("format", "table", "Output format: json, table")
+	rootCmd.AddCommand(usageCmd)
+}
+
+func runUsage(cmd *cobra.Command, args []string) error {
+	days, _ := cmd.Flags().GetInt("days")
+	by, _ := cmd.Flags().GetString("by")
+	format, _ := cmd.Flags().GetString("format")
+	if days < 1 {
+		return fmt.Errorf("--days must be at least 1")
+	}
+
+	path, err := usagePath()
+	if err != nil {
+		return err
+	}
+	y, m, d := time.Now().Date()
+	since := time.Date(y, m, d-days+1, 0, 0, 0, 0, time.Local)
+	records, err := usage.Read(path, since)
+	if err != nil {
+		return err
+	}
+	rows, err := usage.Summarize(records, by, cfg.ProxyPrices)
+	if err != nil {
+		return err
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rows)
+	}
+
+	fmt.Printf("Usage: %s (since %s)\n\n", path, since.Format(time.DateOnly))
+	if len(rows) == 0 {
+		fmt.Println("No traffic recorded.")
+		return nil
+	}
+	var total usage.Row
+	fmt.Printf("%-20s %6s %9s %10s %10s %10s %9s\n", strings.ToUpper(by), "JOBS", "REQUESTS", "SENT", "RECEIVED", "TOTAL", "COST")
+	for _, r := range rows {
+		fmt.Printf("%-20s %6d %9d %10s %10s %10s %9.2f\n", r.Key, r.Jobs, r.Requests,
+			usage.FormatBytes(r.Sent), usage.FormatBytes(r.Received), usage.FormatBytes(r.Bytes()), r.Cost)
+		total.Requests += r.Requests
+		total.Sent += r.Sent
+		total.Received += r.Received
+		total.Cost += r.Cost
+	}
+	fmt.Printf("%-20s %6s %9d %10s %10s %10s %9.2f\n", "total", "", total.Requests,
+		usage.FormatBytes(total.Sent), usage.FormatBytes(total.Received), usage.FormatBytes(total.Bytes()), total.Cost)
+	if len(cfg.ProxyPrices) == 0 {
+		fmt.Println("\nNo proxy_prices configured; costs are zero.")
+	}
+	return nil
+}
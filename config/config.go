@@ -1,10 +1,11 @@
 package config
 
 import (
-	"os"
+	"fmt"
+	"slices"
 	"strconv"
-
-	"github.com/joho/godotenv"
+	"strings"
+	"time"
 )
 
 // Config holds all application configuration.
@@ -12,6 +13,7 @@ type Config struct {
 	// General
 	DefaultPlatform string
 	RespectRobots   bool
+	RobotsLog       string // path to JSON-lines audit log of robots.txt decisions
 	DelayProfile    string // "cautious", "normal", "aggressive"
 
 	// Rate limiting
@@ -19,89 +21,141 @@ type Config struct {
 	RateBurst     int
 	MaxConcurrent int
 
+	// Strategy chain
+	FastStrategies  []string      // raced concurrently
+	SlowStrategies  []string      // tried sequentially as fallback
+	RaceTimeout     time.Duration // deadline for the fast race
+	FallbackTimeout time.Duration // deadline for the fallback phase (0 = none)
+
+	// Circuit breaker (per strategy)
+	BreakerThreshold int           // consecutive failures before a strategy is skipped
+	BreakerCooldown  time.Duration // how long a tripped strategy is skipped
+
+	// Tokopedia endpoint overrides (e.g. the local mock server); empty = production
+	TokopediaBaseURL    string
+	TokopediaGraphQLURL string
+
+	// Response cache
+	CacheEnabled     bool
+	CachePath        string        // bbolt file; empty = <user cache dir>/kidkazz/cache.db
+	CacheTTLSearch   time.Duration // freshness of search results
+	CacheTTLTrending time.Duration // freshness of trending results
+	CacheTTLProduct  time.Duration // freshness of product details
+	CacheStale       time.Duration // how long past its TTL an entry is served while refreshing
+	CacheRefresh     bool          // skip cache reads but store fresh results (--refresh)
+
+	// Logging
+	LogLevel  string // "debug", "info", "warn", "error"
+	LogFormat string // "text", "json"
+
+	// Tracing
+	TraceExporter string // "none", "stdout", "otlp"
+	TraceEndpoint string // OTLP/HTTP endpoint URL; empty = OTEL_EXPORTER_OTLP_* env
+	TraceFile     string // stdout exporter destination; empty = stderr
+
+	// Record/replay (cassette directories; mutually exclusive)
+	RecordDir string
+	ReplayDir string
+
 	// HTTP server
-	HTTPPort string
-	APIKey   string
+	HTTPPort    string
+	MetricsPort string // serves /metrics and /status without auth; empty = on HTTPPort behind the API key
+	APIKey      string
 
 	// Proxy
 	ProxyMode       string // "decodo", "wireguard", "custom", "direct"
-	DecodoUsername   string
-	DecodoPassword   string
+	DecodoUsername  string
+	DecodoPassword  string
 	DecodoCountry   string
 	DecodoCity      string
 	WireGuardConfig string
 	ProxyFile       string // file with proxy list for custom mode
+
+	// Browser fingerprints
+	FingerprintsFile string // JSON file of browser profiles; empty = built-in set
+	TLSImpersonate   bool   // send HTTPS with the profile's TLS and HTTP/2 fingerprint
+
+	// Cookies
+	CookieJar     string   // encrypted file the cookie jars persist to; empty = in memory
+	CookieKey     string   // passphrase for the cookie jar; empty = random key in CookieKeyFile
+	CookieKeyFile string   // key file when there is no passphrase; empty = <user config dir>/kidkazz/cookie.key
+	Warmup        []string // pages visited before a session's first scrape: home, search
+
+	// Bandwidth accounting
+	Job         string             // job name in the usage log; empty = the command or MCP tool name
+	UsageLog    string             // JSON-lines usage log; empty = <user cache dir>/kidkazz/usage.jsonl
+	BudgetJob   string             // bytes one job may transfer, e.g. "200MB"; empty = unlimited
+	BudgetDaily string             // bytes all jobs may transfer per day; empty = unlimited
+	ProxyPrices map[string]float64 // price per GB by proxy provider, for cost estimates
+
+	// Config file the settings were read from, and the profile applied on top
+	File    string
+	Profile string
+
+	sources map[string]string // setting key -> where its value came from
 }
 
 // DefaultConfig returns configuration with sensible defaults.
 func DefaultConfig() *Config {
 	return &Config{
-		DefaultPlatform: "tokopedia",
-		RespectRobots:   true,
-		DelayProfile:    "normal",
-		RatePerSecond:   2.0,
-		RateBurst:       3,
-		MaxConcurrent:   5,
-		ProxyMode:       "direct",
-		DecodoCountry:   "id",
-		HTTPPort:        "8080",
+		DefaultPlatform:  "tokopedia",
+		RespectRobots:    true,
+		DelayProfile:     "normal",
+		RatePerSecond:    2.0,
+		RateBurst:        3,
+		MaxConcurrent:    5,
+		FastStrategies:   []string{"graphql", "mobile"},
+		SlowStrategies:   []string{"static", "headless"},
+		RaceTimeout:      10 * time.Second,
+		BreakerThreshold: 5,
+		BreakerCooldown:  time.Minute,
+		CacheEnabled:     true,
+		CacheTTLSearch:   15 * time.Minute,
+		CacheTTLTrending: time.Hour,
+		CacheTTLProduct:  6 * time.Hour,
+		CacheStale:       time.Hour,
+		LogLevel:         "info",
+		LogFormat:        "text",
+		TraceExporter:    "none",
+		ProxyMode:        "direct",
+		DecodoCountry:    "id",
+		HTTPPort:         "8080",
 	}
 }
 
-// LoadFromEnv loads .env file (if present) then overrides config from environment variables.
-func (c *Config) LoadFromEnv() {
-	// Auto-load .env file; silently ignored if missing
-	_ = godotenv.Load()
-
-	if v := os.Getenv("KIDKAZZ_PLATFORM"); v != "" {
-		c.DefaultPlatform = v
-	}
-	if v := os.Getenv("KIDKAZZ_DELAY_PROFILE"); v != "" {
-		c.DelayProfile = v
-	}
-	if v := os.Getenv("KIDKAZZ_RATE_PER_SECOND"); v != "" {
-		if f, err := strconv.ParseFloat(v, 64); err == nil {
-			c.RatePerSecond = f
+// ParsePrices parses "provider=price,..." (price per GB), e.g.
+// "decodo-rotating=3.5,decodo-unblocker=8".
+func ParsePrices(v string) (map[string]float64, error) {
+	out := make(map[string]float64)
+	for _, item := range SplitList(v) {
+		name, price, ok := strings.Cut(item, "=")
+		f, err := strconv.ParseFloat(strings.TrimSpace(price), 64)
+		if !ok || err != nil || f < 0 {
+			return nil, fmt.Errorf("invalid proxy price %q (want provider=price per GB)", item)
 		}
+		out[strings.TrimSpace(name)] = f
 	}
-	if v := os.Getenv("KIDKAZZ_RATE_BURST"); v != "" {
-		if n, err := strconv.Atoi(v); err == nil {
-			c.RateBurst = n
-		}
-	}
-	if v := os.Getenv("KIDKAZZ_MAX_CONCURRENT"); v != "" {
-		if n, err := strconv.Atoi(v); err == nil {
-			c.MaxConcurrent = n
+	return out, nil
+}
+
+// FormatPrices renders prices as ParsePrices reads them, sorted by provider.
+func FormatPrices(prices map[string]float64) string {
+	items := make([]string, 0, len(prices))
+	for name, price := range prices {
+		items = append(items, name+"="+strconv.FormatFloat(price, 'g', -1, 64))
+	}
+	slices.Sort(items)
+	return strings.Join(items, ",")
+}
+
+// SplitList parses a comma-separated list, trimming blanks. An empty string
+// yields an empty (non-nil) list so a phase can be disabled explicitly.
+func SplitList(v string) []string {
+	out := []string{}
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
 		}
 	}
-	if v := os.Getenv("KIDKAZZ_PROXY_MODE"); v != "" {
-		c.ProxyMode = v
-	}
-	if v := os.Getenv("DECODO_USERNAME"); v != "" {
-		c.DecodoUsername = v
-	}
-	if v := os.Getenv("DECODO_PASSWORD"); v != "" {
-		c.DecodoPassword = v
-	}
-	if v := os.Getenv("DECODO_COUNTRY"); v != "" {
-		c.DecodoCountry = v
-	}
-	if v := os.Getenv("DECODO_CITY"); v != "" {
-		c.DecodoCity = v
-	}
-	if v := os.Getenv("KIDKAZZ_WG_CONFIG"); v != "" {
-		c.WireGuardConfig = v
-	}
-	if v := os.Getenv("KIDKAZZ_PROXIES"); v != "" {
-		c.ProxyFile = v
-	}
-	if v := os.Getenv("KIDKAZZ_RESPECT_ROBOTS"); v == "false" {
-		c.RespectRobots = false
-	}
-	if v := os.Getenv("PORT"); v != "" {
-		c.HTTPPort = v
-	}
-	if v := os.Getenv("KIDKAZZ_API_KEY"); v != "" {
-		c.APIKey = v
-	}
+	return out
 }
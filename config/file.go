@@ -0,0 +1,145 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the config file looked up in the working directory and in
+// <user config dir>/kidkazz/.
+const FileName = "kidkazz.yaml"
+
+// File is a parsed kidkazz.yaml: base settings, plus named profiles that
+// are layered on top of them.
+type File struct {
+	Settings `yaml:",inline"`
+	Profile  string              `yaml:"profile"` // profile used when none is requested
+	Profiles map[string]Settings `yaml:"profiles"`
+}
+
+// Settings is one layer of a config file, the top level or a profile, keyed
+// by setting key. Keys left out, or set to null, leave the setting as it was.
+type Settings map[string]yaml.Node
+
+// LoadDotEnv loads a .env file from the working directory into the
+// environment, if present. Variables already set are not overridden.
+func LoadDotEnv() {
+	_ = godotenv.Load()
+}
+
+// FindFile returns the config file to load: explicit (or $KIDKAZZ_CONFIG),
+// which must exist, else the first of ./kidkazz.yaml and
+// <user config dir>/kidkazz/kidkazz.yaml that exists, else "".
+func FindFile(explicit string) (string, error) {
+	if explicit == "" {
+		explicit = os.Getenv("KIDKAZZ_CONFIG")
+	}
+	if explicit != "" {
+		if _, err := os.Stat(explicit); err != nil {
+			return "", fmt.Errorf("config file: %w", err)
+		}
+		return explicit, nil
+	}
+
+	candidates := []string{FileName}
+	if dir, err := os.UserConfigDir(); err == nil {
+		candidates = append(candidates, filepath.Join(dir, "kidkazz", FileName))
+	}
+	for _, path := range candidates {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", nil
+}
+
+// ReadFile parses a config file. Unknown keys and values of the wrong type
+// are errors, so typos do not silently fall back to defaults.
+func ReadFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f File
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&f); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	errs := []error{DefaultConfig().apply(f.Settings, "")}
+	for _, name := range f.ProfileNames() {
+		if err := DefaultConfig().apply(f.Profiles[name], ""); err != nil {
+			errs = append(errs, fmt.Errorf("profile %s: %w", name, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return &f, nil
+}
+
+// ProfileNames returns the file's profile names, sorted.
+func (f *File) ProfileNames() []string {
+	names := make([]string, 0, len(f.Profiles))
+	for name := range f.Profiles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// LoadFile applies the top-level settings of f (read from path) to c.
+func (c *Config) LoadFile(f *File, path string) error {
+	c.File = path
+	return c.apply(f.Settings, "file "+c.File)
+}
+
+// UseProfile applies profile from the loaded file f to c, or the file's
+// default profile when profile is empty.
+func (c *Config) UseProfile(f *File, profile string) error {
+	if profile == "" {
+		profile = f.Profile
+	}
+	if profile == "" {
+		return nil
+	}
+	p, ok := f.Profiles[profile]
+	if !ok {
+		return fmt.Errorf("profile %q not found in %s (available: %s)", profile, c.File, strings.Join(f.ProfileNames(), ", "))
+	}
+	c.Profile = profile
+	return c.apply(p, "profile "+profile)
+}
+
+// apply decodes the settings in layer into c, recording source for each.
+func (c *Config) apply(layer Settings, source string) error {
+	var errs []error
+	for _, key := range slices.Sorted(maps.Keys(layer)) {
+		if _, ok := lookup(key); !ok {
+			n := layer[key]
+			errs = append(errs, fmt.Errorf("line %d: unknown key %q", n.Line, key))
+		}
+	}
+	for _, s := range settingsTable {
+		n, ok := layer[s.Key]
+		if !ok || n.Tag == "!!null" {
+			continue
+		}
+		if err := n.Decode(s.field(c)); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.Key, err))
+			continue
+		}
+		c.SetSource(s.Key, source)
+	}
+	return errors.Join(errs...)
+}
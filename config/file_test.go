@@ -0,0 +1,103 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testFile = `
+delay_profile: cautious
+rate_per_second: 1.5
+race_timeout: 4s
+profile: fast
+profiles:
+  fast:
+    delay_profile: aggressive
+    max_concurrent: 10
+  proxied:
+    proxy_mode: decodo
+`
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	if err := os.WriteFile(path, []byte(testFile), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		profile       string
+		wantProfile   string
+		delay         string
+		delaySource   string
+		maxConcurrent int
+		proxyMode     string
+	}{
+		{"default profile", "", "fast", "aggressive", "profile fast", 10, "direct"},
+		{"named profile", "proxied", "proxied", "cautious", "file " + path, 5, "decodo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := DefaultConfig()
+			if err := c.LoadFile(f, path); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.UseProfile(f, tt.profile); err != nil {
+				t.Fatal(err)
+			}
+			if c.Profile != tt.wantProfile {
+				t.Errorf("profile = %q, want %q", c.Profile, tt.wantProfile)
+			}
+			if c.DelayProfile != tt.delay || c.Source("delay_profile") != tt.delaySource {
+				t.Errorf("delay_profile = %q from %q, want %q from %q", c.DelayProfile, c.Source("delay_profile"), tt.delay, tt.delaySource)
+			}
+			if c.RatePerSecond != 1.5 || c.Source("rate_per_second") != "file "+path {
+				t.Errorf("rate_per_second = %v from %q, want the file's 1.5", c.RatePerSecond, c.Source("rate_per_second"))
+			}
+			if c.MaxConcurrent != tt.maxConcurrent {
+				t.Errorf("max_concurrent = %d, want %d", c.MaxConcurrent, tt.maxConcurrent)
+			}
+			if c.ProxyMode != tt.proxyMode {
+				t.Errorf("proxy_mode = %q, want %q", c.ProxyMode, tt.proxyMode)
+			}
+			if c.RaceTimeout != 4*time.Second {
+				t.Errorf("race_timeout = %v, want 4s", c.RaceTimeout)
+			}
+			if c.Source("log_level") != "default" {
+				t.Errorf("log_level source = %q, want default", c.Source("log_level"))
+			}
+		})
+	}
+
+	if err := DefaultConfig().UseProfile(f, "missing"); err == nil {
+		t.Error("unknown profile: want an error")
+	}
+}
+
+func TestReadFileUnknownKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	tests := []struct {
+		name string
+		file string
+	}{
+		{"misspelt key", "delay_profle: cautious\n"},
+		{"misspelt key in a profile", "profiles:\n  fast:\n    max_concurent: 10\n"},
+		{"wrong type", "rate_burst: lots\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(path, []byte(tt.file), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ReadFile(path); err == nil {
+				t.Error("want an error")
+			}
+		})
+	}
+}
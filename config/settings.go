@@ -0,0 +1,286 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// Setting describes one configurable value: its config-file key, the
+// environment variable and CLI flag that override it, and the Config field
+// it sets. The file, environment and flag layers are all driven by
+// settingsTable, so a new setting is one entry there plus its field.
+type Setting struct {
+	Key    string
+	Env    string // "" = no environment variable
+	Flag   string // "" = no CLI flag
+	Usage  string // flag help
+	Secret bool   // redacted by Value unless asked otherwise
+	Negate bool   // a bool whose flag turns it off, e.g. --no-cache
+	field  func(c *Config) any
+}
+
+// settingsTable lists every setting in config-file order.
+var settingsTable = []Setting{
+	{Key: "platform", Env: "KIDKAZZ_PLATFORM", Flag: "platform", Usage: "Target marketplace platform", field: func(c *Config) any { return &c.DefaultPlatform }},
+	{Key: "delay_profile", Env: "KIDKAZZ_DELAY_PROFILE", Flag: "delay-profile", Usage: "Delay profile: cautious, normal, aggressive", field: func(c *Config) any { return &c.DelayProfile }},
+	{Key: "respect_robots", Env: "KIDKAZZ_RESPECT_ROBOTS", Flag: "respect-robots", Usage: "Respect robots.txt rules", field: func(c *Config) any { return &c.RespectRobots }},
+	{Key: "robots_log", Env: "KIDKAZZ_ROBOTS_LOG", Flag: "robots-log", Usage: "Append robots.txt decisions as JSON lines to this file", field: func(c *Config) any { return &c.RobotsLog }},
+	{Key: "rate_per_second", Env: "KIDKAZZ_RATE_PER_SECOND", Flag: "rate-per-second", Usage: "Max requests per second per host", field: func(c *Config) any { return &c.RatePerSecond }},
+	{Key: "rate_burst", Env: "KIDKAZZ_RATE_BURST", Flag: "rate-burst", Usage: "Rate limiter burst size", field: func(c *Config) any { return &c.RateBurst }},
+	{Key: "max_concurrent", Env: "KIDKAZZ_MAX_CONCURRENT", Flag: "max-concurrent", Usage: "Max concurrent page fetches", field: func(c *Config) any { return &c.MaxConcurrent }},
+	{Key: "fast_strategies", Env: "KIDKAZZ_FAST_STRATEGIES", Flag: "fast-strategies", Usage: "Comma-separated strategies raced concurrently", field: func(c *Config) any { return &c.FastStrategies }},
+	{Key: "slow_strategies", Env: "KIDKAZZ_SLOW_STRATEGIES", Flag: "slow-strategies", Usage: "Comma-separated fallback strategies, tried in order", field: func(c *Config) any { return &c.SlowStrategies }},
+	{Key: "race_timeout", Env: "KIDKAZZ_RACE_TIMEOUT", Flag: "race-timeout", Usage: "Deadline for the fast strategy race", field: func(c *Config) any { return &c.RaceTimeout }},
+	{Key: "fallback_timeout", Env: "KIDKAZZ_FALLBACK_TIMEOUT", Flag: "fallback-timeout", Usage: "Deadline for the fallback phase (0 = none)", field: func(c *Config) any { return &c.FallbackTimeout }},
+	{Key: "breaker_threshold", Env: "KIDKAZZ_BREAKER_THRESHOLD", field: func(c *Config) any { return &c.BreakerThreshold }},
+	{Key: "breaker_cooldown", Env: "KIDKAZZ_BREAKER_COOLDOWN", field: func(c *Config) any { return &c.BreakerCooldown }},
+	{Key: "tokopedia_base_url", Env: "KIDKAZZ_TOKOPEDIA_BASE_URL", field: func(c *Config) any { return &c.TokopediaBaseURL }},
+	{Key: "tokopedia_gql_url", Env: "KIDKAZZ_TOKOPEDIA_GQL_URL", field: func(c *Config) any { return &c.TokopediaGraphQLURL }},
+	{Key: "cache", Env: "KIDKAZZ_CACHE", Flag: "no-cache", Usage: "Bypass the response cache entirely", Negate: true, field: func(c *Config) any { return &c.CacheEnabled }},
+	{Key: "cache_path", Env: "KIDKAZZ_CACHE_PATH", field: func(c *Config) any { return &c.CachePath }},
+	{Key: "cache_ttl_search", Env: "KIDKAZZ_CACHE_TTL_SEARCH", field: func(c *Config) any { return &c.CacheTTLSearch }},
+	{Key: "cache_ttl_trending", Env: "KIDKAZZ_CACHE_TTL_TRENDING", field: func(c *Config) any { return &c.CacheTTLTrending }},
+	{Key: "cache_ttl_product", Env: "KIDKAZZ_CACHE_TTL_PRODUCT", field: func(c *Config) any { return &c.CacheTTLProduct }},
+	{Key: "cache_stale", Env: "KIDKAZZ_CACHE_STALE", field: func(c *Config) any { return &c.CacheStale }},
+	{Key: "log_level", Env: "KIDKAZZ_LOG_LEVEL", Flag: "log-level", Usage: "Log level: debug, info, warn, error", field: func(c *Config) any { return &c.LogLevel }},
+	{Key: "log_format", Env: "KIDKAZZ_LOG_FORMAT", Flag: "log-format", Usage: "Log format: text, json", field: func(c *Config) any { return &c.LogFormat }},
+	{Key: "trace_exporter", Env: "KIDKAZZ_TRACE_EXPORTER", Flag: "trace", Usage: "Trace exporter: none, stdout, otlp", field: func(c *Config) any { return &c.TraceExporter }},
+	{Key: "trace_endpoint", Env: "KIDKAZZ_TRACE_ENDPOINT", field: func(c *Config) any { return &c.TraceEndpoint }},
+	{Key: "trace_file", Env: "KIDKAZZ_TRACE_FILE", Flag: "trace-file", Usage: "Write stdout-exporter spans to this file instead of stderr", field: func(c *Config) any { return &c.TraceFile }},
+	{Key: "port", Env: "PORT", field: func(c *Config) any { return &c.HTTPPort }},
+	{Key: "metrics_port", Env: "KIDKAZZ_METRICS_PORT", field: func(c *Config) any { return &c.MetricsPort }},
+	{Key: "api_key", Env: "KIDKAZZ_API_KEY", Secret: true, field: func(c *Config) any { return &c.APIKey }},
+	{Key: "proxy_mode", Env: "KIDKAZZ_PROXY_MODE", Flag: "proxy-mode", Usage: "Proxy mode: decodo, wireguard, custom, direct", field: func(c *Config) any { return &c.ProxyMode }},
+	{Key: "decodo_username", Env: "DECODO_USERNAME", Secret: true, field: func(c *Config) any { return &c.DecodoUsername }},
+	{Key: "decodo_password", Env: "DECODO_PASSWORD", Secret: true, field: func(c *Config) any { return &c.DecodoPassword }},
+	{Key: "decodo_country", Env: "DECODO_COUNTRY", field: func(c *Config) any { return &c.DecodoCountry }},
+	{Key: "decodo_city", Env: "DECODO_CITY", field: func(c *Config) any { return &c.DecodoCity }},
+	{Key: "wireguard_config", Env: "KIDKAZZ_WG_CONFIG", Flag: "wireguard-config", Usage: "Path to WireGuard config file", field: func(c *Config) any { return &c.WireGuardConfig }},
+	{Key: "proxy_file", Env: "KIDKAZZ_PROXIES", Flag: "proxy-file", Usage: "Path to proxy list file", field: func(c *Config) any { return &c.ProxyFile }},
+	{Key: "tls_impersonate", Env: "KIDKAZZ_TLS_IMPERSONATE", Flag: "tls-impersonate", Usage: "Match the TLS and HTTP/2 fingerprint of HTTPS requests to the browser profile", field: func(c *Config) any { return &c.TLSImpersonate }},
+	{Key: "fingerprints_file", Env: "KIDKAZZ_FINGERPRINTS", Flag: "fingerprints", Usage: "JSON file of browser fingerprint profiles (default: built-in set)", field: func(c *Config) any { return &c.FingerprintsFile }},
+	{Key: "cookie_jar", Env: "KIDKAZZ_COOKIE_JAR", Flag: "cookie-jar", Usage: "Persist cookies, encrypted, to this file between runs (default: in memory)", field: func(c *Config) any { return &c.CookieJar }},
+	{Key: "cookie_key", Env: "KIDKAZZ_COOKIE_KEY", Secret: true, field: func(c *Config) any { return &c.CookieKey }},
+	{Key: "cookie_key_file", Env: "KIDKAZZ_COOKIE_KEY_FILE", field: func(c *Config) any { return &c.CookieKeyFile }},
+	{Key: "warmup", Env: "KIDKAZZ_WARMUP", Flag: "warmup", Usage: "Comma-separated pages visited before the first scrape: home, search", field: func(c *Config) any { return &c.Warmup }},
+	{Key: "job", Env: "KIDKAZZ_JOB", Flag: "job", Usage: "Name this run in the usage log (default: the command name)", field: func(c *Config) any { return &c.Job }},
+	{Key: "usage_log", Env: "KIDKAZZ_USAGE_LOG", field: func(c *Config) any { return &c.UsageLog }},
+	{Key: "budget_job", Env: "KIDKAZZ_BUDGET_JOB", Flag: "budget-job", Usage: "Abort a job after it transfers this much, e.g. 200MB (default: unlimited)", field: func(c *Config) any { return &c.BudgetJob }},
+	{Key: "budget_daily", Env: "KIDKAZZ_BUDGET_DAILY", Flag: "budget-daily", Usage: "Refuse scrapes once today's jobs transferred this much, e.g. 5GB (default: unlimited)", field: func(c *Config) any { return &c.BudgetDaily }},
+	{Key: "proxy_prices", Env: "KIDKAZZ_PROXY_PRICES", field: func(c *Config) any { return &c.ProxyPrices }},
+}
+
+// AllSettings returns every setting in config-file order.
+func AllSettings() []Setting {
+	return settingsTable
+}
+
+// lookup returns the setting with the config-file key key.
+func lookup(key string) (Setting, bool) {
+	for _, s := range settingsTable {
+		if s.Key == key {
+			return s, true
+		}
+	}
+	return Setting{}, false
+}
+
+// Value returns the setting's current value in c, with secrets redacted.
+func (s Setting) Value(c *Config) string {
+	v := s.raw(c)
+	if s.Secret && v != "" {
+		return "<redacted>"
+	}
+	return v
+}
+
+// raw formats the setting's value in c as its environment variable takes it.
+func (s Setting) raw(c *Config) string {
+	switch p := s.field(c).(type) {
+	case *string:
+		return *p
+	case *bool:
+		return strconv.FormatBool(*p)
+	case *int:
+		return strconv.Itoa(*p)
+	case *float64:
+		return strconv.FormatFloat(*p, 'g', -1, 64)
+	case *time.Duration:
+		return p.String()
+	case *[]string:
+		return strings.Join(*p, ",")
+	case *map[string]float64:
+		return FormatPrices(*p)
+	}
+	panic("config: unsupported type for setting " + s.Key)
+}
+
+// set parses v, as written in an environment variable or flag, into c. On
+// error c is left unchanged.
+func (s Setting) set(c *Config, v string) error {
+	switch p := s.field(c).(type) {
+	case *string:
+		*p = v
+	case *bool:
+		return assign(p, v, strconv.ParseBool)
+	case *int:
+		return assign(p, v, strconv.Atoi)
+	case *float64:
+		return assign(p, v, func(v string) (float64, error) { return strconv.ParseFloat(v, 64) })
+	case *time.Duration:
+		return assign(p, v, time.ParseDuration)
+	case *[]string:
+		*p = SplitList(v)
+	case *map[string]float64:
+		return assign(p, v, ParsePrices)
+	default:
+		panic("config: unsupported type for setting " + s.Key)
+	}
+	return nil
+}
+
+func assign[T any](p *T, v string, parse func(string) (T, error)) error {
+	x, err := parse(v)
+	if err != nil {
+		return err
+	}
+	*p = x
+	return nil
+}
+
+// isList reports whether the setting is a list, which an empty value clears.
+func (s Setting) isList() bool {
+	_, ok := s.field(&Config{}).(*[]string)
+	return ok
+}
+
+// Source reports where key's current value came from: "default",
+// "file <path>", "profile <name>", "env <VAR>" or "flag --<name>".
+func (c *Config) Source(key string) string {
+	if src, ok := c.sources[key]; ok {
+		return src
+	}
+	return "default"
+}
+
+// SetSource records where key's current value came from.
+func (c *Config) SetSource(key, source string) {
+	if c.sources == nil {
+		c.sources = make(map[string]string)
+	}
+	c.sources[key] = source
+}
+
+// LoadFromEnv loads the .env file (if present), then applies every setting
+// whose environment variable is set. An empty variable is ignored, except
+// for lists, which it empties. Values that do not parse are reported and
+// leave the setting as it was.
+func (c *Config) LoadFromEnv() error {
+	LoadDotEnv()
+	var errs []error
+	for _, s := range settingsTable {
+		v, ok := os.LookupEnv(s.Env)
+		if !ok || (v == "" && !s.isList()) {
+			continue
+		}
+		if err := s.set(c, v); err != nil {
+			errs = append(errs, fmt.Errorf("%s: invalid value %q", s.Env, v))
+			continue
+		}
+		c.SetSource(s.Key, "env "+s.Env)
+	}
+	return errors.Join(errs...)
+}
+
+// RegisterFlags defines the flag of every setting that has one on fs, with
+// the built-in default as its default.
+func RegisterFlags(fs *pflag.FlagSet) {
+	def := DefaultConfig()
+	for _, s := range settingsTable {
+		if s.Flag == "" {
+			continue
+		}
+		switch p := s.field(def).(type) {
+		case *bool:
+			fs.Bool(s.Flag, *p && !s.Negate, s.Usage)
+		case *int:
+			fs.Int(s.Flag, *p, s.Usage)
+		case *float64:
+			fs.Float64(s.Flag, *p, s.Usage)
+		case *time.Duration:
+			fs.Duration(s.Flag, *p, s.Usage)
+		default:
+			fs.String(s.Flag, s.raw(def), s.Usage)
+		}
+	}
+}
+
+// LoadFlags applies the flags the user set on fs, as registered by
+// RegisterFlags.
+func (c *Config) LoadFlags(fs *pflag.FlagSet) error {
+	var errs []error
+	for _, s := range settingsTable {
+		if s.Flag == "" || !fs.Changed(s.Flag) {
+			continue
+		}
+		v := fs.Lookup(s.Flag).Value.String()
+		if s.Negate {
+			on, _ := strconv.ParseBool(v)
+			v = strconv.FormatBool(!on)
+		}
+		if err := s.set(c, v); err != nil {
+			errs = append(errs, fmt.Errorf("--%s: invalid value %q", s.Flag, v))
+			continue
+		}
+		c.SetSource(s.Key, "flag --"+s.Flag)
+	}
+	return errors.Join(errs...)
+}
+
+// Validate reports every setting with an invalid value. Strategy names are
+// platform-specific and are checked by the caller.
+func (c *Config) Validate() error {
+	var errs []error
+	oneOf := func(key, v string, allowed ...string) {
+		if !slices.Contains(allowed, v) {
+			errs = append(errs, fmt.Errorf("%s: %q is not one of %s", key, v, strings.Join(allowed, ", ")))
+		}
+	}
+	atLeast := func(key string, v, min int) {
+		if v < min {
+			errs = append(errs, fmt.Errorf("%s: must be at least %d", key, min))
+		}
+	}
+
+	oneOf("delay_profile", c.DelayProfile, "cautious", "normal", "aggressive")
+	oneOf("proxy_mode", c.ProxyMode, "direct", "decodo", "wireguard", "custom")
+	oneOf("log_format", strings.ToLower(c.LogFormat), "text", "json")
+	oneOf("trace_exporter", strings.ToLower(c.TraceExporter), "none", "stdout", "otlp")
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		errs = append(errs, fmt.Errorf("log_level: %q is not one of debug, info, warn, error", c.LogLevel))
+	}
+
+	if c.RatePerSecond <= 0 {
+		errs = append(errs, fmt.Errorf("rate_per_second: must be positive"))
+	}
+	atLeast("rate_burst", c.RateBurst, 1)
+	atLeast("max_concurrent", c.MaxConcurrent, 1)
+	atLeast("breaker_threshold", c.BreakerThreshold, 1)
+	if c.RaceTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("race_timeout: must be positive"))
+	}
+	if c.FallbackTimeout < 0 {
+		errs = append(errs, fmt.Errorf("fallback_timeout: must not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
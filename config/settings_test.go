@@ -0,0 +1,78 @@
+package config
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+func TestLoadFromEnv(t *testing.T) {
+	t.Setenv("KIDKAZZ_RATE_BURST", "7")
+	t.Setenv("KIDKAZZ_MAX_CONCURRENT", "many")
+	t.Setenv("KIDKAZZ_RACE_TIMEOUT", "3s")
+	t.Setenv("KIDKAZZ_SLOW_STRATEGIES", "")
+	t.Setenv("KIDKAZZ_PROXY_MODE", "")
+
+	c := DefaultConfig()
+	if err := c.LoadFromEnv(); err == nil {
+		t.Error("invalid KIDKAZZ_MAX_CONCURRENT: want an error")
+	}
+	tests := []struct {
+		key, value, source string
+	}{
+		{"rate_burst", "7", "env KIDKAZZ_RATE_BURST"},
+		{"max_concurrent", "5", "default"}, // did not parse
+		{"race_timeout", "3s", "env KIDKAZZ_RACE_TIMEOUT"},
+		{"slow_strategies", "", "env KIDKAZZ_SLOW_STRATEGIES"}, // an empty list clears it
+		{"proxy_mode", "direct", "default"},                    // an empty value is ignored
+	}
+	for _, tt := range tests {
+		s, _ := lookup(tt.key)
+		if v, src := s.Value(c), c.Source(tt.key); v != tt.value || src != tt.source {
+			t.Errorf("%s = %q from %q, want %q from %q", tt.key, v, src, tt.value, tt.source)
+		}
+	}
+}
+
+func TestFlags(t *testing.T) {
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	RegisterFlags(fs)
+	for _, s := range settingsTable {
+		if s.Flag != "" && fs.Lookup(s.Flag) == nil {
+			t.Errorf("no --%s flag for %s", s.Flag, s.Key)
+		}
+	}
+	if def := fs.Lookup("fast-strategies").DefValue; def != "graphql,mobile" {
+		t.Errorf("--fast-strategies default = %q", def)
+	}
+
+	err := fs.Parse([]string{"--no-cache", "--race-timeout=2s", "--warmup=home,search", "--job=nightly", "--cookie-jar="})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := DefaultConfig()
+	c.CookieJar = "jar.enc"
+	if err := c.LoadFlags(fs); err != nil {
+		t.Fatal(err)
+	}
+	if c.CacheEnabled || c.Source("cache") != "flag --no-cache" {
+		t.Errorf("cache = %v from %q, want false from --no-cache", c.CacheEnabled, c.Source("cache"))
+	}
+	if c.RaceTimeout != 2*time.Second {
+		t.Errorf("race_timeout = %v, want 2s", c.RaceTimeout)
+	}
+	if !slices.Equal(c.Warmup, []string{"home", "search"}) {
+		t.Errorf("warmup = %q", c.Warmup)
+	}
+	if c.Job != "nightly" {
+		t.Errorf("job = %q", c.Job)
+	}
+	if c.CookieJar != "" {
+		t.Errorf("explicit empty --cookie-jar left %q", c.CookieJar)
+	}
+	if c.Source("delay_profile") != "default" || c.DelayProfile != "normal" {
+		t.Errorf("unset flag changed delay_profile to %q from %q", c.DelayProfile, c.Source("delay_profile"))
+	}
+}
@@ -0,0 +1,256 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lukman83/kidkazz-scrap/internal/crawl"
+	"github.com/lukman83/kidkazz-scrap/internal/logging"
+	"github.com/lukman83/kidkazz-scrap/internal/metrics"
+	"github.com/lukman83/kidkazz-scrap/internal/models"
+	"github.com/lukman83/kidkazz-scrap/internal/platform"
+	"github.com/lukman83/kidkazz-scrap/internal/usage"
+)
+
+// revalidateTimeout bounds a background refresh of a stale entry.
+const revalidateTimeout = 2 * time.Minute
+
+// Scraper is a platform.Scraper that answers from the Store when it can.
+// Requests that force a single strategy (platform.WithStrategy) are debugging
+// runs and always go to the inner scraper.
+type Scraper struct {
+	name    string // platform name, part of every key
+	inner   platform.Scraper
+	store   *Store
+	policy  Policy
+	refresh bool // skip reads, but still store fresh results
+
+	mu       sync.Mutex
+	inflight map[string]bool // keys being revalidated in the background
+	closed   bool            // no new revalidations once Close has begun
+	wg       sync.WaitGroup
+
+	ctx    context.Context // parent of background revalidations
+	cancel context.CancelFunc
+}
+
+type refreshKey struct{}
+
+// WithRefresh makes requests with ctx skip the cached results, like the
+// refresh flag of NewScraper: they are scraped and replace what is cached.
+func WithRefresh(ctx context.Context) context.Context {
+	return context.WithValue(ctx, refreshKey{}, true)
+}
+
+// NewScraper wraps inner, the scraper registered as name. With refresh set,
+// every request is scraped and the result replaces the cached one.
+func NewScraper(name string, inner platform.Scraper, store *Store, policy Policy, refresh bool) *Scraper {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scraper{
+		name:     name,
+		inner:    inner,
+		store:    store,
+		policy:   policy,
+		refresh:  refresh,
+		inflight: make(map[string]bool),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Unwrap returns the wrapped scraper.
+func (c *Scraper) Unwrap() platform.Scraper { return c.inner }
+
+// Close lets background revalidations run until ctx is done, then cancels
+// the rest and waits for them to return. An entry whose refresh was
+// cancelled stays stale and is refreshed by a later request.
+func (c *Scraper) Close(ctx context.Context) {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		c.cancel()
+		<-done
+	}
+	c.cancel()
+}
+
+func (c *Scraper) Search(ctx context.Context, keyword string, opts platform.SearchOpts) ([]models.Product, error) {
+	if opts.Page <= 0 {
+		opts.Page = 1
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = 20
+	}
+	key := c.key(KindSearch, c.withLocation(opts.Location, "q="+normalizeText(keyword), fmt.Sprintf("page=%d", opts.Page), fmt.Sprintf("limit=%d", opts.Limit))...)
+	return lookup(ctx, c, KindSearch, key, func(ctx context.Context) ([]models.Product, error) {
+		return c.inner.Search(ctx, keyword, opts)
+	})
+}
+
+func (c *Scraper) Trending(ctx context.Context, opts platform.TrendingOpts) ([]models.Product, error) {
+	if opts.Limit <= 0 {
+		opts.Limit = 20
+	}
+	key := c.key(KindTrending, c.withLocation(opts.Location, "category="+normalizeText(opts.Category), fmt.Sprintf("limit=%d", opts.Limit))...)
+	return lookup(ctx, c, KindTrending, key, func(ctx context.Context) ([]models.Product, error) {
+		return c.inner.Trending(ctx, opts)
+	})
+}
+
+func (c *Scraper) ProductDetail(ctx context.Context, productURL string, opts platform.DetailOpts) (*models.Product, error) {
+	key := c.key(KindProduct, c.withLocation(opts.Location, "url="+normalizeURL(productURL))...)
+	return lookup(ctx, c, KindProduct, key, func(ctx context.Context) (*models.Product, error) {
+		return c.inner.ProductDetail(ctx, productURL, opts)
+	})
+}
+
+// lookup answers from the store when the entry is fresh, or stale and
+// revalidating; otherwise it fetches and stores the result. Store errors
+// never fail the request. Either way the platform.ResultInfo of ctx reflects
+// where the result came from.
+func lookup[T any](ctx context.Context, c *Scraper, kind Kind, key string, fetch func(context.Context) (T, error)) (T, error) {
+	if platform.StrategyFrom(ctx) != "" {
+		return fetch(ctx)
+	}
+
+	if refresh, _ := ctx.Value(refreshKey{}).(bool); !c.refresh && !refresh {
+		e, ok, err := c.store.Get(key)
+		if err != nil {
+			slog.WarnContext(ctx, "cache read failed", "key", key, "err", err)
+		}
+		if ok {
+			state := c.policy.State(e, time.Now())
+			var v T
+			if state != Expired && json.Unmarshal(e.Value, &v) == nil {
+				age := time.Since(e.StoredAt).Round(time.Second)
+				platform.MergeResult(ctx, platform.ResultInfo{TotalData: e.TotalData, Strategy: e.Strategy, CachedAt: e.StoredAt})
+				if state == Stale {
+					c.store.count(counterStaleHits)
+					metrics.CacheLookups.WithLabelValues(c.name, string(kind), "stale").Inc()
+					platform.Warn(ctx, fmt.Sprintf("cached result is stale (%s old); a refresh is running", age))
+					platform.ReportProgress(ctx, fmt.Sprintf("Serving cached result (%s old), refreshing in background...", age))
+					revalidate(ctx, c, kind, key, fetch)
+				} else {
+					c.store.count(counterHits)
+					metrics.CacheLookups.WithLabelValues(c.name, string(kind), "hit").Inc()
+					platform.ReportProgress(ctx, fmt.Sprintf("Serving cached result (%s old)", age))
+				}
+				return v, nil
+			}
+		}
+	}
+
+	c.store.count(counterMisses)
+	metrics.CacheLookups.WithLabelValues(c.name, string(kind), "miss").Inc()
+	fetchCtx, result := platform.WithResultInfo(ctx)
+	v, err := fetch(fetchCtx)
+	info := result()
+	platform.MergeResult(ctx, info)
+	if err != nil {
+		return v, err
+	}
+	c.put(ctx, kind, key, v, info)
+	return v, nil
+}
+
+// revalidate refreshes key in the background unless a refresh is already
+// running or c is closing. The refresh keeps ctx's request ID, crawl session
+// and usage job but nothing else of the caller's context; Close cancels it.
+func revalidate[T any](ctx context.Context, c *Scraper, kind Kind, key string, fetch func(context.Context) (T, error)) {
+	requestID, session, job := logging.RequestIDFrom(ctx), crawl.Session(ctx), usage.JobFrom(ctx)
+	c.mu.Lock()
+	if c.inflight[key] || c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.inflight[key] = true
+	c.wg.Add(1)
+	c.mu.Unlock()
+
+	go func() {
+		defer c.wg.Done()
+		defer func() {
+			c.mu.Lock()
+			delete(c.inflight, key)
+			c.mu.Unlock()
+		}()
+
+		// Detached from the caller, which has already been answered.
+		ctx := crawl.WithSession(usage.WithJob(logging.WithRequestID(c.ctx, requestID), job), session)
+		ctx, cancel := context.WithTimeout(ctx, revalidateTimeout)
+		defer cancel()
+		ctx, result := platform.WithResultInfo(ctx)
+		v, err := fetch(ctx)
+		if err != nil {
+			slog.WarnContext(ctx, "cache refresh failed", "key", key, "err", err)
+			return
+		}
+		c.put(ctx, kind, key, v, result())
+	}()
+}
+
+func (c *Scraper) put(ctx context.Context, kind Kind, key string, v any, info platform.ResultInfo) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	e := Entry{Kind: kind, StoredAt: time.Now(), Value: data, Strategy: info.Strategy, TotalData: info.TotalData}
+	if err := c.store.Put(key, e); err != nil {
+		slog.WarnContext(ctx, "cache write failed", "key", key, "err", err)
+	}
+}
+
+// key builds "<platform>|<kind>|<part>|...".
+func (c *Scraper) key(kind Kind, parts ...string) string {
+	return strings.Join(append([]string{c.name, string(kind)}, parts...), "|")
+}
+
+// withLocation appends a "loc=" part to parts for a request with a location.
+// When the platform resolves locations (platform.LocationResolver) the part
+// is the canonical name, so "Surabaya" and "surabaya/gubeng" share an entry.
+func (c *Scraper) withLocation(location string, parts ...string) []string {
+	if location = normalizeText(location); location == "" {
+		return parts
+	}
+	if r, ok := platform.Underlying(c.inner).(platform.LocationResolver); ok {
+		if name, err := r.CanonicalLocation(location); err == nil {
+			location = name
+		}
+	}
+	return append(parts, "loc="+location)
+}
+
+// normalizeText lower-cases s and collapses whitespace, so "Boneka  Anak"
+// and "boneka anak" share an entry.
+func normalizeText(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
+
+// normalizeURL drops the query string and fragment (tracking parameters) and
+// the trailing slash, and lower-cases the host.
+func normalizeURL(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Host == "" {
+		return strings.TrimSpace(raw)
+	}
+	u.Host = strings.ToLower(u.Host)
+	u.RawQuery = ""
+	u.Fragment = ""
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	return u.String()
+}
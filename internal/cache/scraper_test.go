@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lukman83/kidkazz-scrap/internal/models"
+	"github.com/lukman83/kidkazz-scrap/internal/platform"
+)
+
+// slowScraper answers searches after delay, or when its context ends.
+type slowScraper struct {
+	delay     time.Duration
+	searches  atomic.Int32
+	cancelled atomic.Int32
+}
+
+func (s *slowScraper) Search(ctx context.Context, keyword string, opts platform.SearchOpts) ([]models.Product, error) {
+	s.searches.Add(1)
+	select {
+	case <-time.After(s.delay):
+		return []models.Product{{Name: keyword}}, nil
+	case <-ctx.Done():
+		s.cancelled.Add(1)
+		return nil, ctx.Err()
+	}
+}
+
+func (s *slowScraper) Trending(ctx context.Context, opts platform.TrendingOpts) ([]models.Product, error) {
+	return nil, nil
+}
+
+func (s *slowScraper) ProductDetail(ctx context.Context, url string, opts platform.DetailOpts) (*models.Product, error) {
+	return nil, nil
+}
+
+func TestCloseCancelsRevalidation(t *testing.T) {
+	store, _ := openTemp(t)
+	defer store.Close()
+	inner := &slowScraper{}
+	policy := Policy{TTL: map[Kind]time.Duration{KindSearch: time.Millisecond}, Stale: time.Hour}
+	c := NewScraper("tokopedia", inner, store, policy, false)
+
+	ctx := context.Background()
+	if _, err := c.Search(ctx, "boneka", platform.SearchOpts{}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * time.Millisecond) // let the entry go stale
+
+	inner.delay = time.Hour
+	products, err := c.Search(ctx, "boneka", platform.SearchOpts{})
+	if err != nil || len(products) != 1 {
+		t.Fatalf("stale hit: %v, %v", products, err)
+	}
+
+	closeCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	c.Close(closeCtx)
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Close took %s", d)
+	}
+	if inner.searches.Load() != 2 || inner.cancelled.Load() != 1 {
+		t.Errorf("searches, cancelled = %d, %d; want 2, 1", inner.searches.Load(), inner.cancelled.Load())
+	}
+
+	// A closed scraper answers but starts no refreshes.
+	if _, err := c.Search(ctx, "boneka", platform.SearchOpts{}); err != nil {
+		t.Fatal(err)
+	}
+	if n := inner.searches.Load(); n != 2 {
+		t.Errorf("refresh started after Close (%d searches)", n)
+	}
+}
+
+func TestWithRefresh(t *testing.T) {
+	store, _ := openTemp(t)
+	defer store.Close()
+	inner := &slowScraper{}
+	policy := Policy{TTL: map[Kind]time.Duration{KindSearch: time.Hour}}
+	c := NewScraper("tokopedia", inner, store, policy, false)
+
+	ctx := context.Background()
+	for _, ctx := range []context.Context{ctx, ctx, WithRefresh(ctx), ctx} {
+		if _, err := c.Search(ctx, "boneka", platform.SearchOpts{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := inner.searches.Load(); n != 2 {
+		t.Errorf("scraped %d times, want 2: the first search and the refresh", n)
+	}
+}
+
+// cityScraper resolves a bare city to its default district.
+type cityScraper struct{ slowScraper }
+
+func (s *cityScraper) CanonicalLocation(location string) (string, error) {
+	if !strings.Contains(location, "/") {
+		location += "/pusat"
+	}
+	return location, nil
+}
+
+func TestLocationKeys(t *testing.T) {
+	store, _ := openTemp(t)
+	defer store.Close()
+	inner := &cityScraper{}
+	policy := Policy{TTL: map[Kind]time.Duration{KindSearch: time.Hour}}
+	c := NewScraper("tokopedia", inner, store, policy, false)
+
+	ctx := context.Background()
+	for _, loc := range []string{"Surabaya", "surabaya/pusat", " SURABAYA ", "jakarta", ""} {
+		if _, err := c.Search(ctx, "boneka", platform.SearchOpts{Location: loc}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := inner.searches.Load(); n != 3 {
+		t.Errorf("scraped %d times, want 3: surabaya, jakarta and no location", n)
+	}
+}
@@ -0,0 +1,381 @@
+// Package cache keeps scraper results on disk so repeated requests do not
+// re-scrape. Entries are fresh for a per-kind TTL, then served stale (while
+// being refreshed in the background) for a further grace period.
+package cache
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	bolterrors "go.etcd.io/bbolt/errors"
+)
+
+// Kind is the request type an entry was stored for.
+type Kind string
+
+const (
+	KindSearch   Kind = "search"
+	KindTrending Kind = "trending"
+	KindProduct  Kind = "product"
+)
+
+// Kinds lists every entry kind.
+func Kinds() []Kind { return []Kind{KindSearch, KindTrending, KindProduct} }
+
+// Policy decides how long entries stay usable.
+type Policy struct {
+	TTL   map[Kind]time.Duration // fresh lifetime per kind
+	Stale time.Duration          // extra time an expired entry is served while it is refreshed
+}
+
+// State is the freshness of an entry.
+type State int
+
+const (
+	Fresh   State = iota // within its TTL
+	Stale                // past its TTL but inside the stale-while-revalidate window
+	Expired              // unusable
+)
+
+// State classifies e at now.
+func (p Policy) State(e Entry, now time.Time) State {
+	age := now.Sub(e.StoredAt)
+	ttl := p.TTL[e.Kind]
+	switch {
+	case age < ttl:
+		return Fresh
+	case age < ttl+p.Stale:
+		return Stale
+	}
+	return Expired
+}
+
+// Entry is one cached result.
+type Entry struct {
+	Kind      Kind            `json:"kind"`
+	StoredAt  time.Time       `json:"stored_at"`
+	Value     json.RawMessage `json:"value"`
+	Strategy  string          `json:"strategy,omitempty"`   // strategy that scraped Value
+	TotalData int             `json:"total_data,omitempty"` // platform's match count, if reported
+}
+
+var (
+	entriesBucket  = []byte("entries")
+	countersBucket = []byte("counters")
+	savedBucket    = []byte("saved") // one nested bucket per collection
+)
+
+// Counter names persisted in the store.
+const (
+	counterHits      = "hits"
+	counterStaleHits = "stale_hits"
+	counterMisses    = "misses"
+	counterWrites    = "writes"
+)
+
+// Store is a bbolt-backed entry store. bbolt holds an exclusive file lock, so
+// only one process can use a given file at a time.
+//
+// Lookup counters are kept in memory and written in batches, so a cache hit
+// costs no write transaction.
+type Store struct {
+	db   *bolt.DB
+	path string
+
+	mu      sync.Mutex
+	pending map[string]uint64 // counter increments not yet written
+	npend   uint64
+}
+
+// lockTimeout is how long Open waits for another process to release the file.
+const lockTimeout = 200 * time.Millisecond
+
+// counterBatch is how many counter increments are kept in memory before they
+// are written. Put, Stats and Close write them sooner.
+const counterBatch = 100
+
+// ErrLocked is returned by Open when another process holds the cache file.
+var ErrLocked = errors.New("cache file is in use by another process")
+
+// DefaultPath returns <user cache dir>/kidkazz/cache.db.
+func DefaultPath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "kidkazz", "cache.db"), nil
+}
+
+// Open opens (creating if needed) the store at path. It gives up with
+// ErrLocked if another process holds the file.
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create cache dir: %w", err)
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: lockTimeout})
+	if errors.Is(err, bolterrors.ErrTimeout) {
+		return nil, fmt.Errorf("%w: %s", ErrLocked, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open cache: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{entriesBucket, countersBucket, savedBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("init cache: %w", err)
+	}
+	return &Store{db: db, path: path, pending: make(map[string]uint64)}, nil
+}
+
+// Path returns the file backing the store.
+func (s *Store) Path() string { return s.path }
+
+// Close writes the pending counters and closes the underlying file.
+func (s *Store) Close() error {
+	_ = s.db.Update(s.flushCounters)
+	return s.db.Close()
+}
+
+// Get returns the entry stored under key.
+func (s *Store) Get(key string) (Entry, bool, error) {
+	var e Entry
+	var found bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(entriesBucket).Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, &e)
+	})
+	return e, found, err
+}
+
+// Put stores e under key.
+func (s *Store) Put(key string, e Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(entriesBucket).Put([]byte(key), data); err != nil {
+			return err
+		}
+		if err := add(tx, counterWrites, 1); err != nil {
+			return err
+		}
+		return s.flushCounters(tx)
+	})
+}
+
+// PutSaved stores data under key in collection. Saved data sits beside the
+// cache entries but never expires, and Purge leaves it alone: its owner
+// deletes what it no longer keeps.
+func (s *Store) PutSaved(collection, key string, data []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(savedBucket).CreateBucketIfNotExists([]byte(collection))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), data)
+	})
+}
+
+// DeleteSaved removes keys from collection.
+func (s *Store) DeleteSaved(collection string, keys ...string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(savedBucket).Bucket([]byte(collection))
+		if b == nil {
+			return nil
+		}
+		for _, k := range keys {
+			if err := b.Delete([]byte(k)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// EachSaved calls fn for every key of collection, in key order. data is
+// only valid during the call.
+func (s *Store) EachSaved(collection string, fn func(key string, data []byte) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(savedBucket).Bucket([]byte(collection))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error { return fn(string(k), v) })
+	})
+}
+
+// count increments a counter in memory, writing the batch once it is full.
+// Failures are ignored; counters are informational.
+func (s *Store) count(name string) {
+	s.mu.Lock()
+	s.pending[name]++
+	s.npend++
+	full := s.npend >= counterBatch
+	s.mu.Unlock()
+	if full {
+		_ = s.db.Update(s.flushCounters)
+	}
+}
+
+// flushCounters adds the pending counter increments to the persisted
+// counters in tx. If tx fails they are lost.
+func (s *Store) flushCounters(tx *bolt.Tx) error {
+	s.mu.Lock()
+	pending := s.pending
+	s.pending, s.npend = make(map[string]uint64), 0
+	s.mu.Unlock()
+	for name, n := range pending {
+		if err := add(tx, name, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func add(tx *bolt.Tx, name string, delta uint64) error {
+	b := tx.Bucket(countersBucket)
+	var n uint64
+	if v := b.Get([]byte(name)); len(v) == 8 {
+		n = binary.BigEndian.Uint64(v)
+	}
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, n+delta)
+	return b.Put([]byte(name), buf)
+}
+
+// KindStats counts the entries of one kind by freshness.
+type KindStats struct {
+	Entries int `json:"entries"`
+	Fresh   int `json:"fresh"`
+	Stale   int `json:"stale"`
+	Expired int `json:"expired"`
+	Bytes   int `json:"bytes"`
+}
+
+// Stats summarises the store's contents and lifetime counters.
+type Stats struct {
+	Path      string             `json:"path"`
+	FileBytes int64              `json:"file_bytes"`
+	Kinds     map[Kind]KindStats `json:"kinds"`
+	Hits      uint64             `json:"hits"`
+	StaleHits uint64             `json:"stale_hits"`
+	Misses    uint64             `json:"misses"`
+	Writes    uint64             `json:"writes"`
+}
+
+// HitRate returns the fraction of lookups answered from the cache.
+func (st Stats) HitRate() float64 {
+	total := st.Hits + st.StaleHits + st.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(st.Hits+st.StaleHits) / float64(total)
+}
+
+// Stats scans the store, classifying entries with p. It writes the pending
+// counters first.
+func (s *Store) Stats(p Policy) (Stats, error) {
+	st := Stats{Path: s.path, Kinds: make(map[Kind]KindStats)}
+	now := time.Now()
+	_ = s.db.Update(s.flushCounters)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		st.FileBytes = tx.Size()
+		counters := tx.Bucket(countersBucket)
+		read := func(name string) uint64 {
+			if v := counters.Get([]byte(name)); len(v) == 8 {
+				return binary.BigEndian.Uint64(v)
+			}
+			return 0
+		}
+		st.Hits = read(counterHits)
+		st.StaleHits = read(counterStaleHits)
+		st.Misses = read(counterMisses)
+		st.Writes = read(counterWrites)
+
+		return tx.Bucket(entriesBucket).ForEach(func(k, v []byte) error {
+			var e Entry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return nil // unreadable entries are left for purge
+			}
+			ks := st.Kinds[e.Kind]
+			ks.Entries++
+			ks.Bytes += len(k) + len(v)
+			switch p.State(e, now) {
+			case Fresh:
+				ks.Fresh++
+			case Stale:
+				ks.Stale++
+			default:
+				ks.Expired++
+			}
+			st.Kinds[e.Kind] = ks
+			return nil
+		})
+	})
+	return st, err
+}
+
+// Purge deletes entries and returns how many were removed. With expiredOnly,
+// only entries past their stale window (and unreadable ones) are removed;
+// otherwise every entry goes, and the counters too. Saved data is kept.
+func (s *Store) Purge(p Policy, expiredOnly bool) (int, error) {
+	now := time.Now()
+	removed := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		if !expiredOnly {
+			s.mu.Lock()
+			s.pending, s.npend = make(map[string]uint64), 0
+			s.mu.Unlock()
+			removed = tx.Bucket(entriesBucket).Stats().KeyN
+			for _, name := range [][]byte{entriesBucket, countersBucket} {
+				if err := tx.DeleteBucket(name); err != nil {
+					return err
+				}
+				if _, err := tx.CreateBucket(name); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		b := tx.Bucket(entriesBucket)
+		var stale [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			var e Entry
+			if err := json.Unmarshal(v, &e); err != nil || p.State(e, now) == Expired {
+				stale = append(stale, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range stale {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		removed = len(stale)
+		return nil
+	})
+	return removed, err
+}
@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"encoding/binary"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func openTemp(t *testing.T) (*Store, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "cache.db")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, path
+}
+
+// persisted returns the counter as written to the file.
+func persisted(t *testing.T, s *Store, name string) uint64 {
+	t.Helper()
+	var n uint64
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(countersBucket).Get([]byte(name)); len(v) == 8 {
+			n = binary.BigEndian.Uint64(v)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestOpenLocked(t *testing.T) {
+	s, path := openTemp(t)
+	defer s.Close()
+
+	start := time.Now()
+	_, err := Open(path)
+	if !errors.Is(err, ErrLocked) {
+		t.Fatalf("second Open: err = %v, want ErrLocked", err)
+	}
+	if d := time.Since(start); d > lockTimeout+time.Second {
+		t.Errorf("second Open took %s", d)
+	}
+}
+
+func TestCountersBatched(t *testing.T) {
+	s, path := openTemp(t)
+	for range counterBatch - 1 {
+		s.count(counterHits)
+	}
+	if n := persisted(t, s, counterHits); n != 0 {
+		t.Errorf("%d hits written before the batch filled", n)
+	}
+	s.count(counterMisses)
+	if n := persisted(t, s, counterHits); n != counterBatch-1 {
+		t.Errorf("full batch: %d hits written, want %d", n, counterBatch-1)
+	}
+
+	s.count(counterStaleHits)
+	st, err := s.Stats(Policy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Hits != counterBatch-1 || st.StaleHits != 1 || st.Misses != 1 {
+		t.Errorf("stats: hits, stale, misses = %d, %d, %d", st.Hits, st.StaleHits, st.Misses)
+	}
+
+	s.count(counterHits)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if n := persisted(t, s, counterHits); n != counterBatch {
+		t.Errorf("after Close: %d hits written, want %d", n, counterBatch)
+	}
+}
+
+func TestSaved(t *testing.T) {
+	s, path := openTemp(t)
+	for _, k := range []string{"b", "a", "c"} {
+		if err := s.PutSaved("searches", k, []byte(k+"-data")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.DeleteSaved("searches", "c"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Purge(Policy{}, false); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var got []string
+	err = s.EachSaved("searches", func(key string, data []byte) error {
+		got = append(got, key+"="+string(data))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a=a-data", "b=b-data"}; !slices.Equal(got, want) {
+		t.Errorf("saved = %v, want %v", got, want)
+	}
+	if err := s.EachSaved("products", func(string, []byte) error { return errors.New("called") }); err != nil {
+		t.Errorf("empty collection: %v", err)
+	}
+}
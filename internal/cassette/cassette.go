@@ -0,0 +1,257 @@
+// Package cassette records HTTP interactions to disk and replays them, so
+// scrapes can be reproduced offline and deterministically.
+package cassette
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Interaction is one recorded request/response pair as stored on disk.
+type Interaction struct {
+	Key      string   `json:"key"`
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is the recorded (redacted) request.
+type Request struct {
+	Method    string          `json:"method"`
+	URL       string          `json:"url"`
+	Header    http.Header     `json:"header,omitempty"`
+	Operation string          `json:"operation,omitempty"` // GraphQL operationName
+	Variables json.RawMessage `json:"variables,omitempty"` // GraphQL variables
+	Body      string          `json:"body,omitempty"`
+}
+
+// Response is the recorded (decompressed, redacted) response.
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body"`
+	BodyBase64 bool        `json:"body_base64,omitempty"` // Body holds base64 for non-UTF-8 payloads
+}
+
+// redactedHeaders never reach disk with their real values.
+var redactedHeaders = []string{
+	"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie",
+	"X-Api-Key", "X-Auth-Token",
+}
+
+// redactedParams are query parameters whose values are scrubbed from URLs.
+var redactedParams = []string{"token", "access_token", "api_key", "apikey", "key", "password", "sig", "signature"}
+
+const redacted = "REDACTED"
+
+// volatileParams are per-install identifiers a client generates afresh on
+// each run. They are left out of the match key of GraphQL variables holding
+// a query string, so recordings replay across runs.
+var volatileParams = []string{"unique_id"}
+
+// matchKey identifies a request for replay: method, normalised URL and, for
+// GraphQL, the operation name and variables. Other bodies are matched by hash.
+func matchKey(method string, u *url.URL, body []byte) (key, operation string, variables json.RawMessage) {
+	nu := *u
+	nu.User = nil
+	nu.Fragment = ""
+	q := nu.Query()
+	for _, p := range redactedParams {
+		if q.Has(p) {
+			q.Set(p, redacted)
+		}
+	}
+	nu.RawQuery = q.Encode() // sorted
+	key = method + " " + nu.String()
+
+	if len(body) == 0 {
+		return key, "", nil
+	}
+	if op, vars, ok := graphQLOperation(body); ok {
+		return key + " op=" + op + " vars=" + string(vars), op, vars
+	}
+	sum := sha256.Sum256(body)
+	return key + " body=" + hex.EncodeToString(sum[:8]), "", nil
+}
+
+// graphQLOperation extracts operationName and canonical variables from a
+// GraphQL payload sent either as a single object or a batch array.
+func graphQLOperation(body []byte) (string, json.RawMessage, bool) {
+	type gqlReq struct {
+		OperationName string         `json:"operationName"`
+		Variables     map[string]any `json:"variables"`
+	}
+	var reqs []gqlReq
+	if err := json.Unmarshal(body, &reqs); err != nil {
+		var single gqlReq
+		if err := json.Unmarshal(body, &single); err != nil {
+			return "", nil, false
+		}
+		reqs = []gqlReq{single}
+	}
+	if len(reqs) == 0 || reqs[0].OperationName == "" {
+		return "", nil, false
+	}
+	ops := make([]string, len(reqs))
+	vars := make([]map[string]any, len(reqs))
+	for i, r := range reqs {
+		ops[i] = r.OperationName
+		vars[i] = r.Variables
+		dropVolatile(r.Variables)
+	}
+	// json.Marshal sorts map keys, giving a canonical form.
+	canon, err := json.Marshal(vars)
+	if err != nil {
+		return "", nil, false
+	}
+	return strings.Join(ops, ","), canon, true
+}
+
+// dropVolatile removes volatileParams from the query-string values of vars.
+func dropVolatile(vars map[string]any) {
+	for k, v := range vars {
+		s, ok := v.(string)
+		if !ok || !strings.Contains(s, "=") {
+			continue
+		}
+		q, err := url.ParseQuery(s)
+		if err != nil {
+			continue
+		}
+		changed := false
+		for _, p := range volatileParams {
+			if q.Has(p) {
+				q.Del(p)
+				changed = true
+			}
+		}
+		if changed {
+			vars[k] = q.Encode()
+		}
+	}
+}
+
+// fileName returns the cassette file for the n-th recording of key.
+func fileName(dir, key string, n int) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(dir, fmt.Sprintf("%s-%03d.json", hex.EncodeToString(sum[:8]), n))
+}
+
+func readInteraction(path string) (*Interaction, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var it Interaction
+	if err := json.Unmarshal(data, &it); err != nil {
+		return nil, fmt.Errorf("parse cassette %s: %w", path, err)
+	}
+	return &it, nil
+}
+
+func encodeBody(b []byte) (string, bool) {
+	if utf8.Valid(b) {
+		return string(b), false
+	}
+	return base64.StdEncoding.EncodeToString(b), true
+}
+
+func decodeBody(r Response) ([]byte, error) {
+	if r.BodyBase64 {
+		return base64.StdEncoding.DecodeString(r.Body)
+	}
+	return []byte(r.Body), nil
+}
+
+// Redactor scrubs secrets from recorded data.
+type Redactor struct {
+	secrets [][]byte
+}
+
+// NewRedactor creates a Redactor that additionally replaces every occurrence
+// of the given literal secrets (proxy credentials, API keys) wherever they appear.
+func NewRedactor(secrets ...string) *Redactor {
+	r := &Redactor{}
+	for _, s := range secrets {
+		if len(s) >= 4 { // avoid scrubbing trivially short strings everywhere
+			r.secrets = append(r.secrets, []byte(s))
+		}
+	}
+	sort.Slice(r.secrets, func(i, j int) bool { return len(r.secrets[i]) > len(r.secrets[j]) })
+	return r
+}
+
+func (r *Redactor) bytes(b []byte) []byte {
+	for _, s := range r.secrets {
+		b = bytes.ReplaceAll(b, s, []byte(redacted))
+	}
+	return b
+}
+
+func (r *Redactor) string(s string) string {
+	return string(r.bytes([]byte(s)))
+}
+
+func (r *Redactor) header(h http.Header) http.Header {
+	out := make(http.Header, len(h))
+	for k, vals := range h {
+		cp := make([]string, len(vals))
+		for i, v := range vals {
+			cp[i] = r.string(v)
+		}
+		out[k] = cp
+	}
+	for _, k := range redactedHeaders {
+		if _, ok := out[k]; ok {
+			out.Set(k, redacted)
+		}
+	}
+	// Keep cookie names, so a cassette shows which cookies were exchanged.
+	if vals := h.Values("Cookie"); len(vals) > 0 {
+		var names []string
+		for _, v := range vals {
+			for _, c := range strings.Split(v, ";") {
+				names = append(names, cookieName(c)+"="+redacted)
+			}
+		}
+		out.Set("Cookie", strings.Join(names, "; "))
+	}
+	if vals := h.Values("Set-Cookie"); len(vals) > 0 {
+		out.Del("Set-Cookie")
+		for _, v := range vals {
+			out.Add("Set-Cookie", cookieName(v)+"="+redacted)
+		}
+	}
+	return out
+}
+
+// cookieName returns the name of a Cookie pair or Set-Cookie value.
+func cookieName(s string) string {
+	name, _, _ := strings.Cut(s, "=")
+	return strings.TrimSpace(name)
+}
+
+func (r *Redactor) url(u *url.URL) string {
+	nu := *u
+	if nu.User != nil {
+		nu.User = url.User(redacted)
+	}
+	q := nu.Query()
+	for _, p := range redactedParams {
+		if q.Has(p) {
+			q.Set(p, redacted)
+		}
+	}
+	nu.RawQuery = q.Encode()
+	return r.string(nu.String())
+}
@@ -0,0 +1,93 @@
+package cassette
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRedactorHeader(t *testing.T) {
+	h := http.Header{}
+	h.Set("User-Agent", "Mozilla/5.0")
+	h.Set("Authorization", "Bearer s3cret-token")
+	h.Set("Cookie", "_SID=abc; local_cache=%7B%7D")
+	h.Add("Set-Cookie", "_SID=def; Path=/; HttpOnly")
+	h.Set("X-Trace", "proxy-pass-1234")
+
+	got := NewRedactor("pass-1234").header(h)
+	want := map[string]string{
+		"User-Agent":    "Mozilla/5.0",
+		"Authorization": redacted,
+		"Cookie":        "_SID=REDACTED; local_cache=REDACTED",
+		"Set-Cookie":    "_SID=REDACTED",
+		"X-Trace":       "proxy-REDACTED",
+	}
+	for k, v := range want {
+		if got.Get(k) != v {
+			t.Errorf("%s = %q, want %q", k, got.Get(k), v)
+		}
+	}
+}
+
+func TestMatchKeyIgnoresVolatileParams(t *testing.T) {
+	u, _ := url.Parse("https://gql.example/graphql")
+	body := func(uniqueID string) []byte {
+		return []byte(`[{"operationName":"Search","variables":{"params":"q=boneka&unique_id=` + uniqueID + `&page=1"}}]`)
+	}
+	a, op, _ := matchKey("POST", u, body("aaaa"))
+	b, _, _ := matchKey("POST", u, body("bbbb"))
+	if op != "Search" {
+		t.Errorf("operation = %q", op)
+	}
+	if a != b {
+		t.Errorf("keys differ by unique_id:\n%s\n%s", a, b)
+	}
+	c, _, _ := matchKey("POST", u, []byte(`[{"operationName":"Search","variables":{"params":"q=boneka&page=2"}}]`))
+	if a == c {
+		t.Error("keys equal across pages")
+	}
+}
+
+func TestRecordReplay(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "page "+r.URL.Query().Get("page")+" for "+r.Header.Get("User-Agent"))
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+
+	rec, err := NewRecorder(dir, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Headers added below the recorder, as StealthTransport adds them.
+	addUA := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		req.Header.Set("User-Agent", "profile-ua")
+		return rec.Via(http.DefaultTransport).RoundTrip(req)
+	})
+	resp, err := (&http.Client{Transport: addUA}).Get(srv.URL + "/search?page=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	rp, err := NewReplayer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: rp}
+	resp, err = client.Get(srv.URL + "/search?page=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if got := string(data); got != "page 1 for profile-ua" {
+		t.Errorf("replayed %q", got)
+	}
+	if _, err := client.Get(srv.URL + "/search?page=2"); err == nil || !strings.Contains(err.Error(), "cassette:") {
+		t.Errorf("unrecorded request: err = %v, want a cassette error", err)
+	}
+}
@@ -0,0 +1,148 @@
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/lukman83/kidkazz-scrap/internal/httputil"
+)
+
+// Recorder is an http.RoundTripper that forwards requests to Next and writes
+// each interaction to Dir. Responses are stored decompressed and redacted.
+//
+// A transport that adds headers of its own records what it actually sends
+// by wrapping its innermost transport with Via instead of using Next.
+type Recorder struct {
+	Dir      string
+	Next     http.RoundTripper
+	Redactor *Redactor
+
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// NewRecorder creates a Recorder writing to dir, which is created if missing.
+func NewRecorder(dir string, next http.RoundTripper, redactor *Redactor) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create cassette dir: %w", err)
+	}
+	if redactor == nil {
+		redactor = NewRedactor()
+	}
+	return &Recorder{Dir: dir, Next: next, Redactor: redactor, counts: make(map[string]int)}, nil
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	return r.record(req, r.Next)
+}
+
+// Via returns a RoundTripper that sends requests with next and records them
+// to r's cassette.
+func (r *Recorder) Via(next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return r.record(req, next)
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func (r *Recorder) record(req *http.Request, next http.RoundTripper) (*http.Response, error) {
+	reqBody, err := snapshotBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decompress so the cassette is readable and replay needs no encoding logic.
+	body, err := httputil.ReadBody(resp)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("cassette: read response: %w", err)
+	}
+	header := resp.Header.Clone()
+	header.Del("Content-Encoding")
+	header.Del("Content-Length")
+
+	key, op, vars := matchKey(req.Method, req.URL, reqBody)
+	respBody, b64 := encodeBody(r.Redactor.bytes(body))
+	it := Interaction{
+		Key: r.Redactor.string(key),
+		Request: Request{
+			Method:    req.Method,
+			URL:       r.Redactor.url(req.URL),
+			Header:    r.Redactor.header(req.Header),
+			Operation: op,
+			Variables: vars,
+		},
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Header:     r.Redactor.header(header),
+			Body:       respBody,
+			BodyBase64: b64,
+		},
+	}
+	if op == "" && len(reqBody) > 0 {
+		it.Request.Body = r.Redactor.string(string(reqBody))
+	}
+	if err := r.write(key, &it); err != nil {
+		return nil, err
+	}
+
+	resp.Header = header
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Uncompressed = true
+	return resp, nil
+}
+
+func (r *Recorder) write(key string, it *Interaction) error {
+	r.mu.Lock()
+	n := r.counts[key]
+	r.counts[key] = n + 1
+	r.mu.Unlock()
+
+	data, err := json.MarshalIndent(it, "", "  ")
+	if err != nil {
+		return fmt.Errorf("cassette: encode: %w", err)
+	}
+	if err := os.WriteFile(fileName(r.Dir, key, n), data, 0o644); err != nil {
+		return fmt.Errorf("cassette: write: %w", err)
+	}
+	return nil
+}
+
+// snapshotBody reads the request body for keying and restores it for sending.
+func snapshotBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if req.GetBody != nil {
+		rc, err := req.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("cassette: copy request body: %w", err)
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("cassette: read request body: %w", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
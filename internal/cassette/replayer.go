@@ -0,0 +1,92 @@
+package cassette
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// Replayer is an http.RoundTripper that serves responses from a cassette
+// directory written by Recorder and never touches the network. Repeated
+// identical requests replay successive recordings, then keep returning the last.
+type Replayer struct {
+	Dir string
+
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// NewReplayer creates a Replayer reading from dir.
+func NewReplayer(dir string) (*Replayer, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("open cassette dir: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("cassette path %s is not a directory", dir)
+	}
+	return &Replayer{Dir: dir, counts: make(map[string]int)}, nil
+}
+
+func (p *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := snapshotBody(req)
+	if err != nil {
+		return nil, err
+	}
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	key, op, _ := matchKey(req.Method, req.URL, body)
+
+	p.mu.Lock()
+	n := p.counts[key]
+	p.counts[key] = n + 1
+	p.mu.Unlock()
+
+	it, err := p.load(key, n)
+	if err != nil {
+		if op != "" {
+			return nil, fmt.Errorf("cassette: %s %s (operation %s): %w", req.Method, req.URL.Redacted(), op, err)
+		}
+		return nil, fmt.Errorf("cassette: %s %s: %w", req.Method, req.URL.Redacted(), err)
+	}
+
+	respBody, err := decodeBody(it.Response)
+	if err != nil {
+		return nil, fmt.Errorf("cassette: decode body: %w", err)
+	}
+	header := it.Response.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", it.Response.StatusCode, http.StatusText(it.Response.StatusCode)),
+		StatusCode:    it.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(respBody)),
+		ContentLength: int64(len(respBody)),
+		Request:       req,
+	}, nil
+}
+
+// load returns the n-th recording for key, falling back to the latest one.
+func (p *Replayer) load(key string, n int) (*Interaction, error) {
+	for i := n; i >= 0; i-- {
+		it, err := readInteraction(fileName(p.Dir, key, i))
+		if err == nil {
+			return it, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, errors.New("no recording found")
+}
@@ -0,0 +1,372 @@
+// Package compare answers "where is this cheapest?": it searches a keyword
+// on one or more platforms, drops ads and reports price statistics over the
+// offers, with the cheapest credible ones. It backs the compare command and
+// the compare_prices MCP tool.
+package compare
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lukman83/kidkazz-scrap/internal/models"
+	"github.com/lukman83/kidkazz-scrap/internal/platform"
+)
+
+// Defaults for Options. The credibility bar matches the MCP prompts'.
+const (
+	DefaultLimit      = 60
+	DefaultMinReviews = 10
+	DefaultMinRating  = 4.5
+	DefaultTop        = 5
+)
+
+// Upper bounds of Options, so that one comparison stays a handful of
+// searches.
+const (
+	MaxPages = 5
+	MaxLimit = 100
+	MaxTop   = 50
+)
+
+// Options configures a comparison. Zero Platforms, Pages, Limit and Top take
+// the defaults; MinReviews and MinRating apply as given, so 0 disables them.
+//
+// Shop reputation is not scraped: a non-official offer is credible on its
+// product's rating instead.
+type Options struct {
+	Platforms  []string // default: tokopedia
+	Pages      int      // result pages searched per platform; default 1, at most MaxPages
+	Limit      int      // products per page; at most MaxLimit
+	Location   string   // buyer location the prices apply to
+	MinReviews int      // reviews a credible offer needs
+	MinRating  float64  // product rating a non-official credible offer needs
+	Top        int      // cheapest credible offers listed; at most MaxTop
+}
+
+// check rejects counts outside their bounds.
+func (o Options) check() error {
+	for _, c := range []struct {
+		name  string
+		value int
+		bound int
+	}{
+		{"pages", o.Pages, MaxPages},
+		{"limit", o.Limit, MaxLimit},
+		{"top", o.Top, MaxTop},
+	} {
+		if c.value < 0 || c.value > c.bound {
+			return fmt.Errorf("%s must be between 0 (default) and %d, got %d", c.name, c.bound, c.value)
+		}
+	}
+	return nil
+}
+
+func (o *Options) defaults() {
+	if len(o.Platforms) == 0 {
+		o.Platforms = []string{"tokopedia"}
+	}
+	if o.Pages <= 0 {
+		o.Pages = 1
+	}
+	if o.Limit <= 0 {
+		o.Limit = DefaultLimit
+	}
+	if o.Top <= 0 {
+		o.Top = DefaultTop
+	}
+}
+
+// ParsePlatforms parses a comma-separated platform list. "all" is every
+// registered platform; "" is the default.
+func ParsePlatforms(spec string) []string {
+	if strings.TrimSpace(spec) == "all" {
+		names := platform.List()
+		slices.Sort(names)
+		return names
+	}
+	var names []string
+	for _, name := range strings.Split(spec, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Report is the result of a comparison. Prices are in Rupiah.
+type Report struct {
+	Query       string           `json:"query" jsonschema_description:"Search keyword"`
+	Location    string           `json:"location,omitempty" jsonschema_description:"Buyer location the prices apply to"`
+	Platforms   []PlatformResult `json:"platforms" jsonschema_description:"What was searched on each platform"`
+	Offers      int              `json:"offers" jsonschema_description:"Non-ad offers with a price, across platforms"`
+	FilteredAds int              `json:"filtered_ads" jsonschema_description:"Ads excluded from every statistic"`
+	Effective   *Stats           `json:"effective_price,omitempty" jsonschema_description:"Price paid after discounts, over every offer"`
+	List        *Stats           `json:"list_price,omitempty" jsonschema_description:"Price before discounts, over every offer"`
+	Official    *Stats           `json:"official,omitempty" jsonschema_description:"Effective price over official-store offers"`
+	NonOfficial *Stats           `json:"non_official,omitempty" jsonschema_description:"Effective price over the other offers"`
+	Duplicates  int              `json:"duplicates" jsonschema_description:"Repeated listings dropped: the same product on two pages or platforms"`
+	Discounted  int              `json:"discounted" jsonschema_description:"Offers with a discount"`
+	MinReviews  int              `json:"min_reviews" jsonschema_description:"Reviews a credible offer needs"`
+	MinRating   float64          `json:"min_rating" jsonschema_description:"Product rating a non-official credible offer needs, standing in for shop reputation, which is not scraped"`
+	CredibleBar string           `json:"credible_bar" jsonschema_description:"The rule an offer met to count as credible"`
+	Credible    int              `json:"credible" jsonschema_description:"Offers meeting the credibility bar"`
+	Cheapest    []Offer          `json:"cheapest_credible" jsonschema_description:"Cheapest credible offers, cheapest first"`
+	Warnings    []string         `json:"warnings" jsonschema_description:"Failed platforms or strategies, stale cache and other caveats"`
+	ComparedAt  time.Time        `json:"compared_at"`
+}
+
+// PlatformResult is what a comparison searched on one platform.
+type PlatformResult struct {
+	Platform     string `json:"platform"`
+	StrategyUsed string `json:"strategy_used,omitempty"`
+	TotalData    int    `json:"total_data" jsonschema_description:"Products matching on the platform; 0 if not reported"`
+	Products     int    `json:"products" jsonschema_description:"Products scraped, ads included"`
+	Error        string `json:"error,omitempty"`
+}
+
+// Stats summarizes a set of prices.
+type Stats struct {
+	Count  int   `json:"count"`
+	Min    int64 `json:"min"`
+	P25    int64 `json:"p25"`
+	Median int64 `json:"median"`
+	P75    int64 `json:"p75"`
+	Max    int64 `json:"max"`
+}
+
+// Offer is one product listing in a comparison.
+type Offer struct {
+	Platform       string  `json:"platform"`
+	Name           string  `json:"name"`
+	URL            string  `json:"url"`
+	Shop           string  `json:"shop"`
+	City           string  `json:"city,omitempty"`
+	Official       bool    `json:"official"`
+	ListPrice      int64   `json:"list_price" jsonschema_description:"Price before discount"`
+	Discount       int     `json:"discount_percent,omitempty"`
+	EffectivePrice int64   `json:"effective_price" jsonschema_description:"Price paid after discount"`
+	Rating         float64 `json:"rating,omitempty"`
+	Reviews        int     `json:"reviews"`
+	Sold           int     `json:"sold,omitempty"`
+}
+
+// Compare searches query on every platform in opts and reports on the
+// offers. It fails only when every platform does.
+func Compare(ctx context.Context, query string, opts Options) (*Report, error) {
+	if err := opts.check(); err != nil {
+		return nil, err
+	}
+	opts.defaults()
+	r := &Report{
+		Query:       query,
+		Location:    opts.Location,
+		MinReviews:  opts.MinReviews,
+		MinRating:   opts.MinRating,
+		CredibleBar: CredibleBar(opts.MinReviews, opts.MinRating),
+		Cheapest:    []Offer{},
+		Warnings:    []string{},
+	}
+
+	var offers []Offer
+	var errs []error
+	seen := make(map[string]bool)
+	for _, name := range opts.Platforms {
+		pr, products, warnings, err := search(ctx, name, query, opts)
+		r.Warnings = append(r.Warnings, warnings...)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			pr.Error = err.Error()
+			r.Warnings = append(r.Warnings, fmt.Sprintf("%s failed: %v", name, err))
+		}
+		r.Platforms = append(r.Platforms, pr)
+
+		kept := models.FilterAds(products)
+		r.FilteredAds += len(products) - len(kept)
+		for _, p := range kept {
+			o := offerOf(name, p)
+			if o.EffectivePrice <= 0 {
+				continue
+			}
+			keys := offerKeys(name, p)
+			if slices.ContainsFunc(keys, func(k string) bool { return seen[k] }) {
+				r.Duplicates++
+				continue
+			}
+			for _, k := range keys {
+				seen[k] = true
+			}
+			offers = append(offers, o)
+		}
+	}
+	if len(errs) == len(opts.Platforms) {
+		return nil, errors.Join(errs...)
+	}
+
+	r.Offers = len(offers)
+	var effective, list, official, nonOfficial []int64
+	var credible []Offer
+	for _, o := range offers {
+		effective = append(effective, o.EffectivePrice)
+		list = append(list, o.ListPrice)
+		if o.Official {
+			official = append(official, o.EffectivePrice)
+		} else {
+			nonOfficial = append(nonOfficial, o.EffectivePrice)
+		}
+		if o.EffectivePrice < o.ListPrice {
+			r.Discounted++
+		}
+		if credibleOffer(o, opts) {
+			credible = append(credible, o)
+		}
+	}
+	r.Effective = statsOf(effective)
+	r.List = statsOf(list)
+	r.Official = statsOf(official)
+	r.NonOfficial = statsOf(nonOfficial)
+
+	r.Credible = len(credible)
+	slices.SortStableFunc(credible, func(a, b Offer) int {
+		return cmp.Or(cmp.Compare(a.EffectivePrice, b.EffectivePrice), cmp.Compare(b.Reviews, a.Reviews))
+	})
+	r.Cheapest = append(r.Cheapest, credible[:min(opts.Top, len(credible))]...)
+	r.ComparedAt = time.Now()
+	return r, nil
+}
+
+// credibleOffer reports whether o has opts.MinReviews reviews and comes from
+// an official store or, for lack of a scraped shop reputation, has a product
+// rating of opts.MinRating.
+func credibleOffer(o Offer, opts Options) bool {
+	return o.Reviews >= opts.MinReviews && (o.Official || o.Rating >= opts.MinRating)
+}
+
+// CredibleBar describes the credibility rule for minReviews and minRating.
+func CredibleBar(minReviews int, minRating float64) string {
+	return fmt.Sprintf("%d+ reviews, and an official store or a product rated %.1f+ "+
+		"(product rating stands in for shop reputation, which is not scraped)", minReviews, minRating)
+}
+
+// offerKeys identifies the listing of p on the named platform: by product
+// ID and by URL without its query, so a listing seen twice (on two result
+// pages, or on two platforms) counts once.
+func offerKeys(platformName string, p models.Product) []string {
+	var keys []string
+	if p.ID != "" {
+		keys = append(keys, "id:"+platformName+"/"+p.ID)
+	}
+	if u, err := url.Parse(p.URL); err == nil && u.Host != "" {
+		keys = append(keys, "url:"+strings.ToLower(u.Host)+strings.TrimSuffix(u.Path, "/"))
+	}
+	return keys
+}
+
+// search scrapes opts.Pages pages of query on the named platform, stopping
+// at the last page, and returns the warnings the scrapes recorded.
+func search(ctx context.Context, name, query string, opts Options) (pr PlatformResult, all []models.Product, warnings []string, err error) {
+	pr = PlatformResult{Platform: name}
+	scraper, err := platform.Get(name)
+	if err != nil {
+		return pr, nil, nil, err
+	}
+
+	for page := 1; page <= opts.Pages; page++ {
+		platform.ReportProgress(ctx, fmt.Sprintf("Searching '%s' on %s, page %d...", query, name, page))
+		pageCtx, info := platform.WithResultInfo(ctx)
+		products, err := scraper.Search(pageCtx, query, platform.SearchOpts{
+			Page:     page,
+			Limit:    opts.Limit,
+			Location: opts.Location,
+		})
+		ri := info()
+		warnings = append(warnings, ri.Warnings...)
+		if err != nil {
+			if len(all) == 0 {
+				return pr, nil, warnings, err
+			}
+			// Keep the pages already scraped.
+			warnings = append(warnings, fmt.Sprintf("%s page %d failed: %v", name, page, err))
+			break
+		}
+		if page == 1 {
+			pr.StrategyUsed, pr.TotalData = ri.Strategy, ri.TotalData
+		}
+		all = append(all, products...)
+		if len(products) < opts.Limit || (ri.TotalData > 0 && page*opts.Limit >= ri.TotalData) {
+			break
+		}
+	}
+	pr.Products = len(all)
+	return pr, all, warnings, nil
+}
+
+// offerOf returns p as an offer. The scraped price is already discounted;
+// when only the original price and discount are known, the effective price
+// is derived from them.
+func offerOf(platformName string, p models.Product) Offer {
+	o := Offer{
+		Platform:       platformName,
+		Name:           p.Name,
+		URL:            p.URL,
+		Shop:           p.Shop.Name,
+		City:           p.Shop.City,
+		Official:       p.Shop.IsOfficial,
+		ListPrice:      max(p.OriginalPrice, p.Price),
+		EffectivePrice: p.Price,
+		Rating:         p.Rating,
+		Reviews:        p.ReviewCount,
+		Sold:           p.SoldCount,
+	}
+	if o.EffectivePrice == 0 && p.OriginalPrice > 0 {
+		o.EffectivePrice = p.OriginalPrice * int64(100-p.DiscountPercent) / 100
+	}
+	o.Discount = DiscountPercent(o.ListPrice, o.EffectivePrice)
+	return o
+}
+
+// DiscountPercent returns how much cheaper effective is than list, rounded
+// to whole percent. It is computed from the two prices, since the scraped
+// discount can be missing or out of date.
+func DiscountPercent(list, effective int64) int {
+	if list <= 0 || effective >= list {
+		return 0
+	}
+	return int(math.Round(100 * float64(list-effective) / float64(list)))
+}
+
+// statsOf returns the statistics of prices, or nil if there are none.
+// Quartiles interpolate linearly between the closest ranks.
+func statsOf(prices []int64) *Stats {
+	if len(prices) == 0 {
+		return nil
+	}
+	sorted := slices.Sorted(slices.Values(prices))
+	return &Stats{
+		Count:  len(sorted),
+		Min:    sorted[0],
+		P25:    quantile(sorted, 0.25),
+		Median: quantile(sorted, 0.5),
+		P75:    quantile(sorted, 0.75),
+		Max:    sorted[len(sorted)-1],
+	}
+}
+
+func quantile(sorted []int64, q float64) int64 {
+	pos := q * float64(len(sorted)-1)
+	lo := int(pos)
+	if lo+1 >= len(sorted) {
+		return sorted[lo]
+	}
+	frac := pos - float64(lo)
+	return int64(math.Round(float64(sorted[lo]) + frac*float64(sorted[lo+1]-sorted[lo])))
+}
@@ -0,0 +1,187 @@
+package compare
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/lukman83/kidkazz-scrap/internal/models"
+	"github.com/lukman83/kidkazz-scrap/internal/platform"
+)
+
+func TestQuantile(t *testing.T) {
+	tests := []struct {
+		name   string
+		sorted []int64
+		q      float64
+		want   int64
+	}{
+		{"single", []int64{100}, 0.5, 100},
+		{"odd median", []int64{10, 20, 30}, 0.5, 20},
+		{"even median", []int64{10, 20, 30, 40}, 0.5, 25},
+		{"interpolated quartile", []int64{10, 20, 30, 40}, 0.25, 18},
+		{"min", []int64{10, 20, 30, 40}, 0, 10},
+		{"max", []int64{10, 20, 30, 40}, 1, 40},
+		{"rounded", []int64{1, 2}, 0.25, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := quantile(tt.sorted, tt.q); got != tt.want {
+				t.Errorf("quantile(%v, %v) = %d, want %d", tt.sorted, tt.q, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatsOf(t *testing.T) {
+	if s := statsOf(nil); s != nil {
+		t.Errorf("statsOf(nil) = %+v, want nil", s)
+	}
+	got := statsOf([]int64{50, 10, 40, 20, 30})
+	want := Stats{Count: 5, Min: 10, P25: 20, Median: 30, P75: 40, Max: 50}
+	if *got != want {
+		t.Errorf("got %+v, want %+v", *got, want)
+	}
+}
+
+func TestOfferOf(t *testing.T) {
+	tests := []struct {
+		name      string
+		p         models.Product
+		list      int64
+		effective int64
+		discount  int
+	}{
+		{"no discount", models.Product{Price: 100_000}, 100_000, 100_000, 0},
+		{"discounted", models.Product{Price: 80_000, OriginalPrice: 100_000, DiscountPercent: 20}, 100_000, 80_000, 20},
+		{"stale scraped discount", models.Product{Price: 70_000, OriginalPrice: 100_000, DiscountPercent: 20}, 100_000, 70_000, 30},
+		{"price derived from discount", models.Product{OriginalPrice: 100_000, DiscountPercent: 25}, 100_000, 75_000, 25},
+		{"no price", models.Product{}, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := offerOf("tokopedia", tt.p)
+			if o.ListPrice != tt.list || o.EffectivePrice != tt.effective || o.Discount != tt.discount {
+				t.Errorf("list, effective, discount = %d, %d, %d; want %d, %d, %d", o.ListPrice, o.EffectivePrice, o.Discount, tt.list, tt.effective, tt.discount)
+			}
+			if o.Platform != "tokopedia" {
+				t.Errorf("platform = %q", o.Platform)
+			}
+		})
+	}
+}
+
+func TestDiscountPercent(t *testing.T) {
+	tests := []struct {
+		list, effective int64
+		want            int
+	}{
+		{100_000, 80_000, 20},
+		{100_000, 99_900, 0}, // rounds to nothing: no "-0%"
+		{100_000, 99_400, 1},
+		{100_000, 100_000, 0},
+		{0, 50_000, 0},
+	}
+	for _, tt := range tests {
+		if got := DiscountPercent(tt.list, tt.effective); got != tt.want {
+			t.Errorf("DiscountPercent(%d, %d) = %d, want %d", tt.list, tt.effective, got, tt.want)
+		}
+	}
+}
+
+func TestCredibleOffer(t *testing.T) {
+	opts := Options{MinReviews: 10, MinRating: 4.5}
+	tests := []struct {
+		name string
+		o    Offer
+		want bool
+	}{
+		{"official, few stars", Offer{Official: true, Reviews: 10, Rating: 3.0}, true},
+		{"official, too few reviews", Offer{Official: true, Reviews: 9, Rating: 5.0}, false},
+		{"other shop, rated product", Offer{Reviews: 50, Rating: 4.5}, true},
+		{"other shop, low rating", Offer{Reviews: 500, Rating: 4.4}, false},
+		{"other shop, unrated", Offer{Reviews: 10}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := credibleOffer(tt.o, opts); got != tt.want {
+				t.Errorf("credible = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if bar := CredibleBar(10, 4.5); !strings.Contains(bar, "10+ reviews") || !strings.Contains(bar, "not scraped") {
+		t.Errorf("CredibleBar = %q", bar)
+	}
+}
+
+// pagedScraper serves fixed result pages.
+type pagedScraper struct {
+	pages [][]models.Product
+}
+
+func (s *pagedScraper) Search(ctx context.Context, keyword string, opts platform.SearchOpts) ([]models.Product, error) {
+	if opts.Page > len(s.pages) {
+		return nil, nil
+	}
+	return s.pages[opts.Page-1], nil
+}
+
+func (s *pagedScraper) Trending(ctx context.Context, opts platform.TrendingOpts) ([]models.Product, error) {
+	return nil, nil
+}
+
+func (s *pagedScraper) ProductDetail(ctx context.Context, url string, opts platform.DetailOpts) (*models.Product, error) {
+	return nil, nil
+}
+
+func TestCompare(t *testing.T) {
+	offer := func(id, url string, price int64, reviews int, rating float64, official bool) models.Product {
+		return models.Product{ID: id, URL: url, Price: price, ReviewCount: reviews, Rating: rating, Shop: models.Shop{IsOfficial: official}}
+	}
+	platform.Register("compare-a", &pagedScraper{pages: [][]models.Product{
+		{
+			offer("1", "https://shop.example/a/susu?extParam=1", 90_000, 100, 4.9, false),
+			offer("2", "https://shop.example/b/susu", 80_000, 5, 5.0, true),   // too few reviews
+			offer("3", "https://shop.example/c/susu", 70_000, 40, 4.0, false), // rated too low
+			{ID: "4", Price: 10_000, IsAd: true},
+		},
+		{
+			// Page 2 repeats listing 1, with another tracking query.
+			offer("1", "https://shop.example/a/susu?extParam=2", 90_000, 100, 4.9, false),
+			offer("5", "https://shop.example/e/susu", 95_000, 12, 3.5, true),
+		},
+	}})
+	platform.Register("compare-b", &pagedScraper{pages: [][]models.Product{
+		// The same listing, reached through another platform.
+		{offer("x9", "https://SHOP.example/a/susu/", 90_000, 100, 4.9, false)},
+	}})
+
+	r, err := Compare(context.Background(), "susu", Options{
+		Platforms: []string{"compare-a", "compare-b"}, Pages: 2, Limit: 4, MinReviews: 10, MinRating: 4.5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Offers != 4 || r.Duplicates != 2 || r.FilteredAds != 1 {
+		t.Errorf("offers, duplicates, ads = %d, %d, %d; want 4, 2, 1", r.Offers, r.Duplicates, r.FilteredAds)
+	}
+	var cheapest []int64
+	for _, o := range r.Cheapest {
+		cheapest = append(cheapest, o.EffectivePrice)
+	}
+	if r.Credible != 2 || !slices.Equal(cheapest, []int64{90_000, 95_000}) {
+		t.Errorf("credible %d, cheapest %v; want 2, [90000 95000]", r.Credible, cheapest)
+	}
+	if r.CredibleBar == "" {
+		t.Error("report does not state its credibility bar")
+	}
+}
+
+func TestCompareBounds(t *testing.T) {
+	for _, opts := range []Options{{Pages: MaxPages + 1}, {Limit: MaxLimit + 1}, {Top: MaxTop + 1}, {Pages: -1}} {
+		if _, err := Compare(context.Background(), "susu", opts); err == nil {
+			t.Errorf("Compare(%+v): want an error", opts)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+// Package crawl identifies crawl sessions: the requests that should look
+// like one visitor to the site, sharing a browser profile, cookie jar,
+// warm-up and app install. A session is normally one crawl and takes its
+// request ID; a scrape shared between crawls runs under a request ID of its
+// own but keeps the session of the crawl that started it.
+package crawl
+
+import (
+	"context"
+
+	"github.com/lukman83/kidkazz-scrap/internal/logging"
+)
+
+type sessionKey struct{}
+
+// WithSession returns a context whose requests belong to session id.
+func WithSession(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, sessionKey{}, id)
+}
+
+// Session returns the session of ctx: the one set by WithSession, or else
+// ctx's request ID. It is "" when ctx carries neither.
+func Session(ctx context.Context) string {
+	if id, _ := ctx.Value(sessionKey{}).(string); id != "" {
+		return id
+	}
+	return logging.RequestIDFrom(ctx)
+}
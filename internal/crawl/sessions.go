@@ -0,0 +1,100 @@
+package crawl
+
+import (
+	"sync"
+	"time"
+)
+
+// SessionTTL is how long an idle session keeps its state: its browser
+// profile, cookie jar, warm-up and app install.
+const SessionTTL = 30 * time.Minute
+
+// sweepInterval is how often a SessionMap looks for idle sessions.
+const sweepInterval = time.Minute
+
+// SessionMap holds one value per session (or other per-crawl key) and
+// forgets the ones unused for its TTL. Idle entries are swept at most once
+// a minute, by Get. It is safe for concurrent use.
+type SessionMap[T any] struct {
+	ttl     time.Duration
+	expired func(id string, v T)
+
+	// Now is the map's clock; tests replace it before first use.
+	Now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*sessionEntry[T]
+	swept   time.Time
+}
+
+type sessionEntry[T any] struct {
+	v    T
+	seen time.Time
+}
+
+// NewSessionMap returns a map that forgets entries idle for ttl. expired,
+// if not nil, is called with each entry forgotten that way, from the Get
+// that swept it.
+func NewSessionMap[T any](ttl time.Duration, expired func(id string, v T)) *SessionMap[T] {
+	return &SessionMap[T]{ttl: ttl, expired: expired, Now: time.Now, entries: make(map[string]*sessionEntry[T])}
+}
+
+// Get returns the value of id, made by create on first use, and marks id
+// as used.
+func (m *SessionMap[T]) Get(id string, create func() T) T {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.Now()
+	if now.Sub(m.swept) > sweepInterval {
+		m.sweep(now)
+		m.swept = now
+	}
+	e, ok := m.entries[id]
+	if !ok {
+		e = &sessionEntry[T]{v: create()}
+		m.entries[id] = e
+	}
+	e.seen = now
+	return e.v
+}
+
+// sweep forgets the entries idle for longer than the TTL. m.mu must be held.
+func (m *SessionMap[T]) sweep(now time.Time) {
+	for id, e := range m.entries {
+		if now.Sub(e.seen) <= m.ttl {
+			continue
+		}
+		delete(m.entries, id)
+		if m.expired != nil {
+			m.expired(id, e.v)
+		}
+	}
+}
+
+// Peek returns the value of id without marking it as used.
+func (m *SessionMap[T]) Peek(id string) (T, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[id]
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	return e.v, true
+}
+
+// Delete forgets id.
+func (m *SessionMap[T]) Delete(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, id)
+}
+
+// Each calls fn with every entry, in no particular order. fn must not use m.
+func (m *SessionMap[T]) Each(fn func(id string, v T)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, e := range m.entries {
+		fn(id, e.v)
+	}
+}
@@ -0,0 +1,65 @@
+package crawl
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSessionMap(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var expired []string
+	m := NewSessionMap(10*time.Minute, func(id string, v int) {
+		expired = append(expired, id)
+	})
+	m.Now = func() time.Time { return now }
+	next := 0
+	create := func() int { next++; return next }
+
+	if a, b := m.Get("a", create), m.Get("b", create); a != 1 || b != 2 {
+		t.Fatalf("first use: a = %d, b = %d", a, b)
+	}
+	if a := m.Get("a", create); a != 1 {
+		t.Errorf("a recreated on its second use: %d", a)
+	}
+
+	// Peek does not keep b alive; Get keeps a alive.
+	now = now.Add(6 * time.Minute)
+	if b, ok := m.Peek("b"); !ok || b != 2 {
+		t.Errorf("Peek(b) = %d, %v", b, ok)
+	}
+	m.Get("a", create)
+	now = now.Add(6 * time.Minute)
+	m.Get("c", create)
+	if _, ok := m.Peek("b"); ok || !slices.Equal(expired, []string{"b"}) {
+		t.Errorf("after b's TTL: b kept %v, expired %q", ok, expired)
+	}
+	if _, ok := m.Peek("a"); !ok {
+		t.Error("a expired though used within its TTL")
+	}
+
+	// Sweeps run at most once a minute: a, idle since minute 6, outlives
+	// its TTL until the sweep after minute 15:50's.
+	now = now.Add(3*time.Minute + 50*time.Second)
+	m.Get("c", create)
+	now = now.Add(30 * time.Second)
+	m.Get("c", create)
+	if _, ok := m.Peek("a"); !ok {
+		t.Error("swept twice within a minute")
+	}
+	now = now.Add(40 * time.Second)
+	m.Get("c", create)
+	if _, ok := m.Peek("a"); ok || !slices.Equal(expired, []string{"b", "a"}) {
+		t.Errorf("a kept %v, expired %q; want b and a", ok, expired)
+	}
+
+	m.Delete("c")
+	var left []string
+	m.Each(func(id string, v int) { left = append(left, id) })
+	if len(left) != 0 {
+		t.Errorf("entries after Delete: %q", left)
+	}
+	if c := m.Get("c", create); c != 4 {
+		t.Errorf("deleted c reused its value: %d", c)
+	}
+}
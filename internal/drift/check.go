@@ -0,0 +1,116 @@
+package drift
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lukman83/kidkazz-scrap/internal/models"
+)
+
+// DefaultMaxEmpty is the fraction of products allowed to leave a checked field
+// empty before a fill-rate warning is raised.
+const DefaultMaxEmpty = 0.2
+
+// FillRule checks that a product field is populated across a batch.
+type FillRule struct {
+	Field    string
+	Filled   func(p models.Product) bool
+	MaxEmpty float64 // 0 means DefaultMaxEmpty
+}
+
+// FillRate is the outcome of one FillRule over a batch.
+type FillRate struct {
+	Field    string  `json:"field"`
+	Rate     float64 `json:"rate"`  // fraction of products with the field populated
+	Empty    int     `json:"empty"` // products with the field empty
+	MaxEmpty float64 `json:"max_empty"`
+	Warn     bool    `json:"warn"`
+}
+
+// Schema is what a source's payloads and parsed products are expected to look like.
+type Schema struct {
+	Name  string     // e.g. "graphql-search"
+	Shape Shape      // nil skips the shape comparison
+	Fill  []FillRule // fill-rate checks on the parsed products
+}
+
+// Report is the result of checking one batch.
+type Report struct {
+	Source    string     `json:"source"`
+	Schema    string     `json:"schema"`
+	Products  int        `json:"products"`
+	Findings  []Finding  `json:"findings,omitempty"`
+	FillRates []FillRate `json:"fill_rates,omitempty"`
+	Error     string     `json:"error,omitempty"` // payload could not be analysed
+	CheckedAt time.Time  `json:"checked_at"`
+}
+
+// Check compares raw against the schema's shape and computes fill-rates over products.
+func Check(source string, schema Schema, raw []byte, products []models.Product) Report {
+	r := Report{Source: source, Schema: schema.Name, Products: len(products), CheckedAt: time.Now()}
+	if schema.Shape != nil && len(raw) > 0 {
+		actual, err := Infer(raw)
+		if err != nil {
+			r.Error = err.Error()
+		} else {
+			r.Findings = Compare(schema.Shape, actual)
+		}
+	}
+	if len(products) > 0 {
+		r.FillRates = FillRates(products, schema.Fill)
+	}
+	return r
+}
+
+// FillRates evaluates rules over products.
+func FillRates(products []models.Product, rules []FillRule) []FillRate {
+	out := make([]FillRate, 0, len(rules))
+	for _, rule := range rules {
+		maxEmpty := rule.MaxEmpty
+		if maxEmpty <= 0 {
+			maxEmpty = DefaultMaxEmpty
+		}
+		empty := 0
+		for _, p := range products {
+			if !rule.Filled(p) {
+				empty++
+			}
+		}
+		emptyFrac := float64(empty) / float64(len(products))
+		out = append(out, FillRate{
+			Field:    rule.Field,
+			Rate:     1 - emptyFrac,
+			Empty:    empty,
+			MaxEmpty: maxEmpty,
+			Warn:     emptyFrac > maxEmpty,
+		})
+	}
+	return out
+}
+
+// Warnings returns the problems worth acting on: missing and type-changed
+// fields, fill-rates over their threshold, and analysis errors. Unknown
+// fields are informational and not included.
+func (r Report) Warnings() []string {
+	var out []string
+	if r.Error != "" {
+		out = append(out, r.Error)
+	}
+	for _, f := range r.Findings {
+		if f.Kind != FindingUnknown {
+			out = append(out, f.String())
+		}
+	}
+	for _, fr := range r.FillRates {
+		if fr.Warn {
+			out = append(out, fmt.Sprintf("%d/%d products have empty %s (%.0f%% > %.0f%%)",
+				fr.Empty, r.Products, fr.Field, (1-fr.Rate)*100, fr.MaxEmpty*100))
+		}
+	}
+	return out
+}
+
+// OK reports whether the batch raised no warnings.
+func (r Report) OK() bool {
+	return len(r.Warnings()) == 0
+}
@@ -0,0 +1,127 @@
+package drift
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Monitor accumulates drift reports per source so long-running processes can
+// expose them. It is safe for concurrent use.
+type Monitor struct {
+	mu      sync.Mutex
+	sources map[string]*sourceStats
+}
+
+type sourceStats struct {
+	checks       int
+	warnBatches  int
+	findings     map[FindingKind]int
+	fillWarnings map[string]int
+	fillRates    map[string]float64 // most recent rate per field
+	seen         map[string]bool    // distinct findings already returned by Record
+	last         time.Time
+	lastWarnings []string
+}
+
+// Stats is a point-in-time summary of the drift seen for one source.
+type Stats struct {
+	Source         string              `json:"source"`
+	Checks         int                 `json:"checks"`
+	WarningBatches int                 `json:"warning_batches"`
+	Findings       map[FindingKind]int `json:"findings"`
+	FillWarnings   map[string]int      `json:"fill_warnings"`
+	FillRates      map[string]float64  `json:"fill_rates"`
+	LastChecked    time.Time           `json:"last_checked"`
+	LastWarnings   []string            `json:"last_warnings,omitempty"`
+}
+
+// NewMonitor creates an empty Monitor.
+func NewMonitor() *Monitor {
+	return &Monitor{sources: make(map[string]*sourceStats)}
+}
+
+// Record adds a report and returns the findings not seen before for its
+// source, so callers can log each distinct change once.
+func (m *Monitor) Record(r Report) []Finding {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sources[r.Source]
+	if !ok {
+		s = &sourceStats{
+			findings:     make(map[FindingKind]int),
+			fillWarnings: make(map[string]int),
+			fillRates:    make(map[string]float64),
+			seen:         make(map[string]bool),
+		}
+		m.sources[r.Source] = s
+	}
+
+	var fresh []Finding
+	for _, f := range r.Findings {
+		if key := f.String(); !s.seen[key] {
+			s.seen[key] = true
+			fresh = append(fresh, f)
+		}
+		s.findings[f.Kind]++
+	}
+	for _, fr := range r.FillRates {
+		s.fillRates[fr.Field] = fr.Rate
+		if fr.Warn {
+			s.fillWarnings[fr.Field]++
+		}
+	}
+
+	s.checks++
+	s.last = r.CheckedAt
+	warnings := r.Warnings()
+	if len(warnings) > 0 {
+		s.warnBatches++
+		s.lastWarnings = warnings
+	}
+	return fresh
+}
+
+// Snapshot returns the stats of every source, sorted by name.
+func (m *Monitor) Snapshot() []Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make([]Stats, 0, len(m.sources))
+	for name, s := range m.sources {
+		st := Stats{
+			Source:         name,
+			Checks:         s.checks,
+			WarningBatches: s.warnBatches,
+			Findings:       make(map[FindingKind]int, len(s.findings)),
+			FillWarnings:   make(map[string]int, len(s.fillWarnings)),
+			FillRates:      make(map[string]float64, len(s.fillRates)),
+			LastChecked:    s.last,
+			LastWarnings:   append([]string(nil), s.lastWarnings...),
+		}
+		for k, v := range s.findings {
+			st.Findings[k] = v
+		}
+		for k, v := range s.fillWarnings {
+			st.FillWarnings[k] = v
+		}
+		for k, v := range s.fillRates {
+			st.FillRates[k] = v
+		}
+		out = append(out, st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Source < out[j].Source })
+	return out
+}
+
+// Reporter is implemented by scrapers that monitor their payloads for drift.
+type Reporter interface {
+	Drift() []Stats
+}
+
+// SelfChecker is implemented by scrapers that can probe their sources on demand.
+type SelfChecker interface {
+	SelfCheck(ctx context.Context, keyword string, strategies []string) ([]Report, error)
+}
@@ -0,0 +1,215 @@
+// Package drift detects changes in the shape of upstream payloads before they
+// turn into silently empty fields. A payload's Shape is compared against a
+// stored expected Shape, and the products parsed from it are checked for
+// field fill-rates.
+package drift
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Shape maps a JSON path to the type(s) found there. Paths start at "$",
+// object keys are joined with "." and array elements are written "[]", so
+// "$[].data.products[].price" covers the price of every product.
+//
+// Types are "object", "array", "string", "number", "bool" and "null", joined
+// with "|" when a path holds more than one. In an expected Shape a trailing
+// "?" marks the path optional (absence is not reported), and "any" accepts
+// every type without descending further.
+type Shape map[string]string
+
+// ParseShape decodes an expected Shape from JSON.
+func ParseShape(data []byte) (Shape, error) {
+	var s Shape
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parse shape: %w", err)
+	}
+	return s, nil
+}
+
+// Infer returns the Shape of a JSON document.
+func Infer(raw []byte) (Shape, error) {
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, fmt.Errorf("infer shape: %w", err)
+	}
+	seen := make(map[string]map[string]bool)
+	walk(v, "$", seen)
+
+	s := make(Shape, len(seen))
+	for path, types := range seen {
+		s[path] = joinTypes(types)
+	}
+	return s, nil
+}
+
+func walk(v any, path string, seen map[string]map[string]bool) {
+	add := func(t string) {
+		if seen[path] == nil {
+			seen[path] = make(map[string]bool)
+		}
+		seen[path][t] = true
+	}
+	switch x := v.(type) {
+	case map[string]any:
+		add("object")
+		for k, child := range x {
+			walk(child, path+"."+k, seen)
+		}
+	case []any:
+		add("array")
+		for _, child := range x {
+			walk(child, path+"[]", seen)
+		}
+	case string:
+		add("string")
+	case float64:
+		add("number")
+	case bool:
+		add("bool")
+	case nil:
+		add("null")
+	}
+}
+
+func joinTypes(types map[string]bool) string {
+	list := make([]string, 0, len(types))
+	for t := range types {
+		list = append(list, t)
+	}
+	sort.Strings(list)
+	return strings.Join(list, "|")
+}
+
+// FindingKind classifies a difference between an expected and actual Shape.
+type FindingKind string
+
+const (
+	FindingUnknown     FindingKind = "unknown"      // field not in the expected shape
+	FindingMissing     FindingKind = "missing"      // required field absent
+	FindingTypeChanged FindingKind = "type_changed" // field present with an unexpected type
+)
+
+// Finding is one difference between an expected and actual Shape.
+type Finding struct {
+	Kind     FindingKind `json:"kind"`
+	Path     string      `json:"path"`
+	Expected string      `json:"expected,omitempty"`
+	Actual   string      `json:"actual,omitempty"`
+}
+
+func (f Finding) String() string {
+	switch f.Kind {
+	case FindingMissing:
+		return fmt.Sprintf("missing field %s (expected %s)", f.Path, f.Expected)
+	case FindingTypeChanged:
+		return fmt.Sprintf("field %s changed type: expected %s, got %s", f.Path, f.Expected, f.Actual)
+	}
+	return fmt.Sprintf("unknown field %s (%s)", f.Path, f.Actual)
+}
+
+// Compare reports how actual differs from expected. Required fields are only
+// reported missing when their parent is present as an object (or array, for
+// elements), so an empty array or a string-or-array field does not flag every
+// field below it. null is accepted for any known field.
+func Compare(expected, actual Shape) []Finding {
+	var out []Finding
+	for path, got := range actual {
+		if underAny(expected, path) {
+			continue
+		}
+		spec, ok := expected[path]
+		if !ok {
+			out = append(out, Finding{Kind: FindingUnknown, Path: path, Actual: got})
+			continue
+		}
+		want, _ := parseSpec(spec)
+		if bad := unexpectedTypes(want, got); bad != "" {
+			out = append(out, Finding{Kind: FindingTypeChanged, Path: path, Expected: strings.Join(want, "|"), Actual: got})
+		}
+	}
+	for path, spec := range expected {
+		want, optional := parseSpec(spec)
+		if optional {
+			continue
+		}
+		if _, ok := actual[path]; ok {
+			continue
+		}
+		if parent := parentPath(path); parent != "" && !holdsChildren(actual[parent], path) {
+			continue
+		}
+		out = append(out, Finding{Kind: FindingMissing, Path: path, Expected: strings.Join(want, "|")})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Kind != out[j].Kind {
+			return out[i].Kind < out[j].Kind
+		}
+		return out[i].Path < out[j].Path
+	})
+	return out
+}
+
+// holdsChildren reports whether a parent of type parentTypes can contain path.
+func holdsChildren(parentTypes, path string) bool {
+	want := "object"
+	if strings.HasSuffix(path, "[]") {
+		want = "array"
+	}
+	for _, t := range strings.Split(parentTypes, "|") {
+		if t == want {
+			return true
+		}
+	}
+	return false
+}
+
+func parseSpec(spec string) (types []string, optional bool) {
+	spec, optional = strings.CutSuffix(spec, "?")
+	return strings.Split(spec, "|"), optional
+}
+
+// unexpectedTypes returns the types in got that want does not allow.
+func unexpectedTypes(want []string, got string) string {
+	var bad []string
+	for _, t := range strings.Split(got, "|") {
+		if t == "null" {
+			continue
+		}
+		ok := false
+		for _, w := range want {
+			if w == t || w == "any" {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			bad = append(bad, t)
+		}
+	}
+	return strings.Join(bad, "|")
+}
+
+// underAny reports whether path lies below a path the expected shape marks "any".
+func underAny(expected Shape, path string) bool {
+	for p := parentPath(path); p != ""; p = parentPath(p) {
+		if want, _ := parseSpec(expected[p]); len(want) == 1 && want[0] == "any" {
+			return true
+		}
+	}
+	return false
+}
+
+// parentPath returns the enclosing path: "$.a.b" -> "$.a", "$.a[]" -> "$.a".
+func parentPath(path string) string {
+	if p, ok := strings.CutSuffix(path, "[]"); ok {
+		return p
+	}
+	if i := strings.LastIndexByte(path, '.'); i > 0 {
+		return path[:i]
+	}
+	return ""
+}
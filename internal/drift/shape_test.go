@@ -0,0 +1,150 @@
+package drift
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lukman83/kidkazz-scrap/internal/models"
+)
+
+func TestInfer(t *testing.T) {
+	got, err := Infer([]byte(`{"products":[{"price":1,"shop":null},{"price":"2"}],"ok":true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Shape{
+		"$":                  "object",
+		"$.ok":               "bool",
+		"$.products":         "array",
+		"$.products[]":       "object",
+		"$.products[].price": "number|string",
+		"$.products[].shop":  "null",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Infer = %v, want %v", got, want)
+	}
+	if _, err := Infer([]byte("<html>")); err == nil {
+		t.Error("Infer accepted a non-JSON payload")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	expected := Shape{
+		"$":                  "object",
+		"$.products":         "array",
+		"$.products[]":       "object",
+		"$.products[].name":  "string",
+		"$.products[].price": "number",
+		"$.products[].badge": "string?",
+		"$.tracking":         "any",
+	}
+	tests := []struct {
+		name    string
+		payload string
+		want    []Finding
+	}{
+		{
+			name:    "matching",
+			payload: `{"products":[{"name":"Boneka","price":50000,"badge":null}],"tracking":{"id":[1]}}`,
+		},
+		{
+			name:    "renamed field",
+			payload: `{"products":[{"name":"Boneka","priceInt":50000}],"tracking":1}`,
+			want: []Finding{
+				{Kind: FindingMissing, Path: "$.products[].price", Expected: "number"},
+				{Kind: FindingUnknown, Path: "$.products[].priceInt", Actual: "number"},
+			},
+		},
+		{
+			name:    "changed type",
+			payload: `{"products":[{"name":"Boneka","price":"Rp50.000"}],"tracking":1}`,
+			want: []Finding{
+				{Kind: FindingTypeChanged, Path: "$.products[].price", Expected: "number", Actual: "string"},
+			},
+		},
+		{
+			// Only the missing element is reported, not every field below it.
+			name:    "empty array",
+			payload: `{"products":[],"tracking":1}`,
+			want: []Finding{
+				{Kind: FindingMissing, Path: "$.products[]", Expected: "object"},
+			},
+		},
+		{
+			name:    "missing container",
+			payload: `{"tracking":1}`,
+			want: []Finding{
+				{Kind: FindingMissing, Path: "$.products", Expected: "array"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := Infer([]byte(tt.payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := Compare(expected, actual); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Compare = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	schema := Schema{
+		Name:  "search",
+		Shape: Shape{"$": "object", "$.price": "number"},
+		Fill: []FillRule{
+			{Field: "price", Filled: func(p models.Product) bool { return p.Price > 0 }},
+			{Field: "shop", Filled: func(p models.Product) bool { return p.Shop.Name != "" }, MaxEmpty: 0.5},
+		},
+	}
+	products := []models.Product{
+		{Price: 1, Shop: models.Shop{Name: "a"}}, {Price: 1}, {Price: 0, Shop: models.Shop{Name: "b"}}, {Price: 0, Shop: models.Shop{Name: "c"}},
+	}
+	r := Check("graphql", schema, []byte(`{"price":"1"}`), products)
+
+	if len(r.Findings) != 1 || r.Findings[0].Kind != FindingTypeChanged {
+		t.Errorf("findings = %v", r.Findings)
+	}
+	want := []FillRate{
+		{Field: "price", Rate: 0.5, Empty: 2, MaxEmpty: DefaultMaxEmpty, Warn: true},
+		{Field: "shop", Rate: 0.75, Empty: 1, MaxEmpty: 0.5},
+	}
+	if !reflect.DeepEqual(r.FillRates, want) {
+		t.Errorf("fill rates = %+v, want %+v", r.FillRates, want)
+	}
+	if w := r.Warnings(); len(w) != 2 || r.OK() {
+		t.Errorf("warnings = %q", w)
+	}
+
+	if r := Check("graphql", schema, []byte("not json"), nil); r.Error == "" || r.OK() {
+		t.Errorf("unparseable payload: %+v", r)
+	}
+}
+
+func TestMonitorRecord(t *testing.T) {
+	m := NewMonitor()
+	missing := Finding{Kind: FindingMissing, Path: "$.price", Expected: "number"}
+	r := Report{Source: "graphql", Findings: []Finding{missing}}
+
+	if fresh := m.Record(r); len(fresh) != 1 {
+		t.Errorf("first report: fresh findings %v", fresh)
+	}
+	if fresh := m.Record(r); len(fresh) != 0 {
+		t.Errorf("repeated finding returned again: %v", fresh)
+	}
+	m.Record(Report{Source: "static"})
+
+	stats := m.Snapshot()
+	if len(stats) != 2 || stats[0].Source != "graphql" || stats[1].Source != "static" {
+		t.Fatalf("snapshot = %+v", stats)
+	}
+	if g := stats[0]; g.Checks != 2 || g.WarningBatches != 2 || g.Findings[FindingMissing] != 2 {
+		t.Errorf("graphql stats = %+v", g)
+	}
+	if s := stats[1]; s.Checks != 1 || s.WarningBatches != 0 {
+		t.Errorf("static stats = %+v", s)
+	}
+}
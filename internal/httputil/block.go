@@ -0,0 +1,202 @@
+package httputil
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ResponseKind classifies why a response did not yield usable data.
+type ResponseKind string
+
+const (
+	KindCaptcha       ResponseKind = "captcha"
+	KindRateLimited   ResponseKind = "rate_limited"
+	KindGeoBlocked    ResponseKind = "geo_blocked"
+	KindWAFBlock      ResponseKind = "waf_block"
+	KindSchemaChanged ResponseKind = "schema_changed"
+	KindEmpty         ResponseKind = "empty"
+)
+
+// ResponseError is a typed failure carrying the classification of a response.
+type ResponseError struct {
+	Kind       ResponseKind
+	StatusCode int           // 0 when not tied to an HTTP status (e.g. rendered pages)
+	Detail     string        // short human-readable explanation
+	RetryAfter time.Duration // server-requested wait, if any
+}
+
+func (e *ResponseError) Error() string {
+	msg := e.Kind.describe()
+	if e.StatusCode != 0 {
+		msg += fmt.Sprintf(" (HTTP %d)", e.StatusCode)
+	}
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	if e.RetryAfter > 0 {
+		msg += fmt.Sprintf(" (retry after %s)", e.RetryAfter)
+	}
+	return msg
+}
+
+// IsBlock reports whether the kind is an anti-bot block rather than a data problem.
+func (k ResponseKind) IsBlock() bool {
+	switch k {
+	case KindCaptcha, KindRateLimited, KindGeoBlocked, KindWAFBlock:
+		return true
+	}
+	return false
+}
+
+func (k ResponseKind) describe() string {
+	switch k {
+	case KindCaptcha:
+		return "blocked by captcha challenge"
+	case KindRateLimited:
+		return "rate limited"
+	case KindGeoBlocked:
+		return "geo-blocked"
+	case KindWAFBlock:
+		return "blocked by WAF"
+	case KindSchemaChanged:
+		return "unexpected response schema"
+	case KindEmpty:
+		return "no results"
+	}
+	return string(k)
+}
+
+// NewResponseError creates a ResponseError of the given kind.
+func NewResponseError(kind ResponseKind, statusCode int, format string, args ...any) *ResponseError {
+	return &ResponseError{Kind: kind, StatusCode: statusCode, Detail: fmt.Sprintf(format, args...)}
+}
+
+// AsResponseError unwraps err to a *ResponseError, if it contains one.
+func AsResponseError(err error) (*ResponseError, bool) {
+	var re *ResponseError
+	if errors.As(err, &re) {
+		return re, true
+	}
+	return nil, false
+}
+
+// IsBlocked reports whether err is a captcha, rate-limit, geo or WAF block.
+func IsBlocked(err error) bool {
+	re, ok := AsResponseError(err)
+	return ok && re.Kind.IsBlock()
+}
+
+// IsEmpty reports whether err signals a genuinely empty result set.
+func IsEmpty(err error) bool {
+	re, ok := AsResponseError(err)
+	return ok && re.Kind == KindEmpty
+}
+
+// challengePageMaxSize bounds which 200 responses are scanned for challenge
+// markers. Real Tokopedia pages are several hundred KB; interstitials are small,
+// so this avoids false positives from login widgets embedded in full pages.
+const challengePageMaxSize = 128 << 10
+
+var (
+	captchaMarkers = []string{
+		"g-recaptcha", "hcaptcha", "h-captcha", "px-captcha", "cf-turnstile",
+		"captcha-delivery.com", "challenge-platform", "verify you are human",
+	}
+	wafMarkers = []string{
+		"access denied", "request blocked", "errors.edgesuite.net",
+		"the requested url was rejected", "attention required!", "incapsula incident",
+	}
+	geoMarkers = []string{
+		"not available in your country", "not available in your region",
+		"tidak tersedia di negara",
+	}
+)
+
+// BlockFeedbackFunc is notified when DetectBlock finds a challenge that the
+// transport could not see from the status code alone.
+type BlockFeedbackFunc func(kind ResponseKind)
+
+type blockFeedbackKey struct{}
+
+// WithBlockFeedback returns a context carrying fn. Transports attach it to the
+// outgoing request so that body-level detections can throttle the host.
+func WithBlockFeedback(ctx context.Context, fn BlockFeedbackFunc) context.Context {
+	return context.WithValue(ctx, blockFeedbackKey{}, fn)
+}
+
+// DetectBlock classifies a response as a captcha, rate-limit, geo or WAF block.
+// It returns nil when the response looks like a normal page or API payload.
+// body must be the already-decompressed response body.
+func DetectBlock(resp *http.Response, body []byte) error {
+	err := detect(resp.StatusCode, resp.Header, body)
+	// Non-200 blocks are already visible to the transport; only report
+	// challenges hidden behind a 200.
+	if re, ok := AsResponseError(err); ok && resp.StatusCode == http.StatusOK && resp.Request != nil {
+		if fn, ok := resp.Request.Context().Value(blockFeedbackKey{}).(BlockFeedbackFunc); ok && fn != nil {
+			fn(re.Kind)
+		}
+	}
+	return err
+}
+
+// DetectBlockPage is DetectBlock for content that did not come from an
+// http.Response, such as HTML rendered by the headless browser.
+func DetectBlockPage(body []byte) error {
+	return detect(http.StatusOK, nil, body)
+}
+
+func detect(status int, header http.Header, body []byte) error {
+	lower := bytes.ToLower(body)
+
+	switch {
+	case status == http.StatusTooManyRequests:
+		re := NewResponseError(KindRateLimited, status, "too many requests")
+		re.RetryAfter = ParseRetryAfter(header)
+		return re
+	case status == http.StatusUnavailableForLegalReasons:
+		return NewResponseError(KindGeoBlocked, status, "unavailable for legal reasons")
+	case status == http.StatusForbidden || status == http.StatusUnauthorized || status == http.StatusServiceUnavailable:
+		if m := firstMarker(lower, captchaMarkers); m != "" {
+			return NewResponseError(KindCaptcha, status, "page contains %q", m)
+		}
+		if m := firstMarker(lower, geoMarkers); m != "" {
+			return NewResponseError(KindGeoBlocked, status, "page contains %q", m)
+		}
+		if status == http.StatusServiceUnavailable {
+			return nil // plain server error, left to retry logic
+		}
+		if m := firstMarker(lower, wafMarkers); m != "" {
+			return NewResponseError(KindWAFBlock, status, "page contains %q", m)
+		}
+		return NewResponseError(KindWAFBlock, status, "request forbidden")
+	case status == http.StatusOK:
+		if len(body) > challengePageMaxSize || looksLikeJSON(body) {
+			return nil
+		}
+		if m := firstMarker(lower, captchaMarkers); m != "" {
+			return NewResponseError(KindCaptcha, status, "page contains %q", m)
+		}
+		if m := firstMarker(lower, geoMarkers); m != "" {
+			return NewResponseError(KindGeoBlocked, status, "page contains %q", m)
+		}
+	}
+	return nil
+}
+
+func firstMarker(lowerBody []byte, markers []string) string {
+	for _, m := range markers {
+		if bytes.Contains(lowerBody, []byte(m)) {
+			return m
+		}
+	}
+	return ""
+}
+
+func looksLikeJSON(body []byte) bool {
+	trimmed := bytes.TrimSpace(body)
+	return len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[')
+}
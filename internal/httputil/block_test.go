@@ -0,0 +1,79 @@
+package httputil
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDetectBlock(t *testing.T) {
+	page := func(s string) string { return "<html><body>" + s + "</body></html>" }
+	tests := []struct {
+		name       string
+		status     int
+		retryAfter string
+		body       string
+		kind       ResponseKind // "" when the response is not a block
+		wait       time.Duration
+	}{
+		{name: "rate limited", status: 429, retryAfter: "30", body: "slow down", kind: KindRateLimited, wait: 30 * time.Second},
+		{name: "legal", status: 451, kind: KindGeoBlocked},
+		{name: "captcha on 403", status: 403, body: page(`<div class="g-recaptcha"></div>`), kind: KindCaptcha},
+		{name: "geo on 403", status: 403, body: page("Not available in your country"), kind: KindGeoBlocked},
+		{name: "waf on 403", status: 403, body: page("Access Denied"), kind: KindWAFBlock},
+		{name: "plain 403", status: 403, kind: KindWAFBlock},
+		{name: "plain 401", status: 401, kind: KindWAFBlock},
+		{name: "captcha on 503", status: 503, body: page(`<script src="https://ct.captcha-delivery.com/c.js"></script>`), kind: KindCaptcha},
+		{name: "plain 503", status: 503, body: page("Service Unavailable")},
+		{name: "captcha on 200", status: 200, body: page("Verify you are human"), kind: KindCaptcha},
+		{name: "geo on 200", status: 200, body: page("Produk tidak tersedia di negara Anda"), kind: KindGeoBlocked},
+		{name: "empty result", status: 200, body: `{"data":{"searchProductV5":{"header":{"totalData":0},"data":{"products":[]}}}}`},
+		{name: "json mentioning captcha", status: 200, body: `{"data":{"name":"hcaptcha sticker"}}`},
+		{name: "normal page", status: 200, body: page(`<h1>Boneka Beruang</h1><span>Rp50.000</span>`)},
+		{name: "large page with a login widget", status: 200, body: page(`<div class="g-recaptcha"></div>` + strings.Repeat("x", challengePageMaxSize))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+			if tt.retryAfter != "" {
+				resp.Header.Set("Retry-After", tt.retryAfter)
+			}
+			err := DetectBlock(resp, []byte(tt.body))
+			if tt.kind == "" {
+				if err != nil {
+					t.Fatalf("got %v, want no block", err)
+				}
+				return
+			}
+			re, ok := AsResponseError(err)
+			if !ok {
+				t.Fatalf("got %v, want a %s error", err, tt.kind)
+			}
+			if re.Kind != tt.kind || re.StatusCode != tt.status || re.RetryAfter != tt.wait {
+				t.Errorf("got %s (HTTP %d, retry after %s), want %s (HTTP %d, retry after %s)",
+					re.Kind, re.StatusCode, re.RetryAfter, tt.kind, tt.status, tt.wait)
+			}
+			if !IsBlocked(err) || IsEmpty(err) {
+				t.Errorf("IsBlocked = %v, IsEmpty = %v", IsBlocked(err), IsEmpty(err))
+			}
+		})
+	}
+}
+
+func TestDetectBlockFeedback(t *testing.T) {
+	var got []ResponseKind
+	ctx := WithBlockFeedback(context.Background(), func(kind ResponseKind) { got = append(got, kind) })
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "https://www.tokopedia.com/search", nil)
+
+	captcha := []byte(`<div class="cf-turnstile"></div>`)
+	DetectBlock(&http.Response{StatusCode: 200, Request: req}, captcha)
+	// The transport sees a 403 itself, so it is not reported again.
+	DetectBlock(&http.Response{StatusCode: 403, Request: req}, captcha)
+	DetectBlock(&http.Response{StatusCode: 200, Request: req}, []byte(`{"data":{}}`))
+
+	if len(got) != 1 || got[0] != KindCaptcha {
+		t.Errorf("feedback %v, want one captcha", got)
+	}
+}
@@ -2,12 +2,17 @@ package httputil
 
 import (
 	"compress/gzip"
+	"context"
 	"fmt"
 	"io"
+	"math/rand/v2"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/andybalholm/brotli"
+	"github.com/lukman83/kidkazz-scrap/internal/progress"
 )
 
 // NewHTTPClient creates an HTTP client with sensible defaults.
@@ -26,9 +31,22 @@ func NewHTTPClient(transport http.RoundTripper) *http.Client {
 	}
 }
 
+const (
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 10 * time.Second
+	// maxRetryAfter caps how long DoWithRetry honours a Retry-After header.
+	// Longer waits return the throttled response so callers can fall back instead.
+	maxRetryAfter = 30 * time.Second
+)
+
 // DoWithRetry performs an HTTP request with retry logic.
+// Network errors, 5xx and 429 responses are retried with exponential backoff and
+// full jitter, honouring Retry-After when present. Waiting stops as soon as the
+// request context is cancelled. After the final attempt the last response is
+// returned as-is so callers can classify it.
 // On retry, the request body is reset via req.GetBody if available.
 func DoWithRetry(client *http.Client, req *http.Request, maxRetries int) (*http.Response, error) {
+	ctx := req.Context()
 	var lastErr error
 	for i := 0; i <= maxRetries; i++ {
 		if i > 0 && req.GetBody != nil {
@@ -41,20 +59,82 @@ func DoWithRetry(client *http.Client, req *http.Request, maxRetries int) (*http.
 		resp, err := client.Do(req)
 		if err != nil {
 			lastErr = err
-			time.Sleep(time.Duration(i+1) * 500 * time.Millisecond)
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if i < maxRetries {
+				if err := sleepCtx(ctx, RetryBackoff(i)); err != nil {
+					return nil, err
+				}
+			}
 			continue
 		}
-		if resp.StatusCode >= 500 {
-			resp.Body.Close()
-			lastErr = fmt.Errorf("server error: %d", resp.StatusCode)
-			time.Sleep(time.Duration(i+1) * 500 * time.Millisecond)
-			continue
+		if !retryableStatus(resp.StatusCode) || i == maxRetries {
+			return resp, nil
+		}
+
+		wait := RetryBackoff(i)
+		if ra := ParseRetryAfter(resp.Header); ra > 0 {
+			if ra > maxRetryAfter {
+				return resp, nil
+			}
+			wait = max(wait, ra)
+		}
+		resp.Body.Close()
+		lastErr = fmt.Errorf("server returned %d", resp.StatusCode)
+		progress.Report(ctx, fmt.Sprintf("HTTP %d from %s, retrying in %s...", resp.StatusCode, req.URL.Host, wait.Round(100*time.Millisecond)))
+		if err := sleepCtx(ctx, wait); err != nil {
+			return nil, err
 		}
-		return resp, nil
 	}
 	return nil, fmt.Errorf("request failed after %d retries: %w", maxRetries, lastErr)
 }
 
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// RetryBackoff returns the full-jitter exponential backoff for the given attempt (0-based).
+func RetryBackoff(attempt int) time.Duration {
+	d := retryMaxDelay
+	if attempt < 16 {
+		d = min(retryBaseDelay<<attempt, retryMaxDelay)
+	}
+	return time.Duration(rand.Int64N(int64(d))) + time.Millisecond
+}
+
+// ParseRetryAfter parses a Retry-After header given as delay-seconds or an HTTP date.
+// It returns 0 if the header is absent or invalid.
+func ParseRetryAfter(h http.Header) time.Duration {
+	v := strings.TrimSpace(h.Get("Retry-After"))
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // ReadBody reads and decompresses an HTTP response body.
 func ReadBody(resp *http.Response) ([]byte, error) {
 	var reader io.ReadCloser
@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"github.com/lukman83/kidkazz-scrap/internal/drift"
+	"github.com/lukman83/kidkazz-scrap/internal/platform"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	breakerStateDesc = prometheus.NewDesc(namespace+"_breaker_state",
+		"Circuit breaker state per strategy (0 = closed, 1 = half-open, 2 = open).",
+		[]string{"platform", "strategy"}, nil)
+	successRateDesc = prometheus.NewDesc(namespace+"_strategy_success_rate",
+		"Recent success rate per strategy, as used for fallback ordering.",
+		[]string{"platform", "strategy"}, nil)
+	coalesceLeadersDesc = prometheus.NewDesc(namespace+"_coalesce_leaders_total",
+		"Scrapes started after request coalescing.",
+		[]string{"platform"}, nil)
+	coalescedDesc = prometheus.NewDesc(namespace+"_coalesced_requests_total",
+		"Requests answered by joining an identical in-flight scrape.",
+		[]string{"platform"}, nil)
+	coalesceInFlightDesc = prometheus.NewDesc(namespace+"_coalesce_in_flight",
+		"Scrapes currently shared by coalesced requests.",
+		[]string{"platform"}, nil)
+	driftChecksDesc = prometheus.NewDesc(namespace+"_drift_checks_total",
+		"Payloads checked for schema drift.",
+		[]string{"platform", "strategy"}, nil)
+	driftFindingsDesc = prometheus.NewDesc(namespace+"_drift_findings_total",
+		"Schema drift findings by kind (unknown, missing, type_changed).",
+		[]string{"platform", "strategy", "kind"}, nil)
+	driftFillWarningsDesc = prometheus.NewDesc(namespace+"_drift_fill_warnings_total",
+		"Batches where a product field was empty beyond its threshold.",
+		[]string{"platform", "strategy", "field"}, nil)
+	driftFillRateDesc = prometheus.NewDesc(namespace+"_drift_fill_rate",
+		"Fraction of products with the field populated in the latest batch.",
+		[]string{"platform", "strategy", "field"}, nil)
+)
+
+// platformCollector exports the state registered scrapers already track
+// (breakers, coalescing, schema drift), read at scrape time.
+type platformCollector struct{}
+
+func (platformCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		breakerStateDesc, successRateDesc, coalesceLeadersDesc, coalescedDesc, coalesceInFlightDesc,
+		driftChecksDesc, driftFindingsDesc, driftFillWarningsDesc, driftFillRateDesc,
+	} {
+		ch <- d
+	}
+}
+
+func (platformCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, name := range platform.List() {
+		scraper, err := platform.Get(name)
+		if err != nil {
+			continue
+		}
+		scraper = platform.Underlying(scraper)
+
+		if hr, ok := scraper.(platform.HealthReporter); ok {
+			for _, h := range hr.Health() {
+				ch <- prometheus.MustNewConstMetric(breakerStateDesc, prometheus.GaugeValue, breakerValue(h.State), name, h.Strategy)
+				ch <- prometheus.MustNewConstMetric(successRateDesc, prometheus.GaugeValue, h.SuccessRate, name, h.Strategy)
+			}
+		}
+		if cr, ok := scraper.(platform.CoalesceReporter); ok {
+			st := cr.Coalescing()
+			ch <- prometheus.MustNewConstMetric(coalesceLeadersDesc, prometheus.CounterValue, float64(st.Leaders), name)
+			ch <- prometheus.MustNewConstMetric(coalescedDesc, prometheus.CounterValue, float64(st.Coalesced), name)
+			ch <- prometheus.MustNewConstMetric(coalesceInFlightDesc, prometheus.GaugeValue, float64(st.InFlight), name)
+		}
+		if dr, ok := scraper.(drift.Reporter); ok {
+			for _, st := range dr.Drift() {
+				ch <- prometheus.MustNewConstMetric(driftChecksDesc, prometheus.CounterValue, float64(st.Checks), name, st.Source)
+				for kind, n := range st.Findings {
+					ch <- prometheus.MustNewConstMetric(driftFindingsDesc, prometheus.CounterValue, float64(n), name, st.Source, string(kind))
+				}
+				for field, n := range st.FillWarnings {
+					ch <- prometheus.MustNewConstMetric(driftFillWarningsDesc, prometheus.CounterValue, float64(n), name, st.Source, field)
+				}
+				for field, rate := range st.FillRates {
+					ch <- prometheus.MustNewConstMetric(driftFillRateDesc, prometheus.GaugeValue, rate, name, st.Source, field)
+				}
+			}
+		}
+	}
+}
+
+func breakerValue(state string) float64 {
+	switch state {
+	case platform.BreakerHalfOpen.String():
+		return 1
+	case platform.BreakerOpen.String():
+		return 2
+	}
+	return 0
+}
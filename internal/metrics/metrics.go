@@ -0,0 +1,112 @@
+// Package metrics defines the Prometheus metrics exported on /metrics by
+// serve-http. Collectors are package-level so any layer can record into them;
+// outside serve-http they are simply never scraped.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "kidkazz"
+
+// Registry holds every kidkazz metric plus the Go runtime and process collectors.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// StrategyRequests counts strategy executions by outcome: success, empty,
+	// failure, circuit_open or cancelled.
+	StrategyRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "strategy_requests_total",
+		Help:      "Strategy executions by platform, strategy and outcome.",
+	}, []string{"platform", "strategy", "outcome"})
+
+	// StrategyLatency observes how long completed strategy executions took.
+	StrategyLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "strategy_duration_seconds",
+		Help:      "Duration of strategy executions (retries included) by platform, strategy and outcome.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2, 5, 10, 20, 40, 80},
+	}, []string{"platform", "strategy", "outcome"})
+
+	// FallbackDepth observes how far down the strategy chain a request went:
+	// 1 is the fast race, 2 the first slow fallback, and so on.
+	FallbackDepth = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "fallback_depth",
+		Help:      "Position in the strategy chain where a request ended (1 = fast race), by outcome (found, empty, exhausted).",
+		Buckets:   []float64{1, 2, 3, 4, 5},
+	}, []string{"platform", "outcome"})
+
+	// RateLimitWait observes time spent waiting before a request was sent.
+	RateLimitWait = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "rate_limit_wait_seconds",
+		Help:      "Time requests waited by host and stage (rate_limit = token bucket and Retry-After pause, spacing = crawl-delay/human delay).",
+		Buckets:   []float64{0.001, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10, 30},
+	}, []string{"host", "stage"})
+
+	// RobotsBlocks counts requests refused by robots.txt.
+	RobotsBlocks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "robots_blocked_total",
+		Help:      "Requests refused because robots.txt disallows them, by host.",
+	}, []string{"host"})
+
+	// ProxyRequests counts requests per proxy provider by outcome: ok,
+	// blocked (403/429) or error (transport failure).
+	ProxyRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "proxy_requests_total",
+		Help:      "Requests sent through each proxy provider by outcome (ok, blocked, error).",
+	}, []string{"provider", "outcome"})
+
+	// BrowserLaunch observes headless browser start-up time.
+	BrowserLaunch = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "browser_launch_seconds",
+		Help:      "Time to launch and connect the headless browser, by outcome (ok, error).",
+		Buckets:   []float64{0.25, 0.5, 1, 2, 4, 8, 16},
+	}, []string{"outcome"})
+
+	// ToolCalls counts MCP tool calls by outcome: ok or error.
+	ToolCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mcp_tool_calls_total",
+		Help:      "MCP tool calls by tool and outcome (ok, error).",
+	}, []string{"tool", "outcome"})
+
+	// ToolDuration observes MCP tool call latency.
+	ToolDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "mcp_tool_duration_seconds",
+		Help:      "MCP tool call duration by tool.",
+		Buckets:   []float64{0.05, 0.1, 0.5, 1, 2, 5, 10, 20, 40, 80},
+	}, []string{"tool"})
+
+	// CacheLookups counts response cache lookups by result: hit, stale or miss.
+	CacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_lookups_total",
+		Help:      "Response cache lookups by platform, kind and result (hit, stale, miss).",
+	}, []string{"platform", "kind", "result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		StrategyRequests, StrategyLatency, FallbackDepth, RateLimitWait, RobotsBlocks,
+		ProxyRequests, BrowserLaunch, ToolCalls, ToolDuration, CacheLookups,
+		platformCollector{},
+	)
+}
+
+// Handler serves the registry in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
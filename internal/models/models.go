@@ -20,12 +20,15 @@ type Product struct {
 	Category        string    `json:"category,omitempty"`
 	Shop            Shop      `json:"shop"`
 	ReviewCount     int       `json:"review_count,omitempty"`
+	Rating          float64   `json:"rating,omitempty"`     // average, out of 5
+	SoldCount       int       `json:"sold_count,omitempty"` // lower bound, e.g. 1000 for "1rb+ terjual"
 	IsAd            bool      `json:"is_ad"`
 	Labels          []Label   `json:"labels,omitempty"`
 	Wishlist        bool      `json:"wishlist"`
 	Platform        string    `json:"platform"`
 	ScrapedAt       time.Time `json:"scraped_at"`
 	Strategy        string    `json:"strategy"`
+	Location        string    `json:"location,omitempty"` // buyer location the result was fetched for
 }
 
 type Shop struct {
@@ -34,3 +37,14 @@ type Shop struct {
 	City       string `json:"city,omitempty"`
 	IsOfficial bool   `json:"is_official,omitempty"`
 }
+
+// FilterAds returns products without the ads.
+func FilterAds(products []Product) []Product {
+	filtered := make([]Product, 0, len(products))
+	for _, p := range products {
+		if !p.IsAd {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,176 @@
+package platform
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/lukman83/kidkazz-scrap/internal/crawl"
+	"github.com/lukman83/kidkazz-scrap/internal/logging"
+	"github.com/lukman83/kidkazz-scrap/internal/models"
+	"github.com/lukman83/kidkazz-scrap/internal/progress"
+	"github.com/lukman83/kidkazz-scrap/internal/usage"
+)
+
+// Key returns a normalised identity for the request: keywords are
+// lower-cased with whitespace collapsed, so "Boneka  Anak" and "boneka anak"
+// share a key. Locations are normalised the same way.
+func (r Request) Key() string {
+	keyword := strings.Join(strings.Fields(strings.ToLower(r.Keyword)), " ")
+	location := strings.Join(strings.Fields(strings.ToLower(r.Location)), " ")
+	return fmt.Sprintf("%d|%s|%s|%d|%d|%s", r.Type, keyword, strings.TrimSpace(r.URL), r.Page, r.Limit, location)
+}
+
+// Coalescer merges concurrent identical requests into one in-flight scrape,
+// singleflight-style. The shared scrape runs detached from any single caller:
+// a caller that gives up returns immediately, and the scrape is cancelled only
+// once every caller has gone. It carries none of the first caller's context
+// values either, so it does not run under that caller's request ID, trace
+// or usage job; it only keeps that caller's crawl session (crawl.Session),
+// so the pages of one crawl present one visitor even when shared. Its
+// traffic is charged to the usage jobs of the callers still waiting on it
+// (see usage.Share).
+type Coalescer struct {
+	mu    sync.Mutex
+	calls map[string]*call
+
+	leaders   int64 // scrapes started
+	coalesced int64 // callers that joined an in-flight scrape
+}
+
+type call struct {
+	done     chan struct{}
+	products []models.Product
+	info     ResultInfo
+	err      error
+
+	share *usage.Share
+
+	// Guarded by Coalescer.mu.
+	waiters  int
+	cancel   context.CancelFunc
+	progress map[int]ProgressFunc
+	nextID   int
+}
+
+// NewCoalescer creates an empty Coalescer.
+func NewCoalescer() *Coalescer {
+	return &Coalescer{calls: make(map[string]*call)}
+}
+
+// Do runs fn for key, or waits for the identical call already in flight.
+// fn receives a fresh context with a request ID of its own and the first
+// caller's crawl session, whose progress messages reach every waiting
+// caller and whose traffic is charged to their usage jobs; other values the
+// scrape depends on must be added by fn. Each caller
+// gets its own copy of the result slice, and the ResultInfo fn recorded.
+func (c *Coalescer) Do(ctx context.Context, key string, fn func(ctx context.Context) ([]models.Product, error)) ([]models.Product, error) {
+	c.mu.Lock()
+	cl, joined := c.calls[key]
+	var shared context.Context
+	if joined {
+		c.coalesced++
+	} else {
+		c.leaders++
+		var cancel context.CancelFunc
+		var share *usage.Share
+		shared = crawl.WithSession(logging.WithRequestID(context.Background(), logging.NewRequestID()), crawl.Session(ctx))
+		shared, cancel = context.WithCancel(shared)
+		shared, share = usage.WithShare(shared)
+		cl = &call{done: make(chan struct{}), cancel: cancel, share: share, progress: make(map[int]ProgressFunc)}
+		c.calls[key] = cl
+	}
+	unshare := cl.share.Join(ctx)
+	cl.waiters++
+	id := cl.nextID
+	cl.nextID++
+	if fn := progress.From(ctx); fn != nil {
+		cl.progress[id] = fn
+	}
+	c.mu.Unlock()
+
+	if joined {
+		ReportProgress(ctx, "Joining an identical request already in progress...")
+	} else {
+		slog.DebugContext(ctx, "starting shared scrape", "scrape_id", logging.RequestIDFrom(shared))
+		shared = WithProgress(shared, func(msg string) { c.broadcast(cl, msg) })
+		shared, result := WithResultInfo(shared)
+		go func() {
+			defer cl.cancel()
+			products, err := fn(shared)
+			c.mu.Lock()
+			cl.products, cl.info, cl.err = products, result(), err
+			if c.calls[key] == cl {
+				delete(c.calls, key)
+			}
+			c.mu.Unlock()
+			close(cl.done)
+		}()
+	}
+
+	select {
+	case <-cl.done:
+		unshare()
+		c.leave(key, cl, id)
+		MergeResult(ctx, cl.info)
+		return slices.Clone(cl.products), cl.err
+	case <-ctx.Done():
+		unshare()
+		c.leave(key, cl, id)
+		return nil, ctx.Err()
+	}
+}
+
+// leave removes a waiter; the last one out cancels an unfinished scrape.
+func (c *Coalescer) leave(key string, cl *call, id int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(cl.progress, id)
+	cl.waiters--
+	if cl.waiters > 0 {
+		return
+	}
+	select {
+	case <-cl.done:
+	default:
+		// Nobody is left to answer; later callers start afresh.
+		if c.calls[key] == cl {
+			delete(c.calls, key)
+		}
+		cl.cancel()
+	}
+}
+
+func (c *Coalescer) broadcast(cl *call, msg string) {
+	c.mu.Lock()
+	fns := make([]ProgressFunc, 0, len(cl.progress))
+	for _, fn := range cl.progress {
+		fns = append(fns, fn)
+	}
+	c.mu.Unlock()
+	for _, fn := range fns {
+		fn(msg)
+	}
+}
+
+// CoalesceStats counts shared scrapes since startup.
+type CoalesceStats struct {
+	Leaders   int64 `json:"leaders"`   // scrapes actually started
+	Coalesced int64 `json:"coalesced"` // requests answered by joining an in-flight scrape
+	InFlight  int   `json:"in_flight"`
+}
+
+// Stats returns the coalescing counters.
+func (c *Coalescer) Stats() CoalesceStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CoalesceStats{Leaders: c.leaders, Coalesced: c.coalesced, InFlight: len(c.calls)}
+}
+
+// CoalesceReporter is implemented by scrapers that coalesce identical requests.
+type CoalesceReporter interface {
+	Coalescing() CoalesceStats
+}
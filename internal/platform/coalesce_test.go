@@ -0,0 +1,225 @@
+package platform
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lukman83/kidkazz-scrap/internal/crawl"
+	"github.com/lukman83/kidkazz-scrap/internal/logging"
+	"github.com/lukman83/kidkazz-scrap/internal/models"
+	"github.com/lukman83/kidkazz-scrap/internal/usage"
+)
+
+func TestRequestKey(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Request
+		same bool
+	}{
+		{
+			name: "keyword case and whitespace",
+			a:    Request{Type: SearchRequest, Keyword: "Boneka  Anak", Page: 1, Limit: 20},
+			b:    Request{Type: SearchRequest, Keyword: " boneka anak", Page: 1, Limit: 20},
+			same: true,
+		},
+		{
+			name: "location case",
+			a:    Request{Type: SearchRequest, Keyword: "boneka", Location: "Surabaya"},
+			b:    Request{Type: SearchRequest, Keyword: "boneka", Location: "surabaya"},
+			same: true,
+		},
+		{
+			name: "page",
+			a:    Request{Type: SearchRequest, Keyword: "boneka", Page: 1},
+			b:    Request{Type: SearchRequest, Keyword: "boneka", Page: 2},
+		},
+		{
+			name: "limit",
+			a:    Request{Type: SearchRequest, Keyword: "boneka", Limit: 20},
+			b:    Request{Type: SearchRequest, Keyword: "boneka", Limit: 40},
+		},
+		{
+			name: "type",
+			a:    Request{Type: SearchRequest, Keyword: "boneka"},
+			b:    Request{Type: TrendingRequest, Keyword: "boneka"},
+		},
+		{
+			name: "location",
+			a:    Request{Type: SearchRequest, Keyword: "boneka"},
+			b:    Request{Type: SearchRequest, Keyword: "boneka", Location: "medan"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if same := tt.a.Key() == tt.b.Key(); same != tt.same {
+				t.Errorf("%q vs %q: same = %v, want %v", tt.a.Key(), tt.b.Key(), same, tt.same)
+			}
+		})
+	}
+}
+
+func TestCoalescerDo(t *testing.T) {
+	c := NewCoalescer()
+	release := make(chan struct{})
+	var runs atomic.Int32
+	fn := func(ctx context.Context) ([]models.Product, error) {
+		runs.Add(1)
+		SetResult(ctx, "graphql", 42)
+		<-release
+		return []models.Product{{Name: "Boneka"}}, nil
+	}
+
+	const callers = 5
+	var wg sync.WaitGroup
+	results := make([][]models.Product, callers)
+	infos := make([]ResultInfo, callers)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, info := WithResultInfo(context.Background())
+			results[i], _ = c.Do(ctx, "boneka", fn)
+			infos[i] = info()
+		}()
+	}
+	waitFor(t, func() bool { s := c.Stats(); return s.Leaders+s.Coalesced == callers })
+	close(release)
+	wg.Wait()
+
+	if n := runs.Load(); n != 1 {
+		t.Errorf("fn ran %d times, want 1", n)
+	}
+	if s := c.Stats(); s.Leaders != 1 || s.Coalesced != callers-1 || s.InFlight != 0 {
+		t.Errorf("stats = %+v", s)
+	}
+	for i := range callers {
+		if len(results[i]) != 1 || infos[i].Strategy != "graphql" || infos[i].TotalData != 42 {
+			t.Errorf("caller %d got %v, %+v", i, results[i], infos[i])
+		}
+	}
+	results[0][0].Name = "changed"
+	if results[1][0].Name != "Boneka" {
+		t.Error("callers share the result slice")
+	}
+}
+
+func TestCoalescerDoCancel(t *testing.T) {
+	c := NewCoalescer()
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	fn := func(ctx context.Context) ([]models.Product, error) {
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+		return nil, ctx.Err()
+	}
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	go func() { _, err := c.Do(ctx1, "boneka", fn); errs <- err }()
+	<-started
+	go func() { _, err := c.Do(ctx2, "boneka", fn); errs <- err }()
+	waitFor(t, func() bool { return c.Stats().Coalesced == 1 })
+
+	cancel1()
+	if err := <-errs; err != context.Canceled {
+		t.Fatalf("first caller: err = %v, want context.Canceled", err)
+	}
+	select {
+	case <-cancelled:
+		t.Fatal("scrape cancelled while a caller still waits")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	cancel2()
+	<-errs
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("scrape not cancelled after the last caller left")
+	}
+}
+
+func TestCoalescerDoDetached(t *testing.T) {
+	type callerKey struct{}
+	ctx := logging.WithRequestID(context.Background(), "leader")
+	ctx = context.WithValue(ctx, callerKey{}, "job budget")
+
+	var id, session string
+	var leaked any
+	_, err := NewCoalescer().Do(ctx, "boneka", func(ctx context.Context) ([]models.Product, error) {
+		id, session, leaked = logging.RequestIDFrom(ctx), crawl.Session(ctx), ctx.Value(callerKey{})
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id == "" || id == "leader" {
+		t.Errorf("scrape request ID = %q, want a fresh one", id)
+	}
+	if session != "leader" {
+		t.Errorf("scrape session = %q, want the caller's", session)
+	}
+	if leaked != nil {
+		t.Errorf("scrape sees the caller's value %v", leaked)
+	}
+}
+
+func TestCoalescerDoChargesCallers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.jsonl")
+	meter, err := usage.OpenMeter(path, usage.Budget{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewCoalescer()
+	release := make(chan struct{})
+	fn := func(ctx context.Context) ([]models.Product, error) {
+		<-release
+		return nil, meter.Add(ctx, "direct", usage.Counts{Requests: 1, Received: 100})
+	}
+
+	var wg sync.WaitGroup
+	for _, id := range []string{"job-a", "job-b"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx := usage.WithJob(logging.WithRequestID(context.Background(), id), "search")
+			c.Do(ctx, "boneka", fn)
+		}()
+	}
+	waitFor(t, func() bool { s := c.Stats(); return s.Leaders+s.Coalesced == 2 })
+	close(release)
+	wg.Wait()
+	if err := meter.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := usage.Read(path, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	charged := make(map[string]int64)
+	for _, r := range records {
+		charged[r.RequestID] += r.Bytes()
+	}
+	if len(charged) != 2 || charged["job-a"] != 50 || charged["job-b"] != 50 {
+		t.Errorf("charged %v, want 50 bytes to each caller", charged)
+	}
+}
+
+// waitFor polls cond until it holds or a second has passed.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within 1s")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
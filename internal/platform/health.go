@@ -0,0 +1,271 @@
+package platform
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of a per-strategy circuit breaker.
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // healthy, requests flow
+	BreakerOpen                         // tripped, requests skipped until cool-down ends
+	BreakerHalfOpen                     // cool-down over, a single probe is allowed
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// BreakerConfig tunes the circuit breakers of a HealthTracker.
+type BreakerConfig struct {
+	FailureThreshold int           // consecutive failures that trip the breaker
+	CoolDown         time.Duration // time spent open before a half-open probe
+	Window           int           // number of recent outcomes used for success rate
+}
+
+// DefaultBreakerConfig returns the breaker settings used when none are configured.
+func DefaultBreakerConfig() BreakerConfig {
+	return BreakerConfig{FailureThreshold: 5, CoolDown: time.Minute, Window: 20}
+}
+
+// latencyAlpha is the EWMA weight given to the newest latency sample.
+const latencyAlpha = 0.3
+
+// StrategyHealth tracks the breaker state, recent success rate and latency of one strategy.
+type StrategyHealth struct {
+	cfg BreakerConfig
+	now func() time.Time
+
+	mu          sync.Mutex
+	state       BreakerState
+	consecutive int // consecutive failures
+	openedAt    time.Time
+	probing     bool // a half-open probe is in flight
+	outcomes    []bool
+	next        int
+	latency     time.Duration
+}
+
+// Allow reports whether the strategy may run now. An open breaker whose
+// cool-down has elapsed moves to half-open and admits exactly one probe.
+func (h *StrategyHealth) Allow() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	switch h.state {
+	case BreakerOpen:
+		if h.now().Sub(h.openedAt) < h.cfg.CoolDown {
+			return false
+		}
+		h.state = BreakerHalfOpen
+		h.probing = true
+		return true
+	case BreakerHalfOpen:
+		if h.probing {
+			return false
+		}
+		h.probing = true
+		return true
+	}
+	return true
+}
+
+// Record stores the outcome of one execution and updates the breaker.
+func (h *StrategyHealth) Record(success bool, latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.outcomes) < h.cfg.Window {
+		h.outcomes = append(h.outcomes, success)
+	} else if h.cfg.Window > 0 {
+		h.outcomes[h.next] = success
+		h.next = (h.next + 1) % h.cfg.Window
+	}
+	if h.latency == 0 {
+		h.latency = latency
+	} else {
+		h.latency = time.Duration(latencyAlpha*float64(latency) + (1-latencyAlpha)*float64(h.latency))
+	}
+
+	h.probing = false
+	if success {
+		h.consecutive = 0
+		h.state = BreakerClosed
+		return
+	}
+	h.consecutive++
+	if h.state == BreakerHalfOpen || h.consecutive >= h.cfg.FailureThreshold {
+		h.state = BreakerOpen
+		h.openedAt = h.now()
+	}
+}
+
+// Release gives back a half-open probe slot without recording an outcome,
+// e.g. when the probe was cancelled because another strategy won the race.
+func (h *StrategyHealth) Release() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.probing = false
+}
+
+// SuccessRate returns the fraction of recent executions that succeeded.
+// A strategy with no history is assumed healthy.
+func (h *StrategyHealth) SuccessRate() float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.successRate()
+}
+
+func (h *StrategyHealth) successRate() float64 {
+	if len(h.outcomes) == 0 {
+		return 1
+	}
+	ok := 0
+	for _, o := range h.outcomes {
+		if o {
+			ok++
+		}
+	}
+	return float64(ok) / float64(len(h.outcomes))
+}
+
+// RetryIn returns how long until an open breaker admits a probe.
+func (h *StrategyHealth) RetryIn() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.state != BreakerOpen {
+		return 0
+	}
+	return max(h.cfg.CoolDown-h.now().Sub(h.openedAt), 0)
+}
+
+// HealthSnapshot is a point-in-time view of a strategy's health.
+type HealthSnapshot struct {
+	Strategy            string  `json:"strategy"`
+	State               string  `json:"state"`
+	SuccessRate         float64 `json:"success_rate"`
+	LatencyMs           int64   `json:"latency_ms"`
+	ConsecutiveFailures int     `json:"consecutive_failures"`
+	Samples             int     `json:"samples"`
+}
+
+// HealthTracker keeps one StrategyHealth per strategy name. It is meant to be
+// long-lived (one per Scraper) so breaker state carries across requests.
+type HealthTracker struct {
+	cfg        BreakerConfig
+	now        func() time.Time // the breakers' clock, replaced in tests
+	mu         sync.Mutex
+	strategies map[string]*StrategyHealth
+}
+
+// NewHealthTracker creates a tracker; zero fields in cfg take their defaults.
+func NewHealthTracker(cfg BreakerConfig) *HealthTracker {
+	def := DefaultBreakerConfig()
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = def.FailureThreshold
+	}
+	if cfg.CoolDown <= 0 {
+		cfg.CoolDown = def.CoolDown
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = def.Window
+	}
+	return &HealthTracker{cfg: cfg, now: time.Now, strategies: make(map[string]*StrategyHealth)}
+}
+
+// For returns the health record for the named strategy, creating it if needed.
+func (t *HealthTracker) For(name string) *StrategyHealth {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	h, ok := t.strategies[name]
+	if !ok {
+		h = &StrategyHealth{cfg: t.cfg, now: t.now}
+		t.strategies[name] = h
+	}
+	return h
+}
+
+// Order returns strategies sorted by recent success rate (descending), then
+// by average latency (ascending). Ties keep their configured order.
+func (t *HealthTracker) Order(strategies []Strategy) []Strategy {
+	type scored struct {
+		s       Strategy
+		rate    float64
+		latency time.Duration
+	}
+	items := make([]scored, len(strategies))
+	for i, s := range strategies {
+		h := t.For(s.Name())
+		h.mu.Lock()
+		items[i] = scored{s: s, rate: h.successRate(), latency: h.latency}
+		h.mu.Unlock()
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].rate != items[j].rate {
+			return items[i].rate > items[j].rate
+		}
+		// Only reorder on latency once both have been measured.
+		if items[i].latency == 0 || items[j].latency == 0 {
+			return false
+		}
+		return items[i].latency < items[j].latency
+	})
+	out := make([]Strategy, len(items))
+	for i, it := range items {
+		out[i] = it.s
+	}
+	return out
+}
+
+// Snapshot returns the health of every tracked strategy, sorted by name.
+func (t *HealthTracker) Snapshot() []HealthSnapshot {
+	t.mu.Lock()
+	names := make([]string, 0, len(t.strategies))
+	for name := range t.strategies {
+		names = append(names, name)
+	}
+	t.mu.Unlock()
+	sort.Strings(names)
+
+	out := make([]HealthSnapshot, 0, len(names))
+	for _, name := range names {
+		h := t.For(name)
+		h.mu.Lock()
+		out = append(out, HealthSnapshot{
+			Strategy:            name,
+			State:               h.state.String(),
+			SuccessRate:         h.successRate(),
+			LatencyMs:           h.latency.Milliseconds(),
+			ConsecutiveFailures: h.consecutive,
+			Samples:             len(h.outcomes),
+		})
+		h.mu.Unlock()
+	}
+	return out
+}
+
+// HealthReporter is implemented by scrapers that track per-strategy health.
+type HealthReporter interface {
+	Health() []HealthSnapshot
+}
+
+// CircuitOpenError is returned for a strategy skipped because its breaker is open.
+type CircuitOpenError struct {
+	Strategy string
+	RetryIn  time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit open, skipped (next probe in %s)", e.RetryIn.Round(time.Second))
+}
@@ -0,0 +1,143 @@
+package platform
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock that only moves when told to.
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time          { return c.now }
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newTestTracker(cfg BreakerConfig) (*HealthTracker, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	t := NewHealthTracker(cfg)
+	t.now = clock.Now
+	return t, clock
+}
+
+func TestBreakerTransitions(t *testing.T) {
+	tracker, clock := newTestTracker(BreakerConfig{FailureThreshold: 2, CoolDown: time.Minute})
+	h := tracker.For("graphql")
+	state := func() string { return tracker.Snapshot()[0].State }
+
+	h.Record(false, time.Second)
+	if !h.Allow() || state() != "closed" {
+		t.Fatalf("one failure under the threshold: state %s", state())
+	}
+	h.Record(false, time.Second)
+	if h.Allow() || state() != "open" {
+		t.Fatalf("threshold reached: state %s", state())
+	}
+
+	// The cool-down runs on the injected clock.
+	clock.Advance(40 * time.Second)
+	if h.Allow() {
+		t.Fatal("admitted during the cool-down")
+	}
+	if got := h.RetryIn(); got != 20*time.Second {
+		t.Errorf("RetryIn = %s, want 20s", got)
+	}
+
+	// After the cool-down exactly one probe is admitted.
+	clock.Advance(20 * time.Second)
+	if !h.Allow() || state() != "half-open" {
+		t.Fatalf("cool-down over: state %s", state())
+	}
+	if h.Allow() {
+		t.Fatal("admitted a second probe while one is in flight")
+	}
+	h.Release()
+	if !h.Allow() {
+		t.Fatal("released probe slot not reusable")
+	}
+
+	// A failed probe reopens the breaker for another full cool-down.
+	h.Record(false, time.Second)
+	if h.Allow() || state() != "open" || h.RetryIn() != time.Minute {
+		t.Fatalf("failed probe: state %s, retry in %s", state(), h.RetryIn())
+	}
+
+	// A successful probe closes it.
+	clock.Advance(time.Minute)
+	h.Allow()
+	h.Record(true, time.Second)
+	if !h.Allow() || !h.Allow() || state() != "closed" || h.RetryIn() != 0 {
+		t.Fatalf("successful probe: state %s", state())
+	}
+}
+
+// namedStrategy is a Strategy that only has a name.
+type namedStrategy string
+
+func (s namedStrategy) Name() string { return string(s) }
+
+func (s namedStrategy) Execute(ctx context.Context, req Request) (*Result, error) {
+	return nil, nil
+}
+
+func TestHealthOrder(t *testing.T) {
+	names := func(ss []Strategy) []string {
+		var out []string
+		for _, s := range ss {
+			out = append(out, s.Name())
+		}
+		return out
+	}
+	configured := []Strategy{namedStrategy("graphql"), namedStrategy("mobile"), namedStrategy("static")}
+
+	tests := []struct {
+		name   string
+		record map[string][]time.Duration // latencies; negative ones are failures
+		want   []string
+	}{
+		{
+			name: "no history keeps the configured order",
+			want: []string{"graphql", "mobile", "static"},
+		},
+		{
+			name: "success rate first",
+			record: map[string][]time.Duration{
+				"graphql": {time.Second, -time.Second},
+				"mobile":  {5 * time.Second},
+			},
+			want: []string{"mobile", "static", "graphql"},
+		},
+		{
+			name: "then latency",
+			record: map[string][]time.Duration{
+				"graphql": {3 * time.Second},
+				"mobile":  {2 * time.Second},
+				"static":  {time.Second},
+			},
+			want: []string{"static", "mobile", "graphql"},
+		},
+		{
+			name: "unmeasured latency keeps its place",
+			record: map[string][]time.Duration{
+				"mobile": {time.Second},
+				"static": {500 * time.Millisecond},
+			},
+			want: []string{"graphql", "static", "mobile"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker, _ := newTestTracker(BreakerConfig{})
+			for name, latencies := range tt.record {
+				for _, l := range latencies {
+					tracker.For(name).Record(l > 0, l.Abs())
+				}
+			}
+			got := names(tracker.Order(configured))
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Fatalf("order = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -21,6 +21,10 @@ type Request struct {
 	URL     string
 	Page    int
 	Limit   int
+
+	// Location is the buyer location results are fetched for, in the
+	// platform's own notation (empty: the platform's default).
+	Location string
 }
 
 type Result struct {
@@ -31,13 +35,19 @@ type Result struct {
 }
 
 type SearchOpts struct {
-	Page  int
-	Limit int
+	Page     int
+	Limit    int
+	Location string // buyer location, e.g. "surabaya" (see Request.Location)
 }
 
 type TrendingOpts struct {
 	Category string
 	Limit    int
+	Location string // buyer location, e.g. "surabaya" (see Request.Location)
+}
+
+type DetailOpts struct {
+	Location string // buyer location, e.g. "surabaya" (see Request.Location)
 }
 
 type Strategy interface {
@@ -48,5 +58,12 @@ type Strategy interface {
 type Scraper interface {
 	Search(ctx context.Context, keyword string, opts SearchOpts) ([]models.Product, error)
 	Trending(ctx context.Context, opts TrendingOpts) ([]models.Product, error)
-	ProductDetail(ctx context.Context, url string) (*models.Product, error)
+	ProductDetail(ctx context.Context, url string, opts DetailOpts) (*models.Product, error)
+}
+
+// LocationResolver is implemented by scrapers that accept buyer locations.
+// CanonicalLocation returns the one name a location has however it is
+// spelled, e.g. "surabaya/gubeng" for "Surabaya".
+type LocationResolver interface {
+	CanonicalLocation(location string) (string, error)
 }
@@ -1,21 +1,23 @@
 package platform
 
-import "context"
+import (
+	"context"
 
-// ProgressFunc is a callback for reporting progress messages.
-type ProgressFunc func(msg string)
+	"github.com/lukman83/kidkazz-scrap/internal/progress"
+)
 
-type progressKey struct{}
+// ProgressFunc is a callback for reporting progress messages.
+type ProgressFunc = progress.Func
 
 // WithProgress returns a context carrying the given progress callback.
 func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
-	return context.WithValue(ctx, progressKey{}, fn)
+	return progress.With(ctx, fn)
 }
 
-// ReportProgress calls the progress callback in ctx, if any.
-// Safe to call when no callback is set (e.g. MCP mode) — it simply returns.
+// ReportProgress calls the progress callback in ctx, if any, and logs msg at
+// debug level. Safe to call when no callback is set. The CLI spinner and MCP
+// progress notifications are both fed from here, as are the HTTP client's
+// and transport's messages (see package progress).
 func ReportProgress(ctx context.Context, msg string) {
-	if fn, ok := ctx.Value(progressKey{}).(ProgressFunc); ok && fn != nil {
-		fn(msg)
-	}
+	progress.Report(ctx, msg)
 }
@@ -35,3 +35,21 @@ func List() []string {
 	}
 	return names
 }
+
+// Unwrapper is implemented by scrapers that decorate another, such as the
+// response cache. Optional capabilities (health, drift, selfcheck) live on
+// the innermost scraper.
+type Unwrapper interface {
+	Unwrap() Scraper
+}
+
+// Underlying returns the innermost scraper behind any decorators.
+func Underlying(s Scraper) Scraper {
+	for {
+		u, ok := s.(Unwrapper)
+		if !ok {
+			return s
+		}
+		s = u.Unwrap()
+	}
+}
@@ -0,0 +1,89 @@
+package platform
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/lukman83/kidkazz-scrap/internal/progress"
+)
+
+// ResultInfo describes how a request's products were obtained: what a
+// caller reporting more than the products (the MCP tools) needs.
+type ResultInfo struct {
+	TotalData int       // matching products on the platform; 0 if unknown
+	Strategy  string    // strategy that produced the products
+	CachedAt  time.Time // when the response cache stored them; zero if scraped now
+	Warnings  []string  // failed strategies, drift, stale data, ...
+}
+
+type resultKey struct{}
+
+type resultRecorder struct {
+	mu   sync.Mutex
+	info ResultInfo
+}
+
+// WithResultInfo returns a context whose scrapes record their ResultInfo,
+// and a function returning what has been recorded so far. Warnings from
+// packages below platform (progress.Warn) are recorded too.
+func WithResultInfo(ctx context.Context) (context.Context, func() ResultInfo) {
+	r := &resultRecorder{}
+	ctx = progress.WithWarnings(context.WithValue(ctx, resultKey{}, r), r.warn)
+	return ctx, func() ResultInfo {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		info := r.info
+		info.Warnings = slices.Clone(info.Warnings)
+		return info
+	}
+}
+
+func recorderFrom(ctx context.Context) *resultRecorder {
+	r, _ := ctx.Value(resultKey{}).(*resultRecorder)
+	return r
+}
+
+// SetResult records the strategy that produced ctx's products and the
+// platform's total match count.
+func SetResult(ctx context.Context, strategy string, totalData int) {
+	if r := recorderFrom(ctx); r != nil {
+		r.mu.Lock()
+		r.info.Strategy, r.info.TotalData = strategy, totalData
+		r.mu.Unlock()
+	}
+}
+
+// Warn records msg as a warning about ctx's result. Callers report it as
+// progress themselves, in their own words.
+func Warn(ctx context.Context, msg string) {
+	progress.Warn(ctx, msg)
+}
+
+func (r *resultRecorder) warn(msg string) {
+	r.mu.Lock()
+	r.info.Warnings = append(r.info.Warnings, msg)
+	r.mu.Unlock()
+}
+
+// MergeResult records info, obtained under another context (a shared or
+// cached scrape), as ctx's. Set fields replace ctx's; warnings are appended.
+func MergeResult(ctx context.Context, info ResultInfo) {
+	r := recorderFrom(ctx)
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if info.Strategy != "" {
+		r.info.Strategy = info.Strategy
+	}
+	if info.TotalData != 0 {
+		r.info.TotalData = info.TotalData
+	}
+	if !info.CachedAt.IsZero() {
+		r.info.CachedAt = info.CachedAt
+	}
+	r.info.Warnings = append(r.info.Warnings, info.Warnings...)
+}
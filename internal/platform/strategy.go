@@ -0,0 +1,17 @@
+package platform
+
+import "context"
+
+type strategyKey struct{}
+
+// WithStrategy returns a context that restricts scrapers to the named strategy,
+// skipping the usual fallback chain. Used for debugging a strategy in isolation.
+func WithStrategy(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, strategyKey{}, name)
+}
+
+// StrategyFrom returns the strategy forced by WithStrategy, or "" for the full chain.
+func StrategyFrom(ctx context.Context) string {
+	name, _ := ctx.Value(strategyKey{}).(string)
+	return name
+}
@@ -0,0 +1,50 @@
+// Package progress carries progress and warning callbacks in a context, so
+// low-level packages (HTTP client, transport) can report what they are doing
+// without depending on the scraping domain.
+package progress
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Func receives progress messages or warnings.
+type Func func(msg string)
+
+type (
+	progressKey struct{}
+	warnKey     struct{}
+)
+
+// With returns a context carrying the given progress callback.
+func With(ctx context.Context, fn Func) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// From returns the progress callback in ctx, or nil.
+func From(ctx context.Context) Func {
+	fn, _ := ctx.Value(progressKey{}).(Func)
+	return fn
+}
+
+// Report calls the progress callback in ctx, if any, and logs msg at debug
+// level. Safe to call when no callback is set.
+func Report(ctx context.Context, msg string) {
+	slog.DebugContext(ctx, msg, "progress", true)
+	if fn, ok := ctx.Value(progressKey{}).(Func); ok && fn != nil {
+		fn(msg)
+	}
+}
+
+// WithWarnings returns a context whose warnings are passed to fn.
+func WithWarnings(ctx context.Context, fn Func) context.Context {
+	return context.WithValue(ctx, warnKey{}, fn)
+}
+
+// Warn passes msg to the warning callback in ctx, if any. Callers report it
+// as progress themselves, in their own words.
+func Warn(ctx context.Context, msg string) {
+	if fn, ok := ctx.Value(warnKey{}).(Func); ok && fn != nil {
+		fn(msg)
+	}
+}
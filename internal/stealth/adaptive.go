@@ -0,0 +1,116 @@
+package stealth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// backoffFactor is the multiplicative decrease applied on each throttle signal.
+	backoffFactor = 0.5
+	// minRateFraction is the lowest rate a host can be throttled to, relative to the configured rate.
+	minRateFraction = 0.05
+	// recoverFraction is the additive increase per successful request, relative to the configured rate.
+	recoverFraction = 0.05
+)
+
+// AdaptiveLimiter is a per-host AIMD rate limiter. Throttle signals (429, 403,
+// challenge pages) halve a host's rate and may pause it for a Retry-After
+// window; each successful response adds back a small fraction of the
+// configured rate until it is fully recovered.
+type AdaptiveLimiter struct {
+	max   rate.Limit
+	burst int
+	mu    sync.Mutex
+	hosts map[string]*hostLimiter
+}
+
+type hostLimiter struct {
+	limiter     *rate.Limiter
+	pausedUntil time.Time
+}
+
+// NewAdaptiveLimiter creates a limiter allowing up to perSecond requests per host.
+func NewAdaptiveLimiter(perSecond float64, burst int) *AdaptiveLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &AdaptiveLimiter{
+		max:   rate.Limit(perSecond),
+		burst: burst,
+		hosts: make(map[string]*hostLimiter),
+	}
+}
+
+func (a *AdaptiveLimiter) host(host string) *hostLimiter {
+	h, ok := a.hosts[host]
+	if !ok {
+		h = &hostLimiter{limiter: rate.NewLimiter(a.max, a.burst)}
+		a.hosts[host] = h
+	}
+	return h
+}
+
+// Wait blocks until host is out of any Retry-After pause and a token is available.
+func (a *AdaptiveLimiter) Wait(ctx context.Context, host string) error {
+	a.mu.Lock()
+	h := a.host(host)
+	pause := time.Until(h.pausedUntil)
+	a.mu.Unlock()
+
+	if pause > 0 {
+		select {
+		case <-time.After(pause):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return h.limiter.Wait(ctx)
+}
+
+// Backoff halves the host's rate and pauses it for retryAfter (if positive).
+// It returns the new effective rate.
+func (a *AdaptiveLimiter) Backoff(host string, retryAfter time.Duration) rate.Limit {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	h := a.host(host)
+	next := h.limiter.Limit() * backoffFactor
+	if floor := a.max * minRateFraction; next < floor {
+		next = floor
+	}
+	h.limiter.SetLimit(next)
+	if retryAfter > 0 {
+		if until := time.Now().Add(retryAfter); until.After(h.pausedUntil) {
+			h.pausedUntil = until
+		}
+	}
+	return next
+}
+
+// Success additively restores the host's rate towards the configured maximum.
+func (a *AdaptiveLimiter) Success(host string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	h := a.host(host)
+	cur := h.limiter.Limit()
+	if cur >= a.max {
+		return
+	}
+	next := cur + a.max*recoverFraction
+	if next > a.max {
+		next = a.max
+	}
+	h.limiter.SetLimit(next)
+}
+
+// Rate returns the current effective rate for host.
+func (a *AdaptiveLimiter) Rate(host string) rate.Limit {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.host(host).limiter.Limit()
+}
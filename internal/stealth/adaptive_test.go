@@ -0,0 +1,66 @@
+package stealth
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func near(a, b rate.Limit) bool { return math.Abs(float64(a-b)) < 1e-9 }
+
+func TestAdaptiveLimiterAIMD(t *testing.T) {
+	a := NewAdaptiveLimiter(10, 1)
+
+	// Each throttle signal halves the rate, down to 5% of the configured one.
+	for _, want := range []rate.Limit{5, 2.5, 1.25, 0.625, 0.5, 0.5} {
+		if got := a.Backoff("a.example", 0); !near(got, want) {
+			t.Fatalf("after backoff rate = %v, want %v", got, want)
+		}
+	}
+	if got := a.Rate("b.example"); got != 10 {
+		t.Errorf("other host throttled to %v", got)
+	}
+
+	// Each success adds back 5% of the configured rate, up to the full rate.
+	a.Success("a.example")
+	if got := a.Rate("a.example"); !near(got, 1) {
+		t.Errorf("after one success rate = %v, want 1", got)
+	}
+	for i := 0; i < 30; i++ {
+		a.Success("a.example")
+	}
+	if got := a.Rate("a.example"); got != 10 {
+		t.Errorf("after recovering rate = %v, want 10", got)
+	}
+}
+
+func TestAdaptiveLimiterRetryAfter(t *testing.T) {
+	a := NewAdaptiveLimiter(1000, 10)
+	a.Backoff("a.example", 50*time.Millisecond)
+	// A shorter Retry-After does not cut the pause short.
+	a.Backoff("a.example", time.Millisecond)
+
+	start := time.Now()
+	if err := a.Wait(context.Background(), "a.example"); err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(start); waited < 40*time.Millisecond {
+		t.Errorf("waited %s, want the Retry-After pause", waited)
+	}
+
+	start = time.Now()
+	if err := a.Wait(context.Background(), "b.example"); err != nil || time.Since(start) > 20*time.Millisecond {
+		t.Errorf("unpaused host: err %v after %s", err, time.Since(start))
+	}
+
+	a.Backoff("a.example", time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := a.Wait(ctx, "a.example"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("paused wait err = %v, want the context's", err)
+	}
+}
@@ -0,0 +1,550 @@
+package stealth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+
+	"github.com/lukman83/kidkazz-scrap/internal/crawl"
+)
+
+// Jar is an RFC 6265 cookie jar for one browser identity. Unlike
+// net/http/cookiejar it can list its cookies, so they can be saved to disk
+// and copied into the headless browser.
+type Jar struct {
+	mu       sync.Mutex
+	cookies  map[string]*JarCookie // by domain;path;name
+	onChange func()
+	ignored  func(name string) bool // cookies never stored or sent; nil = none
+}
+
+// JarCookie is a stored cookie with the attributes needed to match it.
+type JarCookie struct {
+	Name     string    `json:"name"`
+	Value    string    `json:"value"`
+	Domain   string    `json:"domain"`
+	Path     string    `json:"path"`
+	HostOnly bool      `json:"host_only,omitempty"`
+	Secure   bool      `json:"secure,omitempty"`
+	HTTPOnly bool      `json:"http_only,omitempty"`
+	Expires  time.Time `json:"expires,omitzero"` // zero = session cookie
+	Created  time.Time `json:"created"`          // orders cookies with equal paths
+}
+
+func (c *JarCookie) key() string { return c.Domain + ";" + c.Path + ";" + c.Name }
+
+func (c *JarCookie) expired(now time.Time) bool {
+	return !c.Expires.IsZero() && !c.Expires.After(now)
+}
+
+func newJar(onChange func(), ignored func(string) bool) *Jar {
+	return &Jar{cookies: make(map[string]*JarCookie), onChange: onChange, ignored: ignored}
+}
+
+func (j *Jar) ignore(name string) bool {
+	return j.ignored != nil && j.ignored(name)
+}
+
+// SetCookies stores the cookies a response from u set, implementing
+// http.CookieJar. Cookies for a domain u cannot set are ignored.
+func (j *Jar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	host := strings.ToLower(u.Hostname())
+	now := time.Now()
+	changed := false
+
+	j.mu.Lock()
+	for _, c := range cookies {
+		if j.ignore(c.Name) {
+			continue
+		}
+		jc := &JarCookie{Name: c.Name, Value: c.Value, Path: c.Path, Secure: c.Secure, HTTPOnly: c.HttpOnly}
+		if c.Domain == "" {
+			jc.Domain, jc.HostOnly = host, true
+		} else {
+			d := strings.TrimPrefix(strings.ToLower(c.Domain), ".")
+			if !domainMatch(host, d) || (!strings.Contains(d, ".") && d != host) {
+				continue
+			}
+			jc.Domain = d
+		}
+		if jc.Path == "" || jc.Path[0] != '/' {
+			jc.Path = defaultPath(u.Path)
+		}
+		switch {
+		case c.MaxAge < 0:
+			jc.Expires = now
+		case c.MaxAge > 0:
+			jc.Expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+		case !c.Expires.IsZero():
+			jc.Expires = c.Expires
+		}
+
+		if jc.expired(now) {
+			if _, ok := j.cookies[jc.key()]; ok {
+				delete(j.cookies, jc.key())
+				changed = true
+			}
+			continue
+		}
+		jc.Created = now
+		if old, ok := j.cookies[jc.key()]; ok {
+			jc.Created = old.Created
+		}
+		j.cookies[jc.key()] = jc
+		changed = true
+	}
+	j.mu.Unlock()
+
+	if changed && j.onChange != nil {
+		j.onChange()
+	}
+}
+
+// Cookies returns the cookies to send to u, longest path first, then oldest
+// first, implementing http.CookieJar.
+func (j *Jar) Cookies(u *url.URL) []*http.Cookie {
+	host := strings.ToLower(u.Hostname())
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	now := time.Now()
+
+	j.mu.Lock()
+	var matched []*JarCookie
+	for k, c := range j.cookies {
+		if c.expired(now) {
+			delete(j.cookies, k)
+			continue
+		}
+		if j.ignore(c.Name) {
+			continue
+		}
+		if c.HostOnly && host != c.Domain || !c.HostOnly && !domainMatch(host, c.Domain) {
+			continue
+		}
+		if !pathMatch(path, c.Path) || c.Secure && u.Scheme != "https" {
+			continue
+		}
+		matched = append(matched, c)
+	}
+	j.mu.Unlock()
+
+	slices.SortFunc(matched, func(a, b *JarCookie) int {
+		if d := len(b.Path) - len(a.Path); d != 0 {
+			return d
+		}
+		if d := a.Created.Compare(b.Created); d != 0 {
+			return d
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	out := make([]*http.Cookie, len(matched))
+	for i, c := range matched {
+		out[i] = &http.Cookie{Name: c.Name, Value: c.Value}
+	}
+	return out
+}
+
+// All returns a copy of every unexpired cookie.
+func (j *Jar) All() []JarCookie {
+	now := time.Now()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	out := make([]JarCookie, 0, len(j.cookies))
+	for _, c := range j.cookies {
+		if !c.expired(now) && !j.ignore(c.Name) {
+			out = append(out, *c)
+		}
+	}
+	return out
+}
+
+// Store adds cookies as they are, e.g. those read back from the headless
+// browser. Unchanged cookies do not mark the jar dirty.
+func (j *Jar) Store(cookies []JarCookie) {
+	now := time.Now()
+	changed := false
+	j.mu.Lock()
+	for _, c := range cookies {
+		if j.ignore(c.Name) {
+			continue
+		}
+		c.Domain = strings.TrimPrefix(strings.ToLower(c.Domain), ".")
+		if c.Path == "" {
+			c.Path = "/"
+		}
+		if c.expired(now) {
+			continue
+		}
+		old, ok := j.cookies[c.key()]
+		if ok && old.Value == c.Value && old.Expires.Equal(c.Expires) {
+			continue
+		}
+		switch {
+		case ok:
+			c.Created = old.Created
+		case c.Created.IsZero():
+			c.Created = now
+		}
+		j.cookies[c.key()] = &c
+		changed = true
+	}
+	j.mu.Unlock()
+
+	if changed && j.onChange != nil {
+		j.onChange()
+	}
+}
+
+// domainMatch reports whether host is domain or a subdomain of it.
+func domainMatch(host, domain string) bool {
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// pathMatch implements the RFC 6265 path-match rule.
+func pathMatch(reqPath, cookiePath string) bool {
+	if reqPath == cookiePath {
+		return true
+	}
+	if !strings.HasPrefix(reqPath, cookiePath) {
+		return false
+	}
+	return strings.HasSuffix(cookiePath, "/") || reqPath[len(cookiePath)] == '/'
+}
+
+// defaultPath is the RFC 6265 default cookie path: the request path's directory.
+func defaultPath(p string) string {
+	i := strings.LastIndex(p, "/")
+	if i <= 0 {
+		return "/"
+	}
+	return p[:i]
+}
+
+// CookieJars holds one Jar per session (crawl), so concurrent crawls never
+// see each other's cookies even when they present the same browser profile.
+// With a file the jars persist between runs, encrypted with AES-256-GCM:
+// a saved jar remembers its profile, and a new session on that profile takes
+// over one idle saved jar, like a returning visitor. A jar is idle once its
+// session has been unused for crawl.SessionTTL.
+type CookieJars struct {
+	path    string
+	keyFile string
+	key     []byte // nil until loaded or first saved
+	salt    []byte // scrypt salt when the key comes from a passphrase
+
+	passphrase string
+
+	// ignoreMu guards ignored. Jars read it under their own lock, which
+	// mu is held around, so it cannot be mu.
+	ignoreMu sync.RWMutex
+	ignored  map[string]bool
+
+	mu    sync.Mutex
+	jars  *crawl.SessionMap[*sessionJar] // by session ID
+	idle  map[string][]*Jar              // saved or released jars by profile, most recent last
+	dirty bool
+	timer *time.Timer
+}
+
+// sessionJar is the jar a session holds and the profile it presents.
+type sessionJar struct {
+	jar     *Jar
+	profile string
+}
+
+// savedJar is one jar in the cookie file.
+type savedJar struct {
+	Profile string      `json:"profile"`
+	Cookies []JarCookie `json:"cookies"`
+}
+
+// autosaveDelay batches cookie changes into one write in long-running servers.
+const autosaveDelay = 10 * time.Second
+
+// NewCookieJars creates in-memory jars that are never saved.
+func NewCookieJars() *CookieJars {
+	c := &CookieJars{ignored: make(map[string]bool), idle: make(map[string][]*Jar)}
+	c.jars = crawl.NewSessionMap(crawl.SessionTTL, c.release)
+	return c
+}
+
+// Ignore keeps the named cookies out of every jar: they are neither stored
+// from responses or the headless browser nor sent, and ones already saved
+// are dropped. It is for cookies a
+// scraper sets per request, such as the delivery address, which must not
+// carry over to the session's later requests.
+func (c *CookieJars) Ignore(names ...string) {
+	c.ignoreMu.Lock()
+	defer c.ignoreMu.Unlock()
+	for _, name := range names {
+		c.ignored[name] = true
+	}
+}
+
+func (c *CookieJars) isIgnored(name string) bool {
+	c.ignoreMu.RLock()
+	defer c.ignoreMu.RUnlock()
+	return c.ignored[name]
+}
+
+// OpenCookieJars loads the jars saved at path, if it exists. The key is
+// derived from passphrase (scrypt) or, when passphrase is empty, read from
+// keyFile, which is created with mode 0600 on first save. An empty keyFile
+// means DefaultCookieKeyFile.
+func OpenCookieJars(path, passphrase, keyFile string) (*CookieJars, error) {
+	if passphrase == "" && keyFile == "" {
+		var err error
+		if keyFile, err = DefaultCookieKeyFile(); err != nil {
+			return nil, fmt.Errorf("cookie jar: %w", err)
+		}
+	}
+	c := NewCookieJars()
+	c.path, c.passphrase, c.keyFile = path, passphrase, keyFile
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cookie jar: %w", err)
+	}
+	if err := c.decode(data); err != nil {
+		return nil, fmt.Errorf("cookie jar %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// DefaultCookieKeyFile is where the cookie key lives when neither a
+// passphrase nor a key file is configured: the user's config directory,
+// away from the jar so a copy of the jar alone cannot be decrypted.
+func DefaultCookieKeyFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "kidkazz", "cookie.key"), nil
+}
+
+// For returns the jar of session, which presents the named browser profile.
+// A session's first call takes over the most recently used idle jar of
+// profile, if any.
+func (c *CookieJars) For(session, profile string) *Jar {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.jars.Get(session, func() *sessionJar {
+		s := &sessionJar{profile: profile}
+		if idle := c.idle[profile]; len(idle) > 0 {
+			s.jar = idle[len(idle)-1]
+			c.idle[profile] = idle[:len(idle)-1]
+		} else {
+			s.jar = newJar(c.changed, c.isIgnored)
+		}
+		return s
+	})
+	return s.jar
+}
+
+// release returns the jar of a session unused for crawl.SessionTTL to the
+// idle pool. Empty jars are dropped. It runs from c.jars.Get, under c.mu.
+func (c *CookieJars) release(_ string, s *sessionJar) {
+	if len(s.jar.All()) > 0 {
+		c.idle[s.profile] = append(c.idle[s.profile], s.jar)
+	}
+}
+
+// changed marks the jars dirty and schedules a save.
+func (c *CookieJars) changed() {
+	if c.path == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dirty = true
+	if c.timer == nil {
+		c.timer = time.AfterFunc(autosaveDelay, func() {
+			if err := c.Save(); err != nil {
+				slog.Warn("cookie jar save failed", "path", c.path, "err", err)
+			}
+		})
+	}
+}
+
+// Save writes the jars to disk if they changed since the last save. It is
+// a no-op for in-memory jars.
+func (c *CookieJars) Save() error {
+	if c.path == "" {
+		return nil
+	}
+	c.mu.Lock()
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	if !c.dirty {
+		c.mu.Unlock()
+		return nil
+	}
+	var state []savedJar
+	keep := func(profile string, j *Jar) {
+		if cookies := j.All(); len(cookies) > 0 {
+			state = append(state, savedJar{Profile: profile, Cookies: cookies})
+		}
+	}
+	for profile, jars := range c.idle {
+		for _, j := range jars {
+			keep(profile, j)
+		}
+	}
+	c.jars.Each(func(_ string, s *sessionJar) {
+		keep(s.profile, s.jar)
+	})
+	c.dirty = false
+	c.mu.Unlock()
+
+	plain, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	data, err := c.encode(plain)
+	if err != nil {
+		return fmt.Errorf("cookie jar: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o700); err != nil {
+		return fmt.Errorf("cookie jar: %w", err)
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("cookie jar: %w", err)
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// jarFile is the on-disk format: the AES-GCM sealed JSON list of savedJar.
+type jarFile struct {
+	Version int    `json:"version"`
+	Salt    []byte `json:"salt,omitempty"` // scrypt salt; absent when a key file is used
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+func (c *CookieJars) decode(data []byte) error {
+	var f jarFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return err
+	}
+	if f.Version != 1 {
+		return fmt.Errorf("unsupported version %d", f.Version)
+	}
+	c.salt = f.Salt
+	if err := c.loadKey(false); err != nil {
+		return err
+	}
+	aead, err := newAEAD(c.key)
+	if err != nil {
+		return err
+	}
+	plain, err := aead.Open(nil, f.Nonce, f.Data, nil)
+	if err != nil {
+		return errors.New("cannot decrypt (wrong KIDKAZZ_COOKIE_KEY or key file?)")
+	}
+
+	var state []savedJar
+	if err := json.Unmarshal(plain, &state); err != nil {
+		return err
+	}
+	for _, saved := range state {
+		j := newJar(nil, c.isIgnored) // loading is not a change
+		j.Store(saved.Cookies)
+		j.onChange = c.changed
+		c.idle[saved.Profile] = append(c.idle[saved.Profile], j)
+	}
+	return nil
+}
+
+func (c *CookieJars) encode(plain []byte) ([]byte, error) {
+	if err := c.loadKey(true); err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(c.key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return json.Marshal(jarFile{Version: 1, Salt: c.salt, Nonce: nonce, Data: aead.Seal(nil, nonce, plain, nil)})
+}
+
+// loadKey sets c.key from the passphrase or the key file, creating the salt
+// or key file when create is set and they do not exist yet.
+func (c *CookieJars) loadKey(create bool) error {
+	if c.key != nil {
+		return nil
+	}
+	if c.passphrase != "" {
+		if c.salt == nil {
+			if !create {
+				return errors.New("file was not encrypted with a passphrase; unset KIDKAZZ_COOKIE_KEY")
+			}
+			c.salt = make([]byte, 16)
+			if _, err := rand.Read(c.salt); err != nil {
+				return err
+			}
+		}
+		key, err := scrypt.Key([]byte(c.passphrase), c.salt, 1<<15, 8, 1, 32)
+		if err != nil {
+			return err
+		}
+		c.key = key
+		return nil
+	}
+
+	if c.salt != nil {
+		return errors.New("file is encrypted with a passphrase; set KIDKAZZ_COOKIE_KEY")
+	}
+	keyPath := c.keyFile
+	key, err := os.ReadFile(keyPath)
+	if errors.Is(err, os.ErrNotExist) && create {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(keyPath), 0o700); err != nil {
+			return err
+		}
+		if err := os.WriteFile(keyPath, key, 0o600); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return fmt.Errorf("key file: %w", err)
+	}
+	if len(key) != 32 {
+		return fmt.Errorf("key file %s: want 32 bytes, got %d", keyPath, len(key))
+	}
+	c.key = key
+	return nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,121 @@
+package stealth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lukman83/kidkazz-scrap/internal/crawl"
+	"github.com/lukman83/kidkazz-scrap/internal/logging"
+)
+
+var shop, _ = url.Parse("https://www.tokopedia.com/")
+
+func setCookie(j *Jar, name, value string) {
+	j.SetCookies(shop, []*http.Cookie{{Name: name, Value: value, MaxAge: 3600}})
+}
+
+func cookieValue(j *Jar, name string) string {
+	for _, c := range j.Cookies(shop) {
+		if c.Name == name {
+			return c.Value
+		}
+	}
+	return ""
+}
+
+func TestCookieJarsPerSession(t *testing.T) {
+	jars := NewCookieJars()
+	a, b := jars.For("crawl-a", "chrome-win"), jars.For("crawl-b", "chrome-win")
+	setCookie(a, "_abck", "a")
+	if got := cookieValue(b, "_abck"); got != "" {
+		t.Errorf("crawl-b sees crawl-a's cookie %q", got)
+	}
+	if jars.For("crawl-a", "chrome-win") != a {
+		t.Error("crawl-a got a new jar on its second request")
+	}
+
+	// Once crawl-a is idle its jar goes to the next crawl on that profile.
+	jars.jars.Now = func() time.Time { return time.Now().Add(2 * crawl.SessionTTL) }
+	if got := cookieValue(jars.For("crawl-c", "chrome-win"), "_abck"); got != "a" {
+		t.Errorf("crawl-c did not take over the idle jar: _abck = %q", got)
+	}
+	if got := cookieValue(jars.For("crawl-d", "firefox-linux"), "_abck"); got != "" {
+		t.Errorf("another profile took over the jar: _abck = %q", got)
+	}
+}
+
+func TestCookieJarsPersist(t *testing.T) {
+	dir := t.TempDir()
+	path, keyFile := filepath.Join(dir, "cookies.jar"), filepath.Join(dir, "keys", "cookie.key")
+
+	jars, err := OpenCookieJars(path, "", keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setCookie(jars.For("run-1", "chrome-win"), "DID_JS", "x")
+	if err := jars.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(keyFile); err != nil {
+		t.Fatalf("key not written to the configured file: %v", err)
+	}
+	if _, err := os.Stat(path + ".key"); err == nil {
+		t.Error("key written next to the jar")
+	}
+
+	jars, err = OpenCookieJars(path, "", keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cookieValue(jars.For("run-2", "chrome-win"), "DID_JS"); got != "x" {
+		t.Errorf("next run's session: DID_JS = %q, want x", got)
+	}
+
+	if _, err := OpenCookieJars(path, "", filepath.Join(dir, "other.key")); err == nil {
+		t.Error("opened the jar without its key")
+	}
+	if _, err := OpenCookieJars(path, "passphrase", ""); err == nil {
+		t.Error("opened a key-file jar with a passphrase")
+	}
+}
+
+func TestTransportIgnoresCookies(t *testing.T) {
+	var sent []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var names []string
+		for _, c := range r.Cookies() {
+			names = append(names, c.Name)
+		}
+		sent = append(sent, strings.Join(names, ","))
+		http.SetCookie(w, &http.Cookie{Name: "_abck", Value: "sensor"})
+		http.SetCookie(w, &http.Cookie{Name: "local_cache", Value: "surabaya"})
+	}))
+	defer srv.Close()
+
+	pool, err := NewFingerprintPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	jars := NewCookieJars()
+	jars.Ignore("local_cache")
+	client := &http.Client{Transport: &StealthTransport{Fingerprint: pool, Cookies: jars}}
+	ctx := logging.WithRequestID(context.Background(), "crawl")
+	for range 2 {
+		req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if sent[1] != "_abck" {
+		t.Errorf("second request sent cookies %q, want only _abck", sent[1])
+	}
+}
@@ -3,6 +3,7 @@ package stealth
 import (
 	"context"
 	"math/rand/v2"
+	"sync"
 	"time"
 )
 
@@ -60,3 +61,39 @@ func (h *HumanDelay) randomBetween(min, max time.Duration) time.Duration {
 	}
 	return min + time.Duration(rand.Int64N(int64(max-min)))
 }
+
+// hostSpacer enforces a minimum interval between consecutive requests to the
+// same host. Concurrent callers are queued into successive slots rather than
+// all waking at once. The zero value is ready to use.
+type hostSpacer struct {
+	mu   sync.Mutex
+	next map[string]time.Time
+}
+
+// wait blocks until host's next slot, then books the following one interval later.
+func (s *hostSpacer) wait(ctx context.Context, host string, interval time.Duration) error {
+	s.mu.Lock()
+	if s.next == nil {
+		s.next = make(map[string]time.Time)
+	}
+	now := time.Now()
+	slot := s.next[host]
+	if slot.Before(now) {
+		slot = now
+	}
+	s.next[host] = slot.Add(interval)
+	s.mu.Unlock()
+
+	d := time.Until(slot)
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -1,99 +1,286 @@
 package stealth
 
 import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
 	"net/http"
-	"sync"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/lukman83/kidkazz-scrap/internal/crawl"
 )
 
-// Fingerprint represents a browser identity with matching UA and headers.
+// Fingerprint is a coherent browser profile: the UA, client hints, platform,
+// Accept-Language, viewport and header order of one real browser install.
+// Every field describes the same browser, so a Chrome-on-macOS profile never
+// claims Sec-Ch-Ua-Platform "Windows" and Edge sends Edge's brand list.
 type Fingerprint struct {
-	UserAgent string
-	Headers   http.Header
+	Name           string   `json:"name"`
+	Browser        string   `json:"browser"` // chrome, edge or firefox
+	Weight         int      `json:"weight"`  // relative selection weight (0 = 1)
+	UserAgent      string   `json:"user_agent"`
+	Platform       string   `json:"platform"`     // Windows, macOS or Linux
+	Architecture   string   `json:"architecture"` // CPU reported in client hints: x86 or arm; empty = x86
+	AcceptLanguage string   `json:"accept_language"`
+	Viewport       Viewport `json:"viewport"`
+
+	// Headers identify the browser and are sent on every request
+	// (client hints, Accept-Encoding).
+	Headers map[string]string `json:"headers"`
+	// NavigationHeaders are sent on top-level page loads.
+	NavigationHeaders map[string]string `json:"navigation_headers"`
+	// FetchHeaders are sent on XHR/fetch calls such as GraphQL.
+	FetchHeaders map[string]string `json:"fetch_headers"`
+	// HeaderOrder is the order the browser writes headers on the wire.
+	// net/http sorts headers itself; TLSImpersonator honours it.
+	HeaderOrder []string `json:"header_order"`
 }
 
-// FingerprintPool rotates through a set of browser fingerprints.
+// Viewport is a browser window's inner size in CSS pixels.
+type Viewport struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// NavigatorPlatform returns the navigator.platform value matching f.Platform.
+func (f Fingerprint) NavigatorPlatform() string {
+	switch f.Platform {
+	case "Windows":
+		return "Win32"
+	case "macOS":
+		return "MacIntel"
+	default:
+		return "Linux x86_64"
+	}
+}
+
+// Arch returns the CPU architecture Chromium reports for f in its
+// high-entropy client hints.
+func (f Fingerprint) Arch() string {
+	if f.Architecture == "" {
+		return "x86"
+	}
+	return f.Architecture
+}
+
+// Chromium reports whether f is a Chromium-based browser.
+func (f Fingerprint) Chromium() bool {
+	return f.Browser == "chrome" || f.Browser == "edge"
+}
+
+var brandRe = regexp.MustCompile(`"([^"]+)";v="([^"]+)"`)
+
+// Brands parses the Sec-Ch-Ua header into brand/version pairs, in order.
+// It is empty for browsers without client hints (Firefox).
+func (f Fingerprint) Brands() [][2]string {
+	var out [][2]string
+	for _, m := range brandRe.FindAllStringSubmatch(f.Headers["Sec-Ch-Ua"], -1) {
+		out = append(out, [2]string{m[1], m[2]})
+	}
+	return out
+}
+
+// validate checks that f is usable and internally consistent.
+func (f *Fingerprint) validate() error {
+	if f.Name == "" {
+		return errors.New("missing name")
+	}
+	if f.UserAgent == "" {
+		return fmt.Errorf("%s: missing user_agent", f.Name)
+	}
+	if !slices.Contains([]string{"chrome", "edge", "firefox"}, f.Browser) {
+		return fmt.Errorf("%s: browser %q is not one of chrome, edge, firefox", f.Name, f.Browser)
+	}
+	if !slices.Contains([]string{"Windows", "macOS", "Linux"}, f.Platform) {
+		return fmt.Errorf("%s: platform %q is not one of Windows, macOS, Linux", f.Name, f.Platform)
+	}
+	if !slices.Contains([]string{"", "x86", "arm"}, f.Architecture) {
+		return fmt.Errorf("%s: architecture %q is not one of x86, arm", f.Name, f.Architecture)
+	}
+	if f.Weight < 0 {
+		return fmt.Errorf("%s: weight must not be negative", f.Name)
+	}
+	// The file may spell header names in any case; canonicalize them.
+	for _, h := range []*map[string]string{&f.Headers, &f.NavigationHeaders, &f.FetchHeaders} {
+		canon := make(map[string]string, len(*h))
+		for k, v := range *h {
+			canon[http.CanonicalHeaderKey(k)] = v
+		}
+		*h = canon
+	}
+	if p := f.Headers["Sec-Ch-Ua-Platform"]; p != "" && p != `"`+f.Platform+`"` {
+		return fmt.Errorf("%s: Sec-Ch-Ua-Platform %s does not match platform %q", f.Name, p, f.Platform)
+	}
+	if f.Browser == "edge" && !strings.Contains(f.Headers["Sec-Ch-Ua"], "Microsoft Edge") {
+		return fmt.Errorf("%s: edge profile without the Microsoft Edge brand in Sec-Ch-Ua", f.Name)
+	}
+	if f.Browser == "firefox" && f.Headers["Sec-Ch-Ua"] != "" {
+		return fmt.Errorf("%s: firefox does not send Sec-Ch-Ua", f.Name)
+	}
+	return nil
+}
+
+//go:embed fingerprints.json
+var defaultFingerprintsJSON []byte
+
+// FingerprintPool picks browser profiles by weight. Requests that share a
+// session (one crawl) keep the same profile, so a site never sees one visitor
+// switch browsers mid-crawl.
 type FingerprintPool struct {
 	fingerprints []Fingerprint
-	mu           sync.Mutex
-	idx          int
+	total        int // sum of effective weights
+
+	sessions *crawl.SessionMap[int] // profile index by session ID
+}
+
+// NewFingerprintPool creates a pool with the built-in browser profiles.
+func NewFingerprintPool() (*FingerprintPool, error) {
+	fp, err := parseFingerprints(defaultFingerprintsJSON)
+	if err != nil {
+		return nil, fmt.Errorf("built-in fingerprints: %w", err)
+	}
+	return fp, nil
 }
 
-// NewFingerprintPool creates a pool with realistic browser fingerprints.
-func NewFingerprintPool() *FingerprintPool {
-	return &FingerprintPool{
-		fingerprints: defaultFingerprints(),
+// LoadFingerprintPool creates a pool from a JSON file holding an array of
+// profiles in the format of the built-in fingerprints.json.
+func LoadFingerprintPool(path string) (*FingerprintPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("fingerprints: %w", err)
 	}
+	fp, err := parseFingerprints(data)
+	if err != nil {
+		return nil, fmt.Errorf("fingerprints %s: %w", path, err)
+	}
+	return fp, nil
 }
 
-// Next returns the next fingerprint in round-robin order.
+func parseFingerprints(data []byte) (*FingerprintPool, error) {
+	var fps []Fingerprint
+	if err := json.Unmarshal(data, &fps); err != nil {
+		return nil, err
+	}
+	if len(fps) == 0 {
+		return nil, errors.New("no profiles")
+	}
+	pool := &FingerprintPool{sessions: crawl.NewSessionMap[int](crawl.SessionTTL, nil)}
+	for i := range fps {
+		if err := fps[i].validate(); err != nil {
+			return nil, err
+		}
+		pool.total += weight(fps[i])
+	}
+	pool.fingerprints = fps
+	return pool, nil
+}
+
+func weight(f Fingerprint) int {
+	return max(f.Weight, 1)
+}
+
+// Next returns a weighted random profile, independent of any session.
 func (fp *FingerprintPool) Next() Fingerprint {
-	fp.mu.Lock()
-	defer fp.mu.Unlock()
-	f := fp.fingerprints[fp.idx%len(fp.fingerprints)]
-	fp.idx++
-	return f
-}
-
-func defaultFingerprints() []Fingerprint {
-	return []Fingerprint{
-		// Chrome 133 — Windows
-		{
-			UserAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/133.0.0.0 Safari/537.36",
-			Headers:   chromeHeaders("133"),
-		},
-		// Chrome 133 — macOS
-		{
-			UserAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/133.0.0.0 Safari/537.36",
-			Headers:   chromeHeaders("133"),
-		},
-		// Chrome 133 — Linux
-		{
-			UserAgent: "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/133.0.0.0 Safari/537.36",
-			Headers:   chromeHeaders("133"),
-		},
-		// Firefox 135 — Windows
-		{
-			UserAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:135.0) Gecko/20100101 Firefox/135.0",
-			Headers:   firefoxHeaders(),
-		},
-		// Firefox 135 — macOS
-		{
-			UserAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:135.0) Gecko/20100101 Firefox/135.0",
-			Headers:   firefoxHeaders(),
-		},
-		// Edge 133 — Windows
-		{
-			UserAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/133.0.0.0 Safari/537.36 Edg/133.0.0.0",
-			Headers:   chromeHeaders("133"),
-		},
-	}
-}
-
-func chromeHeaders(version string) http.Header {
-	h := http.Header{}
-	h.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8")
-	h.Set("Accept-Language", "en-US,en;q=0.9")
-	h.Set("Accept-Encoding", "gzip, deflate, br")
-	h.Set("Sec-Ch-Ua", `"Chromium";v="`+version+`", "Not(A:Brand";v="99", "Google Chrome";v="`+version+`"`)
-	h.Set("Sec-Ch-Ua-Mobile", "?0")
-	h.Set("Sec-Ch-Ua-Platform", `"Windows"`)
-	h.Set("Sec-Fetch-Dest", "document")
-	h.Set("Sec-Fetch-Mode", "navigate")
-	h.Set("Sec-Fetch-Site", "none")
-	h.Set("Sec-Fetch-User", "?1")
-	h.Set("Upgrade-Insecure-Requests", "1")
-	return h
-}
-
-func firefoxHeaders() http.Header {
-	h := http.Header{}
-	h.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8")
-	h.Set("Accept-Language", "en-US,en;q=0.5")
-	h.Set("Accept-Encoding", "gzip, deflate, br")
-	h.Set("Sec-Fetch-Dest", "document")
-	h.Set("Sec-Fetch-Mode", "navigate")
-	h.Set("Sec-Fetch-Site", "none")
-	h.Set("Sec-Fetch-User", "?1")
-	h.Set("Upgrade-Insecure-Requests", "1")
-	return h
+	return fp.fingerprints[fp.pick(nil)]
+}
+
+// Session returns the profile assigned to session id, assigning one by weight
+// on first use. With browsers given, that first assignment is limited to
+// those browsers; a session keeps its profile for good once assigned. An
+// empty id behaves like Next.
+func (fp *FingerprintPool) Session(id string, browsers ...string) Fingerprint {
+	if id == "" {
+		return fp.fingerprints[fp.pick(browsers)]
+	}
+
+	idx := fp.sessions.Get(id, func() int { return fp.pick(browsers) })
+	return fp.fingerprints[idx]
+}
+
+// pick returns the index of a weighted random profile among browsers (all
+// when empty, or when none match).
+func (fp *FingerprintPool) pick(browsers []string) int {
+	match := func(f Fingerprint) bool {
+		return len(browsers) == 0 || slices.Contains(browsers, f.Browser)
+	}
+	total := 0
+	for _, f := range fp.fingerprints {
+		if match(f) {
+			total += weight(f)
+		}
+	}
+	if total == 0 {
+		browsers, total = nil, fp.total
+	}
+	n := rand.IntN(total)
+	for i, f := range fp.fingerprints {
+		if !match(f) {
+			continue
+		}
+		if n -= weight(f); n < 0 {
+			return i
+		}
+	}
+	return len(fp.fingerprints) - 1
+}
+
+type fingerprintKey struct{}
+
+// WithFingerprint returns ctx carrying the profile chosen for a request.
+func WithFingerprint(ctx context.Context, f Fingerprint) context.Context {
+	return context.WithValue(ctx, fingerprintKey{}, f)
+}
+
+// FingerprintFrom returns the profile StealthTransport applied to the
+// request carrying ctx.
+func FingerprintFrom(ctx context.Context) (Fingerprint, bool) {
+	f, ok := ctx.Value(fingerprintKey{}).(Fingerprint)
+	return f, ok
+}
+
+// Apply rewrites h to match f. Identity headers (User-Agent, Accept-Language,
+// Accept-Encoding and client hints) always follow the profile; navigations
+// get the profile's navigation headers, other requests its fetch headers
+// where the caller set none.
+func (f Fingerprint) Apply(h http.Header) {
+	for k := range h {
+		if strings.HasPrefix(k, "Sec-Ch-Ua") {
+			h.Del(k)
+		}
+	}
+	h.Set("User-Agent", f.UserAgent)
+	if f.AcceptLanguage != "" {
+		h.Set("Accept-Language", f.AcceptLanguage)
+	}
+	for k, v := range f.Headers {
+		h.Set(k, v)
+	}
+
+	if isNavigation(h) {
+		// A click from another page keeps the caller's Sec-Fetch-Site.
+		followed := h.Get("Referer") != "" && h.Get("Sec-Fetch-Site") != ""
+		for k, v := range f.NavigationHeaders {
+			if k == "Sec-Fetch-Site" && followed {
+				continue
+			}
+			h.Set(k, v)
+		}
+		return
+	}
+	for k, v := range f.FetchHeaders {
+		if h.Get(k) == "" {
+			h.Set(k, v)
+		}
+	}
+}
+
+// isNavigation reports whether h looks like a top-level page load.
+func isNavigation(h http.Header) bool {
+	return h.Get("Sec-Fetch-Mode") == "navigate" || strings.Contains(h.Get("Accept"), "text/html")
 }
@@ -0,0 +1,70 @@
+package stealth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuiltinFingerprints(t *testing.T) {
+	pool, err := NewFingerprintPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range pool.fingerprints {
+		if f.Chromium() && f.Architecture == "" {
+			t.Errorf("%s: no architecture for its client hints", f.Name)
+		}
+		if f.Chromium() && len(f.Brands()) == 0 {
+			t.Errorf("%s: no Sec-Ch-Ua brands", f.Name)
+		}
+	}
+}
+
+func TestParseFingerprints(t *testing.T) {
+	const chrome = `"name": "c", "browser": "chrome", "user_agent": "Mozilla/5.0", "platform": "Windows"`
+	tests := []struct {
+		name, json, err string
+	}{
+		{"valid", `[{` + chrome + `, "architecture": "arm"}]`, ""},
+		{"not json", `[{`, "unexpected end"},
+		{"empty", `[]`, "no profiles"},
+		{"bad architecture", `[{` + chrome + `, "architecture": "mips"}]`, "architecture"},
+		{"hints contradict platform", `[{` + chrome + `, "headers": {"sec-ch-ua-platform": "\"macOS\""}}]`, "does not match"},
+		{"firefox with client hints", `[{"name": "f", "browser": "firefox", "user_agent": "Mozilla/5.0", "platform": "Linux", "headers": {"Sec-Ch-Ua": "x"}}]`, "firefox"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseFingerprints([]byte(tt.json))
+			if tt.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("err = %v, want one mentioning %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestSessionKeepsProfile(t *testing.T) {
+	pool, err := parseFingerprints([]byte(`[
+		{"name": "ff", "browser": "firefox", "user_agent": "Mozilla/5.0", "platform": "Linux", "weight": 1000},
+		{"name": "cr", "browser": "chrome", "user_agent": "Mozilla/5.0", "platform": "Linux", "weight": 1}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Force the session onto Firefox, then ask for Chromium only.
+	pool.sessions.Get("crawl", func() int { return 0 })
+	if got := pool.Session("crawl", "chrome", "edge"); got.Name != "ff" {
+		t.Errorf("session switched to %s", got.Name)
+	}
+	if got := pool.Session("crawl"); got.Name != "ff" {
+		t.Errorf("session lost its profile: %s", got.Name)
+	}
+	if got := pool.Session("crawl/headless", "chrome", "edge"); got.Name != "cr" {
+		t.Errorf("new Chromium-only session got %s", got.Name)
+	}
+}
@@ -0,0 +1,435 @@
+package stealth
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	fhttp "github.com/bogdanfinn/fhttp"
+	"github.com/bogdanfinn/fhttp/http2"
+	utls "github.com/bogdanfinn/utls"
+	"golang.org/x/net/proxy"
+)
+
+// tlsProfile is the TLS ClientHello and HTTP/2 connection preface of one
+// browser family.
+type tlsProfile struct {
+	hello         utls.ClientHelloID
+	shuffleExts   bool // Chrome randomises its extension order per connection
+	settings      map[http2.SettingID]uint32
+	settingsOrder []http2.SettingID
+	windowUpdate  uint32
+	priority      *http2.PriorityParam
+	pseudoOrder   []string
+}
+
+// tlsProfiles maps Fingerprint.Browser to its wire fingerprint. Edge shares
+// Chrome's network stack.
+var tlsProfiles = map[string]*tlsProfile{
+	"chrome": {
+		hello:       utls.HelloChrome_133,
+		shuffleExts: true,
+		settings: map[http2.SettingID]uint32{
+			http2.SettingHeaderTableSize:   65536,
+			http2.SettingEnablePush:        0,
+			http2.SettingInitialWindowSize: 6291456,
+			http2.SettingMaxHeaderListSize: 262144,
+		},
+		settingsOrder: []http2.SettingID{
+			http2.SettingHeaderTableSize,
+			http2.SettingEnablePush,
+			http2.SettingInitialWindowSize,
+			http2.SettingMaxHeaderListSize,
+		},
+		windowUpdate: 15663105,
+		priority:     &http2.PriorityParam{Exclusive: true, Weight: 255},
+		pseudoOrder:  []string{":method", ":authority", ":scheme", ":path"},
+	},
+	"firefox": {
+		hello: utls.HelloFirefox_120,
+		settings: map[http2.SettingID]uint32{
+			http2.SettingHeaderTableSize:   65536,
+			http2.SettingInitialWindowSize: 131072,
+			http2.SettingMaxFrameSize:      16384,
+		},
+		settingsOrder: []http2.SettingID{
+			http2.SettingHeaderTableSize,
+			http2.SettingInitialWindowSize,
+			http2.SettingMaxFrameSize,
+		},
+		windowUpdate: 12517377,
+		priority:     &http2.PriorityParam{Weight: 41},
+		pseudoOrder:  []string{":method", ":path", ":authority", ":scheme"},
+	},
+}
+
+func init() {
+	tlsProfiles["edge"] = tlsProfiles["chrome"]
+}
+
+// TLSImpersonator sends HTTPS requests with the TLS ClientHello (JA3/JA4),
+// HTTP/2 SETTINGS, pseudo-header order and header order of the browser in
+// the request's Fingerprint (see WithFingerprint), so the wire fingerprint
+// agrees with the User-Agent. Requests without a fingerprint look like Chrome.
+//
+// Direct HTTP/2 connections are reused per browser and host; connections
+// through a proxy are used once, like the proxy transports, so each request
+// can leave from a new IP.
+type TLSImpersonator struct {
+	DialTimeout time.Duration  // TCP connect and TLS handshake (default 15s)
+	RootCAs     *x509.CertPool // trusted roots; nil = the system's
+
+	mu    sync.Mutex
+	conns map[string]*http2.ClientConn // direct HTTP/2 connections by browser and address
+	h2    map[*tlsProfile]*http2.Transport
+}
+
+// NewTLSImpersonator creates an impersonator with an empty connection pool.
+func NewTLSImpersonator() *TLSImpersonator {
+	return &TLSImpersonator{
+		conns: make(map[string]*http2.ClientConn),
+		h2:    make(map[*tlsProfile]*http2.Transport),
+	}
+}
+
+// Via returns a RoundTripper that impersonates through proxyURL: http(s)://
+// proxies are tunnelled with CONNECT, socks5:// through SOCKS5. A nil
+// proxyURL dials directly.
+func (ti *TLSImpersonator) Via(proxyURL *url.URL) http.RoundTripper {
+	return &impersonatingTransport{ti: ti, proxy: proxyURL}
+}
+
+type impersonatingTransport struct {
+	ti    *TLSImpersonator
+	proxy *url.URL
+}
+
+func (t *impersonatingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "https" {
+		return nil, fmt.Errorf("tls impersonation: unsupported scheme %q", req.URL.Scheme)
+	}
+	fp, ok := FingerprintFrom(req.Context())
+	if !ok {
+		fp.Browser = "chrome"
+	}
+	prof := tlsProfiles[fp.Browser]
+	if prof == nil {
+		prof = tlsProfiles["chrome"]
+	}
+	freq := toFHTTPRequest(req, fp, prof)
+
+	addr := req.URL.Host
+	if req.URL.Port() == "" {
+		addr = net.JoinHostPort(req.URL.Hostname(), "443")
+	}
+	key := fp.Browser + "|" + addr
+	if t.proxy == nil {
+		if cc := t.ti.pooled(key); cc != nil {
+			fresp, err := cc.RoundTrip(freq)
+			if err == nil {
+				return fromFHTTPResponse(fresp, req), nil
+			}
+			t.ti.drop(key, cc)
+			// The pooled connection died. Send the request again on a fresh
+			// one only if the server cannot have acted on it.
+			if !replayable(req, err) {
+				return nil, err
+			}
+			if req.Body != nil && req.Body != http.NoBody {
+				if req.GetBody == nil {
+					return nil, err
+				}
+				if freq.Body, err = req.GetBody(); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	conn, err := t.dial(req.Context(), addr, req.URL.Hostname(), prof)
+	if err != nil {
+		return nil, err
+	}
+
+	if conn.ConnectionState().NegotiatedProtocol == "h2" {
+		cc, err := t.ti.transport(prof).NewClientConn(conn)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("http2: %w", err)
+		}
+		fresp, err := cc.RoundTrip(freq)
+		if err != nil {
+			cc.Close()
+			return nil, err
+		}
+		if t.proxy == nil {
+			t.ti.keep(key, cc)
+		} else {
+			fresp.Body = &closeConnBody{ReadCloser: fresp.Body, close: cc.Close}
+		}
+		return fromFHTTPResponse(fresp, req), nil
+	}
+
+	// HTTP/1.1: one request on the connection just handshaken.
+	h1 := &fhttp.Transport{
+		DialTLSContext: func(context.Context, string, string) (net.Conn, error) {
+			return conn, nil
+		},
+		DisableKeepAlives:  true,
+		DisableCompression: true,
+	}
+	fresp, err := h1.RoundTrip(freq)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return fromFHTTPResponse(fresp, req), nil
+}
+
+// replayable reports whether req may be sent again after it failed with err
+// on a pooled connection: the server refused the stream before processing
+// it, or the request is idempotent (as net/http decides for its own
+// retries).
+func replayable(req *http.Request, err error) bool {
+	var se http2.StreamError
+	if errors.As(err, &se) && se.Code == http2.ErrCodeRefusedStream {
+		return true
+	}
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	_, key := req.Header["Idempotency-Key"]
+	_, xkey := req.Header["X-Idempotency-Key"]
+	return key || xkey
+}
+
+// dial opens a TCP connection to addr (through the proxy, if any) and
+// performs the profile's TLS handshake on it.
+func (t *impersonatingTransport) dial(ctx context.Context, addr, serverName string, prof *tlsProfile) (*utls.UConn, error) {
+	timeout := t.ti.DialTimeout
+	if timeout <= 0 {
+		timeout = 15 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	raw, err := dialVia(ctx, t.proxy, addr)
+	if err != nil {
+		return nil, err
+	}
+	conn := utls.UClient(raw, &utls.Config{ServerName: serverName, RootCAs: t.ti.RootCAs}, prof.hello, prof.shuffleExts, false, true)
+	if err := conn.HandshakeContext(ctx); err != nil {
+		raw.Close()
+		return nil, fmt.Errorf("tls handshake: %w", err)
+	}
+	return conn, nil
+}
+
+// dialVia connects to addr directly, through an HTTP CONNECT proxy or
+// through a SOCKS5 proxy.
+func dialVia(ctx context.Context, proxyURL *url.URL, addr string) (net.Conn, error) {
+	d := &net.Dialer{}
+	if proxyURL == nil {
+		return d.DialContext(ctx, "tcp", addr)
+	}
+
+	switch proxyURL.Scheme {
+	case "socks5", "socks5h":
+		pd, err := proxy.FromURL(proxyURL, d)
+		if err != nil {
+			return nil, fmt.Errorf("socks5 proxy: %w", err)
+		}
+		conn, err := pd.(proxy.ContextDialer).DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, fmt.Errorf("socks5 proxy: %w", err)
+		}
+		return conn, nil
+	case "http", "https":
+		return dialConnect(ctx, d, proxyURL, addr)
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+	}
+}
+
+// dialConnect opens a tunnel to addr with an HTTP CONNECT request, over TLS
+// for https:// proxies.
+func dialConnect(ctx context.Context, d *net.Dialer, proxyURL *url.URL, addr string) (net.Conn, error) {
+	proxyAddr := proxyURL.Host
+	if proxyURL.Port() == "" {
+		port := "80"
+		if proxyURL.Scheme == "https" {
+			port = "443"
+		}
+		proxyAddr = net.JoinHostPort(proxyURL.Hostname(), port)
+	}
+	conn, err := d.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, fmt.Errorf("proxy connect: %w", err)
+	}
+	if proxyURL.Scheme == "https" {
+		tc := tls.Client(conn, &tls.Config{ServerName: proxyURL.Hostname()})
+		if err := tc.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("proxy connect: %w", err)
+		}
+		conn = tc
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	connectReq := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	if u := proxyURL.User; u != nil {
+		pass, _ := u.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(u.Username() + ":" + pass))
+		connectReq.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+	if err := connectReq.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy connect: %w", err)
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, connectReq)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy connect: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy connect: %s", resp.Status)
+	}
+	if br.Buffered() > 0 {
+		conn.Close()
+		return nil, fmt.Errorf("proxy connect: unexpected data after response")
+	}
+	return conn, nil
+}
+
+// transport returns the HTTP/2 settings holder for prof.
+func (ti *TLSImpersonator) transport(prof *tlsProfile) *http2.Transport {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	if t, ok := ti.h2[prof]; ok {
+		return t
+	}
+	t := &http2.Transport{
+		Settings:           prof.settings,
+		SettingsOrder:      prof.settingsOrder,
+		ConnectionFlow:     prof.windowUpdate,
+		HeaderPriority:     prof.priority,
+		PseudoHeaderOrder:  prof.pseudoOrder,
+		DisableCompression: true,
+		IdleConnTimeout:    90 * time.Second,
+	}
+	ti.h2[prof] = t
+	return t
+}
+
+func (ti *TLSImpersonator) pooled(key string) *http2.ClientConn {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	cc := ti.conns[key]
+	if cc != nil && !cc.CanTakeNewRequest() {
+		delete(ti.conns, key)
+		return nil
+	}
+	return cc
+}
+
+func (ti *TLSImpersonator) keep(key string, cc *http2.ClientConn) {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	if old := ti.conns[key]; old != nil && old != cc {
+		go old.Close()
+	}
+	ti.conns[key] = cc
+}
+
+func (ti *TLSImpersonator) drop(key string, cc *http2.ClientConn) {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	if ti.conns[key] == cc {
+		delete(ti.conns, key)
+	}
+	go cc.Close()
+}
+
+// toFHTTPRequest converts req for the fhttp transports, adding fp's header
+// order and prof's pseudo-header order.
+func toFHTTPRequest(req *http.Request, fp Fingerprint, prof *tlsProfile) *fhttp.Request {
+	h := fhttp.Header(req.Header.Clone())
+	if len(fp.HeaderOrder) > 0 {
+		order := make([]string, len(fp.HeaderOrder))
+		for i, k := range fp.HeaderOrder {
+			order[i] = strings.ToLower(k)
+		}
+		h[fhttp.HeaderOrderKey] = order
+	}
+	h[fhttp.PHeaderOrderKey] = prof.pseudoOrder
+
+	freq := &fhttp.Request{
+		Method:        req.Method,
+		URL:           req.URL,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        h,
+		Body:          req.Body,
+		GetBody:       req.GetBody,
+		ContentLength: req.ContentLength,
+		Host:          req.Host,
+		Close:         req.Close,
+	}
+	return freq.WithContext(req.Context())
+}
+
+// fromFHTTPResponse converts an fhttp response back for the caller of req.
+func fromFHTTPResponse(fresp *fhttp.Response, req *http.Request) *http.Response {
+	return &http.Response{
+		Status:           fresp.Status,
+		StatusCode:       fresp.StatusCode,
+		Proto:            fresp.Proto,
+		ProtoMajor:       fresp.ProtoMajor,
+		ProtoMinor:       fresp.ProtoMinor,
+		Header:           http.Header(fresp.Header),
+		Body:             fresp.Body,
+		ContentLength:    fresp.ContentLength,
+		TransferEncoding: fresp.TransferEncoding,
+		Close:            fresp.Close,
+		Uncompressed:     fresp.Uncompressed,
+		Trailer:          http.Header(fresp.Trailer),
+		Request:          req,
+	}
+}
+
+// closeConnBody closes a single-use connection along with the response body.
+type closeConnBody struct {
+	io.ReadCloser
+	close func() error
+}
+
+func (b *closeConnBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.close()
+	return err
+}
@@ -0,0 +1,172 @@
+package stealth
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bogdanfinn/fhttp/http2"
+	"github.com/lukman83/kidkazz-scrap/internal/testserver"
+)
+
+// tlsRecorder serves HTTPS on a local port and keeps each connection's
+// ClientHello and HTTP/2 preface.
+type tlsRecorder struct {
+	url   string
+	roots *x509.CertPool
+
+	mu     sync.Mutex
+	hellos []testserver.ClientHello
+}
+
+func newTLSRecorder(t *testing.T) *tlsRecorder {
+	t.Helper()
+	cert, pem, err := testserver.NewCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	r := &tlsRecorder{url: "https://" + ln.Addr().String() + "/", roots: x509.NewCertPool()}
+	r.roots.AppendCertsFromPEM(pem)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) { io.WriteString(w, "ok") })
+	go testserver.ServeTLS(ln, cert, ok, func(h testserver.ClientHello) {
+		r.mu.Lock()
+		r.hellos = append(r.hellos, h)
+		r.mu.Unlock()
+	})
+	return r
+}
+
+// get sends a GET as browser on a new connection and returns its ClientHello.
+func (r *tlsRecorder) get(t *testing.T, browser string) testserver.ClientHello {
+	t.Helper()
+	ti := NewTLSImpersonator()
+	ti.RootCAs = r.roots
+	ctx := WithFingerprint(context.Background(), Fingerprint{Browser: browser})
+	req, _ := http.NewRequestWithContext(ctx, "GET", r.url, nil)
+	resp, err := ti.Via(nil).RoundTrip(req)
+	if err != nil {
+		t.Fatalf("%s: %v", browser, err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.hellos) == 0 {
+		t.Fatalf("%s: no ClientHello recorded", browser)
+	}
+	return r.hellos[len(r.hellos)-1]
+}
+
+func TestImpersonationWireFingerprint(t *testing.T) {
+	r := newTLSRecorder(t)
+	tests := []struct {
+		browser string
+		h2      string // Akamai fingerprint: SETTINGS|WINDOW_UPDATE|PRIORITY|pseudo-headers
+	}{
+		{"chrome", "1:65536;2:0;4:6291456;6:262144|15663105|1:1:0:256|m,a,s,p"},
+		{"edge", "1:65536;2:0;4:6291456;6:262144|15663105|1:1:0:256|m,a,s,p"},
+		{"firefox", "1:65536;4:131072;5:16384|12517377|1:0:0:42|m,p,a,s"},
+	}
+	ja3n := make(map[string]string)
+	for _, tt := range tests {
+		t.Run(tt.browser, func(t *testing.T) {
+			hello := r.get(t, tt.browser)
+			if hello.Protocol != "h2" {
+				t.Fatalf("negotiated %q, want h2", hello.Protocol)
+			}
+			if hello.H2 != tt.h2 {
+				t.Errorf("HTTP/2 fingerprint = %s, want %s", hello.H2, tt.h2)
+			}
+			// Chrome shuffles its extensions per connection: the sorted
+			// (JA3N) hash stays the same.
+			if again := r.get(t, tt.browser); again.JA3NHash != hello.JA3NHash {
+				t.Errorf("JA3N changed between connections: %s, %s", hello.JA3NHash, again.JA3NHash)
+			}
+			ja3n[tt.browser] = hello.JA3NHash
+		})
+	}
+	if ja3n["edge"] != ja3n["chrome"] {
+		t.Errorf("edge JA3N %s differs from chrome %s", ja3n["edge"], ja3n["chrome"])
+	}
+	if ja3n["firefox"] == ja3n["chrome"] {
+		t.Errorf("firefox and chrome share JA3N %s", ja3n["chrome"])
+	}
+}
+
+func TestReplayable(t *testing.T) {
+	refused := http2.StreamError{Code: http2.ErrCodeRefusedStream}
+	other := errors.New("connection reset")
+	tests := []struct {
+		name   string
+		method string
+		header string
+		err    error
+		want   bool
+	}{
+		{"get", "GET", "", other, true},
+		{"head", "HEAD", "", other, true},
+		{"post", "POST", "", other, false},
+		{"post refused before processing", "POST", "", refused, true},
+		{"post with idempotency key", "POST", "Idempotency-Key", other, true},
+		{"patch with x-idempotency key", "PATCH", "X-Idempotency-Key", other, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, "https://example.com/", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, "k1")
+			}
+			if got := replayable(req, tt.err); got != tt.want {
+				t.Errorf("replayable = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// urlLessProvider is a proxy the impersonator cannot dial through.
+type urlLessProvider struct{}
+
+func (urlLessProvider) Transport() http.RoundTripper { return http.DefaultTransport }
+func (urlLessProvider) Name() string                 { return "opaque" }
+
+func TestImpersonationNeedsProxyURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider ProxyProvider
+		err      string
+	}{
+		{"provider without proxy URL", urlLessProvider{}, "no proxy URL"},
+		{"broken proxy URL", &HTTPProxyProvider{Label: "custom", RawURL: "://bad"}, "no proxy URL"},
+	}
+	pool, err := NewFingerprintPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := &StealthTransport{
+				Fingerprint: pool,
+				Proxy:       NewProxyRotator([]ProxyProvider{tt.provider}),
+				Impersonate: NewTLSImpersonator(),
+			}
+			req, _ := http.NewRequest("GET", "https://127.0.0.1:1/", nil)
+			_, err := st.RoundTrip(req)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("err = %v, want one mentioning %q", err, tt.err)
+			}
+		})
+	}
+}
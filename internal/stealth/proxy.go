@@ -1,7 +1,9 @@
 package stealth
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"sync"
@@ -13,6 +15,31 @@ type ProxyProvider interface {
 	Name() string
 }
 
+// proxyURLer is implemented by providers that route through a single proxy
+// URL, so the TLS impersonator can dial through the same proxy.
+type proxyURLer interface {
+	ProxyURL() *url.URL
+}
+
+// geoTargeter is implemented by providers that can pick the exit city per
+// request (see WithGeo).
+type geoTargeter interface {
+	InCity(city string) ProxyProvider
+}
+
+type geoKey struct{}
+
+// WithGeo asks for requests made with ctx to leave through a proxy exit in
+// city. Providers that cannot target a city ignore it.
+func WithGeo(ctx context.Context, city string) context.Context {
+	return context.WithValue(ctx, geoKey{}, city)
+}
+
+func geoFrom(ctx context.Context) string {
+	city, _ := ctx.Value(geoKey{}).(string)
+	return city
+}
+
 // ProxyRotator cycles through multiple proxy providers.
 type ProxyRotator struct {
 	providers []ProxyProvider
@@ -38,6 +65,31 @@ func (p *ProxyRotator) Next() ProxyProvider {
 	return provider
 }
 
+// Choose returns the next provider, switched to the exit city ctx asks for
+// (WithGeo) when it can target one, and the proxy URL it routes through:
+// nil for direct connections and for providers that expose none.
+func (p *ProxyRotator) Choose(ctx context.Context) (ProxyProvider, *url.URL) {
+	provider := p.Next()
+	if city := geoFrom(ctx); city != "" {
+		if g, ok := provider.(geoTargeter); ok {
+			provider = g.InCity(city)
+		} else {
+			slog.DebugContext(ctx, "proxy cannot geo-target, using its default exit", "proxy", provider.Name(), "city", city)
+		}
+	}
+	var proxyURL *url.URL
+	if pu, ok := provider.(proxyURLer); ok {
+		proxyURL = pu.ProxyURL()
+	}
+	return provider, proxyURL
+}
+
+// IsDirect reports whether p connects without a proxy.
+func IsDirect(p ProxyProvider) bool {
+	_, ok := p.(*DirectProvider)
+	return ok
+}
+
 // DirectProvider routes traffic directly (no proxy).
 type DirectProvider struct {
 	transport http.RoundTripper
@@ -55,6 +107,9 @@ type DecodoProvider struct {
 	UseUnblocker bool
 	transport    http.RoundTripper
 	once         sync.Once
+
+	mu     sync.Mutex
+	cities map[string]*DecodoProvider // per-city variants, see InCity
 }
 
 func (d *DecodoProvider) Name() string {
@@ -75,6 +130,34 @@ func (d *DecodoProvider) Transport() http.RoundTripper {
 	return d.transport
 }
 
+// InCity returns a provider with the same account that exits in city. The
+// variants are kept, so each city reuses one transport.
+func (d *DecodoProvider) InCity(city string) ProxyProvider {
+	if city == d.City {
+		return d
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if p, ok := d.cities[city]; ok {
+		return p
+	}
+	if d.cities == nil {
+		d.cities = make(map[string]*DecodoProvider)
+	}
+	p := &DecodoProvider{
+		Username:     d.Username,
+		Password:     d.Password,
+		Country:      d.Country,
+		City:         city,
+		UseUnblocker: d.UseUnblocker,
+	}
+	d.cities[city] = p
+	return p
+}
+
+// ProxyURL returns the proxy the provider routes through.
+func (d *DecodoProvider) ProxyURL() *url.URL { return d.buildProxyURL() }
+
 func (d *DecodoProvider) buildProxyURL() *url.URL {
 	user := fmt.Sprintf("user-%s-country-%s", d.Username, d.Country)
 	if d.City != "" {
@@ -129,6 +212,16 @@ func (h *HTTPProxyProvider) Transport() http.RoundTripper {
 	return h.transport
 }
 
+// ProxyURL returns the proxy the provider routes through, or nil if its
+// URL does not parse.
+func (h *HTTPProxyProvider) ProxyURL() *url.URL {
+	u, err := url.Parse(h.RawURL)
+	if err != nil {
+		return nil
+	}
+	return u
+}
+
 // Err returns any error from parsing the proxy URL.
 // Must be called after Transport() to ensure initialization.
 func (h *HTTPProxyProvider) Err() error {
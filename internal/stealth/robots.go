@@ -1,6 +1,7 @@
 package stealth
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -32,6 +33,61 @@ func NewRobotsChecker(client *http.Client, enabled bool) *RobotsChecker {
 	}
 }
 
+// RobotsDecision is the outcome of a robots.txt check.
+type RobotsDecision string
+
+const (
+	RobotsAllowed     RobotsDecision = "allowed"
+	RobotsBlocked     RobotsDecision = "blocked"
+	RobotsFetchFailed RobotsDecision = "fetch_failed" // robots.txt unavailable; request allowed
+)
+
+// RobotsEvent records a single robots.txt decision for auditing.
+type RobotsEvent struct {
+	Time       time.Time      `json:"time"`
+	URL        string         `json:"url"`
+	Host       string         `json:"host"`
+	UserAgent  string         `json:"user_agent"`
+	Decision   RobotsDecision `json:"decision"`
+	CrawlDelay time.Duration  `json:"crawl_delay_ns,omitempty"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// Enabled reports whether robots.txt rules are being enforced.
+func (r *RobotsChecker) Enabled() bool { return r.enabled }
+
+// Check evaluates rawURL against robots.txt and returns the full decision,
+// including any Crawl-delay for the user agent. Fetch failures allow the
+// request but are reported as RobotsFetchFailed.
+func (r *RobotsChecker) Check(userAgent, rawURL string) RobotsEvent {
+	ev := RobotsEvent{Time: time.Now(), URL: rawURL, UserAgent: userAgent, Decision: RobotsAllowed}
+	if !r.enabled {
+		return ev
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		ev.Decision = RobotsBlocked
+		ev.Error = err.Error()
+		return ev
+	}
+	ev.Host = u.Host
+
+	data, err := r.getRobots(u.Scheme + "://" + u.Host)
+	if err != nil {
+		ev.Decision = RobotsFetchFailed
+		ev.Error = err.Error()
+		return ev
+	}
+
+	group := data.FindGroup(userAgent)
+	ev.CrawlDelay = group.CrawlDelay
+	if !group.Test(u.Path) {
+		ev.Decision = RobotsBlocked
+	}
+	return ev
+}
+
 // IsAllowed checks if the given URL is allowed by robots.txt.
 func (r *RobotsChecker) IsAllowed(userAgent, rawURL string) (bool, error) {
 	if !r.enabled {
@@ -69,6 +125,17 @@ func (r *RobotsChecker) CrawlDelay(userAgent, domain string) time.Duration {
 	return group.CrawlDelay
 }
 
+// NewRobotsAuditLog returns an event sink that writes each RobotsEvent as a JSON line to w.
+func NewRobotsAuditLog(w io.Writer) func(RobotsEvent) {
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+	return func(ev RobotsEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		_ = enc.Encode(ev)
+	}
+}
+
 func (r *RobotsChecker) getRobots(domain string) (*robotstxt.RobotsData, error) {
 	r.mu.RLock()
 	data, ok := r.rules[domain]
@@ -1,68 +1,342 @@
 package stealth
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"time"
 
-	"golang.org/x/time/rate"
+	"github.com/lukman83/kidkazz-scrap/internal/cassette"
+	"github.com/lukman83/kidkazz-scrap/internal/crawl"
+	"github.com/lukman83/kidkazz-scrap/internal/httputil"
+	"github.com/lukman83/kidkazz-scrap/internal/metrics"
+	"github.com/lukman83/kidkazz-scrap/internal/progress"
+	"github.com/lukman83/kidkazz-scrap/internal/tracing"
+	"github.com/lukman83/kidkazz-scrap/internal/usage"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // StealthTransport is an http.RoundTripper that applies the full stealth pipeline:
-// RobotsCheck → RateLimiter → HumanDelay → Fingerprint → Proxy → Send
+// Budget → Fingerprint → Cookies → RobotsCheck → RateLimiter → HostSpacing → Proxy → Send → Meter → Adapt rate
+//
+// HostSpacing keeps consecutive requests to one host at least
+// max(robots.txt Crawl-delay, human delay) apart. Proxy exits in the city
+// the request's context asks for (WithGeo) when the provider can target one.
+// Meter counts the bytes sent and received per provider, platform and job;
+// a job over its budget gets an error instead of further traffic.
+//
+// Each request is traced as a stealth.RoundTrip span with a child span per
+// waiting stage (robots, rate-limit wait, human delay, proxy choice).
 type StealthTransport struct {
 	Base        http.RoundTripper
 	Robots      *RobotsChecker
 	Fingerprint *FingerprintPool
 	Proxy       *ProxyRotator
 	Delay       *HumanDelay
-	RateLimiter *rate.Limiter
+	RateLimiter *AdaptiveLimiter
+	RobotsLog   func(RobotsEvent) // optional sink for robots.txt decisions
+
+	// Impersonate, when set, sends HTTPS requests with the TLS and HTTP/2
+	// fingerprint of the request's browser profile instead of Go's.
+	Impersonate *TLSImpersonator
+
+	// Cookies, when set, sends and stores the cookies of the request's
+	// browser profile. It replaces http.Client.Jar, which runs before the
+	// profile is known.
+	Cookies *CookieJars
+
+	// Usage, when set, meters traffic and enforces its budgets.
+	Usage *usage.Meter
+
+	// Recorder, when set, records each request as it is sent, with the
+	// profile's headers and cookies, to a cassette.
+	Recorder *cassette.Recorder
+
+	spacing hostSpacer
 }
 
-func (t *StealthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+func (t *StealthTransport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	ctx, span := tracing.Start(req.Context(), "stealth.RoundTrip",
+		attribute.String("http.request.method", req.Method),
+		attribute.String("server.address", req.URL.Host),
+		attribute.String("url.path", req.URL.Path),
+	)
+	start := time.Now()
+	provider := "direct"
+	defer func() {
+		attrs := []any{"method", req.Method, "host", req.URL.Host, "path", req.URL.Path,
+			"proxy", provider, "duration_ms", time.Since(start).Milliseconds()}
+		if resp != nil {
+			span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+			attrs = append(attrs, "status", resp.StatusCode)
+		}
+		if err != nil {
+			attrs = append(attrs, "err", err)
+		}
+		slog.DebugContext(ctx, "http request", attrs...)
+		tracing.End(span, err)
+	}()
+
+	// 0. Refuse jobs that are over their bandwidth budget
+	if err := t.Usage.Allow(ctx); err != nil {
+		return nil, err
+	}
+
 	// Clone request to avoid mutating the caller's request (http.RoundTripper contract)
-	clone := req.Clone(req.Context())
-
-	// 1. Apply fingerprint (UA + headers)
-	fp := t.Fingerprint.Next()
-	clone.Header.Set("User-Agent", fp.UserAgent)
-	for key, vals := range fp.Headers {
-		if clone.Header.Get(key) == "" {
-			for _, v := range vals {
-				clone.Header.Add(key, v)
+	clone := req.Clone(ctx)
+
+	// 1. Apply fingerprint: one profile per crawl (crawl.Session), so every
+	// request of a crawl presents the same browser. App clients keep the
+	// identity they set themselves.
+	app := isAppClient(ctx)
+	userAgent := clone.Header.Get("User-Agent")
+	var jar *Jar
+	if app {
+		span.SetAttributes(tracing.AttrFingerprint.String("app"))
+	} else {
+		session := crawl.Session(ctx)
+		fp := t.Fingerprint.Session(session)
+		span.SetAttributes(tracing.AttrFingerprint.String(fp.Name))
+		fp.Apply(clone.Header)
+		clone = clone.WithContext(WithFingerprint(clone.Context(), fp))
+		userAgent = fp.UserAgent
+
+		// 1b. Send the session's cookies
+		if t.Cookies != nil {
+			jar = t.Cookies.For(session, fp.Name)
+			for _, c := range jar.Cookies(clone.URL) {
+				if _, err := clone.Cookie(c.Name); err != nil {
+					clone.AddCookie(c)
+				}
 			}
 		}
 	}
 
-	// 2. Check robots.txt
-	if t.Robots != nil {
-		allowed, err := t.Robots.IsAllowed(fp.UserAgent, clone.URL.String())
-		if err == nil && !allowed {
-			return nil, fmt.Errorf("blocked by robots.txt: %s", clone.URL.Path)
+	// 2-4. Check robots.txt, wait for the rate limiter and space requests
+	host := clone.URL.Host
+	if err := t.Admit(clone.Context(), clone.URL, userAgent); err != nil {
+		return nil, err
+	}
+	if t.RateLimiter != nil {
+		// Let body-level challenge detection (httputil.DetectBlock) throttle this host too.
+		ctx := clone.Context()
+		clone = clone.WithContext(httputil.WithBlockFeedback(ctx, func(kind httputil.ResponseKind) {
+			t.throttle(ctx, host, string(kind), 0)
+		}))
+	}
+
+	// 5. Route through proxy if configured
+	transport := t.Base
+	impersonate := t.Impersonate != nil && !app && clone.URL.Scheme == "https"
+	var proxyURL *url.URL
+	if t.Proxy != nil {
+		_, proxySpan := tracing.Start(ctx, "stealth.proxy")
+		var p ProxyProvider
+		p, proxyURL = t.Proxy.Choose(ctx)
+		if city := geoFrom(ctx); city != "" {
+			proxySpan.SetAttributes(attribute.String("kidkazz.geo", city))
+		}
+		transport = p.Transport()
+		provider = p.Name()
+		proxySpan.SetAttributes(tracing.AttrProxy.String(provider))
+		proxySpan.End()
+		// The impersonator dials itself; without a proxy URL the request
+		// would silently go out directly.
+		if impersonate && proxyURL == nil && !IsDirect(p) {
+			return nil, fmt.Errorf("tls impersonation: proxy %s has no proxy URL to dial through", provider)
+		}
+	}
+	if impersonate {
+		transport = t.Impersonate.Via(proxyURL)
+	}
+	span.SetAttributes(tracing.AttrProxy.String(provider))
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	if t.Recorder != nil {
+		transport = t.Recorder.Via(transport)
+	}
+
+	resp, err = transport.RoundTrip(clone)
+	span.SetAttributes(tracing.AttrStatus.String(observeProxy(provider, resp, err)))
+
+	// 6. Meter what went over the wire; the body is counted as it is read
+	metered := usage.Counts{Requests: 1, Sent: requestSize(clone)}
+	if err == nil {
+		metered.Received = responseHeaderSize(resp)
+		resp.Body = usage.CountingBody(ctx, t.Usage, provider, resp.Body)
+	}
+	if berr := t.Usage.Add(ctx, provider, metered); berr != nil && err == nil {
+		slog.WarnContext(ctx, "bandwidth budget exceeded", "err", berr)
+	}
+	if err == nil && jar != nil {
+		if cookies := resp.Cookies(); len(cookies) > 0 {
+			jar.SetCookies(clone.URL, cookies)
+		}
+	}
+	if err != nil || t.RateLimiter == nil {
+		return resp, err
+	}
+
+	// 7. Adapt the host's rate to the response
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusForbidden:
+		t.throttle(clone.Context(), host, fmt.Sprintf("HTTP %d", resp.StatusCode), httputil.ParseRetryAfter(resp.Header))
+	case http.StatusServiceUnavailable:
+		if ra := httputil.ParseRetryAfter(resp.Header); ra > 0 {
+			t.throttle(clone.Context(), host, "HTTP 503", ra)
+		}
+	default:
+		if resp.StatusCode < 400 {
+			t.RateLimiter.Success(host)
 		}
 	}
+	return resp, nil
+}
 
-	// 3. Wait for rate limiter token
+// Admit runs the waiting stages of the pipeline for a request to u sent as
+// userAgent: the robots.txt check, the host's rate limiter and its spacing.
+// RoundTrip runs it for every request; traffic that does not go through the
+// transport, such as the headless browser's navigations, runs it too, so
+// both are gated, audited and spaced together.
+func (t *StealthTransport) Admit(ctx context.Context, u *url.URL, userAgent string) error {
+	// Check robots.txt
+	var crawlDelay time.Duration
+	if t.Robots != nil && t.Robots.Enabled() {
+		_, robotsSpan := tracing.Start(ctx, "stealth.robots")
+		ev := t.Robots.Check(userAgent, u.String())
+		robotsSpan.SetAttributes(tracing.AttrStatus.String(string(ev.Decision)))
+		robotsSpan.End()
+		if t.RobotsLog != nil {
+			t.RobotsLog(ev)
+		}
+		switch ev.Decision {
+		case RobotsBlocked:
+			metrics.RobotsBlocks.WithLabelValues(u.Host).Inc()
+			trace.SpanFromContext(ctx).SetAttributes(tracing.AttrStatus.String("robots_blocked"))
+			progress.Report(ctx, fmt.Sprintf("robots.txt disallows %s", u.Path))
+			return fmt.Errorf("blocked by robots.txt: %s", u.Path)
+		case RobotsFetchFailed:
+			progress.Warn(ctx, fmt.Sprintf("robots.txt unavailable for %s", u.Host))
+			progress.Report(ctx, fmt.Sprintf("robots.txt unavailable for %s, proceeding", u.Host))
+		}
+		crawlDelay = ev.CrawlDelay
+	}
+
+	// Wait for rate limiter token
+	host := u.Host
 	if t.RateLimiter != nil {
-		if err := t.RateLimiter.Wait(clone.Context()); err != nil {
-			return nil, fmt.Errorf("rate limiter: %w", err)
+		if r := t.RateLimiter.Rate(host); r < t.RateLimiter.max {
+			progress.Report(ctx, fmt.Sprintf("Waiting for %s (throttled to %.2f req/s)...", host, float64(r)))
 		}
+		waitStart := time.Now()
+		waitCtx, waitSpan := tracing.Start(ctx, "stealth.rate_limit",
+			attribute.Float64("kidkazz.rate", float64(t.RateLimiter.Rate(host))))
+		err := t.RateLimiter.Wait(waitCtx, host)
+		tracing.End(waitSpan, err)
+		if err != nil {
+			return fmt.Errorf("rate limiter: %w", err)
+		}
+		metrics.RateLimitWait.WithLabelValues(host, "rate_limit").Observe(time.Since(waitStart).Seconds())
 	}
 
-	// 4. Apply human-like delay
+	// Space requests to this host by max(crawl-delay, human delay)
+	interval := crawlDelay
 	if t.Delay != nil {
-		if err := t.Delay.Wait(clone.Context()); err != nil {
-			return nil, fmt.Errorf("delay: %w", err)
+		interval = max(interval, t.Delay.RequestDelay())
+	}
+	if interval > 0 {
+		waitStart := time.Now()
+		waitCtx, waitSpan := tracing.Start(ctx, "stealth.human_delay",
+			attribute.String("kidkazz.interval", interval.String()))
+		err := t.spacing.wait(waitCtx, host, interval)
+		tracing.End(waitSpan, err)
+		if err != nil {
+			return fmt.Errorf("delay: %w", err)
 		}
+		metrics.RateLimitWait.WithLabelValues(host, "spacing").Observe(time.Since(waitStart).Seconds())
 	}
+	return nil
+}
 
-	// 5. Route through proxy if configured
-	transport := t.Base
-	if t.Proxy != nil {
-		transport = t.Proxy.Next().Transport()
+// Adapt adjusts host's rate to the outcome of a request that did not go
+// through the transport: a block slows the host down, a success lets it
+// recover. Other errors leave the rate alone.
+func (t *StealthTransport) Adapt(ctx context.Context, host string, err error) {
+	if t.RateLimiter == nil {
+		return
 	}
-	if transport == nil {
-		transport = http.DefaultTransport
+	if re, ok := httputil.AsResponseError(err); ok && re.Kind.IsBlock() {
+		t.throttle(ctx, host, string(re.Kind), re.RetryAfter)
+	} else if err == nil {
+		t.RateLimiter.Success(host)
+	}
+}
+
+// requestSize estimates the bytes req puts on the wire: request line,
+// headers and body. TLS and HTTP/2 framing are not counted.
+func requestSize(req *http.Request) int64 {
+	n := int64(len(req.Method) + len(req.URL.RequestURI()) + len(" HTTP/1.1\r\n") + len("Host: \r\n") + len(req.URL.Host))
+	n += headerSize(req.Header) + 2
+	if req.ContentLength > 0 {
+		n += req.ContentLength
 	}
+	return n
+}
+
+// responseHeaderSize estimates the bytes of resp's status line and headers.
+func responseHeaderSize(resp *http.Response) int64 {
+	return int64(len("HTTP/1.1 \r\n")+len(resp.Status)) + headerSize(resp.Header) + 2
+}
+
+func headerSize(h http.Header) int64 {
+	var n int64
+	for k, vs := range h {
+		for _, v := range vs {
+			n += int64(len(k) + len(": \r\n") + len(v))
+		}
+	}
+	return n
+}
+
+type appClientKey struct{}
 
-	return transport.RoundTrip(clone)
+// WithAppClient marks requests made with ctx as coming from a native app
+// client that sets its own identity headers. The transport leaves them
+// alone and skips the browser profile's cookies and TLS fingerprint; the
+// rest of the pipeline (robots, rate limits, delays, proxies) still applies.
+func WithAppClient(ctx context.Context) context.Context {
+	return context.WithValue(ctx, appClientKey{}, true)
+}
+
+func isAppClient(ctx context.Context) bool {
+	app, _ := ctx.Value(appClientKey{}).(bool)
+	return app
+}
+
+// observeProxy records the outcome of a request sent through provider and returns it.
+func observeProxy(provider string, resp *http.Response, err error) string {
+	outcome := "ok"
+	switch {
+	case err != nil:
+		outcome = "error"
+	case resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests:
+		outcome = "blocked"
+	}
+	metrics.ProxyRequests.WithLabelValues(provider, outcome).Inc()
+	return outcome
+}
+
+// throttle backs off host's rate and reports the new effective rate.
+func (t *StealthTransport) throttle(ctx context.Context, host, reason string, retryAfter time.Duration) {
+	r := t.RateLimiter.Backoff(host, retryAfter)
+	slog.WarnContext(ctx, "throttled", "host", host, "reason", reason, "rate", float64(r), "retry_after", retryAfter.String())
+	msg := fmt.Sprintf("Throttled by %s (%s), slowing to %.2f req/s", host, reason, float64(r))
+	if retryAfter > 0 {
+		msg += fmt.Sprintf(", pausing %s", retryAfter.Round(time.Second))
+	}
+	progress.Report(ctx, msg)
 }
@@ -0,0 +1,60 @@
+package stealth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/lukman83/kidkazz-scrap/internal/httputil"
+)
+
+func TestAdmit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "User-agent: *\nDisallow: /cart\nCrawl-delay: 0.05\n")
+	}))
+	defer srv.Close()
+
+	var events []RobotsEvent
+	tr := &StealthTransport{
+		Robots:      NewRobotsChecker(srv.Client(), true),
+		RobotsLog:   func(ev RobotsEvent) { events = append(events, ev) },
+		RateLimiter: NewAdaptiveLimiter(1000, 10),
+	}
+	page := func(path string) *url.URL {
+		u, _ := url.Parse(srv.URL + path)
+		return u
+	}
+	ctx := context.Background()
+
+	if err := tr.Admit(ctx, page("/cart"), "Mozilla/5.0"); err == nil {
+		t.Error("admitted a page robots.txt disallows")
+	}
+	start := time.Now()
+	for range 2 {
+		if err := tr.Admit(ctx, page("/search"), "Mozilla/5.0"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if waited := time.Since(start); waited < 40*time.Millisecond {
+		t.Errorf("two pages %s apart, want the Crawl-delay", waited)
+	}
+	if len(events) != 3 || events[0].Decision != RobotsBlocked || events[1].Decision != RobotsAllowed {
+		t.Errorf("audit events = %+v", events)
+	}
+
+	host := page("/").Host
+	tr.Adapt(ctx, host, httputil.NewResponseError(httputil.KindCaptcha, 0, "challenge"))
+	if r := tr.RateLimiter.Rate(host); r != 500 {
+		t.Errorf("rate after a block = %v, want 500", r)
+	}
+	tr.Adapt(ctx, host, errors.New("navigate: connection reset"))
+	tr.Adapt(ctx, host, nil)
+	if r := tr.RateLimiter.Rate(host); r != 550 {
+		t.Errorf("rate after a success = %v, want 550", r)
+	}
+}
@@ -0,0 +1,166 @@
+package testserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Sort orders understood by the mock (mirrors tokopedia.Sort* constants).
+const (
+	sortPriceAsc   = 3
+	sortPriceDesc  = 4
+	sortBestSeller = 5
+	sortNewest     = 9
+)
+
+func sortProducts(ps []Product, orderBy int) {
+	switch orderBy {
+	case sortPriceAsc:
+		sort.SliceStable(ps, func(i, j int) bool { return ps[i].Price < ps[j].Price })
+	case sortPriceDesc:
+		sort.SliceStable(ps, func(i, j int) bool { return ps[i].Price > ps[j].Price })
+	case sortBestSeller:
+		sort.SliceStable(ps, func(i, j int) bool { return ps[i].CountReview > ps[j].CountReview })
+	case sortNewest:
+		sort.SliceStable(ps, func(i, j int) bool { return ps[i].ID > ps[j].ID })
+	}
+}
+
+type gqlRequest struct {
+	OperationName string `json:"operationName"`
+	Variables     struct {
+		Params string `json:"params"`
+	} `json:"variables"`
+}
+
+// handleGraphQL answers SearchProductQueryV4 batches in Tokopedia's response
+// shape. Searches from the app (device=android) also get rating averages and
+// sold-count labels.
+func (s *Server) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	var batch []gqlRequest
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil || len(batch) == 0 {
+		http.Error(w, `{"errors":[{"message":"invalid request"}]}`, http.StatusBadRequest)
+		return
+	}
+
+	base := baseURL(r)
+	out := make([]any, 0, len(batch))
+	for _, req := range batch {
+		if req.OperationName != "SearchProductQueryV4" {
+			out = append(out, map[string]any{
+				"errors": []map[string]string{{"message": fmt.Sprintf("unknown operation %q", req.OperationName)}},
+			})
+			continue
+		}
+		params, _ := url.ParseQuery(req.Variables.Params)
+		start, _ := strconv.Atoi(params.Get("start"))
+		rows, _ := strconv.Atoi(params.Get("rows"))
+		if rows <= 0 {
+			rows = 20
+		}
+		ob, _ := strconv.Atoi(params.Get("ob"))
+
+		products, total := s.search(params.Get("q"), start, rows, ob)
+		products = atLocation(products, buyerCity(r, params))
+		app := params.Get("device") == "android"
+		items := make([]map[string]any, len(products))
+		for i, p := range products {
+			items[i] = gqlProduct(base, p, app)
+		}
+		out = append(out, map[string]any{
+			"data": map[string]any{
+				"ace_search_product_v4": map[string]any{
+					"header": map[string]any{
+						"totalData":     total,
+						"totalDataText": strconv.Itoa(total),
+						"responseCode":  0,
+						"errorMessage":  "",
+					},
+					"data": map[string]any{
+						"products": items,
+					},
+				},
+			},
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+func gqlProduct(base string, p Product, app bool) map[string]any {
+	adID := "0"
+	if p.IsAd {
+		adID = strconv.FormatInt(p.ID, 10)
+	}
+	labels := make([]map[string]string, 0, len(p.Labels)+1)
+	for _, l := range p.Labels {
+		labels = append(labels, map[string]string{"title": l.Title, "position": l.Position, "type": l.Type})
+	}
+	if app && p.Sold > 0 {
+		labels = append(labels, map[string]string{"title": formatSold(p.Sold), "position": "integrity", "type": "textDarkGrey"})
+	}
+	original := ""
+	if p.OriginalPrice > 0 {
+		original = formatRupiah(p.OriginalPrice)
+	}
+	out := map[string]any{
+		"id":                 p.ID,
+		"name":               p.Name,
+		"price":              formatRupiah(p.Price),
+		"originalPrice":      original,
+		"priceRange":         "",
+		"discountPercentage": p.DiscountPercentage,
+		"categoryBreadcrumb": p.Category,
+		"imageUrl":           p.ImageURL,
+		"url":                base + p.path() + "?extParam=src%3Dmock",
+		"countReview":        p.CountReview,
+		"rating":             p.Rating,
+		"wishlist":           false,
+		"ads":                map[string]string{"id": adID},
+		"labelGroups":        labels,
+		"shop": map[string]any{
+			"id":         p.Shop.ID,
+			"name":       p.Shop.Name,
+			"url":        base + p.shopPath(),
+			"city":       p.Shop.City,
+			"isOfficial": p.Shop.IsOfficial,
+		},
+	}
+	if app {
+		out["ratingAverage"] = strconv.FormatFloat(p.Rating, 'f', 1, 64)
+	}
+	return out
+}
+
+// formatSold renders a sold count the way the app labels it, rounded down:
+// "40 terjual", "250+ terjual", "1rb+ terjual", "1,2jt terjual".
+func formatSold(n int) string {
+	switch {
+	case n >= 1_000_000:
+		return strings.Replace(strconv.FormatFloat(float64(n/100_000)/10, 'f', -1, 64), ".", ",", 1) + "jt+ terjual"
+	case n >= 1000:
+		return strconv.Itoa(n/1000) + "rb+ terjual"
+	case n >= 100:
+		return strconv.Itoa(n/50*50) + "+ terjual"
+	}
+	return strconv.Itoa(n) + " terjual"
+}
+
+// formatRupiah renders 1234567 as "Rp1.234.567", like Tokopedia does.
+func formatRupiah(n int64) string {
+	s := strconv.FormatInt(n, 10)
+	var out []byte
+	for i := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			out = append(out, '.')
+		}
+		out = append(out, s[i])
+	}
+	return "Rp" + string(out)
+}
@@ -0,0 +1,96 @@
+package testserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+)
+
+// handleHome serves the homepage. Like the real one it hands a new visitor
+// the bot-detection cookies (_abck, DID_JS) a warmed-up session carries.
+func (s *Server) handleHome(w http.ResponseWriter, r *http.Request) {
+	for _, name := range []string{"_abck", "DID_JS"} {
+		if _, err := r.Cookie(name); err == nil {
+			continue
+		}
+		s.mu.Lock()
+		value := strconv.FormatUint(s.rng.Uint64(), 36)
+		s.mu.Unlock()
+		http.SetCookie(w, &http.Cookie{Name: name, Value: value, Path: "/", MaxAge: 365 * 24 * 3600, HttpOnly: name == "_abck"})
+	}
+	writePage(w, "Tokopedia", map[string]any{
+		"@context": "https://schema.org",
+		"@type":    "WebSite",
+		"url":      baseURL(r) + "/",
+	})
+}
+
+// handleSearchPage serves a search results page carrying a JSON-LD ItemList.
+func (s *Server) handleSearchPage(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page <= 0 {
+		page = 1
+	}
+	const rows = 20
+	products, _ := s.search(q, (page-1)*rows, rows, 0)
+	products = atLocation(products, buyerCity(r, nil))
+
+	base := baseURL(r)
+	elements := make([]map[string]any, len(products))
+	for i, p := range products {
+		elements[i] = map[string]any{
+			"@type":    "ListItem",
+			"position": i + 1,
+			"item":     jsonLDProduct(base, p),
+		}
+	}
+	ld := map[string]any{
+		"@context":        "https://schema.org",
+		"@type":           "ItemList",
+		"itemListElement": elements,
+	}
+	writePage(w, fmt.Sprintf("Jual %s | Tokopedia", q), ld)
+}
+
+// handleProductPage serves a product page carrying a JSON-LD Product.
+func (s *Server) handleProductPage(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.find(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	ld := jsonLDProduct(baseURL(r), p)
+	ld["@context"] = "https://schema.org"
+	writePage(w, p.Name, ld)
+}
+
+func jsonLDProduct(base string, p Product) map[string]any {
+	return map[string]any{
+		"@type": "Product",
+		"name":  p.Name,
+		"url":   base + p.path(),
+		"image": p.ImageURL,
+		"offers": map[string]any{
+			"@type":         "Offer",
+			"price":         p.Price,
+			"priceCurrency": "IDR",
+			"seller":        map[string]string{"@type": "Organization", "name": p.Shop.Name},
+		},
+		"aggregateRating": map[string]any{
+			"ratingValue": p.Rating,
+			"reviewCount": p.CountReview,
+		},
+	}
+}
+
+func writePage(w http.ResponseWriter, title string, ld any) {
+	data, _ := json.Marshal(ld)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, `<!doctype html>
+<html lang="id"><head><meta charset="utf-8"><title>%s</title>
+<script type="application/ld+json">%s</script>
+</head><body><div id="zeus-root"></div></body></html>`, html.EscapeString(title), data)
+}
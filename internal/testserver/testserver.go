@@ -0,0 +1,361 @@
+// Package testserver emulates the Tokopedia surfaces the scraper uses: the
+// SearchProductQueryV4 GraphQL endpoint, the homepage, search pages with
+// JSON-LD, product pages and robots.txt. It supports fixtures, latency and fault injection so
+// the strategy chain and stealth pipeline can be exercised without the network.
+package testserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config controls the mock server's data and fault injection.
+type Config struct {
+	FixturesFile  string        // JSON array of Product; empty = synthetic catalogue
+	RobotsTxt     string        // robots.txt body; empty = allow all
+	Latency       time.Duration // added to every response
+	Jitter        time.Duration // random extra latency in [0, Jitter)
+	RateLimitRate float64       // fraction of requests answered with 429
+	RetryAfter    time.Duration // Retry-After sent with 429s
+	ErrorRate     float64       // fraction of requests answered with 5xx
+	CaptchaRate   float64       // fraction of requests answered with a captcha page
+	EmptyKeyword  string        // searches containing this return no results (default "no-results")
+	PerKeyword    int           // synthetic products per keyword (default 60)
+	Seed          uint64        // seed for fault injection and synthetic data
+}
+
+// Product is a fixture product in the shape Tokopedia's GraphQL API returns.
+type Product struct {
+	ID                 int64   `json:"id"`
+	Name               string  `json:"name"`
+	Price              int64   `json:"price"`
+	OriginalPrice      int64   `json:"original_price,omitempty"`
+	DiscountPercentage int     `json:"discount_percentage,omitempty"`
+	Category           string  `json:"category,omitempty"`
+	ImageURL           string  `json:"image_url,omitempty"`
+	CountReview        int     `json:"count_review,omitempty"`
+	Rating             float64 `json:"rating,omitempty"`
+	Sold               int     `json:"sold,omitempty"` // reported to app (device=android) searches only
+	IsAd               bool    `json:"is_ad,omitempty"`
+	Labels             []Label `json:"labels,omitempty"`
+	Shop               Shop    `json:"shop"`
+	Slug               string  `json:"slug,omitempty"` // URL path segment; derived from Name if empty
+}
+
+// Label is a promo label on a fixture product.
+type Label struct {
+	Title    string `json:"title"`
+	Position string `json:"position,omitempty"`
+	Type     string `json:"type,omitempty"`
+}
+
+// Shop is the seller of a fixture product.
+type Shop struct {
+	ID         int64  `json:"id"`
+	Name       string `json:"name"`
+	Domain     string `json:"domain,omitempty"` // URL path segment; derived from Name if empty
+	City       string `json:"city,omitempty"`
+	IsOfficial bool   `json:"is_official,omitempty"`
+}
+
+// Server is the mock Tokopedia. It implements http.Handler.
+type Server struct {
+	cfg      Config
+	fixtures []Product // nil when using the synthetic catalogue
+	mux      *http.ServeMux
+
+	mu       sync.Mutex
+	rng      *rand.Rand
+	requests map[string]int // per-path request counts
+}
+
+// New creates a mock server from cfg.
+func New(cfg Config) (*Server, error) {
+	if cfg.EmptyKeyword == "" {
+		cfg.EmptyKeyword = "no-results"
+	}
+	if cfg.PerKeyword <= 0 {
+		cfg.PerKeyword = 60
+	}
+	if cfg.RobotsTxt == "" {
+		cfg.RobotsTxt = "User-agent: *\nAllow: /\n"
+	}
+
+	s := &Server{
+		cfg:      cfg,
+		rng:      rand.New(rand.NewPCG(cfg.Seed, cfg.Seed^0x9e3779b97f4a7c15)),
+		requests: make(map[string]int),
+	}
+	if cfg.FixturesFile != "" {
+		data, err := os.ReadFile(cfg.FixturesFile)
+		if err != nil {
+			return nil, fmt.Errorf("read fixtures: %w", err)
+		}
+		if err := json.Unmarshal(data, &s.fixtures); err != nil {
+			return nil, fmt.Errorf("parse fixtures: %w", err)
+		}
+	}
+
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("GET /robots.txt", s.handleRobots)
+	s.mux.HandleFunc("GET /{$}", s.faulty(s.handleHome))
+	s.mux.HandleFunc("POST /graphql/{op}", s.faulty(s.handleGraphQL))
+	s.mux.HandleFunc("POST /graphql", s.faulty(s.handleGraphQL))
+	s.mux.HandleFunc("GET /search", s.faulty(s.handleSearchPage))
+	s.mux.HandleFunc("GET /{shop}/{product}", s.faulty(s.handleProductPage))
+	return s, nil
+}
+
+// Start runs the mock on a random local port. Callers must Close the result.
+func Start(cfg Config) (*httptest.Server, error) {
+	s, err := New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return httptest.NewServer(s), nil
+}
+
+// GraphQLURL returns the search GraphQL endpoint for a server rooted at baseURL.
+func GraphQLURL(baseURL string) string {
+	return strings.TrimRight(baseURL, "/") + "/graphql/SearchProductQueryV4"
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests[r.URL.Path]++
+	s.mu.Unlock()
+	s.mux.ServeHTTP(w, r)
+}
+
+// Requests returns how many requests have hit path.
+func (s *Server) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+func (s *Server) handleRobots(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, s.cfg.RobotsTxt)
+}
+
+// faulty wraps a handler with latency and 429/5xx/captcha injection.
+func (s *Server) faulty(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		delay := s.cfg.Latency
+		if s.cfg.Jitter > 0 {
+			delay += time.Duration(s.rng.Int64N(int64(s.cfg.Jitter)))
+		}
+		roll := s.rng.Float64()
+		s.mu.Unlock()
+
+		if delay > 0 {
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		switch {
+		case roll < s.cfg.RateLimitRate:
+			if s.cfg.RetryAfter > 0 {
+				w.Header().Set("Retry-After", fmt.Sprintf("%d", int(s.cfg.RetryAfter.Seconds())))
+			}
+			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+		case roll < s.cfg.RateLimitRate+s.cfg.ErrorRate:
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		case roll < s.cfg.RateLimitRate+s.cfg.ErrorRate+s.cfg.CaptchaRate:
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, captchaPage)
+		default:
+			next(w, r)
+		}
+	}
+}
+
+const captchaPage = `<!doctype html><html><head><title>Verify</title></head>
+<body><h1>Please verify you are human</h1><div class="g-recaptcha" data-sitekey="mock"></div></body></html>`
+
+// search returns the products matching keyword and the total match count.
+func (s *Server) search(keyword string, start, rows, orderBy int) ([]Product, int) {
+	kw := strings.ToLower(strings.TrimSpace(keyword))
+	if strings.Contains(kw, strings.ToLower(s.cfg.EmptyKeyword)) {
+		return nil, 0
+	}
+
+	var all []Product
+	if s.fixtures != nil {
+		for _, p := range s.fixtures {
+			if kw == "" || strings.Contains(strings.ToLower(p.Name), kw) || strings.Contains(strings.ToLower(p.Category), kw) {
+				all = append(all, p)
+			}
+		}
+	} else {
+		all = synthesize(keyword, s.cfg.PerKeyword, s.cfg.Seed)
+	}
+	sortProducts(all, orderBy)
+
+	total := len(all)
+	if start >= total {
+		return nil, total
+	}
+	end := min(start+rows, total)
+	return all[start:end], total
+}
+
+// atLocation returns ps priced for a buyer in cityID (0: no location), as
+// Tokopedia does for warehouse stock: a few percent up or down per city.
+func atLocation(ps []Product, cityID int) []Product {
+	if cityID <= 0 {
+		return ps
+	}
+	out := make([]Product, len(ps))
+	for i, p := range ps {
+		pct := int64((cityID+int(p.ID))%11) - 5
+		p.Price += p.Price * pct / 100
+		if p.OriginalPrice > 0 {
+			p.OriginalPrice += p.OriginalPrice * pct / 100
+		}
+		out[i] = p
+	}
+	return out
+}
+
+// buyerCity returns the buyer's city ID from the user_cityId search
+// parameter or, failing that, the local_cache address cookie.
+func buyerCity(r *http.Request, params url.Values) int {
+	if id, err := strconv.Atoi(params.Get("user_cityId")); err == nil {
+		return id
+	}
+	c, err := r.Cookie("local_cache")
+	if err != nil {
+		return 0
+	}
+	raw, err := url.QueryUnescape(c.Value)
+	if err != nil {
+		return 0
+	}
+	var addr struct {
+		CityID string `json:"city_id"`
+	}
+	if json.Unmarshal([]byte(raw), &addr) != nil {
+		return 0
+	}
+	id, _ := strconv.Atoi(addr.CityID)
+	return id
+}
+
+// synthesize builds a deterministic catalogue for keyword.
+func synthesize(keyword string, n int, seed uint64) []Product {
+	h := fnv.New64a()
+	h.Write([]byte(slugify(keyword))) // stable across case/punctuation so product pages resolve
+	rng := rand.New(rand.NewPCG(seed, h.Sum64()))
+
+	cities := []string{"Jakarta Barat", "Jakarta Utara", "Surabaya", "Bandung", "Medan", "Tangerang"}
+	labels := []string{"Cashback", "Gratis Ongkir", "Flash Sale", "Grosir"}
+	title := strings.TrimSpace(keyword)
+	if title == "" {
+		title = "Produk"
+	}
+
+	out := make([]Product, n)
+	for i := range out {
+		price := int64(10+rng.IntN(990)) * 1000
+		p := Product{
+			ID:          1000000 + int64(i),
+			Name:        fmt.Sprintf("%s Varian %d", title, i+1),
+			Price:       price,
+			Category:    "mainan-hobi/figure/action-figure",
+			ImageURL:    fmt.Sprintf("https://images.example/%d.jpg", i+1),
+			CountReview: rng.IntN(5000),
+			Rating:      float64(35+rng.IntN(16)) / 10,
+			IsAd:        i%10 == 0,
+			Shop: Shop{
+				ID:         5000 + int64(i%12),
+				Name:       fmt.Sprintf("Toko Mock %d", i%12+1),
+				City:       cities[i%len(cities)],
+				IsOfficial: i%12 == 0,
+			},
+		}
+		p.Sold = p.CountReview * 4
+		if rng.IntN(4) == 0 {
+			p.DiscountPercentage = 5 + rng.IntN(45)
+			p.OriginalPrice = price * 100 / int64(100-p.DiscountPercentage)
+		}
+		if rng.IntN(3) == 0 {
+			p.Labels = []Label{{Title: labels[rng.IntN(len(labels))], Position: "integrity", Type: "textDarkGrey"}}
+		}
+		out[i] = p
+	}
+	return out
+}
+
+func (p Product) shopPath() string {
+	if p.Shop.Domain != "" {
+		return "/" + p.Shop.Domain
+	}
+	return "/" + slugify(p.Shop.Name)
+}
+
+func (p Product) path() string {
+	slug := p.Slug
+	if slug == "" {
+		slug = slugify(p.Name)
+	}
+	return p.shopPath() + "/" + slug
+}
+
+// find returns the product whose URL path is path.
+func (s *Server) find(path string) (Product, bool) {
+	// Synthetic product slugs embed the keyword, so rebuild that keyword's catalogue.
+	var candidates []Product
+	if s.fixtures != nil {
+		candidates = s.fixtures
+	} else {
+		slug := path[strings.LastIndex(path, "/")+1:]
+		if i := strings.LastIndex(slug, "-varian-"); i > 0 {
+			candidates = synthesize(slug[:i], s.cfg.PerKeyword, s.cfg.Seed)
+		}
+	}
+	for _, p := range candidates {
+		if p.path() == path {
+			return p, true
+		}
+	}
+	return Product{}, false
+}
+
+func slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
@@ -0,0 +1,294 @@
+package testserver
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// ClientHello summarises the TLS ClientHello of one connection and, for
+// HTTP/2, the connection preface that followed it. Together they are what a
+// WAF fingerprints a client by.
+type ClientHello struct {
+	Remote     string
+	ServerName string
+	ALPN       []string // protocols offered
+	Protocol   string   // protocol negotiated
+	JA3        string   // version,ciphers,extensions,curves,point formats (GREASE removed)
+	JA3Hash    string   // MD5 of JA3
+	JA3NHash   string   // MD5 of JA3 with sorted extensions, stable across Chrome's shuffling
+	// H2 is the Akamai HTTP/2 fingerprint: SETTINGS|WINDOW_UPDATE|PRIORITY|pseudo-header order.
+	H2 string
+}
+
+// NewCertificate returns a self-signed certificate for localhost and
+// 127.0.0.1, and its PEM encoding for clients to trust (e.g. SSL_CERT_FILE).
+func NewCertificate() (tls.Certificate, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "kidkazz mockserver"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(7 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	return cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
+
+// ServeTLS serves h over TLS (HTTP/2 and HTTP/1.1) on ln, calling record
+// with the fingerprint of every connection. It blocks until ln fails.
+func ServeTLS(ln net.Listener, cert tls.Certificate, h http.Handler, record func(ClientHello)) error {
+	h1 := &chanListener{addr: ln.Addr(), conns: make(chan net.Conn)}
+	srv := &http.Server{Handler: h}
+	go srv.Serve(h1)
+	h2 := &http2.Server{}
+
+	for {
+		raw, err := ln.Accept()
+		if err != nil {
+			h1.Close()
+			return err
+		}
+		go func() {
+			hello := ClientHello{Remote: raw.RemoteAddr().String()}
+			cfg := &tls.Config{
+				Certificates: []tls.Certificate{cert},
+				NextProtos:   []string{"h2", "http/1.1"},
+				GetConfigForClient: func(info *tls.ClientHelloInfo) (*tls.Config, error) {
+					hello.fill(info)
+					return nil, nil
+				},
+			}
+			conn := tls.Server(raw, cfg)
+			if err := conn.Handshake(); err != nil {
+				raw.Close()
+				return
+			}
+			hello.Protocol = conn.ConnectionState().NegotiatedProtocol
+			if hello.Protocol != "h2" {
+				record(hello)
+				h1.conns <- conn
+				return
+			}
+			rc := &prefaceConn{Conn: conn, tls: conn, done: func(fp string) {
+				hello.H2 = fp
+				record(hello)
+			}}
+			h2.ServeConn(rc, &http2.ServeConnOpts{Handler: h, BaseConfig: srv})
+		}()
+	}
+}
+
+func (c *ClientHello) fill(info *tls.ClientHelloInfo) {
+	c.ServerName = info.ServerName
+	c.ALPN = info.SupportedProtos
+
+	join := func(vs []uint16) string {
+		parts := make([]string, 0, len(vs))
+		for _, v := range vs {
+			if !isGREASE(v) {
+				parts = append(parts, strconv.Itoa(int(v)))
+			}
+		}
+		return strings.Join(parts, "-")
+	}
+	curves := make([]uint16, len(info.SupportedCurves))
+	for i, cv := range info.SupportedCurves {
+		curves[i] = uint16(cv)
+	}
+	points := make([]uint16, len(info.SupportedPoints))
+	for i, p := range info.SupportedPoints {
+		points[i] = uint16(p)
+	}
+	sorted := slices.Clone(info.Extensions)
+	slices.Sort(sorted)
+
+	// JA3 takes the legacy ClientHello version, which is TLS 1.2 for every
+	// TLS 1.3 client.
+	ja3 := func(exts []uint16) string {
+		return strings.Join([]string{"771", join(info.CipherSuites), join(exts), join(curves), join(points)}, ",")
+	}
+	c.JA3 = ja3(info.Extensions)
+	sum := md5.Sum([]byte(c.JA3))
+	c.JA3Hash = hex.EncodeToString(sum[:])
+	sum = md5.Sum([]byte(ja3(sorted)))
+	c.JA3NHash = hex.EncodeToString(sum[:])
+}
+
+// isGREASE reports whether v is a GREASE value (RFC 8701), which browsers
+// randomise and fingerprints ignore.
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+// prefaceConn watches the client's first HTTP/2 frames as the server reads
+// them and reports the Akamai fingerprint once the first HEADERS arrives.
+type prefaceConn struct {
+	net.Conn
+	tls  *tls.Conn
+	done func(string)
+
+	buf      bytes.Buffer
+	finished bool
+}
+
+// ConnectionState lets the HTTP/2 server populate Request.TLS.
+func (c *prefaceConn) ConnectionState() tls.ConnectionState {
+	return c.tls.ConnectionState()
+}
+
+func (c *prefaceConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if !c.finished && n > 0 {
+		c.buf.Write(p[:n])
+		if fp, ok := akamaiFingerprint(c.buf.Bytes()); ok {
+			c.finished = true
+			c.buf = bytes.Buffer{}
+			c.done(fp)
+		} else if c.buf.Len() > 64<<10 {
+			c.finished = true
+			c.done("")
+		}
+	}
+	return n, err
+}
+
+// akamaiFingerprint parses the client preface in data. It reports false
+// until the first HEADERS frame is complete.
+func akamaiFingerprint(data []byte) (string, bool) {
+	data, ok := bytes.CutPrefix(data, []byte(http2.ClientPreface))
+	if !ok {
+		return "", false
+	}
+
+	var settings, priorities []string
+	window := "00"
+	for len(data) >= 9 {
+		length := int(data[0])<<16 | int(data[1])<<8 | int(data[2])
+		typ, flags := http2.FrameType(data[3]), http2.Flags(data[4])
+		stream := binary.BigEndian.Uint32(data[5:9]) & 0x7fffffff
+		if len(data) < 9+length {
+			return "", false
+		}
+		payload := data[9 : 9+length]
+		data = data[9+length:]
+
+		switch typ {
+		case http2.FrameSettings:
+			for i := 0; i+6 <= len(payload); i += 6 {
+				settings = append(settings, fmt.Sprintf("%d:%d",
+					binary.BigEndian.Uint16(payload[i:]), binary.BigEndian.Uint32(payload[i+2:])))
+			}
+		case http2.FrameWindowUpdate:
+			if stream == 0 && len(payload) == 4 {
+				window = strconv.Itoa(int(binary.BigEndian.Uint32(payload) & 0x7fffffff))
+			}
+		case http2.FramePriority:
+			if len(payload) == 5 {
+				priorities = append(priorities, priority(stream, payload))
+			}
+		case http2.FrameHeaders:
+			if flags.Has(http2.FlagHeadersPadded) && len(payload) > 0 {
+				pad := int(payload[0])
+				payload = payload[1:]
+				if pad > len(payload) {
+					return "", true
+				}
+				payload = payload[:len(payload)-pad]
+			}
+			if flags.Has(http2.FlagHeadersPriority) && len(payload) >= 5 {
+				priorities = append(priorities, priority(stream, payload[:5]))
+				payload = payload[5:]
+			}
+			var pseudo []string
+			dec := hpack.NewDecoder(4096, func(f hpack.HeaderField) {
+				if strings.HasPrefix(f.Name, ":") {
+					pseudo = append(pseudo, f.Name[1:2])
+				}
+			})
+			if _, err := dec.Write(payload); err != nil {
+				return "", true
+			}
+			if len(priorities) == 0 {
+				priorities = []string{"0"}
+			}
+			return strings.Join([]string{
+				strings.Join(settings, ";"), window, strings.Join(priorities, ","), strings.Join(pseudo, ","),
+			}, "|"), true
+		}
+	}
+	return "", false
+}
+
+// priority formats a PRIORITY payload as stream:exclusive:dependency:weight.
+func priority(stream uint32, p []byte) string {
+	dep := binary.BigEndian.Uint32(p)
+	exclusive := dep >> 31
+	return fmt.Sprintf("%d:%d:%d:%d", stream, exclusive, dep&0x7fffffff, int(p[4])+1)
+}
+
+// chanListener hands already-accepted connections to an http.Server.
+type chanListener struct {
+	addr  net.Addr
+	conns chan net.Conn
+	once  sync.Once
+	done  chan struct{}
+}
+
+func (l *chanListener) Accept() (net.Conn, error) {
+	l.once.Do(l.init)
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, errors.New("listener closed")
+	}
+}
+
+func (l *chanListener) Close() error {
+	l.once.Do(l.init)
+	select {
+	case <-l.done:
+	default:
+		close(l.done)
+	}
+	return nil
+}
+
+func (l *chanListener) Addr() net.Addr { return l.addr }
+
+func (l *chanListener) init() { l.done = make(chan struct{}) }
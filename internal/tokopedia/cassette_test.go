@@ -0,0 +1,232 @@
+package tokopedia
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lukman83/kidkazz-scrap/internal/cassette"
+	"github.com/lukman83/kidkazz-scrap/internal/platform"
+	"github.com/lukman83/kidkazz-scrap/internal/testserver"
+)
+
+var record = flag.Bool("record", false, "re-record testdata/cassettes from internal/testserver")
+
+// testOrigin is the origin the cassettes are recorded under. With -record
+// it resolves to the mock server; on replay nothing is dialed.
+const testOrigin = "http://tokopedia.test"
+
+var testGraphQLEndpoint = testserver.GraphQLURL(testOrigin)
+
+// cassetteTransport replays testdata/cassettes/name. With -record it first
+// records the cassette afresh from h.
+func cassetteTransport(t *testing.T, name string, h http.Handler) http.RoundTripper {
+	t.Helper()
+	dir := filepath.Join("testdata", "cassettes", name)
+	if !*record {
+		rp, err := cassette.NewReplayer(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rp
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	addr := srv.Listener.Addr().String()
+	dial := func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, addr)
+	}
+	rec, err := cassette.NewRecorder(dir, &http.Transport{DialContext: dial}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+// cassetteClient returns an HTTP client backed by cassetteTransport.
+func cassetteClient(t *testing.T, name string, h http.Handler) *http.Client {
+	return &http.Client{Transport: cassetteTransport(t, name, h)}
+}
+
+// mockTokopedia returns the mock server with its synthetic catalogue.
+func mockTokopedia(t *testing.T, cfg testserver.Config) *testserver.Server {
+	t.Helper()
+	if cfg.PerKeyword == 0 {
+		cfg.PerKeyword = 8
+	}
+	s, err := testserver.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// routes sends requests under /graphql to gql and the rest to pages.
+func routes(gql, pages http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/graphql/", gql)
+	mux.Handle("/", pages)
+	return mux
+}
+
+func TestStrategiesReplay(t *testing.T) {
+	req := platform.Request{Type: platform.SearchRequest, Keyword: "boneka", Page: 1, Limit: 5}
+	tests := []struct {
+		name      string
+		strategy  func(*http.Client) platform.Strategy
+		products  int
+		totalData int
+	}{
+		{"graphql", func(c *http.Client) platform.Strategy { return NewGraphQLStrategy(c, testGraphQLEndpoint) }, 5, 8},
+		{"mobile", func(c *http.Client) platform.Strategy { return NewMobileAppStrategy(c, testGraphQLEndpoint) }, 5, 8},
+		{"static", func(c *http.Client) platform.Strategy { return NewStaticPageStrategy(c, testOrigin) }, 8, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := cassetteClient(t, tt.name, mockTokopedia(t, testserver.Config{}))
+			r, err := tt.strategy(client).Execute(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Strategy != tt.name {
+				t.Errorf("strategy = %q, want %q", r.Strategy, tt.name)
+			}
+			if len(r.Products) != tt.products {
+				t.Errorf("got %d products, want %d", len(r.Products), tt.products)
+			}
+			if r.TotalData != tt.totalData {
+				t.Errorf("total = %d, want %d", r.TotalData, tt.totalData)
+			}
+			for _, p := range r.Products {
+				if p.Name == "" || p.Price <= 0 || p.Strategy != tt.name {
+					t.Errorf("incomplete product %+v", p)
+				}
+			}
+		})
+	}
+}
+
+// TestHeadlessReplay renders the recorded search page in a real browser. It
+// needs Chrome or Chromium at $ROD_BROWSER_BIN; rod is not allowed to
+// download one.
+func TestHeadlessReplay(t *testing.T) {
+	if os.Getenv("ROD_BROWSER_BIN") == "" {
+		t.Skip("ROD_BROWSER_BIN not set")
+	}
+	rt := cassetteTransport(t, "headless", mockTokopedia(t, testserver.Config{}))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		out := r.Clone(r.Context())
+		out.RequestURI = ""
+		out.URL, _ = url.Parse(testOrigin + r.URL.RequestURI())
+		out.Host = out.URL.Host
+		resp, err := rt.RoundTrip(out)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		for k, v := range resp.Header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+	defer srv.Close()
+
+	h := NewHeadlessBrowserStrategy(srv.URL, nil, nil, nil, nil, nil)
+	r, err := h.Execute(context.Background(), platform.Request{Type: platform.SearchRequest, Keyword: "boneka", Page: 1, Limit: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Strategy != StrategyHeadless || len(r.Products) != 8 {
+		t.Errorf("got %d products via %s, want 8 via headless", len(r.Products), r.Strategy)
+	}
+}
+
+func TestExecuteWithFallbackReplay(t *testing.T) {
+	tests := []struct {
+		name     string
+		cassette string
+		handler  func(t *testing.T) http.Handler
+		want     string // strategy expected to win
+		products int
+		warnings int
+	}{
+		{
+			name:     "fast strategy wins",
+			cassette: "fallback-found",
+			handler:  func(t *testing.T) http.Handler { return mockTokopedia(t, testserver.Config{}) },
+			want:     StrategyGraphQL,
+			products: 5,
+		},
+		{
+			name:     "blocked graphql falls back to static",
+			cassette: "fallback-blocked",
+			handler: func(t *testing.T) http.Handler {
+				return routes(mockTokopedia(t, testserver.Config{CaptchaRate: 1}), mockTokopedia(t, testserver.Config{}))
+			},
+			want:     StrategyStatic,
+			products: 8,
+			warnings: 2, // the block retry, then the failure
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewScraper(cassetteClient(t, tt.cassette, tt.handler(t)), Options{
+				FastStrategies:  []string{StrategyGraphQL},
+				SlowStrategies:  []string{StrategyStatic},
+				BaseURL:         testOrigin,
+				GraphQLEndpoint: testGraphQLEndpoint,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, info := platform.WithResultInfo(context.Background())
+			products, err := s.executeWithFallback(ctx, platform.Request{Type: platform.SearchRequest, Keyword: "boneka", Page: 1, Limit: 5})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ri := info()
+			if ri.Strategy != tt.want {
+				t.Errorf("strategy = %q, want %q", ri.Strategy, tt.want)
+			}
+			if len(products) != tt.products {
+				t.Errorf("got %d products, want %d", len(products), tt.products)
+			}
+			if len(ri.Warnings) != tt.warnings {
+				t.Errorf("warnings = %q, want %d", ri.Warnings, tt.warnings)
+			}
+		})
+	}
+}
+
+func TestReplayDropsHeadless(t *testing.T) {
+	s, err := NewScraper(http.DefaultClient, Options{Replay: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, st := range append(s.fastStrategies, s.slowStrategies...) {
+		if st.Name() == StrategyHeadless {
+			t.Errorf("headless left in the chain while replaying")
+		}
+	}
+	h, err := s.strategy(StrategyHeadless)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Execute(context.Background(), platform.Request{Type: platform.SearchRequest, Keyword: "boneka"}); !errors.Is(err, ErrNoReplay) {
+		t.Errorf("selected headless: err = %v, want ErrNoReplay", err)
+	}
+}
@@ -0,0 +1,135 @@
+package tokopedia
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"log/slog"
+
+	"github.com/lukman83/kidkazz-scrap/internal/drift"
+	"github.com/lukman83/kidkazz-scrap/internal/models"
+	"github.com/lukman83/kidkazz-scrap/internal/platform"
+)
+
+// Expected payload shapes, see drift.Shape for the format. Update them when
+// Tokopedia changes a payload and the parsers have been adapted.
+//
+//go:embed schemas/*.json
+var schemaFiles embed.FS
+
+func loadShape(name string) drift.Shape {
+	data, err := schemaFiles.ReadFile("schemas/" + name)
+	if err != nil {
+		panic(err)
+	}
+	s, err := drift.ParseShape(data)
+	if err != nil {
+		panic(fmt.Sprintf("%s: %v", name, err))
+	}
+	return s
+}
+
+var (
+	graphqlSearchShape = loadShape("graphql_search.json")
+	appSearchShape     = loadShape("graphql_search_app.json")
+	jsonLDProductShape = loadShape("jsonld_product.json")
+)
+
+func filled(field string, fn func(p models.Product) bool) drift.FillRule {
+	return drift.FillRule{Field: field, Filled: fn}
+}
+
+var (
+	fillPrice    = filled("price", func(p models.Product) bool { return p.Price > 0 })
+	fillName     = filled("name", func(p models.Product) bool { return p.Name != "" })
+	fillURL      = filled("url", func(p models.Product) bool { return p.URL != "" })
+	fillImage    = filled("image_url", func(p models.Product) bool { return p.ImageURL != "" })
+	fillShop     = filled("shop.name", func(p models.Product) bool { return p.Shop.Name != "" })
+	fillCity     = filled("shop.city", func(p models.Product) bool { return p.Shop.City != "" })
+	fillCategory = filled("category", func(p models.Product) bool { return p.Category != "" })
+	fillRating   = filled("rating", func(p models.Product) bool { return p.Rating > 0 })
+)
+
+// schemas lists the expected payload of each strategy. The fill rules only
+// cover fields the strategy is able to populate.
+var schemas = map[string]drift.Schema{
+	StrategyGraphQL: {
+		Name:  "graphql-search",
+		Shape: graphqlSearchShape,
+		Fill:  []drift.FillRule{fillPrice, fillName, fillURL, fillImage, fillShop, fillCity, fillCategory},
+	},
+	StrategyMobile: {
+		Name:  "graphql-search-app",
+		Shape: appSearchShape,
+		Fill:  []drift.FillRule{fillPrice, fillName, fillURL, fillImage, fillShop, fillCity, fillCategory, fillRating},
+	},
+	StrategyStatic: {
+		Name:  "jsonld-product",
+		Shape: jsonLDProductShape,
+		Fill:  []drift.FillRule{fillPrice, fillName, fillURL, fillShop},
+	},
+	// Results extracted from embedded page state carry no Raw payload, so
+	// only the fill rules apply to them.
+	StrategyHeadless: {
+		Name:  "jsonld-product",
+		Shape: jsonLDProductShape,
+		Fill:  []drift.FillRule{fillPrice, fillName, fillURL},
+	},
+}
+
+// checkDrift compares a successful result against its strategy's schema,
+// records it on the monitor and logs newly seen problems.
+func (t *Scraper) checkDrift(ctx context.Context, r *platform.Result) drift.Report {
+	schema, ok := schemas[r.Strategy]
+	if !ok {
+		return drift.Report{Source: r.Strategy}
+	}
+	report := drift.Check(r.Strategy, schema, r.Raw, r.Products)
+	fresh := t.drift.Record(report)
+	for _, f := range fresh {
+		if f.Kind != drift.FindingUnknown {
+			slog.WarnContext(ctx, "schema drift", "strategy", r.Strategy, "finding", f.String())
+		}
+	}
+	for _, fr := range report.FillRates {
+		if fr.Warn {
+			msg := fmt.Sprintf("%s returned %d/%d products with empty %s", r.Strategy, fr.Empty, report.Products, fr.Field)
+			slog.WarnContext(ctx, "low fill rate", "strategy", r.Strategy, "field", fr.Field, "empty", fr.Empty, "products", report.Products)
+			platform.Warn(ctx, msg)
+			platform.ReportProgress(ctx, "Warning: "+msg)
+		}
+	}
+	return report
+}
+
+// Drift reports the schema drift seen for each strategy since startup.
+func (t *Scraper) Drift() []drift.Stats {
+	return t.drift.Snapshot()
+}
+
+// SelfCheck runs a probe search through each named strategy (all strategies
+// when names is empty), bypassing fallbacks, and returns one drift report per
+// strategy. Circuit breakers are ignored so a tripped strategy can still be
+// inspected. A strategy that fails has its error recorded in the report.
+func (t *Scraper) SelfCheck(ctx context.Context, keyword string, names []string) ([]drift.Report, error) {
+	if len(names) == 0 {
+		names = StrategyNames()
+	}
+	reports := make([]drift.Report, 0, len(names))
+	for _, name := range names {
+		s, err := t.strategy(name)
+		if err != nil {
+			return nil, err
+		}
+		platform.ReportProgress(ctx, fmt.Sprintf("Checking %s strategy...", name))
+		req := platform.Request{Type: platform.SearchRequest, Keyword: keyword, Page: 1, Limit: 20}
+		r, err := t.executeWithRetry(ctx, s, req)
+		if err != nil {
+			schema := schemas[name]
+			reports = append(reports, drift.Report{Source: name, Schema: schema.Name, Error: err.Error()})
+			continue
+		}
+		reports = append(reports, t.checkDrift(ctx, r))
+	}
+	return reports, nil
+}
@@ -0,0 +1,195 @@
+package tokopedia
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lukman83/kidkazz-scrap/internal/crawl"
+	"github.com/lukman83/kidkazz-scrap/internal/logging"
+	"github.com/lukman83/kidkazz-scrap/internal/platform"
+	"github.com/lukman83/kidkazz-scrap/internal/stealth"
+	"github.com/lukman83/kidkazz-scrap/internal/testserver"
+)
+
+// tracedStrategy logs each run of a strategy, retries included.
+type tracedStrategy struct {
+	platform.Strategy
+	mu  *sync.Mutex
+	log *[]string
+}
+
+func (s tracedStrategy) Execute(ctx context.Context, req platform.Request) (*platform.Result, error) {
+	s.mu.Lock()
+	*s.log = append(*s.log, s.Name())
+	s.mu.Unlock()
+	return s.Strategy.Execute(ctx, req)
+}
+
+// driftedGraphQL answers searches in a renamed response shape: the products
+// moved and the header lost its total.
+var driftedGraphQL = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	io.WriteString(w, `[{"data":{"ace_search_product_v5":{"header":{"responseCode":0},"data":{"items":[{"id":1,"name":"Boneka"}]}}}}]`)
+})
+
+// TestFallbackOrder runs the strategy chain against the mock server with
+// one failure mode at a time. graphql races alone; mobile then static are
+// the fallbacks, so each mode shows how far down the chain it goes.
+func TestFallbackOrder(t *testing.T) {
+	healthy := func(t *testing.T) http.Handler { return mockTokopedia(t, testserver.Config{}) }
+	tests := []struct {
+		name        string
+		handler     func(t *testing.T) http.Handler
+		keyword     string
+		raceTimeout time.Duration
+		want        string   // strategy that settles the request
+		products    int      // products it returns
+		order       []string // strategy runs, in order
+	}{
+		{
+			name:     "healthy",
+			handler:  healthy,
+			want:     StrategyGraphQL,
+			products: 5,
+			order:    []string{"graphql"},
+		},
+		{
+			name: "blocked",
+			handler: func(t *testing.T) http.Handler {
+				return routes(mockTokopedia(t, testserver.Config{CaptchaRate: 1}), healthy(t))
+			},
+			want:     StrategyStatic,
+			products: 8,
+			order:    []string{"graphql", "graphql", "mobile", "mobile", "static"},
+		},
+		{
+			name:     "empty",
+			handler:  healthy,
+			keyword:  "no-results",
+			want:     StrategyGraphQL,
+			products: 0,
+			order:    []string{"graphql"},
+		},
+		{
+			name:     "drift",
+			handler:  func(t *testing.T) http.Handler { return routes(driftedGraphQL, healthy(t)) },
+			want:     StrategyStatic,
+			products: 8,
+			order:    []string{"graphql", "mobile", "static"},
+		},
+		{
+			name: "timeout",
+			handler: func(t *testing.T) http.Handler {
+				return routes(mockTokopedia(t, testserver.Config{Latency: 200 * time.Millisecond}), healthy(t))
+			},
+			raceTimeout: 50 * time.Millisecond,
+			want:        StrategyMobile,
+			products:    5,
+			order:       []string{"graphql", "mobile"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(tt.handler(t))
+			defer srv.Close()
+			s, err := NewScraper(srv.Client(), Options{
+				FastStrategies:  []string{StrategyGraphQL},
+				SlowStrategies:  []string{StrategyMobile, StrategyStatic},
+				RaceTimeout:     tt.raceTimeout,
+				BaseURL:         srv.URL,
+				GraphQLEndpoint: testserver.GraphQLURL(srv.URL),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var mu sync.Mutex
+			var order []string
+			for _, list := range [][]platform.Strategy{s.fastStrategies, s.slowStrategies} {
+				for i, st := range list {
+					list[i] = tracedStrategy{Strategy: st, mu: &mu, log: &order}
+				}
+			}
+
+			keyword := tt.keyword
+			if keyword == "" {
+				keyword = "boneka"
+			}
+			ctx, info := platform.WithResultInfo(context.Background())
+			products, err := s.executeWithFallback(ctx, platform.Request{Type: platform.SearchRequest, Keyword: keyword, Page: 1, Limit: 5})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := info().Strategy; got != tt.want {
+				t.Errorf("settled by %q, want %q", got, tt.want)
+			}
+			if len(products) != tt.products {
+				t.Errorf("got %d products, want %d", len(products), tt.products)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if !slices.Equal(order, tt.order) {
+				t.Errorf("ran %v, want %v", order, tt.order)
+			}
+		})
+	}
+}
+
+// sessionStrategy records the crawl session and browser profile each run
+// presents.
+type sessionStrategy struct {
+	platform.Strategy
+	pool     *stealth.FingerprintPool
+	mu       sync.Mutex
+	sessions []string
+	profiles []string
+}
+
+func (s *sessionStrategy) Execute(ctx context.Context, req platform.Request) (*platform.Result, error) {
+	session := crawl.Session(ctx)
+	s.mu.Lock()
+	s.sessions = append(s.sessions, session)
+	s.profiles = append(s.profiles, s.pool.Session(session).Name)
+	s.mu.Unlock()
+	return s.Strategy.Execute(ctx, req)
+}
+
+// TestCrawlPagesShareSession crawls two pages, each a scrape of its own in
+// the coalescer, and checks both present the crawl's session and profile.
+func TestCrawlPagesShareSession(t *testing.T) {
+	srv := httptest.NewServer(mockTokopedia(t, testserver.Config{}))
+	defer srv.Close()
+	pool, err := stealth.NewFingerprintPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewScraper(srv.Client(), Options{
+		FastStrategies:  []string{StrategyGraphQL},
+		SlowStrategies:  []string{},
+		BaseURL:         srv.URL,
+		GraphQLEndpoint: testserver.GraphQLURL(srv.URL),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := &sessionStrategy{Strategy: s.fastStrategies[0], pool: pool}
+	s.fastStrategies[0] = rec
+
+	ctx := logging.WithRequestID(context.Background(), "crawl-1")
+	for page := 1; page <= 2; page++ {
+		if _, err := s.Search(ctx, "boneka", platform.SearchOpts{Page: page, Limit: 5}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(rec.sessions) != 2 || rec.sessions[0] != "crawl-1" || rec.sessions[1] != "crawl-1" {
+		t.Errorf("pages ran in sessions %q, want crawl-1 for both", rec.sessions)
+	}
+	if rec.profiles[1] != rec.profiles[0] {
+		t.Errorf("pages presented profiles %q", rec.profiles)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/lukman83/kidkazz-scrap/internal/httputil"
@@ -15,11 +17,16 @@ import (
 
 // GraphQLStrategy calls Tokopedia's internal GraphQL API.
 type GraphQLStrategy struct {
-	client *http.Client
+	client   *http.Client
+	endpoint string
 }
 
-func NewGraphQLStrategy(client *http.Client) *GraphQLStrategy {
-	return &GraphQLStrategy{client: client}
+// NewGraphQLStrategy creates the strategy; an empty endpoint uses DefaultGraphQLEndpoint.
+func NewGraphQLStrategy(client *http.Client, endpoint string) *GraphQLStrategy {
+	if endpoint == "" {
+		endpoint = DefaultGraphQLEndpoint
+	}
+	return &GraphQLStrategy{client: client, endpoint: endpoint}
 }
 
 func (g *GraphQLStrategy) Name() string { return "graphql" }
@@ -44,7 +51,7 @@ func (g *GraphQLStrategy) search(ctx context.Context, req platform.Request) (*pl
 	if page <= 0 {
 		page = 1
 	}
-	return g.executeSearch(ctx, req.Keyword, page, limit, SortBestMatch)
+	return g.executeSearch(ctx, req, page, limit, SortBestMatch)
 }
 
 func (g *GraphQLStrategy) trending(ctx context.Context, req platform.Request) (*platform.Result, error) {
@@ -52,11 +59,17 @@ func (g *GraphQLStrategy) trending(ctx context.Context, req platform.Request) (*
 	if limit <= 0 {
 		limit = 20
 	}
-	return g.executeSearch(ctx, req.Keyword, 1, limit, SortBestSeller)
+	return g.executeSearch(ctx, req, 1, limit, SortBestSeller)
 }
 
-func (g *GraphQLStrategy) executeSearch(ctx context.Context, keyword string, page, limit, sort int) (*platform.Result, error) {
-	params := BuildSearchParams(keyword, page, limit, sort)
+func (g *GraphQLStrategy) executeSearch(ctx context.Context, req platform.Request, page, limit, sort int) (*platform.Result, error) {
+	keyword := req.Keyword
+	values := searchParams(keyword, page, limit, sort, DeviceDesktop)
+	loc, hasLoc := requestLocation(req)
+	if hasLoc {
+		loc.setSearchParams(values)
+	}
+	params := values.Encode()
 
 	payload := []map[string]interface{}{
 		{
@@ -73,13 +86,16 @@ func (g *GraphQLStrategy) executeSearch(ctx context.Context, keyword string, pag
 		return nil, fmt.Errorf("marshal request: %w", err)
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", graphQLEndpoint, bytes.NewReader(body))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", g.endpoint, bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
 	for k, v := range httputil.TokopediaGraphQLHeaders() {
 		httpReq.Header[k] = v
 	}
+	if hasLoc {
+		loc.setCookie(httpReq)
+	}
 
 	resp, err := httputil.DoWithRetry(g.client, httpReq, 2)
 	if err != nil {
@@ -92,18 +108,24 @@ func (g *GraphQLStrategy) executeSearch(ctx context.Context, keyword string, pag
 		return nil, err
 	}
 
+	if err := httputil.DetectBlock(resp, respBody); err != nil {
+		return nil, err
+	}
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("graphql response status %d: %s", resp.StatusCode, string(respBody))
 	}
 
-	products, totalData, err := parseSearchResponse(respBody)
+	products, totalData, err := parseSearchResponse(respBody, g.Name())
 	if err != nil {
 		return nil, err
 	}
+	if len(products) == 0 {
+		return nil, emptyPage(keyword, page, limit, totalData)
+	}
 
 	return &platform.Result{
 		Products:  products,
-		TotalData: totalData,
+		TotalData: derefTotal(totalData),
 		Strategy:  g.Name(),
 		Raw:       json.RawMessage(respBody),
 	}, nil
@@ -114,7 +136,7 @@ type graphqlResponse []struct {
 	Data struct {
 		AceSearchProductV4 struct {
 			Header struct {
-				TotalData    int             `json:"totalData"`
+				TotalData    *int            `json:"totalData"` // nil when the field is missing
 				ResponseCode json.Number     `json:"responseCode"`
 			} `json:"header"`
 			Data struct {
@@ -135,6 +157,7 @@ type graphqlProduct struct {
 	ImageURL            string      `json:"imageUrl"`
 	URL                 string      `json:"url"`
 	CountReview         json.Number `json:"countReview"`
+	RatingAverage       string      `json:"ratingAverage"` // app only, e.g. "4.8"
 	Wishlist            bool        `json:"wishlist"`
 	Ads struct {
 		ID string `json:"id"`
@@ -153,23 +176,47 @@ type graphqlProduct struct {
 	} `json:"shop"`
 }
 
-func parseSearchResponse(data []byte) ([]models.Product, int, error) {
+// emptyPage classifies a search page without products. It is only a genuine
+// empty result when the header explicitly reports a total that leaves nothing
+// for this page. A missing total is what a changed schema or a soft block
+// looks like, so it lets the fallbacks run.
+func emptyPage(keyword string, page, limit int, totalData *int) error {
+	if totalData == nil {
+		return httputil.NewResponseError(httputil.KindSchemaChanged, 0, "no products and no totalData in header")
+	}
+	if start := (page - 1) * limit; start >= *totalData {
+		return httputil.NewResponseError(httputil.KindEmpty, 0, "no products for %q (page %d)", keyword, page)
+	}
+	return httputil.NewResponseError(httputil.KindSchemaChanged, 0, "header reports %d results but products list is empty", *totalData)
+}
+
+// derefTotal returns the reported total, or 0 if the header had none.
+func derefTotal(totalData *int) int {
+	if totalData == nil {
+		return 0
+	}
+	return *totalData
+}
+
+// parseSearchResponse parses a SearchProductQueryV4 response, labelling the
+// products with strategy. The total is nil when the header does not report one.
+func parseSearchResponse(data []byte, strategy string) ([]models.Product, *int, error) {
 	var resp graphqlResponse
 	if err := json.Unmarshal(data, &resp); err != nil {
-		return nil, 0, fmt.Errorf("unmarshal graphql response: %w", err)
+		return nil, nil, httputil.NewResponseError(httputil.KindSchemaChanged, 0, "unmarshal graphql response: %v", err)
 	}
 
 	if len(resp) == 0 {
-		return nil, 0, fmt.Errorf("empty graphql response")
+		return nil, nil, httputil.NewResponseError(httputil.KindSchemaChanged, 0, "empty graphql response")
 	}
 
 	ace := resp[0].Data.AceSearchProductV4
 	rc, err := ace.Header.ResponseCode.Int64()
 	if err != nil {
-		return nil, 0, fmt.Errorf("invalid graphql responseCode %q: %w", ace.Header.ResponseCode.String(), err)
+		return nil, nil, httputil.NewResponseError(httputil.KindSchemaChanged, 0, "invalid graphql responseCode %q", ace.Header.ResponseCode.String())
 	}
 	if rc != 0 {
-		return nil, 0, fmt.Errorf("graphql error responseCode %d", rc)
+		return nil, nil, fmt.Errorf("graphql error responseCode %d", rc)
 	}
 	totalData := ace.Header.TotalData
 	gqlProducts := ace.Data.Products
@@ -182,10 +229,14 @@ func parseSearchResponse(data []byte) ([]models.Product, int, error) {
 		isAd := gp.Ads.ID != "" && gp.Ads.ID != "0"
 
 		var labels []models.Label
+		sold := 0
 		for _, lg := range gp.LabelGroups {
 			if lg.Title == "" {
 				continue
 			}
+			if n, ok := parseSold(lg.Title); ok {
+				sold = n
+			}
 			labels = append(labels, models.Label{
 				Title:    lg.Title,
 				Position: lg.Position,
@@ -208,7 +259,8 @@ func parseSearchResponse(data []byte) ([]models.Product, int, error) {
 			Wishlist:        gp.Wishlist,
 			Platform:        "tokopedia",
 			ScrapedAt:       time.Now(),
-			Strategy:        "graphql",
+			SoldCount:       sold,
+			Strategy:        strategy,
 			Shop: models.Shop{
 				ID:         gp.Shop.ID.String(),
 				Name:       gp.Shop.Name,
@@ -220,6 +272,9 @@ func parseSearchResponse(data []byte) ([]models.Product, int, error) {
 		if rc, err := gp.CountReview.Int64(); err == nil {
 			p.ReviewCount = int(rc)
 		}
+		if r, err := strconv.ParseFloat(strings.Replace(gp.RatingAverage, ",", ".", 1), 64); err == nil {
+			p.Rating = r
+		}
 
 		products = append(products, p)
 	}
@@ -227,6 +282,29 @@ func parseSearchResponse(data []byte) ([]models.Product, int, error) {
 	return products, totalData, nil
 }
 
+// parseSold reads a sold-count label such as "250+ terjual", "1rb+ terjual"
+// or "1,2jt terjual" as the number it promises at least.
+func parseSold(title string) (int, bool) {
+	num, ok := strings.CutSuffix(strings.ToLower(strings.TrimSpace(title)), "terjual")
+	if !ok {
+		return 0, false
+	}
+	num = strings.TrimSpace(num)
+	num = strings.TrimSuffix(num, "+")
+	mult := 1.0
+	switch {
+	case strings.HasSuffix(num, "rb"):
+		num, mult = strings.TrimSuffix(num, "rb"), 1e3
+	case strings.HasSuffix(num, "jt"):
+		num, mult = strings.TrimSuffix(num, "jt"), 1e6
+	}
+	n, err := strconv.ParseFloat(strings.Replace(strings.TrimSpace(num), ",", ".", 1), 64)
+	if err != nil {
+		return 0, false
+	}
+	return int(n * mult), true
+}
+
 // parsePrice extracts a numeric price from strings like "Rp100.000" or "Rp 1.234.567".
 func parsePrice(s string) int64 {
 	var digits []byte
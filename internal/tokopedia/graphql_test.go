@@ -0,0 +1,75 @@
+package tokopedia
+
+import (
+	"testing"
+
+	"github.com/lukman83/kidkazz-scrap/internal/httputil"
+)
+
+func TestEmptyPage(t *testing.T) {
+	total := func(n int) *int { return &n }
+	tests := []struct {
+		name      string
+		page      int
+		totalData *int
+		want      httputil.ResponseKind
+	}{
+		{"explicit zero", 1, total(0), httputil.KindEmpty},
+		{"past the last page", 3, total(40), httputil.KindEmpty},
+		{"missing total", 1, nil, httputil.KindSchemaChanged},
+		{"total says there are products", 1, total(120), httputil.KindSchemaChanged},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			re, ok := httputil.AsResponseError(emptyPage("boneka", tt.page, 20, tt.totalData))
+			if !ok {
+				t.Fatal("emptyPage did not return a ResponseError")
+			}
+			if re.Kind != tt.want {
+				t.Errorf("kind = %s, want %s", re.Kind, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSearchResponseTotal(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		products int
+		reported bool
+	}{
+		{
+			name:     "explicit zero",
+			body:     `[{"data":{"ace_search_product_v4":{"header":{"totalData":0,"responseCode":0},"data":{"products":[]}}}}]`,
+			reported: true,
+		},
+		{
+			name: "missing total",
+			body: `[{"data":{"ace_search_product_v4":{"header":{"responseCode":0},"data":{"products":[]}}}}]`,
+		},
+		{
+			name:     "products",
+			body:     `[{"data":{"ace_search_product_v4":{"header":{"totalData":7,"responseCode":0},"data":{"products":[{"id":1,"name":"Boneka","price":"Rp15.000"}]}}}}]`,
+			products: 1,
+			reported: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			products, total, err := parseSearchResponse([]byte(tt.body), StrategyGraphQL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(products) != tt.products {
+				t.Errorf("got %d products, want %d", len(products), tt.products)
+			}
+			if (total != nil) != tt.reported {
+				t.Errorf("total reported = %v, want %v", total != nil, tt.reported)
+			}
+			if tt.products > 0 && products[0].Price != 15000 {
+				t.Errorf("price = %d, want 15000", products[0].Price)
+			}
+		})
+	}
+}
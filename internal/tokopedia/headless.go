@@ -3,8 +3,10 @@ package tokopedia
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/url"
 	"os"
 	"strings"
@@ -13,17 +15,44 @@ import (
 	"github.com/go-rod/rod"
 	"github.com/go-rod/rod/lib/launcher"
 	"github.com/go-rod/rod/lib/proto"
+	"github.com/lukman83/kidkazz-scrap/internal/crawl"
+	"github.com/lukman83/kidkazz-scrap/internal/httputil"
+	"github.com/lukman83/kidkazz-scrap/internal/metrics"
 	"github.com/lukman83/kidkazz-scrap/internal/models"
 	"github.com/lukman83/kidkazz-scrap/internal/platform"
+	"github.com/lukman83/kidkazz-scrap/internal/stealth"
+	"github.com/lukman83/kidkazz-scrap/internal/tracing"
+	"github.com/lukman83/kidkazz-scrap/internal/usage"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // HeadlessBrowserStrategy uses rod to render pages with JS execution.
 type HeadlessBrowserStrategy struct {
-	launcherURL string // optional remote launcher URL
+	launcherURL  string // optional remote launcher URL
+	baseURL      string
+	fingerprints *stealth.FingerprintPool  // browser profiles (nil: rod's defaults)
+	cookies      *stealth.CookieJars       // shared with the HTTP client (nil: none)
+	usage        *usage.Meter              // bandwidth meter and budgets (nil: none)
+	proxies      *stealth.ProxyRotator     // shared with the HTTP client (nil: direct)
+	transport    *stealth.StealthTransport // robots.txt, rate limits and spacing shared with the HTTP client (nil: none)
 }
 
-func NewHeadlessBrowserStrategy() *HeadlessBrowserStrategy {
-	return &HeadlessBrowserStrategy{}
+// NewHeadlessBrowserStrategy creates the strategy; an empty baseURL uses
+// DefaultBaseURL. With fingerprints set, each page takes the crawl's
+// Chromium profile (UA, client hints, Accept-Language, viewport). With
+// cookies set, the browser starts with the crawl's cookie jar and its
+// cookies are stored back when the page closes. With meter set, the
+// browser's network traffic is metered and its budgets enforced. With
+// proxies set, each browser leaves through the next proxy, in the request's
+// city where the proxy can target one. With transport set, each navigation
+// first passes the HTTP client's robots.txt check, rate limiter and host
+// spacing, and blocks it meets slow the host down for both.
+func NewHeadlessBrowserStrategy(baseURL string, fingerprints *stealth.FingerprintPool, cookies *stealth.CookieJars, meter *usage.Meter, proxies *stealth.ProxyRotator, transport *stealth.StealthTransport) *HeadlessBrowserStrategy {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &HeadlessBrowserStrategy{baseURL: strings.TrimRight(baseURL, "/"), fingerprints: fingerprints, cookies: cookies, usage: meter, proxies: proxies, transport: transport}
 }
 
 func (h *HeadlessBrowserStrategy) Name() string { return "headless" }
@@ -40,27 +69,16 @@ func (h *HeadlessBrowserStrategy) Execute(ctx context.Context, req platform.Requ
 }
 
 func (h *HeadlessBrowserStrategy) search(ctx context.Context, req platform.Request) (*platform.Result, error) {
-	searchURL := fmt.Sprintf("https://www.tokopedia.com/search?q=%s&page=%d", url.QueryEscape(req.Keyword), req.Page)
+	searchURL := fmt.Sprintf("%s/search?q=%s&page=%d", h.baseURL, url.QueryEscape(req.Keyword), req.Page)
 
-	page, cleanup, err := h.openPage(ctx, searchURL)
+	page, htmlContent, cleanup, err := h.loadPage(ctx, searchURL, req)
 	if err != nil {
 		return nil, err
 	}
 	defer cleanup()
 
-	// Wait for page to stabilize
-	timedPage := page.Timeout(15 * time.Second)
-	if err := timedPage.WaitStable(time.Second); err == nil {
-		_ = timedPage.WaitDOMStable(2*time.Second, 0.1)
-	}
-
-	htmlContent, err := page.HTML()
-	if err != nil {
-		return nil, fmt.Errorf("get page HTML: %w", err)
-	}
-
 	// Try to extract JSON-LD from the rendered page
-	products, err := extractJSONLD(htmlContent)
+	products, raw, err := extractJSONLD(htmlContent)
 	if err == nil && len(products) > 0 {
 		for i := range products {
 			products[i].Strategy = "headless"
@@ -68,6 +86,7 @@ func (h *HeadlessBrowserStrategy) search(ctx context.Context, req platform.Reque
 		return &platform.Result{
 			Products: products,
 			Strategy: h.Name(),
+			Raw:      raw,
 		}, nil
 	}
 
@@ -84,23 +103,13 @@ func (h *HeadlessBrowserStrategy) search(ctx context.Context, req platform.Reque
 }
 
 func (h *HeadlessBrowserStrategy) productDetail(ctx context.Context, req platform.Request) (*platform.Result, error) {
-	page, cleanup, err := h.openPage(ctx, req.URL)
+	_, htmlContent, cleanup, err := h.loadPage(ctx, req.URL, req)
 	if err != nil {
 		return nil, err
 	}
 	defer cleanup()
 
-	timedPage := page.Timeout(15 * time.Second)
-	if err := timedPage.WaitStable(time.Second); err == nil {
-		_ = timedPage.WaitDOMStable(2*time.Second, 0.1)
-	}
-
-	htmlContent, err := page.HTML()
-	if err != nil {
-		return nil, fmt.Errorf("get page HTML: %w", err)
-	}
-
-	products, err := extractJSONLD(htmlContent)
+	products, raw, err := extractJSONLD(htmlContent)
 	if err != nil || len(products) == 0 {
 		return nil, fmt.Errorf("no product data extracted from headless page")
 	}
@@ -112,10 +121,61 @@ func (h *HeadlessBrowserStrategy) productDetail(ctx context.Context, req platfor
 	return &platform.Result{
 		Products: products,
 		Strategy: h.Name(),
+		Raw:      raw,
 	}, nil
 }
 
-func (h *HeadlessBrowserStrategy) openPage(ctx context.Context, pageURL string) (*rod.Page, func(), error) {
+// loadPage opens pageURL for req, waits for it to stabilize and returns its
+// rendered HTML, all under one headless.page_load span. A challenge page is
+// an error, which also slows the host down. The caller must run cleanup
+// when it is done with the page.
+func (h *HeadlessBrowserStrategy) loadPage(ctx context.Context, pageURL string, req platform.Request) (page *rod.Page, htmlContent string, cleanup func(), err error) {
+	ctx, span := tracing.Start(ctx, "headless.page_load",
+		tracing.AttrStrategy.String(h.Name()),
+		attribute.String("url.full", pageURL),
+	)
+	defer func() {
+		span.SetAttributes(attribute.Int("kidkazz.html_bytes", len(htmlContent)))
+		tracing.End(span, err)
+	}()
+
+	page, cleanup, err = h.openPage(ctx, pageURL, req)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	// Wait for page to stabilize
+	timedPage := page.Timeout(15 * time.Second)
+	if err := timedPage.WaitStable(time.Second); err == nil {
+		_ = timedPage.WaitDOMStable(2*time.Second, 0.1)
+	}
+	if err := context.Cause(page.GetContext()); errors.Is(err, usage.ErrBudgetExceeded) {
+		cleanup()
+		return nil, "", nil, err
+	}
+
+	htmlContent, err = page.HTML()
+	if err != nil {
+		cleanup()
+		return nil, "", nil, fmt.Errorf("get page HTML: %w", err)
+	}
+	blocked := httputil.DetectBlockPage([]byte(htmlContent))
+	if h.transport != nil {
+		h.transport.Adapt(ctx, pageHost(pageURL), blocked)
+	}
+	if blocked != nil {
+		cleanup()
+		return nil, "", nil, blocked
+	}
+	return page, htmlContent, cleanup, nil
+}
+
+func (h *HeadlessBrowserStrategy) openPage(ctx context.Context, pageURL string, req platform.Request) (*rod.Page, func(), error) {
+	provider, proxyURL, err := h.chooseProxy(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	var l *launcher.Launcher
 	if h.launcherURL != "" {
 		l = launcher.MustNewManaged(h.launcherURL)
@@ -125,40 +185,343 @@ func (h *HeadlessBrowserStrategy) openPage(ctx context.Context, pageURL string)
 			l = l.Bin(bin).NoSandbox(true)
 		}
 	}
+	if proxyURL != nil {
+		l = l.Proxy(proxyURL.Scheme + "://" + proxyURL.Host)
+	}
+	launchStart := time.Now()
 	controlURL, err := l.Launch()
 	if err != nil {
+		metrics.BrowserLaunch.WithLabelValues("error").Observe(time.Since(launchStart).Seconds())
 		return nil, nil, fmt.Errorf("launch browser: %w", err)
 	}
 
 	browser := rod.New().ControlURL(controlURL)
 	if err := browser.Connect(); err != nil {
+		metrics.BrowserLaunch.WithLabelValues("error").Observe(time.Since(launchStart).Seconds())
 		l.Kill()
 		return nil, nil, fmt.Errorf("connect browser: %w", err)
 	}
+	metrics.BrowserLaunch.WithLabelValues("ok").Observe(time.Since(launchStart).Seconds())
+	if proxyURL != nil && proxyURL.User != nil {
+		if err := authenticateProxy(browser, proxyURL.User); err != nil {
+			browser.Close()
+			return nil, nil, err
+		}
+	}
 
-	// Set viewport to desktop size
-	page, err := browser.Page(proto.TargetCreateTarget{URL: pageURL})
+	// Open a blank page so the profile is in place before the first request.
+	page, err := browser.Page(proto.TargetCreateTarget{})
 	if err != nil {
 		browser.Close()
 		return nil, nil, fmt.Errorf("open page: %w", err)
 	}
 
-	err = page.SetViewport(&proto.EmulationSetDeviceMetricsOverride{
-		Width:  1920,
-		Height: 1080,
-	})
+	session, profile, userAgent, err := h.applyFingerprint(ctx, page)
 	if err != nil {
 		browser.Close()
-		return nil, nil, fmt.Errorf("set viewport: %w", err)
+		return nil, nil, err
+	}
+	jar := h.jar(session, profile)
+	if err := h.loadCookies(page, jar); err != nil {
+		browser.Close()
+		return nil, nil, err
+	}
+	if loc, ok := requestLocation(req); ok {
+		if err := h.setLocation(page, loc); err != nil {
+			browser.Close()
+			return nil, nil, err
+		}
 	}
 
+	if err := h.usage.Allow(ctx); err != nil {
+		browser.Close()
+		return nil, nil, err
+	}
+	pageCtx, abort := context.WithCancelCause(ctx)
+	stopMeter := h.meter(pageCtx, page, provider, abort)
 	cleanup := func() {
+		stopMeter()
+		abort(nil)
+		h.saveCookies(ctx, page, jar)
 		page.Close()
 		browser.Close()
 		l.Cleanup()
 	}
 
-	return page, cleanup, nil
+	if err := h.admit(pageCtx, pageURL, userAgent); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	if err := page.Context(pageCtx).Navigate(pageURL); err != nil {
+		cleanup()
+		if cause := context.Cause(pageCtx); errors.Is(cause, usage.ErrBudgetExceeded) {
+			return nil, nil, cause
+		}
+		return nil, nil, fmt.Errorf("navigate: %w", err)
+	}
+
+	return page.Context(pageCtx), cleanup, nil
+}
+
+// admit passes a navigation to pageURL, made as userAgent, through the
+// HTTP client's robots.txt check, rate limiter and host spacing.
+func (h *HeadlessBrowserStrategy) admit(ctx context.Context, pageURL, userAgent string) error {
+	if h.transport == nil {
+		return nil
+	}
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return fmt.Errorf("navigate: %w", err)
+	}
+	return h.transport.Admit(ctx, u, userAgent)
+}
+
+// pageHost returns the host of pageURL, or "" if it does not parse.
+func pageHost(pageURL string) string {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// chooseProxy picks the proxy the browser leaves through and returns the
+// provider name its traffic is metered under, with the proxy's URL (nil for
+// direct connections). A proxy the browser cannot use is an error rather
+// than a silent direct connection.
+func (h *HeadlessBrowserStrategy) chooseProxy(ctx context.Context) (string, *url.URL, error) {
+	if h.proxies == nil {
+		return "direct", nil, nil
+	}
+	p, proxyURL := h.proxies.Choose(ctx)
+	switch {
+	case proxyURL == nil && !stealth.IsDirect(p):
+		return "", nil, fmt.Errorf("headless: proxy %s has no proxy URL for the browser", p.Name())
+	case proxyURL != nil && proxyURL.User != nil && proxyURL.Scheme != "http" && proxyURL.Scheme != "https":
+		return "", nil, fmt.Errorf("headless: the browser cannot log in to %s proxy %s", proxyURL.Scheme, p.Name())
+	}
+	return p.Name(), proxyURL, nil
+}
+
+// authenticateProxy answers the browser's proxy login prompts with user's
+// credentials for as long as the browser runs.
+func authenticateProxy(browser *rod.Browser, user *url.Userinfo) error {
+	if err := (proto.FetchEnable{HandleAuthRequests: true}).Call(browser); err != nil {
+		return fmt.Errorf("proxy auth: %w", err)
+	}
+	password, _ := user.Password()
+	wait := browser.EachEvent(
+		func(e *proto.FetchRequestPaused) {
+			go func() { _ = proto.FetchContinueRequest{RequestID: e.RequestID}.Call(browser) }()
+		},
+		func(e *proto.FetchAuthRequired) {
+			go func() {
+				_ = proto.FetchContinueWithAuth{
+					RequestID: e.RequestID,
+					AuthChallengeResponse: &proto.FetchAuthChallengeResponse{
+						Response: proto.FetchAuthChallengeResponseResponseProvideCredentials,
+						Username: user.Username(),
+						Password: password,
+					},
+				}.Call(browser)
+			}()
+		},
+	)
+	go wait()
+	return nil
+}
+
+// meter counts the page's network traffic, as sent through provider, until
+// stop is called. When the job goes over budget, abort cancels the page with
+// the budget error.
+func (h *HeadlessBrowserStrategy) meter(ctx context.Context, page *rod.Page, provider string, abort context.CancelCauseFunc) (stop func()) {
+	if h.usage == nil {
+		return func() {}
+	}
+	add := func(c usage.Counts) {
+		if err := h.usage.Add(ctx, provider, c); err != nil {
+			abort(err)
+		}
+	}
+	evCtx, cancel := context.WithCancel(ctx)
+	wait := page.Context(evCtx).EachEvent(
+		func(e *proto.NetworkRequestWillBeSent) {
+			add(usage.Counts{Requests: 1, Sent: cdpRequestSize(e.Request)})
+		},
+		func(e *proto.NetworkLoadingFinished) {
+			add(usage.Counts{Received: int64(e.EncodedDataLength)})
+		},
+	)
+	done := make(chan struct{})
+	go func() {
+		wait()
+		close(done)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// cdpRequestSize estimates the bytes a browser request puts on the wire,
+// like the HTTP client's: request line, headers and body.
+func cdpRequestSize(r *proto.NetworkRequest) int64 {
+	n := len(r.Method) + len(r.URL) + len(" HTTP/1.1\r\n\r\n") + len(r.PostData)
+	for k, v := range r.Headers {
+		n += len(k) + len(": \r\n") + len(v.String())
+	}
+	return int64(n)
+}
+
+// applyFingerprint sets the page's viewport and, with a fingerprint pool,
+// overrides its UA, client hints and Accept-Language with the crawl's
+// profile. A browser cannot pass for Firefox, so a crawl whose profile is
+// Firefox browses under a Chromium profile of a separate session instead,
+// leaving the crawl's own profile untouched. Without a pool the viewport is
+// a plain 1920x1080 desktop. It returns the session the browser presents,
+// its profile's name (empty without a pool) and the user agent it sends.
+func (h *HeadlessBrowserStrategy) applyFingerprint(ctx context.Context, page *rod.Page) (session, profile, userAgent string, err error) {
+	viewport := stealth.Viewport{Width: 1920, Height: 1080}
+	session = crawl.Session(ctx)
+	if h.fingerprints != nil {
+		fp := h.fingerprints.Session(session)
+		if !fp.Chromium() {
+			session += "/headless"
+			fp = h.fingerprints.Session(session, "chrome", "edge")
+		}
+		profile, userAgent = fp.Name, fp.UserAgent
+		trace.SpanFromContext(ctx).SetAttributes(tracing.AttrFingerprint.String(fp.Name))
+
+		meta := &proto.EmulationUserAgentMetadata{
+			Platform:     fp.Platform,
+			Architecture: fp.Arch(),
+			Bitness:      "64",
+		}
+		for _, b := range fp.Brands() {
+			meta.Brands = append(meta.Brands, &proto.EmulationUserAgentBrandVersion{Brand: b[0], Version: b[1]})
+		}
+		err = page.SetUserAgent(&proto.NetworkSetUserAgentOverride{
+			UserAgent:         fp.UserAgent,
+			AcceptLanguage:    fp.AcceptLanguage,
+			Platform:          fp.NavigatorPlatform(),
+			UserAgentMetadata: meta,
+		})
+		if err != nil {
+			return "", "", "", fmt.Errorf("set user agent: %w", err)
+		}
+		if fp.Viewport.Width > 0 && fp.Viewport.Height > 0 {
+			viewport = fp.Viewport
+		}
+	} else if v, err := page.Browser().Version(); err == nil {
+		userAgent = v.UserAgent
+	}
+
+	err = page.SetViewport(&proto.EmulationSetDeviceMetricsOverride{
+		Width:  viewport.Width,
+		Height: viewport.Height,
+	})
+	if err != nil {
+		return "", "", "", fmt.Errorf("set viewport: %w", err)
+	}
+	return session, profile, userAgent, nil
+}
+
+// jar returns the cookie jar of session, or nil without shared cookies.
+func (h *HeadlessBrowserStrategy) jar(session, profile string) *stealth.Jar {
+	if h.cookies == nil {
+		return nil
+	}
+	return h.cookies.For(session, profile)
+}
+
+// loadCookies copies jar into the browser before the first navigation.
+func (h *HeadlessBrowserStrategy) loadCookies(page *rod.Page, jar *stealth.Jar) error {
+	if jar == nil {
+		return nil
+	}
+	scheme := "https"
+	if u, err := url.Parse(h.baseURL); err == nil && u.Scheme != "" {
+		scheme = u.Scheme
+	}
+
+	var params []*proto.NetworkCookieParam
+	for _, c := range jar.All() {
+		p := &proto.NetworkCookieParam{
+			Name:     c.Name,
+			Value:    c.Value,
+			Path:     c.Path,
+			Secure:   c.Secure,
+			HTTPOnly: c.HTTPOnly,
+		}
+		// CDP makes a cookie with a Domain a domain cookie; a host-only
+		// cookie is set by URL instead.
+		if c.HostOnly {
+			p.URL = scheme + "://" + c.Domain + c.Path
+		} else {
+			p.Domain = "." + c.Domain
+		}
+		if !c.Expires.IsZero() {
+			p.Expires = proto.TimeSinceEpoch(c.Expires.Unix())
+		}
+		params = append(params, p)
+	}
+	if len(params) == 0 {
+		return nil
+	}
+	if err := page.SetCookies(params); err != nil {
+		return fmt.Errorf("set cookies: %w", err)
+	}
+	return nil
+}
+
+// setLocation sets the location cookie for the site before the first
+// navigation. Where the proxy can target the city, the browser also leaves
+// through an exit there (see chooseProxy).
+func (h *HeadlessBrowserStrategy) setLocation(page *rod.Page, loc Location) error {
+	err := page.SetCookies([]*proto.NetworkCookieParam{{
+		Name:  locationCookie,
+		Value: loc.cookieValue(),
+		URL:   h.baseURL + "/",
+	}})
+	if err != nil {
+		return fmt.Errorf("set location cookie: %w", err)
+	}
+	return nil
+}
+
+// saveCookies stores the browser's cookies, including any set by scripts
+// such as bot-detection sensors, back into jar. The location cookie belongs
+// to the request, not the session, and is left out (the jars ignore it too
+// when NewScraper set them up).
+func (h *HeadlessBrowserStrategy) saveCookies(ctx context.Context, page *rod.Page, jar *stealth.Jar) {
+	if jar == nil {
+		return
+	}
+	res, err := proto.StorageGetCookies{}.Call(page.Browser())
+	if err != nil {
+		slog.WarnContext(ctx, "read browser cookies failed", "err", err)
+		return
+	}
+	cookies := make([]stealth.JarCookie, 0, len(res.Cookies))
+	for _, c := range res.Cookies {
+		if c.Name == locationCookie {
+			continue
+		}
+		jc := stealth.JarCookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Domain:   c.Domain,
+			Path:     c.Path,
+			HostOnly: !strings.HasPrefix(c.Domain, "."),
+			Secure:   c.Secure,
+			HTTPOnly: c.HTTPOnly,
+		}
+		if !c.Session {
+			jc.Expires = c.Expires.Time()
+		}
+		cookies = append(cookies, jc)
+	}
+	jar.Store(cookies)
 }
 
 func (h *HeadlessBrowserStrategy) extractFromDOM(page *rod.Page) ([]models.Product, error) {
@@ -0,0 +1,53 @@
+package tokopedia
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/lukman83/kidkazz-scrap/internal/stealth"
+)
+
+// opaqueProxy is a proxy the browser cannot be pointed at.
+type opaqueProxy struct{}
+
+func (opaqueProxy) Transport() http.RoundTripper { return http.DefaultTransport }
+func (opaqueProxy) Name() string                 { return "opaque" }
+
+func TestHeadlessChooseProxy(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider stealth.ProxyProvider
+		want     string // provider metered
+		proxy    string // browser proxy host
+		err      string
+	}{
+		{"direct", &stealth.DirectProvider{}, "direct", "", ""},
+		{"decodo", &stealth.DecodoProvider{Username: "u", Password: "p"}, "decodo-rotating", "gate.decodo.com:7000", ""},
+		{"socks with login", &stealth.HTTPProxyProvider{Label: "custom", RawURL: "socks5://u:p@127.0.0.1:1080"}, "", "", "cannot log in"},
+		{"no proxy URL", opaqueProxy{}, "", "", "no proxy URL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHeadlessBrowserStrategy("", nil, nil, nil, stealth.NewProxyRotator([]stealth.ProxyProvider{tt.provider}), nil)
+			name, proxyURL, err := h.chooseProxy(context.Background())
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, want one mentioning %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			host := ""
+			if proxyURL != nil {
+				host = proxyURL.Host
+			}
+			if name != tt.want || host != tt.proxy {
+				t.Errorf("chose %s via %q, want %s via %q", name, host, tt.want, tt.proxy)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package tokopedia
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/lukman83/kidkazz-scrap/internal/platform"
+)
+
+// Location is a buyer's delivery address as Tokopedia's address picker
+// stores it. Prices, stock and shipping options in results depend on it.
+type Location struct {
+	Name       string // canonical "city/district" key, e.g. "surabaya/gubeng"
+	City       string // Tokopedia city name, e.g. "Kota Surabaya"
+	District   string // kecamatan
+	CityID     int
+	DistrictID int
+	PostalCode string
+	Lat, Long  string
+
+	// ProxyCity is the city name a geo-targeting proxy expects.
+	ProxyCity string
+}
+
+// locationCity is a city with its districts; the first district is the
+// city's default.
+type locationCity struct {
+	name      string // key in a location string
+	proxyCity string
+	districts []locationDistrict
+}
+
+type locationDistrict struct {
+	name string // key in a location string
+	Location
+}
+
+// locationTable lists the cities a location can name, keyed by the lower-case
+// names accepted in "city" or "city/district".
+var locationTable = []locationCity{
+	{name: "jakarta", proxyCity: "jakarta", districts: []locationDistrict{
+		{"kebayoran baru", Location{City: "Kota Administrasi Jakarta Selatan", District: "Kebayoran Baru", CityID: 176, DistrictID: 2274, PostalCode: "12110", Lat: "-6.2441", Long: "106.8008"}},
+		{"menteng", Location{City: "Kota Administrasi Jakarta Pusat", District: "Menteng", CityID: 175, DistrictID: 2259, PostalCode: "10310", Lat: "-6.1959", Long: "106.8326"}},
+		{"kelapa gading", Location{City: "Kota Administrasi Jakarta Utara", District: "Kelapa Gading", CityID: 177, DistrictID: 2283, PostalCode: "14240", Lat: "-6.1603", Long: "106.9058"}},
+	}},
+	{name: "surabaya", proxyCity: "surabaya", districts: []locationDistrict{
+		{"gubeng", Location{City: "Kota Surabaya", District: "Gubeng", CityID: 252, DistrictID: 3464, PostalCode: "60281", Lat: "-7.2739", Long: "112.7498"}},
+		{"wonokromo", Location{City: "Kota Surabaya", District: "Wonokromo", CityID: 252, DistrictID: 3484, PostalCode: "60243", Lat: "-7.3017", Long: "112.7367"}},
+	}},
+	{name: "bandung", proxyCity: "bandung", districts: []locationDistrict{
+		{"coblong", Location{City: "Kota Bandung", District: "Coblong", CityID: 165, DistrictID: 2118, PostalCode: "40132", Lat: "-6.8915", Long: "107.6107"}},
+	}},
+	{name: "medan", proxyCity: "medan", districts: []locationDistrict{
+		{"medan baru", Location{City: "Kota Medan", District: "Medan Baru", CityID: 46, DistrictID: 554, PostalCode: "20153", Lat: "3.5781", Long: "98.6555"}},
+	}},
+	{name: "semarang", proxyCity: "semarang", districts: []locationDistrict{
+		{"semarang tengah", Location{City: "Kota Semarang", District: "Semarang Tengah", CityID: 214, DistrictID: 2879, PostalCode: "50134", Lat: "-6.9826", Long: "110.4093"}},
+	}},
+	{name: "yogyakarta", proxyCity: "yogyakarta", districts: []locationDistrict{
+		{"gondokusuman", Location{City: "Kota Yogyakarta", District: "Gondokusuman", CityID: 232, DistrictID: 3136, PostalCode: "55221", Lat: "-7.7829", Long: "110.3871"}},
+	}},
+	{name: "makassar", proxyCity: "makassar", districts: []locationDistrict{
+		{"panakkukang", Location{City: "Kota Makassar", District: "Panakkukang", CityID: 448, DistrictID: 6172, PostalCode: "90231", Lat: "-5.1500", Long: "119.4483"}},
+	}},
+	{name: "denpasar", proxyCity: "denpasar", districts: []locationDistrict{
+		{"denpasar selatan", Location{City: "Kota Denpasar", District: "Denpasar Selatan", CityID: 114, DistrictID: 1586, PostalCode: "80222", Lat: "-8.6901", Long: "115.2245"}},
+	}},
+}
+
+// Locations lists the accepted location strings, each city first followed
+// by its "city/district" forms.
+func Locations() []string {
+	var out []string
+	for _, c := range locationTable {
+		out = append(out, c.name)
+		for _, d := range c.districts {
+			out = append(out, c.name+"/"+d.name)
+		}
+	}
+	return out
+}
+
+// LookupLocation resolves "city" or "city/district" (case-insensitive, see
+// Locations). A bare city uses its default district.
+func LookupLocation(s string) (Location, error) {
+	city, district, _ := strings.Cut(normalizeLocation(s), "/")
+	i := slices.IndexFunc(locationTable, func(c locationCity) bool { return c.name == city })
+	if i < 0 {
+		return Location{}, fmt.Errorf("unknown location %q (available: %s)", s, strings.Join(Locations(), ", "))
+	}
+	c := locationTable[i]
+	d := c.districts[0]
+	if district != "" {
+		j := slices.IndexFunc(c.districts, func(d locationDistrict) bool { return d.name == district })
+		if j < 0 {
+			return Location{}, fmt.Errorf("unknown district %q in %s (available: %s)", district, c.name, strings.Join(districtNames(c), ", "))
+		}
+		d = c.districts[j]
+	}
+	loc := d.Location
+	loc.Name = c.name + "/" + d.name
+	loc.ProxyCity = c.proxyCity
+	return loc, nil
+}
+
+func districtNames(c locationCity) []string {
+	out := make([]string, len(c.districts))
+	for i, d := range c.districts {
+		out[i] = d.name
+	}
+	return out
+}
+
+// normalizeLocation lower-cases s and collapses whitespace around and inside
+// its parts, so " Surabaya / Gubeng" reads as "surabaya/gubeng".
+func normalizeLocation(s string) string {
+	city, district, ok := strings.Cut(s, "/")
+	norm := func(p string) string { return strings.Join(strings.Fields(strings.ToLower(p)), " ") }
+	if !ok {
+		return norm(city)
+	}
+	return norm(city) + "/" + norm(district)
+}
+
+// setSearchParams adds the buyer-address parameters the search API uses to
+// price and rank results.
+func (l Location) setSearchParams(params url.Values) {
+	params.Set("user_addressId", "0")
+	params.Set("user_cityId", strconv.Itoa(l.CityID))
+	params.Set("user_districtId", strconv.Itoa(l.DistrictID))
+	params.Set("user_lat", l.Lat)
+	params.Set("user_long", l.Long)
+	params.Set("user_postCode", l.PostalCode)
+	params.Set("user_warehouseId", "0")
+}
+
+// locationCookie is the cookie the website keeps the chosen delivery
+// address in, as URL-encoded JSON.
+const locationCookie = "local_cache"
+
+// cookieValue returns the locationCookie value for l.
+func (l Location) cookieValue() string {
+	data, _ := json.Marshal(map[string]string{
+		"address_id":   "0",
+		"city_id":      strconv.Itoa(l.CityID),
+		"district_id":  strconv.Itoa(l.DistrictID),
+		"postal_code":  l.PostalCode,
+		"lat":          l.Lat,
+		"long":         l.Long,
+		"label":        l.District + ", " + l.City,
+		"warehouse_id": "0",
+	})
+	return url.QueryEscape(string(data))
+}
+
+// setCookie replaces any locationCookie on req with l's.
+func (l Location) setCookie(req *http.Request) {
+	cookies := req.Cookies()
+	req.Header.Del("Cookie")
+	for _, c := range cookies {
+		if c.Name != locationCookie {
+			req.AddCookie(c)
+		}
+	}
+	req.AddCookie(&http.Cookie{Name: locationCookie, Value: l.cookieValue()})
+}
+
+// requestLocation resolves req's location; ok is false when it has none.
+// Scraper validates locations up front, so strategies can ignore the error.
+func requestLocation(req platform.Request) (loc Location, ok bool) {
+	if req.Location == "" {
+		return Location{}, false
+	}
+	loc, err := LookupLocation(req.Location)
+	return loc, err == nil
+}
@@ -0,0 +1,46 @@
+package tokopedia
+
+import "testing"
+
+func TestLookupLocation(t *testing.T) {
+	tests := []struct {
+		in         string
+		name       string
+		districtID int
+		proxyCity  string
+		wantErr    bool
+	}{
+		{in: "surabaya", name: "surabaya/gubeng", districtID: 3464, proxyCity: "surabaya"},
+		{in: "surabaya/wonokromo", name: "surabaya/wonokromo", districtID: 3484, proxyCity: "surabaya"},
+		{in: " Jakarta /  Kelapa   Gading ", name: "jakarta/kelapa gading", districtID: 2283, proxyCity: "jakarta"},
+		{in: "bogor", wantErr: true},
+		{in: "surabaya/menteng", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			loc, err := LookupLocation(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("got %+v, want an error", loc)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if loc.Name != tt.name || loc.DistrictID != tt.districtID || loc.ProxyCity != tt.proxyCity {
+				t.Errorf("got %s (district %d, proxy %s), want %s (district %d, proxy %s)",
+					loc.Name, loc.DistrictID, loc.ProxyCity, tt.name, tt.districtID, tt.proxyCity)
+			}
+		})
+	}
+}
+
+func TestLocationsResolve(t *testing.T) {
+	for _, name := range Locations() {
+		if _, err := LookupLocation(name); err != nil {
+			t.Errorf("listed location %q: %v", name, err)
+		}
+	}
+}
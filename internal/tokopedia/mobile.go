@@ -0,0 +1,209 @@
+package tokopedia
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	mrand "math/rand/v2"
+	"net/http"
+
+	"github.com/lukman83/kidkazz-scrap/internal/crawl"
+	"github.com/lukman83/kidkazz-scrap/internal/httputil"
+	"github.com/lukman83/kidkazz-scrap/internal/platform"
+	"github.com/lukman83/kidkazz-scrap/internal/stealth"
+)
+
+// appVersion is the Tokopedia Android app version the mobile strategy
+// presents. Keep it close to the current Play Store release.
+const appVersion = "3.290.0"
+
+// androidDevice is the phone an app install runs on.
+type androidDevice struct {
+	Model     string
+	Brand     string
+	OSVersion string // Android release
+}
+
+// androidDevices are common phones in Indonesia.
+var androidDevices = []androidDevice{
+	{Model: "SM-A546E", Brand: "samsung", OSVersion: "14"},
+	{Model: "SM-A155F", Brand: "samsung", OSVersion: "14"},
+	{Model: "23021RAA2Y", Brand: "Redmi", OSVersion: "13"},
+	{Model: "2404ARN45A", Brand: "Redmi", OSVersion: "14"},
+	{Model: "CPH2565", Brand: "OPPO", OSVersion: "14"},
+	{Model: "V2247", Brand: "vivo", OSVersion: "13"},
+}
+
+// appInstall is one installation of the app: a device and the identifiers
+// the app generates on first launch.
+type appInstall struct {
+	device   androidDevice
+	deviceID string // Settings.Secure.ANDROID_ID, 16 hex digits
+	uniqueID string // the app's per-install search ID, MD5-sized hex
+}
+
+func newAppInstall() appInstall {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	sum := sha256.Sum256(id)
+	return appInstall{
+		device:   androidDevices[mrand.IntN(len(androidDevices))],
+		deviceID: hex.EncodeToString(id),
+		uniqueID: hex.EncodeToString(sum[:16]),
+	}
+}
+
+// MobileAppStrategy calls the search GraphQL API the way Tokopedia's
+// Android app does: the app's headers, device identifiers and the mobile
+// parameter set. The app API is rate-limited separately from the website
+// and returns rating averages and sold counts.
+//
+// Each crawl session, like its browser profile and cookies, is one
+// app install: its requests share the device identifiers, and the next
+// session is a new install, so no identifier outlives a crawl.
+type MobileAppStrategy struct {
+	client   *http.Client
+	endpoint string
+
+	installs *crawl.SessionMap[appInstall] // by session ID
+}
+
+// NewMobileAppStrategy creates the strategy; an empty endpoint uses
+// DefaultGraphQLEndpoint.
+func NewMobileAppStrategy(client *http.Client, endpoint string) *MobileAppStrategy {
+	if endpoint == "" {
+		endpoint = DefaultGraphQLEndpoint
+	}
+	return &MobileAppStrategy{client: client, endpoint: endpoint, installs: crawl.NewSessionMap[appInstall](crawl.SessionTTL, nil)}
+}
+
+// install returns the app install of ctx's session, creating one on the
+// session's first request.
+func (m *MobileAppStrategy) install(ctx context.Context) appInstall {
+	return m.installs.Get(crawl.Session(ctx), newAppInstall)
+}
+
+func (m *MobileAppStrategy) Name() string { return StrategyMobile }
+
+func (m *MobileAppStrategy) Execute(ctx context.Context, req platform.Request) (*platform.Result, error) {
+	limit := req.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+	switch req.Type {
+	case platform.SearchRequest:
+		return m.executeSearch(ctx, req, max(req.Page, 1), limit, SortBestMatch)
+	case platform.TrendingRequest:
+		return m.executeSearch(ctx, req, 1, limit, SortBestSeller)
+	default:
+		return nil, fmt.Errorf("mobile strategy does not support request type %d", req.Type)
+	}
+}
+
+// executeSearch sends the buyer's address as search parameters; the app
+// has no location cookie.
+func (m *MobileAppStrategy) executeSearch(ctx context.Context, req platform.Request, page, limit, sort int) (*platform.Result, error) {
+	keyword := req.Keyword
+	params := searchParams(keyword, page, limit, sort, DeviceAndroid)
+	install := m.install(ctx)
+	params.Set("unique_id", install.uniqueID)
+	if loc, ok := requestLocation(req); ok {
+		loc.setSearchParams(params)
+	}
+
+	payload := []map[string]interface{}{
+		{
+			"operationName": "SearchProductQueryV4",
+			"query":         searchProductAppQuery,
+			"variables": map[string]interface{}{
+				"params": params.Encode(),
+			},
+		},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(stealth.WithAppClient(ctx), "POST", m.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range install.headers() {
+		httpReq.Header[k] = v
+	}
+
+	resp, err := httputil.DoWithRetry(m.client, httpReq, 2)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := httputil.ReadBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	if err := httputil.DetectBlock(resp, respBody); err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("mobile graphql response status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	products, totalData, err := parseSearchResponse(respBody, m.Name())
+	if err != nil {
+		return nil, err
+	}
+	if len(products) == 0 {
+		return nil, emptyPage(keyword, page, limit, totalData)
+	}
+
+	return &platform.Result{
+		Products:  products,
+		TotalData: derefTotal(totalData),
+		Strategy:  m.Name(),
+		Raw:       json.RawMessage(respBody),
+	}, nil
+}
+
+// headers returns the headers the app's GraphQL client (OkHttp) sends for a
+// logged-out user on this install.
+func (a appInstall) headers() http.Header {
+	d := a.device
+	fingerprint, _ := json.Marshal(map[string]any{
+		"device_model":          d.Model,
+		"device_manufacturer":   d.Brand,
+		"device_system":         "android",
+		"device_system_version": d.OSVersion,
+		"current_os":            "android",
+		"is_emulator":           false,
+		"is_jailbroken_rooted":  false,
+		"unique_id":             a.deviceID,
+		"user_agent":            fmt.Sprintf("Dalvik/2.1.0 (Linux; U; Android %s; %s)", d.OSVersion, d.Model),
+		"language":              "id_ID",
+		"timezone":              "GMT+07:00",
+	})
+	fpData := base64.StdEncoding.EncodeToString(fingerprint)
+	fpHash := sha256.Sum256([]byte(fpData + "+" + a.deviceID))
+
+	h := http.Header{}
+	h.Set("Content-Type", "application/json; charset=UTF-8")
+	h.Set("Accept-Encoding", "gzip")
+	h.Set("User-Agent", fmt.Sprintf("TkpdConsumer/%s (Android %s;)", appVersion, d.OSVersion))
+	h.Set("X-Device", "android-"+appVersion)
+	h.Set("X-Tkpd-App-Name", "com.tokopedia.tkpd")
+	h.Set("X-Tkpd-App-Version", "android-"+appVersion)
+	h.Set("X-Source", "tokopedia-android")
+	h.Set("Os-Type", "1")
+	h.Set("Device-Id", a.deviceID)
+	h.Set("Tkpd-UserId", "0")
+	h.Set("Accept-Language", "id-ID")
+	h.Set("Fingerprint-Data", fpData)
+	h.Set("Fingerprint-Hash", hex.EncodeToString(fpHash[:]))
+	return h
+}
@@ -0,0 +1,24 @@
+package tokopedia
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lukman83/kidkazz-scrap/internal/logging"
+)
+
+func TestMobileInstallPerSession(t *testing.T) {
+	m := NewMobileAppStrategy(nil, "")
+	crawl := logging.WithRequestID(context.Background(), "crawl-1")
+	first := m.install(crawl)
+	if again := m.install(crawl); again != first {
+		t.Errorf("session changed install: %s, then %s", first.deviceID, again.deviceID)
+	}
+	other := m.install(logging.WithRequestID(context.Background(), "crawl-2"))
+	if other.deviceID == first.deviceID || other.uniqueID == first.uniqueID {
+		t.Errorf("two sessions share install %s", first.deviceID)
+	}
+	if got := first.headers().Get("Device-Id"); got != first.deviceID {
+		t.Errorf("Device-Id = %s, want the install's %s", got, first.deviceID)
+	}
+}
@@ -5,7 +5,12 @@ import (
 	"net/url"
 )
 
-const graphQLEndpoint = "https://gql.tokopedia.com/graphql/SearchProductQueryV4"
+// Default Tokopedia endpoints. Both can be overridden (e.g. to point at the
+// local mock server) through Options.
+const (
+	DefaultBaseURL         = "https://www.tokopedia.com"
+	DefaultGraphQLEndpoint = "https://gql.tokopedia.com/graphql/SearchProductQueryV4"
+)
 
 const searchProductQuery = `query SearchProductQueryV4($params: String!) {
 	ace_search_product_v4(params: $params) {
@@ -131,6 +136,63 @@ const searchProductQuery = `query SearchProductQueryV4($params: String!) {
 	}
 }`
 
+// searchProductAppQuery is the Android app's search query. It drops the
+// desktop's related/suggestion blocks and adds ratingAverage; sold counts
+// come in the "integrity" label group.
+const searchProductAppQuery = `query SearchProductQueryV4($params: String!) {
+	ace_search_product_v4(params: $params) {
+		header {
+		totalData
+		responseCode
+		errorMessage
+		additionalParams
+		__typename
+		}
+		data {
+		isQuerySafe
+		products {
+			id
+			name
+			ads {
+			id
+			productClickUrl
+			productViewUrl
+			__typename
+			}
+			categoryBreadcrumb
+			categoryId
+			countReview
+			discountPercentage
+			imageUrl
+			labelGroups {
+			position
+			title
+			type
+			__typename
+			}
+			originalPrice
+			price
+			priceRange
+			rating
+			ratingAverage
+			shop {
+			id
+			name
+			url
+			city
+			isOfficial
+			__typename
+			}
+			url
+			wishlist
+			__typename
+		}
+		__typename
+		}
+		__typename
+	}
+}`
+
 const pdpGetLayoutQuery = `query PDPGetLayoutQuery($shopDomain: String, $productKey: String, $layoutID: String, $apiVersion: Float, $extParam: String) {
   pdpGetLayout(shopDomain: $shopDomain, productKey: $productKey, layoutID: $layoutID, apiVersion: $apiVersion, extParam: $extParam) {
     name
@@ -220,8 +282,20 @@ const (
 	SortPriceDesc  = 4
 )
 
-// BuildSearchParams constructs the URL-encoded params string for SearchProductQueryV4.
-func BuildSearchParams(keyword string, page, rows, orderBy int) string {
+// Devices a search can be made from, selecting the parameter set of
+// BuildSearchParams.
+const (
+	DeviceDesktop = "desktop" // the website
+	DeviceAndroid = "android" // the Android app
+)
+
+// BuildSearchParams constructs the URL-encoded params string for
+// SearchProductQueryV4 as sent by device.
+func BuildSearchParams(keyword string, page, rows, orderBy int, device string) string {
+	return searchParams(keyword, page, rows, orderBy, device).Encode()
+}
+
+func searchParams(keyword string, page, rows, orderBy int, device string) url.Values {
 	start := (page - 1) * rows
 	params := url.Values{}
 	params.Set("q", keyword)
@@ -229,7 +303,15 @@ func BuildSearchParams(keyword string, page, rows, orderBy int) string {
 	params.Set("rows", fmt.Sprintf("%d", rows))
 	params.Set("page", fmt.Sprintf("%d", page))
 	params.Set("ob", fmt.Sprintf("%d", orderBy))
-	params.Set("device", "desktop")
+	params.Set("device", device)
 	params.Set("source", "search")
-	return params.Encode()
+	if device == DeviceAndroid {
+		// The app pages by "page", identifies a logged-out user as 0 and
+		// asks for related keywords in the same call.
+		params.Set("use_page", "true")
+		params.Set("user_id", "0")
+		params.Set("related", "true")
+		params.Set("navsource", "home")
+	}
+	return params
 }
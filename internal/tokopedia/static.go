@@ -17,11 +17,16 @@ import (
 
 // StaticPageStrategy fetches raw HTML and extracts JSON-LD structured data.
 type StaticPageStrategy struct {
-	client *http.Client
+	client  *http.Client
+	baseURL string
 }
 
-func NewStaticPageStrategy(client *http.Client) *StaticPageStrategy {
-	return &StaticPageStrategy{client: client}
+// NewStaticPageStrategy creates the strategy; an empty baseURL uses DefaultBaseURL.
+func NewStaticPageStrategy(client *http.Client, baseURL string) *StaticPageStrategy {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &StaticPageStrategy{client: client, baseURL: strings.TrimRight(baseURL, "/")}
 }
 
 func (s *StaticPageStrategy) Name() string { return "static" }
@@ -38,7 +43,7 @@ func (s *StaticPageStrategy) Execute(ctx context.Context, req platform.Request)
 }
 
 func (s *StaticPageStrategy) search(ctx context.Context, req platform.Request) (*platform.Result, error) {
-	searchURL := fmt.Sprintf("https://www.tokopedia.com/search?q=%s&page=%d", url.QueryEscape(req.Keyword), req.Page)
+	searchURL := fmt.Sprintf("%s/search?q=%s&page=%d", s.baseURL, url.QueryEscape(req.Keyword), req.Page)
 
 	httpReq, err := http.NewRequestWithContext(ctx, "GET", searchURL, nil)
 	if err != nil {
@@ -47,6 +52,9 @@ func (s *StaticPageStrategy) search(ctx context.Context, req platform.Request) (
 	for k, v := range httputil.BrowserHeaders() {
 		httpReq.Header[k] = v
 	}
+	if loc, ok := requestLocation(req); ok {
+		loc.setCookie(httpReq)
+	}
 
 	resp, err := httputil.DoWithRetry(s.client, httpReq, 2)
 	if err != nil {
@@ -58,18 +66,25 @@ func (s *StaticPageStrategy) search(ctx context.Context, req platform.Request) (
 	if err != nil {
 		return nil, err
 	}
+	if err := checkPageResponse(resp, body); err != nil {
+		return nil, err
+	}
 
-	products, err := extractJSONLD(string(body))
+	products, raw, err := extractJSONLD(string(body))
 	if err != nil {
 		return nil, fmt.Errorf("extract JSON-LD: %w", err)
 	}
 	if len(products) == 0 {
+		if !hasJSONLD(string(body)) {
+			return nil, httputil.NewResponseError(httputil.KindSchemaChanged, resp.StatusCode, "search page has no JSON-LD blocks")
+		}
 		return nil, fmt.Errorf("no JSON-LD product data found")
 	}
 
 	return &platform.Result{
 		Products: products,
 		Strategy: s.Name(),
+		Raw:      raw,
 	}, nil
 }
 
@@ -81,6 +96,9 @@ func (s *StaticPageStrategy) productDetail(ctx context.Context, req platform.Req
 	for k, v := range httputil.BrowserHeaders() {
 		httpReq.Header[k] = v
 	}
+	if loc, ok := requestLocation(req); ok {
+		loc.setCookie(httpReq)
+	}
 
 	resp, err := httputil.DoWithRetry(s.client, httpReq, 2)
 	if err != nil {
@@ -92,29 +110,57 @@ func (s *StaticPageStrategy) productDetail(ctx context.Context, req platform.Req
 	if err != nil {
 		return nil, err
 	}
+	if err := checkPageResponse(resp, body); err != nil {
+		return nil, err
+	}
 
-	products, err := extractJSONLD(string(body))
+	products, raw, err := extractJSONLD(string(body))
 	if err != nil {
 		return nil, fmt.Errorf("extract JSON-LD: %w", err)
 	}
 	if len(products) == 0 {
+		if !hasJSONLD(string(body)) {
+			return nil, httputil.NewResponseError(httputil.KindSchemaChanged, resp.StatusCode, "product page has no JSON-LD blocks")
+		}
 		return nil, fmt.Errorf("no JSON-LD product data found in page")
 	}
 
 	return &platform.Result{
 		Products: products,
 		Strategy: s.Name(),
+		Raw:      raw,
 	}, nil
 }
 
+// checkPageResponse turns block pages and non-200 statuses into errors.
+func checkPageResponse(resp *http.Response, body []byte) error {
+	if err := httputil.DetectBlock(resp, body); err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return httputil.NewResponseError(httputil.KindEmpty, resp.StatusCode, "page not found")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("page response status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// hasJSONLD reports whether the HTML contains any JSON-LD script blocks at all.
+func hasJSONLD(htmlContent string) bool {
+	return strings.Contains(htmlContent, "application/ld+json")
+}
+
 // extractJSONLD parses HTML and extracts Product data from JSON-LD script tags.
-func extractJSONLD(htmlContent string) ([]models.Product, error) {
+// It also returns the raw Product objects as a JSON array, for drift checks.
+func extractJSONLD(htmlContent string) ([]models.Product, json.RawMessage, error) {
 	doc, err := html.Parse(strings.NewReader(htmlContent))
 	if err != nil {
-		return nil, fmt.Errorf("parse HTML: %w", err)
+		return nil, nil, fmt.Errorf("parse HTML: %w", err)
 	}
 
 	var products []models.Product
+	var raw []any
 	var walk func(*html.Node)
 	walk = func(n *html.Node) {
 		if n.Type == html.ElementNode && n.Data == "script" {
@@ -124,6 +170,7 @@ func extractJSONLD(htmlContent string) ([]models.Product, error) {
 						if p, err := parseJSONLDProduct(n.FirstChild.Data); err == nil {
 							products = append(products, p...)
 						}
+						raw = appendRawJSONLDProducts(raw, n.FirstChild.Data)
 					}
 				}
 			}
@@ -134,7 +181,47 @@ func extractJSONLD(htmlContent string) ([]models.Product, error) {
 	}
 	walk(doc)
 
-	return products, nil
+	if len(raw) == 0 {
+		return products, nil, nil
+	}
+	rawJSON, err := json.Marshal(raw)
+	if err != nil {
+		return products, nil, nil
+	}
+	return products, rawJSON, nil
+}
+
+// appendRawJSONLDProducts collects the untyped Product objects of a JSON-LD
+// block, looking through arrays and ItemList elements like parseJSONLDProduct.
+func appendRawJSONLDProducts(out []any, data string) []any {
+	var v any
+	if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &v); err != nil {
+		return out
+	}
+	var visit func(v any)
+	visit = func(v any) {
+		switch x := v.(type) {
+		case []any:
+			for _, item := range x {
+				visit(item)
+			}
+		case map[string]any:
+			switch x["@type"] {
+			case "Product":
+				out = append(out, x)
+			case "ItemList":
+				if elems, ok := x["itemListElement"].([]any); ok {
+					for _, e := range elems {
+						if m, ok := e.(map[string]any); ok {
+							visit(m["item"])
+						}
+					}
+				}
+			}
+		}
+	}
+	visit(v)
+	return out
 }
 
 // jsonLDItem represents a generic JSON-LD object.
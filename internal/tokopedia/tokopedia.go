@@ -2,38 +2,221 @@ package tokopedia
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/lukman83/kidkazz-scrap/internal/drift"
+	"github.com/lukman83/kidkazz-scrap/internal/httputil"
+	"github.com/lukman83/kidkazz-scrap/internal/metrics"
 	"github.com/lukman83/kidkazz-scrap/internal/models"
 	"github.com/lukman83/kidkazz-scrap/internal/platform"
+	"github.com/lukman83/kidkazz-scrap/internal/stealth"
+	"github.com/lukman83/kidkazz-scrap/internal/tracing"
+	"github.com/lukman83/kidkazz-scrap/internal/usage"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
-	"golang.org/x/time/rate"
 )
 
 // Scraper implements platform.Scraper for Tokopedia.
 type Scraper struct {
-	fastStrategies []platform.Strategy // Static, GraphQL — raced concurrently
-	slowStrategies []platform.Strategy // Headless — tried sequentially as fallback
-	rateLimiter    *rate.Limiter
-	maxConcurrent  int
+	strategies      map[string]platform.Strategy // every known strategy, for per-request selection
+	fastStrategies  []platform.Strategy          // raced concurrently
+	slowStrategies  []platform.Strategy          // tried sequentially as fallback
+	raceTimeout     time.Duration
+	fallbackTimeout time.Duration
+	maxConcurrent   int
+	health          *platform.HealthTracker // per-strategy breakers, shared across requests
+	drift           *drift.Monitor          // payload schema drift, shared across requests
+	coalesce        *platform.Coalescer     // merges concurrent identical requests
+	warmer          *warmer                 // primes session cookies (nil: no warm-up)
 }
 
-// NewScraper creates a new Tokopedia scraper with the full strategy chain.
-func NewScraper(client *http.Client, rateLimiter *rate.Limiter, maxConcurrent int) *Scraper {
-	return &Scraper{
-		fastStrategies: []platform.Strategy{
-			NewGraphQLStrategy(client),
-		},
-		slowStrategies: []platform.Strategy{
-			NewStaticPageStrategy(client),
-			NewHeadlessBrowserStrategy(),
+// Options configures a Scraper. Zero values take the defaults noted below.
+// Request rates are limited per host by the HTTP client's transport
+// (stealth.AdaptiveLimiter), not here.
+type Options struct {
+	MaxConcurrent   int
+	Breaker         platform.BreakerConfig
+	FastStrategies  []string      // raced concurrently (default: graphql, mobile)
+	SlowStrategies  []string      // sequential fallbacks (default: static, headless)
+	RaceTimeout     time.Duration // deadline for the fast race (default: 10s)
+	FallbackTimeout time.Duration // deadline for the whole fallback phase (0: none)
+	BaseURL         string        // website origin (default: DefaultBaseURL)
+	GraphQLEndpoint string        // search GraphQL URL (default: DefaultGraphQLEndpoint)
+
+	// Fingerprints gives the headless browser the same per-crawl profile the
+	// HTTP client uses (default: the browser's own UA and a 1920x1080 viewport).
+	Fingerprints *stealth.FingerprintPool
+
+	// Cookies gives the headless browser the cookie jars the HTTP client
+	// uses, so cookies flow both ways (default: the browser starts empty).
+	Cookies *stealth.CookieJars
+
+	// Usage meters the headless browser's traffic, which bypasses the HTTP
+	// client's transport, and enforces its budgets (default: not metered).
+	Usage *usage.Meter
+
+	// Proxy sends the headless browser through the HTTP client's proxies
+	// (default: direct).
+	Proxy *stealth.ProxyRotator
+
+	// Transport passes the headless browser's navigations through the HTTP
+	// client's robots.txt check, rate limiter and host spacing, and lets
+	// the blocks it meets slow the host down for both (default: none).
+	Transport *stealth.StealthTransport
+
+	// Replay marks a client that replays a cassette. The headless browser
+	// would reach the live site instead, so it is dropped from the strategy
+	// chains and fails with ErrNoReplay when a request selects it.
+	Replay bool
+
+	// Warmup lists the pages visited, in order, before a session's first
+	// scrape (see WarmupSteps; default: none).
+	Warmup []string
+}
+
+// Strategy names accepted in Options and per-request selection.
+const (
+	StrategyGraphQL  = "graphql"
+	StrategyMobile   = "mobile"
+	StrategyStatic   = "static"
+	StrategyHeadless = "headless"
+)
+
+// StrategyNames lists every strategy this scraper can run.
+func StrategyNames() []string {
+	return []string{StrategyGraphQL, StrategyMobile, StrategyStatic, StrategyHeadless}
+}
+
+const defaultRaceTimeout = 10 * time.Second
+
+// ErrNoReplay is returned by a strategy that cannot run from a cassette.
+var ErrNoReplay = errors.New("cannot replay a cassette")
+
+// noReplay stands in for a strategy that would go to the live site while
+// the HTTP client replays a cassette.
+type noReplay string
+
+func (s noReplay) Name() string { return string(s) }
+
+func (s noReplay) Execute(ctx context.Context, req platform.Request) (*platform.Result, error) {
+	return nil, fmt.Errorf("%s: %w", string(s), ErrNoReplay)
+}
+
+func isHeadless(name string) bool { return name == StrategyHeadless }
+
+// platformName labels this scraper's metrics.
+const platformName = "tokopedia"
+
+// NewScraper creates a new Tokopedia scraper with the configured strategy chain.
+func NewScraper(client *http.Client, opts Options) (*Scraper, error) {
+	if opts.FastStrategies == nil {
+		opts.FastStrategies = []string{StrategyGraphQL, StrategyMobile}
+	}
+	if opts.SlowStrategies == nil {
+		opts.SlowStrategies = []string{StrategyStatic, StrategyHeadless}
+	}
+	if opts.Replay {
+		opts.FastStrategies = slices.DeleteFunc(slices.Clone(opts.FastStrategies), isHeadless)
+		opts.SlowStrategies = slices.DeleteFunc(slices.Clone(opts.SlowStrategies), isHeadless)
+	}
+	if opts.RaceTimeout <= 0 {
+		opts.RaceTimeout = defaultRaceTimeout
+	}
+
+	if opts.Cookies != nil {
+		// The address cookie is set per request; the site's echo of it
+		// must not follow the session to requests for other locations.
+		opts.Cookies.Ignore(locationCookie)
+	}
+
+	t := &Scraper{
+		strategies: map[string]platform.Strategy{
+			StrategyGraphQL:  NewGraphQLStrategy(client, opts.GraphQLEndpoint),
+			StrategyMobile:   NewMobileAppStrategy(client, opts.GraphQLEndpoint),
+			StrategyStatic:   NewStaticPageStrategy(client, opts.BaseURL),
+			StrategyHeadless: NewHeadlessBrowserStrategy(opts.BaseURL, opts.Fingerprints, opts.Cookies, opts.Usage, opts.Proxy, opts.Transport),
 		},
-		rateLimiter:   rateLimiter,
-		maxConcurrent: maxConcurrent,
+		raceTimeout:     opts.RaceTimeout,
+		fallbackTimeout: opts.FallbackTimeout,
+		maxConcurrent:   opts.MaxConcurrent,
+		health:          platform.NewHealthTracker(opts.Breaker),
+		drift:           drift.NewMonitor(),
+		coalesce:        platform.NewCoalescer(),
+	}
+	if opts.Replay {
+		t.strategies[StrategyHeadless] = noReplay(StrategyHeadless)
 	}
+
+	seen := make(map[string]bool)
+	pick := func(names []string) ([]platform.Strategy, error) {
+		var out []platform.Strategy
+		for _, name := range names {
+			s, err := t.strategy(name)
+			if err != nil {
+				return nil, err
+			}
+			if seen[name] {
+				return nil, fmt.Errorf("strategy %q configured more than once", name)
+			}
+			seen[name] = true
+			out = append(out, s)
+		}
+		return out, nil
+	}
+	var err error
+	if t.warmer, err = newWarmer(client, opts); err != nil {
+		return nil, err
+	}
+	if t.fastStrategies, err = pick(opts.FastStrategies); err != nil {
+		return nil, err
+	}
+	if t.slowStrategies, err = pick(opts.SlowStrategies); err != nil {
+		return nil, err
+	}
+	if len(t.fastStrategies)+len(t.slowStrategies) == 0 {
+		return nil, fmt.Errorf("no strategies configured")
+	}
+	return t, nil
+}
+
+func (t *Scraper) strategy(name string) (platform.Strategy, error) {
+	s, ok := t.strategies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown tokopedia strategy %q (available: %s)", name, strings.Join(StrategyNames(), ", "))
+	}
+	return s, nil
+}
+
+// Coalescing reports how many requests shared an in-flight scrape.
+func (t *Scraper) Coalescing() platform.CoalesceStats {
+	return t.coalesce.Stats()
+}
+
+// Health reports the circuit-breaker state and recent performance of each strategy.
+func (t *Scraper) Health() []platform.HealthSnapshot {
+	return t.health.Snapshot()
+}
+
+// Locations lists the buyer locations requests accept (see LookupLocation).
+func (t *Scraper) Locations() []string {
+	return Locations()
+}
+
+// CanonicalLocation returns the name of location's city and district (see
+// LookupLocation).
+func (t *Scraper) CanonicalLocation(location string) (string, error) {
+	loc, err := LookupLocation(location)
+	if err != nil {
+		return "", err
+	}
+	return loc.Name, nil
 }
 
 func (t *Scraper) Search(ctx context.Context, keyword string, opts platform.SearchOpts) ([]models.Product, error) {
@@ -45,13 +228,14 @@ func (t *Scraper) Search(ctx context.Context, keyword string, opts platform.Sear
 	}
 
 	req := platform.Request{
-		Type:    platform.SearchRequest,
-		Keyword: keyword,
-		Page:    opts.Page,
-		Limit:   opts.Limit,
+		Type:     platform.SearchRequest,
+		Keyword:  keyword,
+		Page:     opts.Page,
+		Limit:    opts.Limit,
+		Location: opts.Location,
 	}
 
-	return t.executeWithFallback(ctx, req)
+	return t.run(ctx, "tokopedia.Search", req)
 }
 
 func (t *Scraper) Trending(ctx context.Context, opts platform.TrendingOpts) ([]models.Product, error) {
@@ -65,22 +249,24 @@ func (t *Scraper) Trending(ctx context.Context, opts platform.TrendingOpts) ([]m
 	}
 
 	req := platform.Request{
-		Type:    platform.TrendingRequest,
-		Keyword: keyword,
-		Limit:   opts.Limit,
-		Page:    1,
+		Type:     platform.TrendingRequest,
+		Keyword:  keyword,
+		Limit:    opts.Limit,
+		Page:     1,
+		Location: opts.Location,
 	}
 
-	return t.executeWithFallback(ctx, req)
+	return t.run(ctx, "tokopedia.Trending", req)
 }
 
-func (t *Scraper) ProductDetail(ctx context.Context, url string) (*models.Product, error) {
+func (t *Scraper) ProductDetail(ctx context.Context, url string, opts platform.DetailOpts) (*models.Product, error) {
 	req := platform.Request{
-		Type: platform.ProductDetailRequest,
-		URL:  url,
+		Type:     platform.ProductDetailRequest,
+		URL:      url,
+		Location: opts.Location,
 	}
 
-	products, err := t.executeWithFallback(ctx, req)
+	products, err := t.run(ctx, "tokopedia.ProductDetail", req)
 	if err != nil {
 		return nil, err
 	}
@@ -90,7 +276,7 @@ func (t *Scraper) ProductDetail(ctx context.Context, url string) (*models.Produc
 	return &products[0], nil
 }
 
-// SearchAll fetches multiple pages concurrently with rate limiting.
+// SearchAll fetches multiple pages concurrently, at most maxConcurrent at a time.
 func (t *Scraper) SearchAll(ctx context.Context, keyword string, pages, perPage int) ([]models.Product, error) {
 	g, ctx := errgroup.WithContext(ctx)
 	g.SetLimit(t.maxConcurrent)
@@ -99,9 +285,6 @@ func (t *Scraper) SearchAll(ctx context.Context, keyword string, pages, perPage
 	for i := 0; i < pages; i++ {
 		i := i
 		g.Go(func() error {
-			if err := t.rateLimiter.Wait(ctx); err != nil {
-				return err
-			}
 			products, err := t.Search(ctx, keyword, platform.SearchOpts{Page: i + 1, Limit: perPage})
 			if err != nil {
 				return err
@@ -117,43 +300,121 @@ func (t *Scraper) SearchAll(ctx context.Context, keyword string, pages, perPage
 	return flatten(results), nil
 }
 
+// run executes req under a span named spanName, sharing one scrape between
+// concurrent identical requests. A forced strategy is part of the key since
+// it changes how the request runs. The scrape itself runs in a trace of its
+// own, linked from the span of the caller that started it; a caller that
+// joins an in-flight scrape gets a span with no children.
+//
+// A request with a location leaves through a proxy exit in its city and
+// its products record the location.
+func (t *Scraper) run(ctx context.Context, spanName string, req platform.Request) (products []models.Product, err error) {
+	ctx, span := tracing.Start(ctx, spanName,
+		tracing.AttrPlatform.String(platformName),
+		attribute.String("kidkazz.keyword", req.Keyword),
+		attribute.String("kidkazz.url", req.URL),
+		attribute.Int("kidkazz.page", req.Page),
+		attribute.Int("kidkazz.limit", req.Limit),
+		attribute.String("kidkazz.location", req.Location),
+	)
+	defer func() {
+		span.SetAttributes(attribute.Int("kidkazz.products", len(products)))
+		tracing.End(span, err)
+	}()
+
+	var loc Location
+	if req.Location != "" {
+		if loc, err = LookupLocation(req.Location); err != nil {
+			return nil, err
+		}
+		req.Location = loc.Name
+	}
+
+	strategy := platform.StrategyFrom(ctx)
+	key := req.Key() + "|" + strategy
+	caller := ctx
+	return t.coalesce.Do(ctx, key, func(ctx context.Context) ([]models.Product, error) {
+		// The shared context only carries what the key pins down.
+		ctx = usage.WithPlatform(ctx, platformName)
+		if strategy != "" {
+			ctx = platform.WithStrategy(ctx, strategy)
+		}
+		if loc.ProxyCity != "" {
+			ctx = stealth.WithGeo(ctx, loc.ProxyCity)
+		}
+		// A new trace, linked to the caller that started it.
+		ctx, span := tracing.StartLinked(ctx, caller, "tokopedia.scrape", tracing.AttrPlatform.String(platformName))
+		defer span.End()
+
+		t.warmer.warm(ctx, req)
+		products, err := t.executeWithFallback(ctx, req)
+		for i := range products {
+			products[i].Location = loc.Name
+		}
+		return products, err
+	})
+}
+
+// blockRetries is how many times a strategy is re-run after an anti-bot block.
+// Each retry goes back through StealthTransport, which picks the next proxy.
+const blockRetries = 1
+
 // executeWithFallback races fast strategies concurrently, then falls back to slow strategies.
+// A genuinely empty result from any strategy ends the chain early; blocks are retried
+// on a fresh proxy before moving on. Strategies whose circuit breaker is open are
+// skipped, and slow strategies are tried in order of recent health. A job over
+// its bandwidth budget ends the chain.
 func (t *Scraper) executeWithFallback(ctx context.Context, req platform.Request) ([]models.Product, error) {
-	var strategyErrors []string
+	if name := platform.StrategyFrom(ctx); name != "" {
+		return t.executeOnly(ctx, name, req)
+	}
+
+	var strategyErrors []error
+
+	products, done, err := t.raceFast(ctx, req, &strategyErrors)
+	if done {
+		return products, err
+	}
+	return t.fallBack(ctx, req, strategyErrors)
+}
+
+// raceFast is phase 1 of executeWithFallback: it races the fast strategies
+// concurrently. done reports whether the request is settled; otherwise the
+// failures are appended to strategyErrors.
+func (t *Scraper) raceFast(ctx context.Context, req platform.Request, strategyErrors *[]error) (products []models.Product, done bool, err error) {
+	ctx, span := tracing.Start(ctx, "fallback.race",
+		attribute.StringSlice("kidkazz.strategies", strategyNames(t.fastStrategies)))
+	outcome := "exhausted"
+	defer func() {
+		span.SetAttributes(tracing.AttrStatus.String(outcome))
+		tracing.End(span, err)
+	}()
 
-	// Phase 1: Race fast strategies concurrently
 	raceCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	type strategyResult struct {
 		products []models.Product
+		total    int
 		strategy string
 		err      error
 	}
 	resultCh := make(chan strategyResult, len(t.fastStrategies))
+	pending := make(map[string]bool, len(t.fastStrategies))
 
 	for _, s := range t.fastStrategies {
+		pending[s.Name()] = true
 		go func(s platform.Strategy) {
-			if t.rateLimiter != nil {
-				if err := t.rateLimiter.Wait(raceCtx); err != nil {
-					resultCh <- strategyResult{strategy: s.Name(), err: err}
-					return
-				}
-			}
-			r, err := s.Execute(raceCtx, req)
+			r, err := t.execute(raceCtx, s, req)
 			if err != nil {
 				resultCh <- strategyResult{strategy: s.Name(), err: err}
 				return
 			}
-			if r == nil || len(r.Products) == 0 {
-				resultCh <- strategyResult{strategy: s.Name(), err: fmt.Errorf("no products returned")}
-				return
-			}
-			resultCh <- strategyResult{products: r.Products, strategy: s.Name()}
+			resultCh <- strategyResult{products: r.Products, total: r.TotalData, strategy: s.Name()}
 		}(s)
 	}
 
-	timer := time.NewTimer(10 * time.Second)
+	timer := time.NewTimer(t.raceTimeout)
 	defer timer.Stop()
 	fastRemaining := len(t.fastStrategies)
 
@@ -162,42 +423,286 @@ fastLoop:
 		select {
 		case r := <-resultCh:
 			fastRemaining--
+			delete(pending, r.strategy)
 			if r.err == nil && len(r.products) > 0 {
 				cancel()
+				outcome = "found"
+				span.SetAttributes(tracing.AttrStrategy.String(r.strategy))
+				observeDepth(1, "found")
+				platform.SetResult(ctx, r.strategy, r.total)
 				platform.ReportProgress(ctx, fmt.Sprintf("Found %d products via %s", len(r.products), r.strategy))
-				return r.products, nil
+				return r.products, true, nil
+			}
+			if httputil.IsEmpty(r.err) {
+				cancel()
+				outcome = "empty"
+				span.SetAttributes(tracing.AttrStrategy.String(r.strategy))
+				observeDepth(1, "empty")
+				platform.SetResult(ctx, r.strategy, 0)
+				platform.ReportProgress(ctx, fmt.Sprintf("No results via %s, skipping fallbacks", r.strategy))
+				return []models.Product{}, true, nil
+			}
+			if errors.Is(r.err, usage.ErrBudgetExceeded) {
+				cancel()
+				outcome = "budget"
+				return nil, true, fmt.Errorf("%s: %w", r.strategy, r.err)
 			}
 			if r.err != nil {
-				strategyErrors = append(strategyErrors, fmt.Sprintf("%s: %v", r.strategy, r.err))
-				platform.ReportProgress(ctx, fmt.Sprintf("Strategy %s failed, trying next...", r.strategy))
+				*strategyErrors = append(*strategyErrors, fmt.Errorf("%s: %w", r.strategy, r.err))
+				platform.Warn(ctx, fmt.Sprintf("strategy %s failed (%s)", r.strategy, failureReason(r.err)))
+				platform.ReportProgress(ctx, fmt.Sprintf("Strategy %s failed (%s), trying next...", r.strategy, failureReason(r.err)))
 			}
 		case <-timer.C:
 			cancel()
-			strategyErrors = append(strategyErrors, fmt.Sprintf("fast strategies: timed out after 10s (%d still pending)", fastRemaining))
-			platform.ReportProgress(ctx, "Fast strategies timed out, trying headless browser...")
+			for name := range pending {
+				t.health.For(name).Record(false, t.raceTimeout)
+			}
+			outcome = "timeout"
+			*strategyErrors = append(*strategyErrors, fmt.Errorf("fast strategies: timed out after %s (%d still pending)", t.raceTimeout, fastRemaining))
+			platform.Warn(ctx, fmt.Sprintf("fast strategies timed out after %s", t.raceTimeout))
+			platform.ReportProgress(ctx, "Fast strategies timed out, trying fallbacks...")
 			break fastLoop
 		case <-ctx.Done():
-			return nil, ctx.Err()
+			return nil, true, ctx.Err()
 		}
 	}
+	return nil, false, nil
+}
 
-	// Phase 2: Fall back to slow strategies sequentially
-	for _, s := range t.slowStrategies {
+// fallBack is phase 2 of executeWithFallback: it tries the slow strategies
+// sequentially, healthiest first, and reports every failure if none succeeds.
+func (t *Scraper) fallBack(ctx context.Context, req platform.Request, strategyErrors []error) (products []models.Product, err error) {
+	ctx, span := tracing.Start(ctx, "fallback.slow",
+		attribute.StringSlice("kidkazz.strategies", strategyNames(t.slowStrategies)))
+	outcome := "exhausted"
+	defer func() {
+		span.SetAttributes(tracing.AttrStatus.String(outcome))
+		tracing.End(span, err)
+	}()
+
+	slowCtx := ctx
+	if t.fallbackTimeout > 0 {
+		var cancelSlow context.CancelFunc
+		slowCtx, cancelSlow = context.WithTimeout(ctx, t.fallbackTimeout)
+		defer cancelSlow()
+	}
+	depth := 1
+	for _, s := range t.health.Order(t.slowStrategies) {
+		if slowCtx.Err() != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			strategyErrors = append(strategyErrors, fmt.Errorf("fallback strategies: timed out after %s", t.fallbackTimeout))
+			break
+		}
+		depth++
 		platform.ReportProgress(ctx, fmt.Sprintf("Trying %s strategy...", s.Name()))
-		result, err := s.Execute(ctx, req)
-		if err == nil && result != nil && len(result.Products) > 0 {
+		result, err := t.execute(slowCtx, s, req)
+		if err == nil {
+			outcome = "found"
+			span.SetAttributes(tracing.AttrStrategy.String(s.Name()))
+			observeDepth(depth, "found")
+			platform.SetResult(ctx, s.Name(), result.TotalData)
 			platform.ReportProgress(ctx, fmt.Sprintf("Found %d products via %s", len(result.Products), s.Name()))
 			return result.Products, nil
 		}
-		if err != nil {
-			strategyErrors = append(strategyErrors, fmt.Sprintf("%s: %v", s.Name(), err))
-			platform.ReportProgress(ctx, fmt.Sprintf("Strategy %s failed, trying next...", s.Name()))
+		if httputil.IsEmpty(err) {
+			outcome = "empty"
+			span.SetAttributes(tracing.AttrStrategy.String(s.Name()))
+			observeDepth(depth, "empty")
+			platform.SetResult(ctx, s.Name(), 0)
+			platform.ReportProgress(ctx, fmt.Sprintf("No results via %s, skipping fallbacks", s.Name()))
+			return []models.Product{}, nil
+		}
+		if errors.Is(err, usage.ErrBudgetExceeded) {
+			outcome = "budget"
+			return nil, fmt.Errorf("%s: %w", s.Name(), err)
+		}
+		strategyErrors = append(strategyErrors, fmt.Errorf("%s: %w", s.Name(), err))
+		platform.Warn(ctx, fmt.Sprintf("strategy %s failed (%s)", s.Name(), failureReason(err)))
+		platform.ReportProgress(ctx, fmt.Sprintf("Strategy %s failed (%s), trying next...", s.Name(), failureReason(err)))
+	}
+
+	observeDepth(depth, "exhausted")
+	target := req.Keyword
+	if target == "" {
+		target = req.URL
+	}
+	return nil, &fallbackError{target: target, errs: strategyErrors}
+}
+
+// executeOnly runs just the named strategy, bypassing the chain and its circuit
+// breaker so each strategy can be tested in isolation. Outcomes are still recorded.
+func (t *Scraper) executeOnly(ctx context.Context, name string, req platform.Request) ([]models.Product, error) {
+	s, err := t.strategy(name)
+	if err != nil {
+		return nil, err
+	}
+	platform.ReportProgress(ctx, fmt.Sprintf("Running %s strategy only...", name))
+
+	h := t.health.For(name)
+	start := time.Now()
+	r, err := t.executeWithRetry(ctx, s, req)
+	switch {
+	case err == nil:
+		h.Record(true, time.Since(start))
+		observeStrategy(name, "success", time.Since(start))
+		t.checkDrift(ctx, r)
+	case httputil.IsEmpty(err):
+		h.Record(true, time.Since(start))
+		observeStrategy(name, "empty", time.Since(start))
+	case errors.Is(err, usage.ErrBudgetExceeded):
+		observeStrategy(name, "budget", 0)
+	case ctx.Err() == nil:
+		h.Record(false, time.Since(start))
+		observeStrategy(name, "failure", time.Since(start))
+	default:
+		observeStrategy(name, "cancelled", 0)
+	}
+	if httputil.IsEmpty(err) {
+		platform.SetResult(ctx, name, 0)
+		return []models.Product{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	platform.SetResult(ctx, name, r.TotalData)
+	return r.Products, nil
+}
+
+// execute runs a single strategy through its circuit breaker and records the
+// outcome, checking successful payloads for schema drift. Cancelled runs
+// (lost race, caller gave up) are not counted. A nil error guarantees a
+// non-empty result.
+func (t *Scraper) execute(ctx context.Context, s platform.Strategy, req platform.Request) (*platform.Result, error) {
+	h := t.health.For(s.Name())
+	if !h.Allow() {
+		observeStrategy(s.Name(), "circuit_open", 0)
+		trace.SpanFromContext(ctx).AddEvent("circuit open", trace.WithAttributes(tracing.AttrStrategy.String(s.Name())))
+		return nil, &platform.CircuitOpenError{Strategy: s.Name(), RetryIn: h.RetryIn()}
+	}
+
+	start := time.Now()
+	r, err := t.executeWithRetry(ctx, s, req)
+	switch {
+	case err == nil:
+		h.Record(true, time.Since(start))
+		observeStrategy(s.Name(), "success", time.Since(start))
+		t.checkDrift(ctx, r)
+	case httputil.IsEmpty(err):
+		h.Record(true, time.Since(start))
+		observeStrategy(s.Name(), "empty", time.Since(start))
+	case ctx.Err() != nil:
+		h.Release()
+		observeStrategy(s.Name(), "cancelled", 0)
+	case errors.Is(err, usage.ErrBudgetExceeded):
+		// The job ran out of bandwidth; the strategy is not at fault.
+		h.Release()
+		observeStrategy(s.Name(), "budget", 0)
+	default:
+		h.Record(false, time.Since(start))
+		observeStrategy(s.Name(), "failure", time.Since(start))
+	}
+	return r, err
+}
+
+// observeStrategy records a strategy execution in the Prometheus metrics.
+// Runs that never completed (circuit open, cancelled) have no latency.
+func observeStrategy(strategy, outcome string, d time.Duration) {
+	metrics.StrategyRequests.WithLabelValues(platformName, strategy, outcome).Inc()
+	if d > 0 {
+		metrics.StrategyLatency.WithLabelValues(platformName, strategy, outcome).Observe(d.Seconds())
+	}
+}
+
+// observeDepth records where in the chain a request ended (1 = fast race).
+func observeDepth(depth int, outcome string) {
+	metrics.FallbackDepth.WithLabelValues(platformName, outcome).Observe(float64(depth))
+}
+
+// executeWithRetry runs a single strategy, retrying on anti-bot blocks.
+// Each attempt gets its own span.
+func (t *Scraper) executeWithRetry(ctx context.Context, s platform.Strategy, req platform.Request) (*platform.Result, error) {
+	for attempt := 0; ; attempt++ {
+		attemptCtx, span := tracing.Start(ctx, "strategy.Execute",
+			tracing.AttrPlatform.String(platformName),
+			tracing.AttrStrategy.String(s.Name()),
+			attribute.Int("kidkazz.attempt", attempt+1),
+		)
+		start := time.Now()
+		r, err := s.Execute(attemptCtx, req)
+		if err == nil && (r == nil || len(r.Products) == 0) {
+			err = fmt.Errorf("no products returned")
+		}
+		status := "ok"
+		switch {
+		case httputil.IsEmpty(err):
+			status = "empty"
+		case err != nil:
+			status = failureReason(err)
+		default:
+			span.SetAttributes(attribute.Int("kidkazz.products", len(r.Products)))
 		}
+		span.SetAttributes(tracing.AttrStatus.String(status))
+		tracing.End(span, err)
+
+		attrs := []any{"platform", platformName, "strategy", s.Name(), "attempt", attempt + 1,
+			"status", status, "duration_ms", time.Since(start).Milliseconds()}
+		if err != nil && !httputil.IsEmpty(err) && ctx.Err() == nil {
+			slog.WarnContext(attemptCtx, "strategy failed", append(attrs, "err", err)...)
+		} else {
+			slog.DebugContext(attemptCtx, "strategy finished", attrs...)
+		}
+
+		if err == nil || !httputil.IsBlocked(err) || attempt >= blockRetries || ctx.Err() != nil {
+			return r, err
+		}
+		platform.Warn(ctx, fmt.Sprintf("strategy %s %s, retried with a fresh proxy", s.Name(), failureReason(err)))
+		platform.ReportProgress(ctx, fmt.Sprintf("Strategy %s %s, retrying with a fresh proxy...", s.Name(), failureReason(err)))
+	}
+}
+
+// strategyNames returns the names of ss, for span attributes.
+func strategyNames(ss []platform.Strategy) []string {
+	names := make([]string, len(ss))
+	for i, s := range ss {
+		names[i] = s.Name()
+	}
+	return names
+}
+
+// failureReason returns a short classification of err for progress messages.
+func failureReason(err error) string {
+	var open *platform.CircuitOpenError
+	if errors.As(err, &open) {
+		return "circuit open"
+	}
+	if errors.Is(err, usage.ErrBudgetExceeded) {
+		return "over budget"
 	}
+	if re, ok := httputil.AsResponseError(err); ok {
+		return string(re.Kind)
+	}
+	return "error"
+}
 
-	return nil, fmt.Errorf("all strategies exhausted for %q:\n  %s", req.Keyword, strings.Join(strategyErrors, "\n  "))
+// fallbackError aggregates the per-strategy failures of executeWithFallback.
+// The individual errors stay reachable through errors.As.
+type fallbackError struct {
+	target string
+	errs   []error
 }
 
+func (e *fallbackError) Error() string {
+	msgs := make([]string, len(e.errs))
+	for i, err := range e.errs {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("all strategies exhausted for %q:\n  %s", e.target, strings.Join(msgs, "\n  "))
+}
+
+func (e *fallbackError) Unwrap() []error { return e.errs }
+
 func flatten(results [][]models.Product) []models.Product {
 	var out []models.Product
 	for _, r := range results {
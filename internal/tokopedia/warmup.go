@@ -0,0 +1,150 @@
+package tokopedia
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/lukman83/kidkazz-scrap/internal/crawl"
+	"github.com/lukman83/kidkazz-scrap/internal/httputil"
+	"github.com/lukman83/kidkazz-scrap/internal/platform"
+	"github.com/lukman83/kidkazz-scrap/internal/stealth"
+	"github.com/lukman83/kidkazz-scrap/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Warm-up steps accepted in Options.Warmup, visited in the order given.
+const (
+	WarmupHome   = "home"   // the homepage
+	WarmupSearch = "search" // the search page for the request's keyword
+)
+
+// WarmupSteps lists every warm-up step.
+func WarmupSteps() []string {
+	return []string{WarmupHome, WarmupSearch}
+}
+
+// warmer browses like a visitor before a session's first scrape, so the
+// site's cookies (_abck, DID_JS, ...) are in the jar when the API calls
+// start. It runs once per crawl session (sessions stay warm for
+// crawl.SessionTTL after their last request) and is skipped when the
+// session already holds cookies for the site.
+type warmer struct {
+	client       *http.Client
+	baseURL      string
+	steps        []string
+	fingerprints *stealth.FingerprintPool // nil: always warm up
+	cookies      *stealth.CookieJars      // nil: always warm up
+
+	sessions *crawl.SessionMap[*sync.Once] // by session ID
+}
+
+// newWarmer returns nil when there are no steps.
+func newWarmer(client *http.Client, opts Options) (*warmer, error) {
+	if len(opts.Warmup) == 0 {
+		return nil, nil
+	}
+	for _, step := range opts.Warmup {
+		if !slices.Contains(WarmupSteps(), step) {
+			return nil, fmt.Errorf("unknown warm-up step %q (available: %s)", step, strings.Join(WarmupSteps(), ", "))
+		}
+	}
+	baseURL := opts.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &warmer{
+		client:       client,
+		baseURL:      strings.TrimRight(baseURL, "/"),
+		steps:        opts.Warmup,
+		fingerprints: opts.Fingerprints,
+		cookies:      opts.Cookies,
+		sessions:     crawl.NewSessionMap[*sync.Once](crawl.SessionTTL, nil),
+	}, nil
+}
+
+// warm runs the warm-up for ctx's session unless it already ran. Concurrent
+// requests of a session wait for it. Failed steps are logged, not returned:
+// a cold session can still scrape.
+func (w *warmer) warm(ctx context.Context, req platform.Request) {
+	if w == nil {
+		return
+	}
+	once := w.sessions.Get(crawl.Session(ctx), func() *sync.Once { return new(sync.Once) })
+	once.Do(func() { w.run(ctx, req) })
+}
+
+func (w *warmer) run(ctx context.Context, req platform.Request) {
+	if w.primed(ctx) {
+		slog.DebugContext(ctx, "warm-up skipped, session has cookies")
+		return
+	}
+
+	ctx, span := tracing.Start(ctx, "tokopedia.warmup", attribute.StringSlice("kidkazz.steps", w.steps))
+	defer tracing.End(span, nil)
+
+	referer := ""
+	for _, step := range w.steps {
+		var pageURL string
+		switch step {
+		case WarmupHome:
+			pageURL = w.baseURL + "/"
+		case WarmupSearch:
+			if req.Keyword == "" {
+				continue
+			}
+			pageURL = fmt.Sprintf("%s/search?st=product&q=%s", w.baseURL, url.QueryEscape(req.Keyword))
+		}
+		if err := w.visit(ctx, pageURL, referer); err != nil {
+			slog.WarnContext(ctx, "warm-up step failed", "step", step, "err", err)
+			continue
+		}
+		referer = pageURL
+	}
+}
+
+// primed reports whether the session already has cookies for the site.
+func (w *warmer) primed(ctx context.Context) bool {
+	if w.fingerprints == nil || w.cookies == nil {
+		return false
+	}
+	u, err := url.Parse(w.baseURL + "/")
+	if err != nil {
+		return false
+	}
+	id := crawl.Session(ctx)
+	fp := w.fingerprints.Session(id)
+	return len(w.cookies.For(id, fp.Name).Cookies(u)) > 0
+}
+
+// visit loads pageURL as a navigation, following a link from referer if set.
+func (w *warmer) visit(ctx context.Context, pageURL, referer string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", pageURL, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range httputil.BrowserHeaders() {
+		req.Header[k] = v
+	}
+	if referer != "" {
+		req.Header.Set("Referer", referer)
+		req.Header.Set("Sec-Fetch-Site", "same-origin")
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<20))
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package usage
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Groupings accepted by Summarize.
+const (
+	ByProvider = "provider"
+	ByPlatform = "platform"
+	ByJob      = "job"
+	ByDay      = "day"
+)
+
+// Groupings lists every grouping.
+func Groupings() []string { return []string{ByProvider, ByPlatform, ByJob, ByDay} }
+
+// Prices maps a proxy provider name to its price per GB (10^9 bytes).
+// Providers without a price, such as "direct", cost nothing.
+type Prices map[string]float64
+
+// Cost returns the estimated cost of c through provider.
+func (p Prices) Cost(provider string, c Counts) float64 {
+	return p[provider] * float64(c.Bytes()) / 1e9
+}
+
+// Row is one line of a usage summary.
+type Row struct {
+	Key  string  `json:"key"`
+	Jobs int     `json:"jobs"`
+	Cost float64 `json:"cost"`
+	Counts
+}
+
+// Summarize totals records grouped by one of Groupings, largest first.
+func Summarize(records []Record, by string, prices Prices) ([]Row, error) {
+	key, ok := map[string]func(Record) string{
+		ByProvider: func(r Record) string { return r.Provider },
+		ByPlatform: func(r Record) string { return r.Platform },
+		ByJob:      func(r Record) string { return r.Job },
+		ByDay:      func(r Record) string { return r.Time.Local().Format(time.DateOnly) },
+	}[by]
+	if !ok {
+		return nil, fmt.Errorf("unknown grouping %q (available: %s)", by, strings.Join(Groupings(), ", "))
+	}
+
+	rows := make(map[string]*Row)
+	jobs := make(map[string]map[string]bool)
+	for _, r := range records {
+		k := key(r)
+		if k == "" {
+			k = "-"
+		}
+		row := rows[k]
+		if row == nil {
+			row = &Row{Key: k}
+			rows[k] = row
+			jobs[k] = make(map[string]bool)
+		}
+		row.add(r.Counts)
+		row.Cost += prices.Cost(r.Provider, r.Counts)
+		jobs[k][r.RequestID] = true
+	}
+
+	out := make([]Row, 0, len(rows))
+	for k, row := range rows {
+		row.Jobs = len(jobs[k])
+		out = append(out, *row)
+	}
+	slices.SortFunc(out, func(a, b Row) int {
+		if c := cmp.Compare(b.Bytes(), a.Bytes()); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Key, b.Key)
+	})
+	return out, nil
+}
+
+// ParseBytes parses a size such as "500MB", "2GB" or "1.5GiB". Decimal units
+// (KB, MB, GB) are powers of 1000, as proxies bill; binary units (KiB, MiB,
+// GiB) powers of 1024. A bare number is bytes.
+func ParseBytes(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	num, unit := s, ""
+	if i >= 0 {
+		num, unit = s[:i], strings.TrimSpace(s[i:])
+	}
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q (want e.g. 500MB or 2GB)", s)
+	}
+	mult, ok := map[string]float64{
+		"": 1, "B": 1,
+		"KB": 1e3, "MB": 1e6, "GB": 1e9, "TB": 1e12,
+		"KIB": 1 << 10, "MIB": 1 << 20, "GIB": 1 << 30, "TIB": 1 << 40,
+	}[strings.ToUpper(unit)]
+	if !ok {
+		return 0, fmt.Errorf("invalid size unit in %q (want B, KB, MB, GB, TB or KiB..TiB)", s)
+	}
+	return int64(n * mult), nil
+}
+
+// FormatBytes renders n in decimal units, e.g. "12.3 MB".
+func FormatBytes(n int64) string {
+	switch {
+	case n >= 1e9:
+		return fmt.Sprintf("%.2f GB", float64(n)/1e9)
+	case n >= 1e6:
+		return fmt.Sprintf("%.1f MB", float64(n)/1e6)
+	case n >= 1e3:
+		return fmt.Sprintf("%.1f KB", float64(n)/1e3)
+	}
+	return fmt.Sprintf("%d B", n)
+}
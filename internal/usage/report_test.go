@@ -0,0 +1,101 @@
+package usage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseBytes(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "512", want: 512},
+		{in: "200MB", want: 200e6},
+		{in: "1.5 GB", want: 1.5e9},
+		{in: "2gib", want: 2 << 30},
+		{in: "10KiB", want: 10 << 10},
+		{in: " 3B ", want: 3},
+		{in: "", wantErr: true},
+		{in: "MB", wantErr: true},
+		{in: "-5MB", wantErr: true},
+		{in: "5PB", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseBytes(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		in   int64
+		want string
+	}{
+		{999, "999 B"},
+		{1500, "1.5 KB"},
+		{12_300_000, "12.3 MB"},
+		{2_500_000_000, "2.50 GB"},
+	}
+	for _, tt := range tests {
+		if got := FormatBytes(tt.in); got != tt.want {
+			t.Errorf("FormatBytes(%d) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	day := time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+	records := []Record{
+		{Time: day, Job: "search", RequestID: "a", Provider: "decodo", Platform: "tokopedia", Counts: Counts{Requests: 2, Sent: 1e8, Received: 9e8}},
+		{Time: day, Job: "search", RequestID: "a", Provider: "direct", Platform: "tokopedia", Counts: Counts{Requests: 1, Received: 500}},
+		{Time: day.Add(24 * time.Hour), Job: "compare", RequestID: "b", Provider: "decodo", Counts: Counts{Requests: 1, Received: 1e9}},
+	}
+	prices := Prices{"decodo": 3}
+
+	tests := []struct {
+		by   string
+		want []Row
+	}{
+		{ByProvider, []Row{
+			{Key: "decodo", Jobs: 2, Cost: 6, Counts: Counts{Requests: 3, Sent: 1e8, Received: 19e8}},
+			{Key: "direct", Jobs: 1, Counts: Counts{Requests: 1, Received: 500}},
+		}},
+		{ByPlatform, []Row{
+			{Key: "tokopedia", Jobs: 1, Cost: 3, Counts: Counts{Requests: 3, Sent: 1e8, Received: 9e8 + 500}},
+			{Key: "-", Jobs: 1, Cost: 3, Counts: Counts{Requests: 1, Received: 1e9}},
+		}},
+		{ByDay, []Row{
+			{Key: "2026-03-01", Jobs: 1, Cost: 3, Counts: Counts{Requests: 3, Sent: 1e8, Received: 9e8 + 500}},
+			{Key: "2026-03-02", Jobs: 1, Cost: 3, Counts: Counts{Requests: 1, Received: 1e9}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.by, func(t *testing.T) {
+			got, err := Summarize(records, tt.by, prices)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d rows, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("row %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+
+	if _, err := Summarize(records, "shop", prices); err == nil {
+		t.Error("unknown grouping: want an error")
+	}
+}
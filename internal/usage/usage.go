@@ -0,0 +1,435 @@
+// Package usage meters the bytes scrapes send and receive, per proxy
+// provider, platform and job, so proxy bandwidth (billed per GB) can be
+// accounted for. It enforces byte budgets and appends finished traffic to a
+// JSON-lines log that the usage report reads.
+//
+// A job is one run of a command or one MCP tool call, identified by its
+// request ID and labelled with a name (see WithJob). A scrape shared by
+// several jobs charges its traffic to them (see Share).
+package usage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/lukman83/kidkazz-scrap/internal/crawl"
+	"github.com/lukman83/kidkazz-scrap/internal/logging"
+)
+
+// Counts is metered traffic.
+type Counts struct {
+	Requests int64 `json:"requests"`
+	Sent     int64 `json:"sent_bytes"`
+	Received int64 `json:"received_bytes"`
+}
+
+// Bytes returns the total bytes in both directions, which is what proxies bill.
+func (c Counts) Bytes() int64 { return c.Sent + c.Received }
+
+func (c *Counts) add(o Counts) {
+	c.Requests += o.Requests
+	c.Sent += o.Sent
+	c.Received += o.Received
+}
+
+// Record is one line of the usage log: a job's traffic through one provider
+// for one platform since the previous line.
+type Record struct {
+	Time      time.Time `json:"time"`
+	Job       string    `json:"job"`
+	RequestID string    `json:"request_id,omitempty"`
+	Provider  string    `json:"provider"`
+	Platform  string    `json:"platform,omitempty"`
+	Counts
+}
+
+// Budget caps metered bytes; zero fields are unlimited.
+type Budget struct {
+	JobBytes   int64 // per job
+	DailyBytes int64 // per calendar day across all jobs, earlier runs in the log included
+}
+
+// ErrBudgetExceeded is wrapped by every budget error.
+var ErrBudgetExceeded = errors.New("usage budget exceeded")
+
+// BudgetError reports which budget a job ran into.
+type BudgetError struct {
+	Scope string // "job" or "daily"
+	Limit int64
+	Used  int64
+}
+
+func (e *BudgetError) Error() string {
+	return fmt.Sprintf("%s budget of %s exceeded (%s used)", e.Scope, FormatBytes(e.Limit), FormatBytes(e.Used))
+}
+
+func (e *BudgetError) Unwrap() error { return ErrBudgetExceeded }
+
+type jobKey struct{}
+type platformKey struct{}
+
+// WithJob names the job of requests made with ctx.
+func WithJob(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, jobKey{}, name)
+}
+
+// JobFrom returns the job name carried by ctx, or "".
+func JobFrom(ctx context.Context) string {
+	name, _ := ctx.Value(jobKey{}).(string)
+	return name
+}
+
+// WithPlatform labels requests made with ctx with the platform they scrape.
+func WithPlatform(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, platformKey{}, name)
+}
+
+func platformFrom(ctx context.Context) string {
+	name, _ := ctx.Value(platformKey{}).(string)
+	return name
+}
+
+type shareKey struct{}
+
+// jobRef identifies the job traffic is charged to.
+type jobRef struct {
+	requestID, name string
+}
+
+func jobOf(ctx context.Context) jobRef {
+	return jobRef{requestID: logging.RequestIDFrom(ctx), name: JobFrom(ctx)}
+}
+
+// Share is one scrape run on behalf of several jobs, such as a coalesced
+// scrape (see platform.Coalescer). Its traffic is split evenly across the
+// jobs waiting on it that are still within budget, and it is over budget
+// only once all of them are.
+type Share struct {
+	mu     sync.Mutex
+	jobs   []shareMember
+	nextID int
+}
+
+type shareMember struct {
+	id  int
+	job jobRef
+}
+
+// WithShare returns a context whose traffic is charged to the jobs that
+// join the returned Share rather than to ctx's own job. Until the first
+// joins, and after the last leaves, ctx's own job pays.
+func WithShare(ctx context.Context) (context.Context, *Share) {
+	s := &Share{}
+	return context.WithValue(ctx, shareKey{}, s), s
+}
+
+// Join charges the share's traffic to ctx's job until leave is called.
+func (s *Share) Join(ctx context.Context) (leave func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.nextID
+	s.nextID++
+	s.jobs = append(s.jobs, shareMember{id: id, job: jobOf(ctx)})
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.jobs = slices.DeleteFunc(s.jobs, func(m shareMember) bool { return m.id == id })
+	}
+}
+
+// payers returns the jobs ctx's traffic is charged to, in join order.
+func payers(ctx context.Context) []jobRef {
+	if s, _ := ctx.Value(shareKey{}).(*Share); s != nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if len(s.jobs) > 0 {
+			out := make([]jobRef, len(s.jobs))
+			for i, m := range s.jobs {
+				out[i] = m.job
+			}
+			return out
+		}
+	}
+	return []jobRef{jobOf(ctx)}
+}
+
+// split divides c into n near-equal parts, the remainders going to the
+// first parts.
+func split(c Counts, n int) []Counts {
+	part := func(v int64, i int) int64 {
+		q, r := v/int64(n), v%int64(n)
+		if int64(i) < r {
+			q++
+		}
+		return q
+	}
+	out := make([]Counts, n)
+	for i := range out {
+		out[i] = Counts{Requests: part(c.Requests, i), Sent: part(c.Sent, i), Received: part(c.Received, i)}
+	}
+	return out
+}
+
+// jobTTL is how long an idle job's running total is kept for its budget.
+const jobTTL = 30 * time.Minute
+
+type recordKey struct {
+	job      jobRef
+	provider string
+	platform string
+}
+
+type jobTotal struct {
+	bytes int64
+}
+
+// Meter counts traffic. A nil *Meter meters nothing and allows everything.
+type Meter struct {
+	path   string // usage log; empty: not persisted
+	budget Budget
+
+	mu       sync.Mutex
+	pending  map[recordKey]*Counts        // not yet in the log
+	jobs     *crawl.SessionMap[*jobTotal] // by request ID
+	day      string                       // local date dayBytes counts
+	dayBytes int64
+}
+
+// DefaultPath returns <user cache dir>/kidkazz/usage.jsonl.
+func DefaultPath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "kidkazz", "usage.jsonl"), nil
+}
+
+// NewMeter returns a meter enforcing budget that keeps no log.
+func NewMeter(budget Budget) *Meter {
+	return &Meter{
+		budget:  budget,
+		pending: make(map[recordKey]*Counts),
+		jobs:    crawl.NewSessionMap[*jobTotal](jobTTL, nil),
+		day:     today(),
+	}
+}
+
+// OpenMeter returns a meter logging to path. Today's traffic already in the
+// log counts towards the daily budget.
+func OpenMeter(path string, budget Budget) (*Meter, error) {
+	m := NewMeter(budget)
+	m.path = path
+	if budget.DailyBytes > 0 {
+		records, err := Read(path, startOfDay(time.Now()))
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range records {
+			m.dayBytes += r.Bytes()
+		}
+	}
+	return m, nil
+}
+
+// Allow returns a *BudgetError once ctx's job (every job of a shared
+// scrape) or the day is over budget.
+func (m *Meter) Allow(ctx context.Context) error {
+	if m == nil {
+		return nil
+	}
+	jobs := payers(ctx)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.check(jobs)
+}
+
+// check returns a *BudgetError when the day, or every one of jobs, is over
+// budget. m.mu must be held.
+func (m *Meter) check(jobs []jobRef) error {
+	if m.budget.DailyBytes > 0 && m.day == today() && m.dayBytes >= m.budget.DailyBytes {
+		return &BudgetError{Scope: "daily", Limit: m.budget.DailyBytes, Used: m.dayBytes}
+	}
+	if under := m.withinBudget(jobs); len(under) == 0 {
+		return &BudgetError{Scope: "job", Limit: m.budget.JobBytes, Used: m.used(jobs[0].requestID)}
+	}
+	return nil
+}
+
+// withinBudget returns the jobs that have not used up their budget.
+// m.mu must be held.
+func (m *Meter) withinBudget(jobs []jobRef) []jobRef {
+	if m.budget.JobBytes <= 0 {
+		return jobs
+	}
+	var out []jobRef
+	for _, j := range jobs {
+		if m.used(j.requestID) < m.budget.JobBytes {
+			out = append(out, j)
+		}
+	}
+	return out
+}
+
+// used returns the bytes job id has used so far. m.mu must be held.
+func (m *Meter) used(id string) int64 {
+	if t, ok := m.jobs.Peek(id); ok {
+		return t.bytes
+	}
+	return 0
+}
+
+// Add meters traffic of ctx's job through provider and returns a
+// *BudgetError if it put the job or the day over budget. A shared scrape's
+// traffic is split across its jobs that are still within budget.
+func (m *Meter) Add(ctx context.Context, provider string, c Counts) error {
+	if m == nil {
+		return nil
+	}
+	jobs, plat := payers(ctx), platformFrom(ctx)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	paying := m.withinBudget(jobs)
+	if len(paying) == 0 {
+		paying = jobs
+	}
+	for i, part := range split(c, len(paying)) {
+		job := paying[i]
+		key := recordKey{job: job, provider: provider, platform: plat}
+		p := m.pending[key]
+		if p == nil {
+			p = &Counts{}
+			m.pending[key] = p
+		}
+		p.add(part)
+
+		m.jobs.Get(job.requestID, func() *jobTotal { return &jobTotal{} }).bytes += part.Bytes()
+	}
+	if d := today(); d != m.day {
+		m.day, m.dayBytes = d, 0
+	}
+	m.dayBytes += c.Bytes()
+	return m.check(jobs)
+}
+
+// Done ends ctx's job: the traffic metered so far is appended to the log
+// and the job's running total is dropped.
+func (m *Meter) Done(ctx context.Context) error {
+	if m == nil {
+		return nil
+	}
+	m.jobs.Delete(logging.RequestIDFrom(ctx))
+	return m.Flush()
+}
+
+// Flush appends pending traffic to the log.
+func (m *Meter) Flush() error {
+	if m == nil || m.path == "" {
+		return nil
+	}
+	m.mu.Lock()
+	pending := m.pending
+	m.pending = make(map[recordKey]*Counts)
+	m.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(m.path), 0o755); err != nil {
+		return fmt.Errorf("create usage dir: %w", err)
+	}
+	f, err := os.OpenFile(m.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("open usage log: %w", err)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	now := time.Now().UTC()
+	enc := json.NewEncoder(w)
+	for k, c := range pending {
+		err := enc.Encode(Record{
+			Time:      now,
+			Job:       k.job.name,
+			RequestID: k.job.requestID,
+			Provider:  k.provider,
+			Platform:  k.platform,
+			Counts:    *c,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("write usage log: %w", err)
+	}
+	return nil
+}
+
+// Read returns the records logged at path since since. A missing log has
+// no records; unreadable lines are skipped.
+func Read(path string, since time.Time) ([]Record, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open usage log: %w", err)
+	}
+	defer f.Close()
+
+	var out []Record
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var r Record
+		if json.Unmarshal(sc.Bytes(), &r) != nil || r.Time.Before(since) {
+			continue
+		}
+		out = append(out, r)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read usage log: %w", err)
+	}
+	return out, nil
+}
+
+// CountingBody wraps a response body, metering every byte read as received
+// traffic. Once the job goes over budget, reads fail with the budget error.
+func CountingBody(ctx context.Context, m *Meter, provider string, body io.ReadCloser) io.ReadCloser {
+	if m == nil {
+		return body
+	}
+	return &countingBody{ReadCloser: body, ctx: ctx, meter: m, provider: provider}
+}
+
+type countingBody struct {
+	io.ReadCloser
+	ctx      context.Context
+	meter    *Meter
+	provider string
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		if berr := b.meter.Add(b.ctx, b.provider, Counts{Received: int64(n)}); berr != nil && err == nil {
+			err = berr
+		}
+	}
+	return n, err
+}
+
+func today() string { return time.Now().Format(time.DateOnly) }
+
+func startOfDay(t time.Time) time.Time {
+	y, mo, d := t.Date()
+	return time.Date(y, mo, d, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,89 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lukman83/kidkazz-scrap/internal/logging"
+)
+
+func job(id string) context.Context {
+	return WithJob(logging.WithRequestID(context.Background(), id), "search")
+}
+
+func TestSplit(t *testing.T) {
+	got := split(Counts{Requests: 1, Sent: 10, Received: 7}, 3)
+	want := []Counts{{1, 4, 3}, {0, 3, 2}, {0, 3, 2}}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("part %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestShareSplitsTraffic(t *testing.T) {
+	m := NewMeter(Budget{JobBytes: 100})
+	scrape, share := WithShare(job("scrape"))
+	leaveA := share.Join(job("a"))
+	leaveB := share.Join(job("b"))
+
+	if err := m.Add(scrape, "direct", Counts{Requests: 1, Received: 120}); err != nil {
+		t.Fatalf("shared scrape under both budgets: %v", err)
+	}
+	if a, b := m.used("a"), m.used("b"); a != 60 || b != 60 {
+		t.Errorf("a, b charged %d, %d; want 60 each", a, b)
+	}
+	if _, ok := m.jobs.Peek("scrape"); ok {
+		t.Error("the shared scrape's own request ID was charged")
+	}
+
+	// a joins with nothing left: b alone pays until it too runs out.
+	leaveA()
+	share.Join(job("c"))
+	m.jobs.Get("c", func() *jobTotal { return &jobTotal{bytes: 100} })
+	if err := m.Add(scrape, "direct", Counts{Received: 30}); err != nil {
+		t.Fatalf("b is within budget: %v", err)
+	}
+	if b := m.used("b"); b != 90 {
+		t.Errorf("b charged %d, want 90", b)
+	}
+	err := m.Add(scrape, "direct", Counts{Received: 30})
+	var be *BudgetError
+	if !errors.As(err, &be) || be.Scope != "job" {
+		t.Errorf("err = %v, want a job budget error once every job is over", err)
+	}
+
+	leaveB()
+	if got := payers(scrape); len(got) != 1 || got[0].requestID != "c" {
+		t.Errorf("payers = %+v, want c", got)
+	}
+}
+
+func TestMeterDone(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.jsonl")
+	m, err := OpenMeter(path, Budget{JobBytes: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := job("run-1")
+	if err := m.Add(ctx, "decodo", Counts{Requests: 2, Sent: 10, Received: 50}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Done(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := Read(path, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].RequestID != "run-1" || records[0].Job != "search" || records[0].Bytes() != 60 {
+		t.Fatalf("records = %+v", records)
+	}
+	if _, ok := m.jobs.Peek("run-1"); ok {
+		t.Error("finished job's total kept")
+	}
+}
@@ -0,0 +1,154 @@
+package mcp
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lukman83/kidkazz-scrap/internal/models"
+	"github.com/lukman83/kidkazz-scrap/internal/platform"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// maxResultProducts caps the products in one tool result. Larger results are
+// returned in slices: next_cursor fetches the next one from the saved search,
+// without scraping again.
+const maxResultProducts = 20
+
+// productsOutput is the structured result of search_products and get_trending.
+type productsOutput struct {
+	Platform     string           `json:"platform" jsonschema_description:"Platform the products were scraped from"`
+	Keyword      string           `json:"keyword,omitempty" jsonschema_description:"Search keyword (search_products)"`
+	Category     string           `json:"category,omitempty" jsonschema_description:"Category filter (get_trending)"`
+	Location     string           `json:"location,omitempty" jsonschema_description:"Buyer location the prices apply to"`
+	Page         int              `json:"page" jsonschema_description:"Page of the platform's results"`
+	Limit        int              `json:"limit" jsonschema_description:"Products requested per page"`
+	TotalData    int              `json:"total_data" jsonschema_description:"Products matching on the platform; 0 when the strategy does not report it"`
+	HasMore      bool             `json:"has_more" jsonschema_description:"Whether the platform has results beyond this page; request page+1 for them"`
+	StrategyUsed string           `json:"strategy_used,omitempty" jsonschema_description:"Scraping strategy that produced the products"`
+	CachedAt     *time.Time       `json:"cached_at,omitempty" jsonschema_description:"When the response cache stored the result; absent when scraped for this call"`
+	FilteredAds  int              `json:"filtered_ads" jsonschema_description:"Ads removed by exclude_ads"`
+	Warnings     []string         `json:"warnings" jsonschema_description:"Failed strategies, stale cache, schema drift and other caveats"`
+	Offset       int              `json:"offset" jsonschema_description:"Index of the first product of this slice in the saved result"`
+	Returned     int              `json:"returned" jsonschema_description:"Products in this response"`
+	Total        int              `json:"total" jsonschema_description:"Products in the saved result"`
+	Products     []models.Product `json:"products"`
+	NextCursor   string           `json:"next_cursor,omitempty" jsonschema_description:"Pass as cursor to get the rest of this result"`
+	Resource     string           `json:"resource" jsonschema_description:"URI of the saved result"`
+}
+
+// productOutput is the structured result of product_detail.
+type productOutput struct {
+	Platform     string          `json:"platform" jsonschema_description:"Platform the product was scraped from"`
+	StrategyUsed string          `json:"strategy_used,omitempty" jsonschema_description:"Scraping strategy that produced the product"`
+	CachedAt     *time.Time      `json:"cached_at,omitempty" jsonschema_description:"When the response cache stored the result; absent when scraped for this call"`
+	Warnings     []string        `json:"warnings" jsonschema_description:"Failed strategies, stale cache, schema drift and other caveats"`
+	Product      *models.Product `json:"product"`
+	Resource     string          `json:"resource,omitempty" jsonschema_description:"URI of the product snapshot"`
+}
+
+// recordResult applies what the scrape of s's products recorded, removing
+// ads from them if excludeAds is set.
+func recordResult(s *savedSearch, info platform.ResultInfo, excludeAds bool) {
+	s.TotalData = info.TotalData
+	s.Strategy = info.Strategy
+	s.Warnings = info.Warnings
+	if !info.CachedAt.IsZero() {
+		s.CachedAt = &info.CachedAt
+	}
+	page := max(s.Page, 1)
+	if s.TotalData > 0 {
+		s.HasMore = page*s.Limit < s.TotalData
+	} else {
+		s.HasMore = len(s.Products) >= s.Limit
+	}
+	if excludeAds {
+		kept := models.FilterAds(s.Products)
+		s.FilteredAds = len(s.Products) - len(kept)
+		s.Products = kept
+	}
+}
+
+// productsResult returns the slice of s starting at offset, with the full
+// output as the text fallback for clients without structured content support.
+func productsResult(s *savedSearch, offset int) *mcp.CallToolResult {
+	end := min(offset+maxResultProducts, len(s.Products))
+	out := productsOutput{
+		Platform:     s.Platform,
+		Keyword:      s.Keyword,
+		Category:     s.Category,
+		Location:     s.Location,
+		Page:         max(s.Page, 1),
+		Limit:        s.Limit,
+		TotalData:    s.TotalData,
+		HasMore:      s.HasMore,
+		StrategyUsed: s.Strategy,
+		CachedAt:     s.CachedAt,
+		FilteredAds:  s.FilteredAds,
+		Warnings:     nonNil(s.Warnings),
+		Offset:       offset,
+		Returned:     end - offset,
+		Total:        len(s.Products),
+		Products:     nonNil(s.Products[offset:end]),
+		Resource:     searchURI(s.ID),
+	}
+	if end < len(s.Products) {
+		out.NextCursor = encodeCursor(s.ID, end)
+	}
+	return withLink(structuredResult(out), out.Resource, "Saved search")
+}
+
+// structuredResult returns out as structured content and indented JSON text.
+func structuredResult(out any) *mcp.CallToolResult {
+	data, _ := json.MarshalIndent(out, "", "  ")
+	return mcp.NewToolResultStructured(out, string(data))
+}
+
+// encodeCursor returns an opaque cursor for the products of saved search id
+// from offset on.
+func encodeCursor(id string, offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(id + ":" + strconv.Itoa(offset)))
+}
+
+// decodeCursor splits a cursor from encodeCursor. The offset follows the
+// last colon, so any ID round-trips.
+func decodeCursor(cursor string) (id string, offset int, err error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		if i := strings.LastIndexByte(string(data), ':'); i > 0 {
+			id = string(data[:i])
+			offset, err = strconv.Atoi(string(data[i+1:]))
+			if err == nil && offset >= 0 {
+				return id, offset, nil
+			}
+		}
+	}
+	return "", 0, fmt.Errorf("invalid cursor %q", cursor)
+}
+
+// nextSlice returns the result slice cursor points to.
+func nextSlice(cursor string) *mcp.CallToolResult {
+	id, offset, err := decodeCursor(cursor)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error())
+	}
+	s, ok := snapshots.search(id)
+	if !ok {
+		return mcp.NewToolResultError(fmt.Sprintf("cursor expired: saved search %s is no longer kept; repeat the call without cursor", id))
+	}
+	if offset > len(s.Products) {
+		return mcp.NewToolResultError(fmt.Sprintf("invalid cursor %q", cursor))
+	}
+	return productsResult(s, offset)
+}
+
+// nonNil returns s, or an empty slice if s is nil, so it encodes as [].
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
@@ -0,0 +1,85 @@
+package mcp
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/lukman83/kidkazz-scrap/internal/logging"
+	"github.com/lukman83/kidkazz-scrap/internal/models"
+	"github.com/lukman83/kidkazz-scrap/internal/platform"
+)
+
+func TestCursor(t *testing.T) {
+	for _, tt := range []struct {
+		id     string
+		offset int
+	}{
+		{"0f3a9c", 20},
+		{"0f3a9c", 0},
+		{logging.NewRequestID(), 40},
+		{"client:chosen:id", 20},
+	} {
+		id, offset, err := decodeCursor(encodeCursor(tt.id, tt.offset))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != tt.id || offset != tt.offset {
+			t.Errorf("round trip of %s:%d = %s:%d", tt.id, tt.offset, id, offset)
+		}
+	}
+
+	raw := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	for _, cursor := range []string{"", "not base64!", encodeCursor("0f3a9c", -1), "MGYzYTlj", raw(":20"), raw("0f3a9c:x")} {
+		if _, _, err := decodeCursor(cursor); err == nil {
+			t.Errorf("decodeCursor(%q): want an error", cursor)
+		}
+	}
+}
+
+func TestRecordResult(t *testing.T) {
+	products := func(n, ads int) []models.Product {
+		out := make([]models.Product, n)
+		for i := range ads {
+			out[i].IsAd = true
+		}
+		return out
+	}
+	tests := []struct {
+		name       string
+		page       int
+		products   []models.Product
+		totalData  int
+		excludeAds bool
+		hasMore    bool
+		kept       int
+	}{
+		{name: "total beyond this page", page: 1, products: products(20, 0), totalData: 45, hasMore: true, kept: 20},
+		{name: "last page by total", page: 3, products: products(5, 0), totalData: 45, kept: 5},
+		{name: "page 0 is page 1", products: products(20, 0), totalData: 21, hasMore: true, kept: 20},
+		{name: "no total, full page", page: 2, products: products(20, 0), hasMore: true, kept: 20},
+		{name: "no total, short page", page: 2, products: products(12, 0), kept: 12},
+		{name: "ads kept", page: 1, products: products(20, 3), hasMore: true, kept: 20},
+		// Removing ads does not make a full page look like the last one.
+		{name: "ads excluded", page: 1, products: products(20, 3), excludeAds: true, hasMore: true, kept: 17},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &savedSearch{Page: tt.page, Limit: 20, Products: tt.products}
+			recordResult(s, platform.ResultInfo{TotalData: tt.totalData, Strategy: "graphql"}, tt.excludeAds)
+			if s.HasMore != tt.hasMore {
+				t.Errorf("HasMore = %v, want %v", s.HasMore, tt.hasMore)
+			}
+			if len(s.Products) != tt.kept || s.FilteredAds != len(tt.products)-tt.kept {
+				t.Errorf("kept %d products, filtered %d; want %d kept", len(s.Products), s.FilteredAds, tt.kept)
+			}
+			for _, p := range s.Products {
+				if tt.excludeAds && p.IsAd {
+					t.Fatal("ad left in the result")
+				}
+			}
+			if s.Strategy != "graphql" || s.CachedAt != nil {
+				t.Errorf("strategy %q, cached at %v", s.Strategy, s.CachedAt)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// conventions is appended to every prompt, so analyses read the same
+// whoever asks for them.
+const conventions = `Conventions:
+- Exclude ads: call search_products and get_trending with exclude_ads true, and say how many were dropped ("filtered_ads").
+- Demand is measured with get_trending (best-seller sort), not with search_products (best-match sort, which favours ads and new listings).
+- Quote prices in Rupiah as "Rp 1.234.567". The effective price is "price"; when "original_price" is higher, mention the discount.
+- Treat an offer as credible when the product has at least 10 reviews and the shop is official ("is_official": true) or the product's rating is 4.5 or more. Shop reputation is not scraped, so say "rated" of the product, not the shop. compare_prices applies the same bar.
+- Link every product you mention by its "url".
+- Results over 20 products come in slices: follow "next_cursor" until it is absent before computing anything.
+- Before scraping again, check kidkazz://searches for a result of the same call from the last hour and read that instead.
+- End with the date the data was scraped ("scraped_at", or "cached_at" when set) and the result's "warnings" and location caveats.`
+
+// promptArg is an argument of a prompt.
+type promptArg struct {
+	name        string
+	description string
+	required    bool
+}
+
+// promptDef is a prompt: a multi-tool workflow rendered from its arguments.
+type promptDef struct {
+	name        string
+	description string
+	args        []promptArg
+	render      func(args map[string]string) string
+}
+
+// promptsTable lists every prompt.
+var promptsTable = []promptDef{
+	{
+		name:        "competitor_price_check",
+		description: "Compare a product's price with the same product from competing shops",
+		args: []promptArg{
+			{"product", "Product name, or the URL of our own listing", true},
+			{"competitors", "Comma-separated competitor shop names (default: every shop selling it)", false},
+		},
+		render: func(a map[string]string) string {
+			competitors := "every shop in the results"
+			if a["competitors"] != "" {
+				competitors = "these shops: " + a["competitors"]
+			}
+			return fmt.Sprintf(`Check how the price of %q compares with %s.
+
+1. If the product is a URL, call product_detail on it to get its name and our price; otherwise treat it as the product name.
+2. Call search_products with the product name as keyword, limit 60, pages 1 and 2.
+3. Keep listings that are the same product (same brand, model and variant or pack size); list what you excluded as different products.
+4. For each competitor, take their cheapest matching listing: price, original price and discount, shop city, official status, rating and review count.
+5. Report a table sorted by price with our listing marked, the cheapest credible offer, and how far above or below it we are in Rupiah and percent.`, a["product"], competitors)
+		},
+	},
+	{
+		name:        "category_opportunity",
+		description: "Size up demand, price bands and competition for a category or keyword",
+		args: []promptArg{
+			{"keyword", "Category or keyword, e.g. kaos dalam anak", true},
+		},
+		render: func(a map[string]string) string {
+			return fmt.Sprintf(`Assess whether %q is a good category to enter.
+
+1. Call get_trending with category %q and limit 50 for the best sellers.
+2. Call search_products with keyword %q and limit 60 to see the wider field, including how many results are ads.
+3. Demand: the sold counts and review counts of the top 10 best sellers.
+4. Price bands: bucket best-seller prices into 4 to 5 bands and count products and total sold per band.
+5. Competition: the share of official stores, the share of ads in the search results, and the shop cities that dominate.
+6. Conclude with the most promising price band and the gap (price, quality or shipping origin) a new listing could fill.`, a["keyword"], a["keyword"], a["keyword"])
+		},
+	},
+	{
+		name:        "supplier_shortlist",
+		description: "Shortlist shops in a city that sell a product well",
+		args: []promptArg{
+			{"keyword", "Product keyword", true},
+			{"city", "Shop city, e.g. Bandung", true},
+		},
+		render: func(a map[string]string) string {
+			return fmt.Sprintf(`Shortlist suppliers of %q located in %s.
+
+1. Call get_trending with category %q and limit 50, then search_products with keyword %q and limit 60.
+2. Keep products whose shop city matches %s (shop.city, case-insensitive; "Kota %s" and "Kab. %s" count).
+3. Group by shop. For each shop: number of matching listings, total sold, best rating, total reviews, price range and official status.
+4. Rank by total sold, then rating. Drop shops that are not credible.
+5. Report the top 10 with one line each on why they made the list, and the listing URLs to contact them through.`, a["keyword"], a["city"], a["keyword"], a["keyword"], a["city"], a["city"], a["city"])
+		},
+	},
+	{
+		name:        "promo_audit",
+		description: "Audit a shop's discounts, promo labels and ads",
+		args: []promptArg{
+			{"shop", "Shop name as shown on the marketplace", true},
+		},
+		render: func(a map[string]string) string {
+			return fmt.Sprintf(`Audit the promotions of the shop %q.
+
+1. Call search_products with keyword %q and limit 60, pages 1 and 2. Keep products whose shop.name matches the shop (case-insensitive).
+2. For this audit only, leave exclude_ads off to keep the shop's ads, and report how many of its listings are ads.
+3. For each listing: price, original price, discount percent, and promo labels (cashback, free shipping, flash sale).
+4. Flag suspicious discounts: a discount above 50%%, or an original price more than twice the price of comparable listings from other shops in the results.
+5. Summarize the share of listings on discount, the average discount, the labels used most, and which best sellers carry no promotion at all.`, a["shop"], a["shop"])
+		},
+	},
+}
+
+// registerPrompts adds the analysis workflow prompts to s.
+func registerPrompts(s *server.MCPServer) {
+	for _, p := range promptsTable {
+		opts := []mcp.PromptOption{mcp.WithPromptDescription(p.description)}
+		for _, a := range p.args {
+			argOpts := []mcp.ArgumentOption{mcp.ArgumentDescription(a.description)}
+			if a.required {
+				argOpts = append(argOpts, mcp.RequiredArgument())
+			}
+			opts = append(opts, mcp.WithArgument(a.name, argOpts...))
+		}
+		s.AddPrompt(mcp.NewPrompt(p.name, opts...), promptHandler(p))
+	}
+}
+
+func promptHandler(p promptDef) server.PromptHandlerFunc {
+	return func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+		args := make(map[string]string, len(p.args))
+		for _, a := range p.args {
+			v := strings.TrimSpace(request.Params.Arguments[a.name])
+			if v == "" && a.required {
+				return nil, fmt.Errorf("%s: argument %q is required", p.name, a.name)
+			}
+			args[a.name] = v
+		}
+		text := p.render(args) + "\n\n" + conventions
+		return mcp.NewGetPromptResult(p.description, []mcp.PromptMessage{
+			mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent(text)),
+		}), nil
+	}
+}
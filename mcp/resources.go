@@ -0,0 +1,534 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lukman83/kidkazz-scrap/internal/cache"
+	"github.com/lukman83/kidkazz-scrap/internal/logging"
+	"github.com/lukman83/kidkazz-scrap/internal/models"
+	"github.com/lukman83/kidkazz-scrap/internal/platform"
+	"github.com/lukman83/kidkazz-scrap/internal/usage"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Resource URIs.
+const (
+	platformsURI    = "kidkazz://platforms"
+	searchesURI     = "kidkazz://searches"
+	searchURIPrefix = "kidkazz://searches/"
+	productPrefix   = "kidkazz://products/"
+)
+
+// Snapshot limits; the entries seen longest ago are dropped first.
+const (
+	maxSearches = 100
+	maxProducts = 5000
+)
+
+// Collections of the cache file the snapshots are saved in.
+const (
+	searchesCollection = "mcp-searches"
+	productsCollection = "mcp-products"
+)
+
+func searchURI(id string) string { return searchURIPrefix + id }
+
+// productURI is the URI of a product's snapshot. Prices differ between buyer
+// locations, so a product fetched for a location has a snapshot of its own.
+func productURI(platformName, id, location string) string {
+	uri := productPrefix + platformName + "/" + id
+	if location != "" {
+		uri += "?location=" + url.QueryEscape(location)
+	}
+	return uri
+}
+
+// savedSearch is a search_products or get_trending result. Stored searches
+// are never modified.
+type savedSearch struct {
+	ID          string           `json:"id"`
+	Tool        string           `json:"tool"`
+	Platform    string           `json:"platform"`
+	Keyword     string           `json:"keyword,omitempty"`
+	Category    string           `json:"category,omitempty"`
+	Page        int              `json:"page,omitempty"`
+	Limit       int              `json:"limit"`
+	Location    string           `json:"location,omitempty"`
+	TotalData   int              `json:"total_data,omitempty"`
+	HasMore     bool             `json:"has_more"`
+	Strategy    string           `json:"strategy_used,omitempty"`
+	CachedAt    *time.Time       `json:"cached_at,omitempty"`
+	FilteredAds int              `json:"filtered_ads,omitempty"`
+	Warnings    []string         `json:"warnings,omitempty"`
+	SavedAt     time.Time        `json:"saved_at"`
+	Products    []models.Product `json:"products"`
+}
+
+// productSnapshot is the latest scraped state of a product.
+type productSnapshot struct {
+	Platform  string         `json:"platform"`
+	Product   models.Product `json:"product"`
+	SeenAt    time.Time      `json:"seen_at"`
+	ChangedAt time.Time      `json:"changed_at"` // first seen, or last price/rating/sales change
+}
+
+// snapshotStore keeps the results of tool calls, so agents can re-read them
+// as resources without re-scraping. With a cache file (see open) they
+// survive restarts. Sessions subscribed to a product's URI are notified
+// when it changes.
+type snapshotStore struct {
+	mu           sync.Mutex
+	searches     map[string]*savedSearch
+	searchOrder  []string                    // oldest first
+	products     map[string]*productSnapshot // by URI
+	productOrder []string                    // seen longest ago first
+	subscribed   map[string]map[string]bool  // product URI to session IDs
+	sessions     map[string]bool             // live session IDs
+	notify       func(session, uri string) error
+	db           *cache.Store // nil: kept in memory only
+}
+
+var snapshots = newSnapshotStore()
+
+func newSnapshotStore() *snapshotStore {
+	return &snapshotStore{
+		searches:   make(map[string]*savedSearch),
+		products:   make(map[string]*productSnapshot),
+		subscribed: make(map[string]map[string]bool),
+		sessions:   make(map[string]bool),
+	}
+}
+
+// open loads the searches and snapshots saved in db, and saves later ones
+// there too.
+func (st *snapshotStore) open(db *cache.Store) error {
+	var searches []*savedSearch
+	err := db.EachSaved(searchesCollection, func(id string, data []byte) error {
+		var s savedSearch
+		if json.Unmarshal(data, &s) == nil {
+			searches = append(searches, &s)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("load saved searches: %w", err)
+	}
+	var products []*productSnapshot
+	err = db.EachSaved(productsCollection, func(uri string, data []byte) error {
+		var p productSnapshot
+		if json.Unmarshal(data, &p) == nil {
+			products = append(products, &p)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("load product snapshots: %w", err)
+	}
+	slices.SortFunc(searches, func(a, b *savedSearch) int { return a.SavedAt.Compare(b.SavedAt) })
+	slices.SortFunc(products, func(a, b *productSnapshot) int { return a.SeenAt.Compare(b.SeenAt) })
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.db = db
+	for _, s := range searches {
+		st.searches[s.ID] = s
+		st.searchOrder = append(st.searchOrder, s.ID)
+	}
+	for _, p := range products {
+		uri := productURI(p.Platform, p.Product.ID, p.Product.Location)
+		st.products[uri] = p
+		st.productOrder = append(st.productOrder, uri)
+	}
+	return nil
+}
+
+// saveSearch stores s under a new ID, along with snapshots of its products,
+// and returns the stored search. IDs are never taken from the client, so
+// one client cannot overwrite another's search.
+func (st *snapshotStore) saveSearch(ctx context.Context, s savedSearch) *savedSearch {
+	s.SavedAt = time.Now()
+
+	st.mu.Lock()
+	s.ID = logging.NewRequestID()
+	for st.searches[s.ID] != nil {
+		s.ID = logging.NewRequestID()
+	}
+	st.searches[s.ID] = &s
+	st.searchOrder = append(st.searchOrder, s.ID)
+	var dropped []string
+	for len(st.searchOrder) > maxSearches {
+		dropped = append(dropped, st.searchOrder[0])
+		delete(st.searches, st.searchOrder[0])
+		st.searchOrder = st.searchOrder[1:]
+	}
+	db := st.db
+	st.mu.Unlock()
+
+	if db != nil {
+		if err := persist(db, searchesCollection, map[string]any{s.ID: &s}, dropped); err != nil {
+			slog.WarnContext(ctx, "save search failed", "search_id", s.ID, "err", err)
+		}
+	}
+	st.saveProducts(ctx, s.Platform, s.Products...)
+	return &s
+}
+
+// search returns the saved search id, if it is still kept.
+func (st *snapshotStore) search(id string) (*savedSearch, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	s, ok := st.searches[id]
+	return s, ok
+}
+
+// product returns the snapshot at uri, if it is still kept.
+func (st *snapshotStore) product(uri string) (*productSnapshot, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	p, ok := st.products[uri]
+	return p, ok
+}
+
+// saveProducts updates the snapshots of products with an ID and notifies
+// the subscribers of those that changed.
+func (st *snapshotStore) saveProducts(ctx context.Context, platformName string, products ...models.Product) {
+	now := time.Now()
+	saved := make(map[string]any)
+	notices := make(map[string][]string) // session to changed URIs
+	st.mu.Lock()
+	for _, p := range products {
+		if p.ID == "" {
+			continue
+		}
+		uri := productURI(platformName, p.ID, p.Location)
+		snap := &productSnapshot{Platform: platformName, Product: p, SeenAt: now, ChangedAt: now}
+		if old, ok := st.products[uri]; ok {
+			st.productOrder = slices.DeleteFunc(st.productOrder, func(u string) bool { return u == uri })
+			if productChanged(old.Product, p) {
+				for session := range st.subscribed[uri] {
+					notices[session] = append(notices[session], uri)
+				}
+			} else {
+				snap.ChangedAt = old.ChangedAt
+			}
+		}
+		st.products[uri] = snap
+		st.productOrder = append(st.productOrder, uri)
+		saved[uri] = snap
+	}
+	var dropped []string
+	for len(st.productOrder) > maxProducts {
+		dropped = append(dropped, st.productOrder[0])
+		delete(st.products, st.productOrder[0])
+		st.productOrder = st.productOrder[1:]
+	}
+	notify, db := st.notify, st.db
+	st.mu.Unlock()
+
+	if db != nil && len(saved)+len(dropped) > 0 {
+		if err := persist(db, productsCollection, saved, dropped); err != nil {
+			slog.WarnContext(ctx, "save product snapshots failed", "err", err)
+		}
+	}
+	if notify == nil {
+		return
+	}
+	for session, uris := range notices {
+		for _, uri := range uris {
+			if err := notify(session, uri); err != nil {
+				// The session is gone; so are its subscriptions.
+				slog.DebugContext(ctx, "resource update not delivered", "session", session, "uri", uri, "err", err)
+				st.unsubscribeAll(session)
+				break
+			}
+		}
+	}
+}
+
+// persist writes saved to collection of db and deletes dropped from it.
+func persist(db *cache.Store, collection string, saved map[string]any, dropped []string) error {
+	for key, v := range saved {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if err := db.PutSaved(collection, key, data); err != nil {
+			return err
+		}
+	}
+	if len(dropped) == 0 {
+		return nil
+	}
+	return db.DeleteSaved(collection, dropped...)
+}
+
+// productChanged reports whether b differs from a in what a watcher cares
+// about.
+func productChanged(a, b models.Product) bool {
+	return a.Name != b.Name ||
+		a.Price != b.Price ||
+		a.OriginalPrice != b.OriginalPrice ||
+		a.PriceRange != b.PriceRange ||
+		a.DiscountPercent != b.DiscountPercent ||
+		a.Rating != b.Rating ||
+		a.ReviewCount != b.ReviewCount ||
+		a.SoldCount != b.SoldCount
+}
+
+// startSession lets session subscribe.
+func (st *snapshotStore) startSession(session string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.sessions[session] = true
+}
+
+// endSession drops session and its subscriptions.
+func (st *snapshotStore) endSession(session string) {
+	st.mu.Lock()
+	delete(st.sessions, session)
+	st.mu.Unlock()
+	st.unsubscribeAll(session)
+}
+
+// liveSession reports whether session has started and not ended.
+func (st *snapshotStore) liveSession(session string) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.sessions[session]
+}
+
+// subscribe subscribes session to uri, unless the session is not live.
+func (st *snapshotStore) subscribe(session, uri string) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if !st.sessions[session] {
+		return false
+	}
+	if st.subscribed[uri] == nil {
+		st.subscribed[uri] = make(map[string]bool)
+	}
+	st.subscribed[uri][session] = true
+	return true
+}
+
+func (st *snapshotStore) unsubscribe(session, uri string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	delete(st.subscribed[uri], session)
+	if len(st.subscribed[uri]) == 0 {
+		delete(st.subscribed, uri)
+	}
+}
+
+// unsubscribeAll drops the subscriptions of a session that has ended.
+func (st *snapshotStore) unsubscribeAll(session string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for uri, sessions := range st.subscribed {
+		delete(sessions, session)
+		if len(sessions) == 0 {
+			delete(st.subscribed, uri)
+		}
+	}
+}
+
+// subscriptionRefresh is how often subscribed products are scraped again.
+const subscriptionRefresh = 30 * time.Minute
+
+// refreshTimeout bounds the scrape of one subscribed product.
+const refreshTimeout = 2 * time.Minute
+
+// refreshSubscriptions scrapes every subscribed product again each interval
+// until ctx is done, so its subscribers hear of changes without waiting for
+// a tool call to return it. Each product is fetched for the location its
+// snapshot was, bypassing the response cache, as a usage job of meter.
+func (st *snapshotStore) refreshSubscriptions(ctx context.Context, every time.Duration, meter *usage.Meter) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		st.mu.Lock()
+		var due []productSnapshot
+		for uri := range st.subscribed {
+			if p, ok := st.products[uri]; ok && p.Product.URL != "" {
+				due = append(due, *p)
+			}
+		}
+		st.mu.Unlock()
+		for _, p := range due {
+			if ctx.Err() != nil {
+				return
+			}
+			st.refresh(ctx, p, meter)
+		}
+	}
+}
+
+// refresh scrapes the product of snapshot p again and saves the result.
+func (st *snapshotStore) refresh(ctx context.Context, p productSnapshot, meter *usage.Meter) {
+	ctx = usage.WithJob(logging.WithRequestID(ctx, logging.NewRequestID()), "subscription-refresh")
+	ctx, cancel := context.WithTimeout(cache.WithRefresh(ctx), refreshTimeout)
+	defer cancel()
+	defer func() {
+		if err := meter.Done(ctx); err != nil {
+			slog.WarnContext(ctx, "write usage log failed", "err", err)
+		}
+	}()
+
+	scraper, err := platform.Get(p.Platform)
+	if err != nil {
+		slog.WarnContext(ctx, "refresh subscribed product failed", "url", p.Product.URL, "err", err)
+		return
+	}
+	product, err := scraper.ProductDetail(ctx, p.Product.URL, platform.DetailOpts{Location: p.Product.Location})
+	if err != nil {
+		slog.WarnContext(ctx, "refresh subscribed product failed", "url", p.Product.URL, "err", err)
+		return
+	}
+	if product.ID == "" {
+		product.ID = p.Product.ID
+	}
+	st.saveProducts(ctx, p.Platform, *product)
+}
+
+// registerResources adds the platforms and saved-data resources to s.
+func registerResources(s *server.MCPServer) {
+	snapshots.mu.Lock()
+	snapshots.notify = func(session, uri string) error {
+		return s.SendNotificationToSpecificClient(session, mcp.MethodNotificationResourceUpdated, map[string]any{"uri": uri})
+	}
+	snapshots.mu.Unlock()
+
+	s.AddResource(mcp.NewResource(platformsURI, "Platforms",
+		mcp.WithResourceDescription("Registered marketplace platforms, their tools, strategies with health, and buyer locations"),
+		mcp.WithMIMEType("application/json"),
+	), handlePlatformsResource)
+
+	s.AddResource(mcp.NewResource(searchesURI, "Saved searches",
+		mcp.WithResourceDescription("Index of the search_products and get_trending results saved by this server for all its clients, newest first"),
+		mcp.WithMIMEType("application/json"),
+	), handleSearchesResource)
+
+	s.AddResourceTemplate(mcp.NewResourceTemplate(searchURIPrefix+"{id}", "Saved search",
+		mcp.WithTemplateDescription("A saved search_products or get_trending result; the id is in the tool result's resource link"),
+		mcp.WithTemplateMIMEType("application/json"),
+	), handleSearchResource)
+
+	s.AddResourceTemplate(mcp.NewResourceTemplate(productPrefix+"{platform}/{id}{?location}", "Product snapshot",
+		mcp.WithTemplateDescription("Latest snapshot of a product seen in any tool result, for the buyer location it was fetched for, if any. Subscribe to be notified when its price, rating or sales change"),
+		mcp.WithTemplateMIMEType("application/json"),
+	), handleProductResource)
+}
+
+// platformInfo describes a registered platform in kidkazz://platforms.
+type platformInfo struct {
+	Name       string                    `json:"name"`
+	Tools      []string                  `json:"tools"`
+	Strategies []platform.HealthSnapshot `json:"strategies,omitempty"`
+	Locations  []string                  `json:"locations,omitempty"`
+}
+
+// locationLister is implemented by scrapers that accept buyer locations.
+type locationLister interface {
+	Locations() []string
+}
+
+func handlePlatformsResource(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	names := platform.List()
+	slices.Sort(names)
+	infos := make([]platformInfo, 0, len(names))
+	for _, name := range names {
+		scraper, err := platform.Get(name)
+		if err != nil {
+			continue
+		}
+		info := platformInfo{Name: name, Tools: []string{"search_products", "get_trending", "product_detail", "compare_prices"}}
+		scraper = platform.Underlying(scraper)
+		if hr, ok := scraper.(platform.HealthReporter); ok {
+			info.Strategies = hr.Health()
+		}
+		if ll, ok := scraper.(locationLister); ok {
+			info.Locations = ll.Locations()
+		}
+		infos = append(infos, info)
+	}
+	return jsonResource(request.Params.URI, infos)
+}
+
+// searchSummary is a saved search in the kidkazz://searches index.
+type searchSummary struct {
+	URI      string    `json:"uri"`
+	Tool     string    `json:"tool"`
+	Platform string    `json:"platform"`
+	Keyword  string    `json:"keyword,omitempty"`
+	Category string    `json:"category,omitempty"`
+	Location string    `json:"location,omitempty"`
+	Products int       `json:"products"`
+	SavedAt  time.Time `json:"saved_at"`
+}
+
+// handleSearchesResource lists the saved searches of every client, not just
+// the caller's: saved searches outlive the sessions that ran them.
+func handleSearchesResource(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	snapshots.mu.Lock()
+	out := make([]searchSummary, 0, len(snapshots.searchOrder))
+	for _, id := range slices.Backward(snapshots.searchOrder) {
+		s := snapshots.searches[id]
+		out = append(out, searchSummary{
+			URI:      searchURI(id),
+			Tool:     s.Tool,
+			Platform: s.Platform,
+			Keyword:  s.Keyword,
+			Category: s.Category,
+			Location: s.Location,
+			Products: len(s.Products),
+			SavedAt:  s.SavedAt,
+		})
+	}
+	snapshots.mu.Unlock()
+	return jsonResource(request.Params.URI, out)
+}
+
+func handleSearchResource(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	id := strings.TrimPrefix(request.Params.URI, searchURIPrefix)
+	s, ok := snapshots.search(id)
+	if !ok {
+		return nil, fmt.Errorf("no saved search %q (see %s)", id, searchesURI)
+	}
+	return jsonResource(request.Params.URI, s)
+}
+
+func handleProductResource(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	p, ok := snapshots.product(request.Params.URI)
+	if !ok {
+		return nil, fmt.Errorf("no snapshot of %s; products are saved when a tool returns them", request.Params.URI)
+	}
+	return jsonResource(request.Params.URI, p)
+}
+
+// jsonResource returns v as the JSON contents of uri. It runs outside the
+// store's lock: stored snapshots are replaced, never modified in place.
+func jsonResource(uri string, v any) ([]mcp.ResourceContents, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return []mcp.ResourceContents{mcp.TextResourceContents{
+		URI:      uri,
+		MIMEType: "application/json",
+		Text:     string(data),
+	}}, nil
+}
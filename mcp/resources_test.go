@@ -0,0 +1,199 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lukman83/kidkazz-scrap/internal/cache"
+	"github.com/lukman83/kidkazz-scrap/internal/logging"
+	"github.com/lukman83/kidkazz-scrap/internal/models"
+	"github.com/lukman83/kidkazz-scrap/internal/platform"
+)
+
+func TestSaveSearchIDs(t *testing.T) {
+	st := newSnapshotStore()
+	// A client reusing its X-Request-ID must not overwrite its earlier search.
+	ctx := logging.WithRequestID(context.Background(), "client-chosen")
+	a := st.saveSearch(ctx, savedSearch{Keyword: "boneka"})
+	b := st.saveSearch(ctx, savedSearch{Keyword: "lego"})
+	if a.ID == b.ID || a.ID == "client-chosen" {
+		t.Fatalf("search IDs %q and %q", a.ID, b.ID)
+	}
+	if s, _ := st.search(a.ID); s.Keyword != "boneka" {
+		t.Errorf("first search now holds %q", s.Keyword)
+	}
+}
+
+func TestSnapshotsPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+	db, err := cache.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := newSnapshotStore()
+	if err := st.open(db); err != nil {
+		t.Fatal(err)
+	}
+	s := st.saveSearch(context.Background(), savedSearch{Platform: "tokopedia", Keyword: "boneka", Products: []models.Product{{ID: "42", Name: "Boneka", Price: 50000}}})
+	db.Close()
+
+	db, err = cache.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	st = newSnapshotStore()
+	if err := st.open(db); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := st.search(s.ID); !ok || got.Keyword != "boneka" {
+		t.Errorf("search after restart = %+v, %v", got, ok)
+	}
+	if p, ok := st.product(productURI("tokopedia", "42", "")); !ok || p.Product.Price != 50000 {
+		t.Errorf("product after restart = %+v, %v", p, ok)
+	}
+}
+
+func TestSubscriptions(t *testing.T) {
+	st := newSnapshotStore()
+	var sent []string
+	st.notify = func(session, uri string) error {
+		if session == "gone" {
+			return errors.New("session not found")
+		}
+		sent = append(sent, session+" "+uri)
+		return nil
+	}
+	uri := productURI("tokopedia", "42", "")
+	ctx := context.Background()
+	st.saveProducts(ctx, "tokopedia", models.Product{ID: "42", Price: 50000})
+	if st.subscribe("a", uri) {
+		t.Fatal("subscribed a session that never started")
+	}
+	st.startSession("a")
+	st.startSession("gone")
+	st.subscribe("a", uri)
+	st.subscribe("gone", uri)
+
+	st.saveProducts(ctx, "tokopedia", models.Product{ID: "42", Price: 50000})
+	if len(sent) != 0 {
+		t.Fatalf("notified of an unchanged product: %v", sent)
+	}
+	st.saveProducts(ctx, "tokopedia", models.Product{ID: "42", Price: 45000})
+	if len(sent) != 1 || sent[0] != "a "+uri {
+		t.Errorf("sent %v, want one update to a", sent)
+	}
+	if st.subscribed[uri]["gone"] {
+		t.Error("a session that is gone is still subscribed")
+	}
+
+	// Another location's price is another snapshot, not a change.
+	st.saveProducts(ctx, "tokopedia", models.Product{ID: "42", Price: 52000, Location: "surabaya/gubeng"})
+	if len(sent) != 1 {
+		t.Errorf("notified of another location's price: %v", sent)
+	}
+	if p, _ := st.product(uri); p.Product.Price != 45000 {
+		t.Errorf("snapshot without a location now has price %v", p.Product.Price)
+	}
+	if p, ok := st.product(productURI("tokopedia", "42", "surabaya/gubeng")); !ok || p.Product.Price != 52000 {
+		t.Errorf("snapshot for surabaya/gubeng = %+v, %v", p, ok)
+	}
+
+	st.endSession("a")
+	if len(st.subscribed) != 0 || st.subscribe("a", uri) {
+		t.Errorf("subscriptions left after the session ended: %v", st.subscribed)
+	}
+}
+
+func TestSubscriptionHandler(t *testing.T) {
+	st := newSnapshotStore()
+	var passed string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		passed = string(body)
+	})
+	h := subscriptionHandler(st, next)
+	postStatus := func(session, body string) (int, string) {
+		req := httptest.NewRequest("POST", "/mcp", strings.NewReader(body))
+		if session != "" {
+			req.Header.Set("Mcp-Session-Id", session)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code, rec.Body.String()
+	}
+	post := func(session, body string) string {
+		_, reply := postStatus(session, body)
+		return reply
+	}
+
+	uri := productURI("tokopedia", "42", "")
+	st.startSession("s1")
+	reply := post("s1", `{"jsonrpc":"2.0","id":1,"method":"resources/subscribe","params":{"uri":"`+uri+`"}}`)
+	if !strings.Contains(reply, `"result"`) || !st.subscribed[uri]["s1"] {
+		t.Errorf("subscribe: reply %s, subscribed %v", reply, st.subscribed)
+	}
+	if reply := post("", `{"jsonrpc":"2.0","id":2,"method":"resources/subscribe","params":{"uri":"`+uri+`"}}`); !strings.Contains(reply, "initialize first") {
+		t.Errorf("subscribe without a session: %s", reply)
+	}
+	if code, _ := postStatus("made-up", `{"jsonrpc":"2.0","id":4,"method":"resources/subscribe","params":{"uri":"`+uri+`"}}`); code != http.StatusNotFound || st.subscribed[uri]["made-up"] {
+		t.Errorf("subscribe with an unknown session: status %d, subscribed %v", code, st.subscribed)
+	}
+
+	call := `{"jsonrpc":"2.0","id":3,"method":"tools/list"}`
+	post("s1", call)
+	if passed != call {
+		t.Errorf("passed on %q, want %q", passed, call)
+	}
+}
+
+// detailScraper answers product details with a fixed price.
+type detailScraper struct {
+	price    int64
+	location string
+}
+
+func (d *detailScraper) Search(ctx context.Context, keyword string, opts platform.SearchOpts) ([]models.Product, error) {
+	return nil, nil
+}
+
+func (d *detailScraper) Trending(ctx context.Context, opts platform.TrendingOpts) ([]models.Product, error) {
+	return nil, nil
+}
+
+func (d *detailScraper) ProductDetail(ctx context.Context, url string, opts platform.DetailOpts) (*models.Product, error) {
+	d.location = opts.Location
+	return &models.Product{ID: "42", URL: url, Price: d.price, Location: opts.Location}, nil
+}
+
+func TestRefreshSubscribedProduct(t *testing.T) {
+	scraper := &detailScraper{price: 45000}
+	platform.Register("refresh-test", scraper)
+	st := newSnapshotStore()
+	var sent []string
+	st.notify = func(session, uri string) error {
+		sent = append(sent, uri)
+		return nil
+	}
+	ctx := context.Background()
+	old := models.Product{ID: "42", URL: "https://example.com/p/42", Price: 50000, Location: "surabaya/gubeng"}
+	st.saveProducts(ctx, "refresh-test", old)
+	uri := productURI("refresh-test", "42", "surabaya/gubeng")
+	st.startSession("a")
+	st.subscribe("a", uri)
+
+	snap, _ := st.product(uri)
+	st.refresh(ctx, *snap, nil)
+	if scraper.location != "surabaya/gubeng" {
+		t.Errorf("refreshed for location %q, want the snapshot's", scraper.location)
+	}
+	if p, _ := st.product(uri); p.Product.Price != 45000 || len(sent) != 1 {
+		t.Errorf("after refresh: price %v, updates %v", p.Product.Price, sent)
+	}
+}
@@ -1,18 +1,179 @@
 package mcp
 
 import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/lukman83/kidkazz-scrap/internal/cache"
+	"github.com/lukman83/kidkazz-scrap/internal/logging"
+	"github.com/lukman83/kidkazz-scrap/internal/platform"
+	"github.com/lukman83/kidkazz-scrap/internal/tracing"
+	"github.com/lukman83/kidkazz-scrap/internal/usage"
+	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-// Serve starts the MCP stdio server with all tools registered.
-func Serve() error {
+// Options are what the MCP servers run with; nil fields turn off what they
+// provide.
+type Options struct {
+	Usage *usage.Meter // meters each tool call and subscription refresh as a job
+	Saved *cache.Store // keeps saved searches and product snapshots across restarts
+}
+
+// Serve starts the MCP stdio server with all tools, resources and prompts
+// registered.
+func Serve(opts Options) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+	startSnapshots(ctx, opts)
+
 	s := server.NewMCPServer(
 		"kidkazz-scrap",
 		"1.0.0",
 		server.WithToolCapabilities(true),
+		server.WithResourceCapabilities(true, false),
+		server.WithPromptCapabilities(false),
+		server.WithHooks(subscriptionHooks(snapshots)),
+		server.WithToolHandlerMiddleware(logTool),
+		server.WithToolHandlerMiddleware(meterTool(opts.Usage)),
+		server.WithToolHandlerMiddleware(traceTool),
+		server.WithToolHandlerMiddleware(progressTool),
 	)
 
 	registerTools(s)
+	registerResources(s)
+	registerPrompts(s)
+
+	// stdout carries the protocol; the transport's own errors go to the logger.
+	stdio := server.NewStdioServer(s)
+	stdio.SetErrorLogger(slog.NewLogLogger(slog.Default().Handler(), slog.LevelError))
+
+	out := &lockedWriter{w: os.Stdout}
+	return stdio.Listen(ctx, newSubscriptionFilter(os.Stdin, out, snapshots), out)
+}
+
+// startSnapshots loads the saved snapshots and refreshes subscribed
+// products until ctx is done.
+func startSnapshots(ctx context.Context, opts Options) {
+	if opts.Saved != nil {
+		if err := snapshots.open(opts.Saved); err != nil {
+			slog.Warn("saved snapshots unavailable, keeping new ones in memory", "err", err)
+		}
+	}
+	go snapshots.refreshSubscriptions(ctx, subscriptionRefresh, opts.Usage)
+}
+
+// logTool gives every tool call a request ID (unless the transport already
+// set one) and a job name for the usage log, and logs its outcome.
+func logTool(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		ctx = logging.EnsureRequestID(ctx)
+		if usage.JobFrom(ctx) == "" {
+			ctx = usage.WithJob(ctx, request.Params.Name)
+		}
+		start := time.Now()
+		result, err := next(ctx, request)
+		attrs := []any{"tool", request.Params.Name, "duration_ms", time.Since(start).Milliseconds()}
+		switch {
+		case err != nil:
+			slog.ErrorContext(ctx, "tool call failed", append(attrs, "err", err)...)
+		case result != nil && result.IsError:
+			slog.WarnContext(ctx, "tool call returned an error", append(attrs, "err", toolErrorText(result))...)
+		default:
+			slog.InfoContext(ctx, "tool call", attrs...)
+		}
+		return result, err
+	}
+}
+
+// meterTool ends each tool call's usage job when the call returns, so its
+// traffic reaches the usage log right away.
+func meterTool(meter *usage.Meter) server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			defer func() {
+				if err := meter.Done(ctx); err != nil {
+					slog.WarnContext(ctx, "write usage log failed", "err", err)
+				}
+			}()
+			return next(ctx, request)
+		}
+	}
+}
+
+// toolErrorText returns the text of an error result, for logging.
+func toolErrorText(result *mcp.CallToolResult) string {
+	for _, c := range result.Content {
+		if tc, ok := mcp.AsTextContent(c); ok {
+			return tc.Text
+		}
+	}
+	return ""
+}
+
+// progressTool forwards the scrape's progress messages (platform.ReportProgress)
+// to the client as notifications/progress, when the call carries a
+// progressToken. Messages from concurrent strategies are numbered in the
+// order they are sent, so progress always increases; those reported after
+// the call returned (by strategies still winding down) are dropped.
+func progressTool(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if request.Params.Meta == nil || request.Params.Meta.ProgressToken == nil {
+			return next(ctx, request)
+		}
+		srv := server.ServerFromContext(ctx)
+		if srv == nil {
+			return next(ctx, request)
+		}
+		token := request.Params.Meta.ProgressToken
+		var (
+			mu       sync.Mutex
+			progress float64
+			done     bool
+		)
+		notify := func(msg string) {
+			mu.Lock()
+			defer mu.Unlock()
+			if done {
+				return
+			}
+			progress++
+			err := srv.SendNotificationToClient(ctx, "notifications/progress", map[string]any{
+				"progressToken": token,
+				"progress":      progress,
+				"message":       msg,
+			})
+			if err != nil {
+				slog.DebugContext(ctx, "progress notification failed", "err", err)
+			}
+		}
+		result, err := next(platform.WithProgress(ctx, notify), request)
+		mu.Lock()
+		done = true
+		mu.Unlock()
+		return result, err
+	}
+}
 
-	return server.ServeStdio(s)
+// traceTool wraps every tool call in a span, the root of the scrape's trace.
+func traceTool(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		ctx, span := tracing.Start(ctx, "mcp.tool/"+request.Params.Name,
+			attribute.String("mcp.tool", request.Params.Name),
+			attribute.String("kidkazz.request_id", logging.RequestIDFrom(ctx)))
+		result, err := next(ctx, request)
+		status := "ok"
+		if err != nil || (result != nil && result.IsError) {
+			status = "error"
+		}
+		span.SetAttributes(tracing.AttrStatus.String(status))
+		tracing.End(span, err)
+		return result, err
+	}
 }
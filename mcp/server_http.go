@@ -1,50 +1,181 @@
 package mcp
 
 import (
+	"context"
 	"crypto/subtle"
-	"log"
+	"encoding/json"
+	"log/slog"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/lukman83/kidkazz-scrap/internal/drift"
+	"github.com/lukman83/kidkazz-scrap/internal/logging"
+	"github.com/lukman83/kidkazz-scrap/internal/metrics"
+	"github.com/lukman83/kidkazz-scrap/internal/platform"
+	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 // ServeHTTP starts the MCP server over HTTP with optional Bearer token auth.
-func ServeHTTP(addr, apiKey string) error {
+// Clients get a session (Mcp-Session-Id) on initialize; resource updates of
+// a session's subscriptions reach it on its GET stream.
+//
+// /healthz answers liveness probes without auth. /metrics and /status
+// describe the scrapers, so they sit behind the same auth as /mcp, or move to
+// metricsAddr (with no auth) when it is set, for a scraper on a private
+// network.
+func ServeHTTP(addr, metricsAddr, apiKey string, opts Options) error {
+	startSnapshots(context.Background(), opts)
+
 	s := server.NewMCPServer(
 		"kidkazz-scrap",
 		"1.0.0",
 		server.WithToolCapabilities(true),
+		server.WithResourceCapabilities(true, false),
+		server.WithPromptCapabilities(false),
+		server.WithHooks(subscriptionHooks(snapshots)),
+		server.WithToolHandlerMiddleware(logTool),
+		server.WithToolHandlerMiddleware(meterTool(opts.Usage)),
+		server.WithToolHandlerMiddleware(instrumentTool),
+		server.WithToolHandlerMiddleware(traceTool),
+		server.WithToolHandlerMiddleware(progressTool),
 	)
 
 	registerTools(s)
+	registerResources(s)
+	registerPrompts(s)
 
-	httpServer := server.NewStreamableHTTPServer(s, server.WithStateLess(true))
-
-	mux := http.NewServeMux()
+	httpServer := server.NewStreamableHTTPServer(s,
+		server.WithHTTPContextFunc(requestContext),
+	)
 
-	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte(`{"status":"ok"}`))
-	})
+	public, internal := routes(noWriteDeadline(subscriptionHandler(snapshots, httpServer)), apiKey, metricsAddr != "")
+	errc := make(chan error, 2)
+	if internal != nil {
+		go func() {
+			slog.Info("metrics server listening", "addr", metricsAddr)
+			errc <- newHTTPServer(metricsAddr, internal).ListenAndServe()
+		}()
+	}
+	go func() {
+		slog.Info("MCP HTTP server listening", "addr", addr)
+		errc <- newHTTPServer(addr, public).ListenAndServe()
+	}()
+	return <-errc
+}
 
-	var mcpHandler http.Handler = httpServer
-	if apiKey != "" {
-		mcpHandler = bearerAuth(apiKey, httpServer)
+// routes returns the handler for the public address and, with
+// separateMetrics, the one for the metrics address.
+func routes(mcpHandler http.Handler, apiKey string, separateMetrics bool) (public, internal *http.ServeMux) {
+	protect := func(h http.Handler) http.Handler {
+		if apiKey == "" {
+			return h
+		}
+		return bearerAuth(apiKey, h)
+	}
+	public = http.NewServeMux()
+	public.HandleFunc("GET /healthz", handleHealthz)
+	public.Handle("/mcp", protect(mcpHandler))
+	if !separateMetrics {
+		public.Handle("GET /metrics", protect(metrics.Handler()))
+		public.Handle("GET /status", protect(http.HandlerFunc(handleStatus)))
+		return public, nil
 	}
-	mux.Handle("/mcp", mcpHandler)
+	internal = http.NewServeMux()
+	internal.Handle("GET /metrics", metrics.Handler())
+	internal.HandleFunc("GET /status", handleStatus)
+	return public, internal
+}
 
-	srv := &http.Server{
+func newHTTPServer(addr string, h http.Handler) *http.Server {
+	return &http.Server{
 		Addr:         addr,
-		Handler:      mux,
+		Handler:      h,
 		ReadTimeout:  30 * time.Second,
 		WriteTimeout: 60 * time.Second,
 		IdleTimeout:  120 * time.Second,
 	}
+}
+
+// noWriteDeadline lifts the server's WriteTimeout for h. MCP responses are
+// streams: a session's GET stream stays open for updates, and a tool call's
+// progress runs as long as its scrape.
+func noWriteDeadline(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NewResponseController(w).SetWriteDeadline(time.Time{})
+		h.ServeHTTP(w, r)
+	})
+}
+
+// handleHealthz reports liveness only.
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// handleStatus reports the circuit-breaker state, schema drift and
+// request-coalescing counters of every platform, which persist for the
+// lifetime of the server.
+func handleStatus(w http.ResponseWriter, r *http.Request) {
+	strategies := make(map[string][]platform.HealthSnapshot)
+	drifts := make(map[string][]drift.Stats)
+	coalescing := make(map[string]platform.CoalesceStats)
+	for _, name := range platform.List() {
+		scraper, err := platform.Get(name)
+		if err != nil {
+			continue
+		}
+		scraper = platform.Underlying(scraper)
+		if hr, ok := scraper.(platform.HealthReporter); ok {
+			strategies[name] = hr.Health()
+		}
+		if dr, ok := scraper.(drift.Reporter); ok {
+			drifts[name] = dr.Drift()
+		}
+		if cr, ok := scraper.(platform.CoalesceReporter); ok {
+			coalescing[name] = cr.Coalescing()
+		}
+	}
 
-	log.Printf("KidKazz MCP HTTP server listening on %s", addr)
-	return srv.ListenAndServe()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"status":     "ok",
+		"strategies": strategies,
+		"drift":      drifts,
+		"coalescing": coalescing,
+	})
+}
+
+// requestContext continues a trace started by the client, if its request
+// carries W3C traceparent headers, and gives the request a fresh request ID.
+// The client's X-Request-ID is logged next to it so logs can be matched with
+// the caller's, but never used as the ID: usage jobs and budgets are keyed
+// by it, and two clients could send the same one.
+func requestContext(ctx context.Context, r *http.Request) context.Context {
+	ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(r.Header))
+	ctx = logging.WithRequestID(ctx, logging.NewRequestID())
+	if id := r.Header.Get("X-Request-ID"); id != "" && len(id) <= 128 {
+		ctx = logging.WithClientRequestID(ctx, id)
+	}
+	return ctx
+}
+
+// instrumentTool counts tool calls and their latency for /metrics.
+func instrumentTool(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		start := time.Now()
+		result, err := next(ctx, request)
+		outcome := "ok"
+		if err != nil || (result != nil && result.IsError) {
+			outcome = "error"
+		}
+		metrics.ToolCalls.WithLabelValues(request.Params.Name, outcome).Inc()
+		metrics.ToolDuration.WithLabelValues(request.Params.Name).Observe(time.Since(start).Seconds())
+		return result, err
+	}
 }
 
 func bearerAuth(apiKey string, next http.Handler) http.Handler {
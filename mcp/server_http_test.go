@@ -0,0 +1,113 @@
+package mcp
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lukman83/kidkazz-scrap/internal/logging"
+)
+
+func TestRoutes(t *testing.T) {
+	mcpOK := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tests := []struct {
+		name            string
+		apiKey          string
+		separateMetrics bool
+		path            string
+		token           string
+		public          int // status on the public address
+		internal        int // status on the metrics address; 0 = no such address
+	}{
+		{name: "healthz needs no token", apiKey: "secret", path: "/healthz", public: 200},
+		{name: "metrics needs the token", apiKey: "secret", path: "/metrics", public: 401},
+		{name: "metrics with token", apiKey: "secret", path: "/metrics", token: "secret", public: 200},
+		{name: "status needs the token", apiKey: "secret", path: "/status", token: "wrong", public: 401},
+		{name: "mcp needs the token", apiKey: "secret", path: "/mcp", public: 401},
+		{name: "no api key", path: "/status", public: 200},
+		{name: "separate metrics", apiKey: "secret", separateMetrics: true, path: "/metrics", public: 404, internal: 200},
+		{name: "separate status", apiKey: "secret", separateMetrics: true, path: "/status", public: 404, internal: 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			public, internal := routes(mcpOK, tt.apiKey, tt.separateMetrics)
+			get := func(h http.Handler) int {
+				req := httptest.NewRequest("GET", tt.path, nil)
+				if tt.token != "" {
+					req.Header.Set("Authorization", "Bearer "+tt.token)
+				}
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, req)
+				return rec.Code
+			}
+			if got := get(public); got != tt.public {
+				t.Errorf("public %s = %d, want %d", tt.path, got, tt.public)
+			}
+			if (internal != nil) != (tt.internal != 0) {
+				t.Fatalf("metrics address served: %v, want %v", internal != nil, tt.internal != 0)
+			}
+			if internal != nil {
+				if got := get(internal); got != tt.internal {
+					t.Errorf("internal %s = %d, want %d", tt.path, got, tt.internal)
+				}
+			}
+		})
+	}
+}
+
+func TestHealthzIsPlain(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handleHealthz(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if body := strings.TrimSpace(rec.Body.String()); body != `{"status":"ok"}` {
+		t.Errorf("healthz = %s", body)
+	}
+}
+
+func TestRequestContextOwnsRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	if err := logging.Setup(&buf, "info", logging.FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for range 2 {
+		req := httptest.NewRequest("POST", "/mcp", nil)
+		req.Header.Set("X-Request-ID", "client-1")
+		ctx := requestContext(req.Context(), req)
+		ids = append(ids, logging.RequestIDFrom(ctx))
+		slog.InfoContext(ctx, "tool call")
+	}
+	if ids[0] == "client-1" || ids[0] == "" || ids[0] == ids[1] {
+		t.Errorf("request IDs = %q, want two fresh ones", ids)
+	}
+	if n := strings.Count(buf.String(), `"client_request_id":"client-1"`); n != 2 {
+		t.Errorf("client request ID logged %d times, want 2:\n%s", n, buf.String())
+	}
+}
+
+func TestNoWriteDeadline(t *testing.T) {
+	stream := noWriteDeadline(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		io.WriteString(w, "update")
+	}))
+	srv := httptest.NewUnstartedServer(stream)
+	srv.Config = newHTTPServer("", stream)
+	srv.Config.WriteTimeout = 20 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if body, err := io.ReadAll(resp.Body); err != nil || string(body) != "update" {
+		t.Errorf("stream past the write timeout: %q, %v", body, err)
+	}
+}
@@ -0,0 +1,192 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// The MCP library advertises resource subscriptions but does not route
+// resources/subscribe and resources/unsubscribe, so the server answers them
+// itself before the library sees them: subscriptionFilter takes them out of
+// the stdio input stream, and subscriptionHandler out of the HTTP requests.
+// Both answer them with the store's answerSubscription, for the session that
+// sent them; updates go to that session only. Only sessions the server has
+// registered and not yet ended can subscribe.
+
+// Subscription methods, which the MCP library has no constants for.
+const (
+	methodSubscribe   mcp.MCPMethod = "resources/subscribe"
+	methodUnsubscribe mcp.MCPMethod = "resources/unsubscribe"
+)
+
+// stdioSession is the ID the MCP library gives its one stdio session.
+const stdioSession = "stdio"
+
+// subscriptionRequest is a resources/subscribe or resources/unsubscribe request.
+type subscriptionRequest struct {
+	ID     any           `json:"id"`
+	Method mcp.MCPMethod `json:"method"`
+	Params struct {
+		URI string `json:"uri"`
+	} `json:"params"`
+}
+
+// parseSubscription returns msg as a subscription request, if it is one.
+func parseSubscription(msg []byte) (*subscriptionRequest, bool) {
+	var req subscriptionRequest
+	if json.Unmarshal(msg, &req) != nil || req.ID == nil {
+		return nil, false
+	}
+	switch req.Method {
+	case methodSubscribe, methodUnsubscribe:
+		return &req, true
+	}
+	return nil, false
+}
+
+// answerSubscription answers the subscription request req of session.
+func (st *snapshotStore) answerSubscription(session string, req *subscriptionRequest) ([]byte, error) {
+	var resp any
+	switch {
+	case session == "":
+		resp = mcp.NewJSONRPCError(mcp.NewRequestId(req.ID), mcp.INVALID_REQUEST, "subscriptions need a session: initialize first", nil)
+	case req.Params.URI == "":
+		resp = mcp.NewJSONRPCError(mcp.NewRequestId(req.ID), mcp.INVALID_PARAMS, "uri is required", nil)
+	case req.Method == methodSubscribe:
+		if !st.subscribe(session, req.Params.URI) {
+			resp = mcp.NewJSONRPCError(mcp.NewRequestId(req.ID), mcp.INVALID_REQUEST, "unknown session: initialize again", nil)
+			break
+		}
+		resp = mcp.NewJSONRPCResultResponse(mcp.NewRequestId(req.ID), mcp.EmptyResult{})
+	default:
+		st.unsubscribe(session, req.Params.URI)
+		resp = mcp.NewJSONRPCResultResponse(mcp.NewRequestId(req.ID), mcp.EmptyResult{})
+	}
+	return json.Marshal(resp)
+}
+
+// subscriptionHooks tells st which sessions are live, and drops the
+// subscriptions of sessions that end.
+func subscriptionHooks(st *snapshotStore) *server.Hooks {
+	hooks := &server.Hooks{}
+	hooks.AddOnRegisterSession(func(ctx context.Context, session server.ClientSession) {
+		st.startSession(session.SessionID())
+	})
+	hooks.AddOnUnregisterSession(func(ctx context.Context, session server.ClientSession) {
+		st.endSession(session.SessionID())
+	})
+	return hooks
+}
+
+// lockedWriter serializes writes, so replies written by subscriptionFilter
+// never interleave with the library's. The library writes every message
+// with a single Write.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (lw *lockedWriter) Write(p []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.w.Write(p)
+}
+
+// subscriptionFilter reads JSON-RPC messages, one per line, and passes on
+// every line that is not a subscription request.
+type subscriptionFilter struct {
+	in    *bufio.Reader
+	out   io.Writer
+	store *snapshotStore
+	buf   []byte // rest of the line being passed on
+	err   error  // read error to return once buf is drained
+}
+
+func newSubscriptionFilter(in io.Reader, out io.Writer, store *snapshotStore) *subscriptionFilter {
+	return &subscriptionFilter{in: bufio.NewReader(in), out: out, store: store}
+}
+
+func (f *subscriptionFilter) Read(p []byte) (int, error) {
+	for len(f.buf) == 0 {
+		if f.err != nil {
+			return 0, f.err
+		}
+		line, err := f.in.ReadBytes('\n')
+		f.err = err
+		if len(line) > 0 && !f.handle(line) {
+			f.buf = line
+		}
+	}
+	n := copy(p, f.buf)
+	f.buf = f.buf[n:]
+	return n, nil
+}
+
+// handle answers line if it is a subscription request and reports whether it did.
+func (f *subscriptionFilter) handle(line []byte) bool {
+	req, ok := parseSubscription(line)
+	if !ok {
+		return false
+	}
+	reply, err := f.store.answerSubscription(stdioSession, req)
+	if err != nil {
+		return false
+	}
+	_, err = fmt.Fprintf(f.out, "%s\n", reply)
+	return err == nil
+}
+
+// maxSubscriptionBody caps the request bodies subscriptionHandler inspects;
+// larger ones are passed on unread.
+const maxSubscriptionBody = 64 << 10
+
+// subscriptionHandler answers the subscription requests POSTed to next, for
+// the session named by their Mcp-Session-Id header, and passes on the rest.
+// A session the server does not know gets a 404, as for any other request,
+// so the client initializes again.
+func subscriptionHandler(st *snapshotStore, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.ContentLength > maxSubscriptionBody {
+			next.ServeHTTP(w, r)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxSubscriptionBody+1))
+		if err != nil {
+			http.Error(w, "read request body", http.StatusBadRequest)
+			return
+		}
+		if req, ok := parseSubscription(body); ok {
+			st.serveSubscription(w, r.Header.Get(server.HeaderKeySessionID), req)
+			return
+		}
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// serveSubscription answers the subscription request req of session over HTTP.
+func (st *snapshotStore) serveSubscription(w http.ResponseWriter, session string, req *subscriptionRequest) {
+	if session != "" && !st.liveSession(session) {
+		http.Error(w, "Invalid session ID", http.StatusNotFound)
+		return
+	}
+	reply, err := st.answerSubscription(session, req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(reply)
+}
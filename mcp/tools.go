@@ -2,9 +2,9 @@ package mcp
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 
+	"github.com/lukman83/kidkazz-scrap/internal/compare"
 	"github.com/lukman83/kidkazz-scrap/internal/platform"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
@@ -13,10 +13,9 @@ import (
 func registerTools(s *server.MCPServer) {
 	// search_products
 	searchTool := mcp.NewTool("search_products",
-		mcp.WithDescription("Search products by keyword on a marketplace platform"),
+		mcp.WithDescription("Search products by keyword on a marketplace platform. Results over 20 products come in slices; pass next_cursor as cursor for the next one"),
 		mcp.WithString("keyword",
-			mcp.Required(),
-			mcp.Description("Search keyword"),
+			mcp.Description("Search keyword (required unless cursor is set)"),
 		),
 		mcp.WithString("platform",
 			mcp.Description("Target platform (default: tokopedia)"),
@@ -27,12 +26,25 @@ func registerTools(s *server.MCPServer) {
 		mcp.WithNumber("limit",
 			mcp.Description("Products per page (default: 20)"),
 		),
+		mcp.WithString("location",
+			mcp.Description("Buyer location as city or city/district, e.g. jakarta or surabaya/gubeng (default: the platform's default). Prices, stock and shipping depend on it"),
+		),
+		mcp.WithBoolean("exclude_ads",
+			mcp.Description("Remove ad/promoted products; filtered_ads counts them (default: false)"),
+		),
+		mcp.WithString("cursor",
+			mcp.Description("next_cursor of a previous result: returns its next slice without scraping again. Other arguments are ignored"),
+		),
+		mcp.WithString("strategy",
+			mcp.Description("Debug: run only this strategy (graphql, mobile, static, headless), skipping fallbacks"),
+		),
+		mcp.WithOutputSchema[productsOutput](),
 	)
 	s.AddTool(searchTool, handleSearchProducts)
 
 	// get_trending
 	trendingTool := mcp.NewTool("get_trending",
-		mcp.WithDescription("Get trending/popular products on a marketplace platform"),
+		mcp.WithDescription("Get trending/popular products on a marketplace platform. Results over 20 products come in slices; pass next_cursor as cursor for the next one"),
 		mcp.WithString("platform",
 			mcp.Description("Target platform (default: tokopedia)"),
 		),
@@ -42,6 +54,19 @@ func registerTools(s *server.MCPServer) {
 		mcp.WithNumber("limit",
 			mcp.Description("Number of products (default: 10)"),
 		),
+		mcp.WithString("location",
+			mcp.Description("Buyer location as city or city/district, e.g. jakarta or surabaya/gubeng (default: the platform's default). Prices, stock and shipping depend on it"),
+		),
+		mcp.WithBoolean("exclude_ads",
+			mcp.Description("Remove ad/promoted products; filtered_ads counts them (default: false)"),
+		),
+		mcp.WithString("cursor",
+			mcp.Description("next_cursor of a previous result: returns its next slice without scraping again. Other arguments are ignored"),
+		),
+		mcp.WithString("strategy",
+			mcp.Description("Debug: run only this strategy (graphql, mobile, static, headless), skipping fallbacks"),
+		),
+		mcp.WithOutputSchema[productsOutput](),
 	)
 	s.AddTool(trendingTool, handleGetTrending)
 
@@ -52,11 +77,61 @@ func registerTools(s *server.MCPServer) {
 			mcp.Required(),
 			mcp.Description("Product page URL"),
 		),
+		mcp.WithString("location",
+			mcp.Description("Buyer location as city or city/district, e.g. jakarta or surabaya/gubeng (default: the platform's default). Prices, stock and shipping depend on it"),
+		),
+		mcp.WithString("strategy",
+			mcp.Description("Debug: run only this strategy (graphql, mobile, static, headless), skipping fallbacks"),
+		),
+		mcp.WithOutputSchema[productOutput](),
 	)
 	s.AddTool(detailTool, handleProductDetail)
+
+	// compare_prices
+	compareTool := mcp.NewTool("compare_prices",
+		mcp.WithDescription("Compare the prices of a product across shops: min, quartiles and median of the effective (discounted) price, official vs other shops, and the cheapest credible offers. Ads are excluded and a listing seen twice counts once. "+
+			"An offer is credible with at least min_reviews reviews and either an official store or a product rating of at least min_rating. Shop reputation is not scraped: the product's rating stands in for it"),
+		mcp.WithString("keyword",
+			mcp.Required(),
+			mcp.Description("Product to compare, as specific as possible (brand, model, variant)"),
+		),
+		mcp.WithString("platforms",
+			mcp.Description("Comma-separated platforms, or all (default: tokopedia)"),
+		),
+		mcp.WithNumber("pages",
+			mcp.Description(fmt.Sprintf("Result pages searched per platform, 1-%d (default: 1)", compare.MaxPages)),
+			mcp.Min(1),
+			mcp.Max(compare.MaxPages),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description(fmt.Sprintf("Products per page, 1-%d (default: %d)", compare.MaxLimit, compare.DefaultLimit)),
+			mcp.Min(1),
+			mcp.Max(compare.MaxLimit),
+		),
+		mcp.WithString("location",
+			mcp.Description("Buyer location as city or city/district, e.g. jakarta or surabaya/gubeng (default: the platform's default). Prices, stock and shipping depend on it"),
+		),
+		mcp.WithNumber("min_reviews",
+			mcp.Description(fmt.Sprintf("Reviews a credible offer needs (default: %d)", compare.DefaultMinReviews)),
+		),
+		mcp.WithNumber("min_rating",
+			mcp.Description(fmt.Sprintf("Product rating a credible offer from a non-official shop needs, in place of shop reputation (default: %.1f)", compare.DefaultMinRating)),
+		),
+		mcp.WithNumber("top",
+			mcp.Description(fmt.Sprintf("Cheapest credible offers to list, 1-%d (default: %d)", compare.MaxTop, compare.DefaultTop)),
+			mcp.Min(1),
+			mcp.Max(compare.MaxTop),
+		),
+		mcp.WithOutputSchema[compare.Report](),
+	)
+	s.AddTool(compareTool, handleComparePrices)
 }
 
 func handleSearchProducts(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	if cursor := request.GetString("cursor", ""); cursor != "" {
+		return nextSlice(cursor), nil
+	}
+
 	keyword := request.GetString("keyword", "")
 	if keyword == "" {
 		return mcp.NewToolResultError("keyword is required"), nil
@@ -66,43 +141,74 @@ func handleSearchProducts(ctx context.Context, request mcp.CallToolRequest) (*mc
 	page := request.GetInt("page", 1)
 	limit := request.GetInt("limit", 20)
 
+	ctx = withStrategy(ctx, request)
+
 	scraper, err := platform.Get(platformName)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("platform error: %v", err)), nil
 	}
 
+	location := request.GetString("location", "")
+	ctx, info := platform.WithResultInfo(ctx)
 	products, err := scraper.Search(ctx, keyword, platform.SearchOpts{
-		Page:  page,
-		Limit: limit,
+		Page:     page,
+		Limit:    limit,
+		Location: location,
 	})
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("search error: %v", err)), nil
 	}
 
-	data, _ := json.MarshalIndent(products, "", "  ")
-	return mcp.NewToolResultText(string(data)), nil
+	s := savedSearch{
+		Tool:     request.Params.Name,
+		Platform: platformName,
+		Keyword:  keyword,
+		Page:     page,
+		Limit:    limit,
+		Location: location,
+		Products: products,
+	}
+	recordResult(&s, info(), request.GetBool("exclude_ads", false))
+	return productsResult(snapshots.saveSearch(ctx, s), 0), nil
 }
 
 func handleGetTrending(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	if cursor := request.GetString("cursor", ""); cursor != "" {
+		return nextSlice(cursor), nil
+	}
+
 	platformName := request.GetString("platform", "tokopedia")
 	category := request.GetString("category", "")
 	limit := request.GetInt("limit", 10)
 
+	ctx = withStrategy(ctx, request)
+
 	scraper, err := platform.Get(platformName)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("platform error: %v", err)), nil
 	}
 
+	location := request.GetString("location", "")
+	ctx, info := platform.WithResultInfo(ctx)
 	products, err := scraper.Trending(ctx, platform.TrendingOpts{
 		Category: category,
 		Limit:    limit,
+		Location: location,
 	})
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("trending error: %v", err)), nil
 	}
 
-	data, _ := json.MarshalIndent(products, "", "  ")
-	return mcp.NewToolResultText(string(data)), nil
+	s := savedSearch{
+		Tool:     request.Params.Name,
+		Platform: platformName,
+		Category: category,
+		Limit:    limit,
+		Location: location,
+		Products: products,
+	}
+	recordResult(&s, info(), request.GetBool("exclude_ads", false))
+	return productsResult(snapshots.saveSearch(ctx, s), 0), nil
 }
 
 func handleProductDetail(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
@@ -113,16 +219,68 @@ func handleProductDetail(ctx context.Context, request mcp.CallToolRequest) (*mcp
 
 	platformName := "tokopedia"
 
+	ctx = withStrategy(ctx, request)
+
 	scraper, err := platform.Get(platformName)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("platform error: %v", err)), nil
 	}
 
-	product, err := scraper.ProductDetail(ctx, url)
+	ctx, info := platform.WithResultInfo(ctx)
+	product, err := scraper.ProductDetail(ctx, url, platform.DetailOpts{Location: request.GetString("location", "")})
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("detail error: %v", err)), nil
 	}
 
-	data, _ := json.MarshalIndent(product, "", "  ")
-	return mcp.NewToolResultText(string(data)), nil
+	ri := info()
+	out := productOutput{
+		Platform:     platformName,
+		StrategyUsed: ri.Strategy,
+		Warnings:     nonNil(ri.Warnings),
+		Product:      product,
+	}
+	if !ri.CachedAt.IsZero() {
+		out.CachedAt = &ri.CachedAt
+	}
+	if product != nil && product.ID != "" {
+		snapshots.saveProducts(ctx, platformName, *product)
+		out.Resource = productURI(platformName, product.ID, product.Location)
+		return withLink(structuredResult(out), out.Resource, "Product snapshot"), nil
+	}
+	return structuredResult(out), nil
+}
+
+func handleComparePrices(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	keyword := request.GetString("keyword", "")
+	if keyword == "" {
+		return mcp.NewToolResultError("keyword is required"), nil
+	}
+
+	report, err := compare.Compare(ctx, keyword, compare.Options{
+		Platforms:  compare.ParsePlatforms(request.GetString("platforms", "")),
+		Pages:      request.GetInt("pages", 1),
+		Limit:      request.GetInt("limit", compare.DefaultLimit),
+		Location:   request.GetString("location", ""),
+		MinReviews: request.GetInt("min_reviews", compare.DefaultMinReviews),
+		MinRating:  request.GetFloat("min_rating", compare.DefaultMinRating),
+		Top:        request.GetInt("top", compare.DefaultTop),
+	})
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("compare error: %v", err)), nil
+	}
+	return structuredResult(report), nil
+}
+
+// withLink appends a link to the resource the result was saved as.
+func withLink(result *mcp.CallToolResult, uri, name string) *mcp.CallToolResult {
+	result.Content = append(result.Content, mcp.NewResourceLink(uri, name, "Re-read this result without scraping again", "application/json"))
+	return result
+}
+
+// withStrategy applies the optional "strategy" argument to ctx.
+func withStrategy(ctx context.Context, request mcp.CallToolRequest) context.Context {
+	if name := request.GetString("strategy", ""); name != "" {
+		return platform.WithStrategy(ctx, name)
+	}
+	return ctx
 }